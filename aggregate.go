@@ -0,0 +1,145 @@
+//
+// Aggregating statistics across kstat instances.
+
+package kstat
+
+import (
+	"math"
+	"sort"
+)
+
+// Aggregate is a statistic aggregated across all of the instances of
+// a kstat, for example cpu_nsec_user across all CPUs.
+type Aggregate struct {
+	// Name is the statistic with the instance replaced by '*',
+	// eg "cpu:*:sys:cpu_nsec_user".
+	Name  string
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+	Mean  float64
+
+	// Values are the per-instance Values that went into the
+	// aggregate and Inputs are the numbers that were aggregated
+	// for each of them, which are the Values' values or, for rate
+	// aggregates, their rates. Both are in Snapshot order, which
+	// is instance order for Snapshots from a Token.
+	Values []Value
+	Inputs []float64
+}
+
+func (a *Aggregate) add(v Value, x float64) {
+	if a.Count == 0 {
+		a.Min, a.Max = x, x
+	}
+	a.Count++
+	a.Sum += x
+	a.Min = math.Min(a.Min, x)
+	a.Max = math.Max(a.Max, x)
+	a.Mean = a.Sum / float64(a.Count)
+	a.Values = append(a.Values, v)
+	a.Inputs = append(a.Inputs, x)
+}
+
+// aggName is the name of v's statistic with the instance wildcarded.
+func aggName(v Value) string {
+	return v.Module + ":*:" + v.Name + ":" + v.Stat
+}
+
+// AggregateValues aggregates the numeric statistics in a Snapshot that
+// are selected by sel across instances. Each different
+// module:name:statistic gets its own Aggregate; they're returned
+// sorted by name.
+func AggregateValues(snap *Snapshot, sel Selector) []*Aggregate {
+	aggs := make(map[string]*Aggregate)
+	for _, v := range snap.Values {
+		if !sel.Match(v) {
+			continue
+		}
+		if x, ok := v.Float(); ok {
+			aggFor(aggs, v).add(v, x)
+		}
+	}
+	return sortedAggs(aggs)
+}
+
+func aggFor(aggs map[string]*Aggregate, v Value) *Aggregate {
+	n := aggName(v)
+	a, ok := aggs[n]
+	if !ok {
+		a = &Aggregate{Name: n}
+		aggs[n] = a
+	}
+	return a
+}
+
+func sortedAggs(aggs map[string]*Aggregate) []*Aggregate {
+	lst := make([]*Aggregate, 0, len(aggs))
+	for _, a := range aggs {
+		lst = append(lst, a)
+	}
+	sort.Slice(lst, func(i, j int) bool { return lst[i].Name < lst[j].Name })
+	return lst
+}
+
+// Aggregator is a Processor that aggregates selected statistics
+// across instances on each Sample. It adds Derived values named
+// "sum(<name>)", "mean(<name>)", "min(<name>)", and "max(<name>)" for
+// each Aggregate, where <name> is the Aggregate's Name. A rate
+// Aggregator aggregates the per-second rates of counters instead
+// and uses "sum_rate" and so on.
+type Aggregator struct {
+	sel  Selector
+	ct   *CounterTracker
+	last []*Aggregate
+}
+
+// NewAggregator creates an Aggregator for the values of the
+// statistics selected by sel.
+func NewAggregator(sel Selector) *Aggregator {
+	return &Aggregator{sel: sel}
+}
+
+// NewRateAggregator creates an Aggregator for the rates of the
+// counters selected by sel. Instances are only included once they
+// have a rate, ie once they've been in two Samples.
+func NewRateAggregator(sel Selector) *Aggregator {
+	return &Aggregator{sel: sel, ct: NewCounterTracker()}
+}
+
+// Process aggregates the Sample and adds the results to it.
+func (ag *Aggregator) Process(sm *Sample) {
+	var lst []*Aggregate
+	prefix := ""
+	if ag.ct == nil {
+		lst = AggregateValues(&sm.Snapshot, ag.sel)
+	} else {
+		prefix = "_rate"
+		aggs := make(map[string]*Aggregate)
+		for _, v := range sm.Values {
+			if !ag.sel.Match(v) {
+				continue
+			}
+			if r, ok := ag.ct.Update(v); ok {
+				aggFor(aggs, v).add(v, r.Rate)
+			}
+		}
+		lst = sortedAggs(aggs)
+	}
+	for _, a := range lst {
+		sm.Derived = append(sm.Derived,
+			Derived{Name: "sum" + prefix + "(" + a.Name + ")", Value: a.Sum},
+			Derived{Name: "mean" + prefix + "(" + a.Name + ")", Value: a.Mean},
+			Derived{Name: "min" + prefix + "(" + a.Name + ")", Value: a.Min},
+			Derived{Name: "max" + prefix + "(" + a.Name + ")", Value: a.Max},
+		)
+	}
+	ag.last = lst
+}
+
+// Last returns the Aggregates from the most recently processed
+// Sample.
+func (ag *Aggregator) Last() []*Aggregate {
+	return ag.last
+}
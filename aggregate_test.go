@@ -0,0 +1,74 @@
+//
+// Test aggregation.
+
+package kstat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// cpuSnapshot returns a Snapshot of cpu:N:sys:syscall for the given
+// values, one per CPU.
+func cpuSnapshot(snaptime int64, vals ...uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	for i, v := range vals {
+		c := counter(snaptime, v)
+		c.Instance = i
+		snap.Values = append(snap.Values, c)
+	}
+	return snap
+}
+
+func TestAggregateValues(t *testing.T) {
+	snap := cpuSnapshot(1, 10, 30, 20)
+	other := counter(1, 1000)
+	other.Stat = "sysread"
+	snap.Values = append(snap.Values, other)
+
+	sel, _ := kstat.ParseSelector("cpu:*:sys:syscall")
+	aggs := kstat.AggregateValues(snap, sel)
+	if len(aggs) != 1 {
+		t.Fatalf("wrong number of aggregates: %+v", aggs)
+	}
+	a := aggs[0]
+	if a.Name != "cpu:*:sys:syscall" || a.Count != 3 || a.Sum != 60 || a.Mean != 20 || a.Min != 10 || a.Max != 30 {
+		t.Fatalf("bad aggregate: %+v", a)
+	}
+	if len(a.Values) != 3 || a.Values[1].Instance != 1 || a.Inputs[1] != 30 {
+		t.Fatalf("bad aggregate per-instance values: %+v", a)
+	}
+
+	sel, _ = kstat.ParseSelector("cpu:*:sys:")
+	if aggs = kstat.AggregateValues(snap, sel); len(aggs) != 2 || aggs[1].Name != "cpu:*:sys:sysread" {
+		t.Fatalf("bad multi-statistic aggregates: %+v", aggs)
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	sec := int64(time.Second)
+	sel, _ := kstat.ParseSelector("cpu:*:sys:syscall")
+	ag := kstat.NewAggregator(sel)
+	rag := kstat.NewRateAggregator(sel)
+	var sm *kstat.Sample
+	for i, vals := range [][]uint64{{0, 0}, {10, 30}} {
+		sm = &kstat.Sample{Snapshot: *cpuSnapshot(int64(i+1)*sec, vals...)}
+		ag.Process(sm)
+		rag.Process(sm)
+	}
+	for name, want := range map[string]float64{
+		"sum(cpu:*:sys:syscall)":       40,
+		"max(cpu:*:sys:syscall)":       30,
+		"mean_rate(cpu:*:sys:syscall)": 20,
+		"min_rate(cpu:*:sys:syscall)":  10,
+	} {
+		if v, ok := sm.Get(name); !ok || v != want {
+			t.Fatalf("bad %s: %v %f", name, ok, v)
+		}
+	}
+	if l := rag.Last(); len(l) != 1 || l[0].Inputs[1] != 30 {
+		t.Fatalf("bad rate Aggregator Last: %+v", l)
+	}
+}
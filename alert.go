@@ -0,0 +1,113 @@
+//
+// Threshold alerts on statistics.
+
+package kstat
+
+// Rule is a threshold alert rule: if a selected statistic (or its
+// per-second rate) is above Threshold (or below it, if Below is set)
+// for For Samples in a row, Func is called.
+//
+// Func is called once when the rule triggers for a statistic and not
+// again until the statistic has gone back within the threshold and
+// then crossed it again for For Samples in a row.
+type Rule struct {
+	Selector  Selector
+	Rate      bool
+	Threshold float64
+	Below     bool
+	// For is how many Samples in a row the statistic must be
+	// beyond the threshold; 0 is the same as 1.
+	For  int
+	Func func(Alert)
+}
+
+// Alert describes a triggered Rule.
+type Alert struct {
+	Rule *Rule
+	// Value is the triggering reading of the statistic and X is
+	// the value (or rate) that was compared to the threshold.
+	Value Value
+	X     float64
+	// Count is how many Samples in a row the statistic has been
+	// beyond the threshold.
+	Count int
+}
+
+// ruleState is the per-statistic state of a Rule.
+type ruleState struct {
+	count int
+	fired bool
+}
+
+type alertRule struct {
+	Rule
+	ct    *CounterTracker
+	state map[string]*ruleState
+}
+
+// Alerter is a Processor that evaluates a set of Rules against each
+// Sample and calls the Funcs of the ones that trigger. Funcs are
+// called synchronously from Process, so they should be quick.
+type Alerter struct {
+	rules []*alertRule
+}
+
+// NewAlerter creates an Alerter for some Rules.
+func NewAlerter(rules ...Rule) *Alerter {
+	a := &Alerter{}
+	for _, r := range rules {
+		a.AddRule(r)
+	}
+	return a
+}
+
+// AddRule adds a Rule to the Alerter.
+func (a *Alerter) AddRule(r Rule) {
+	ar := &alertRule{Rule: r, state: make(map[string]*ruleState)}
+	if r.Rate {
+		ar.ct = NewCounterTracker()
+	}
+	a.rules = append(a.rules, ar)
+}
+
+// Process evaluates the Alerter's Rules against a Sample.
+func (a *Alerter) Process(sm *Sample) {
+	for _, ar := range a.rules {
+		for _, v := range sm.Values {
+			if ar.Selector.Match(v) {
+				ar.check(v)
+			}
+		}
+	}
+}
+
+func (ar *alertRule) check(v Value) {
+	x, ok := v.Float()
+	if !ok {
+		return
+	}
+	if ar.ct != nil {
+		r, ok := ar.ct.Update(v)
+		if !ok {
+			return
+		}
+		x = r.Rate
+	}
+
+	key := v.String()
+	st := ar.state[key]
+	if st == nil {
+		st = &ruleState{}
+		ar.state[key] = st
+	}
+	if (ar.Below && x >= ar.Threshold) || (!ar.Below && x <= ar.Threshold) {
+		st.count = 0
+		st.fired = false
+		return
+	}
+	st.count++
+	if !st.fired && st.count >= ar.For && ar.Func != nil {
+		st.fired = true
+		ar.Func(Alert{Rule: &ar.Rule, Value: v, X: x, Count: st.count})
+	}
+}
@@ -0,0 +1,56 @@
+//
+// Test alerts.
+
+package kstat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestAlerter(t *testing.T) {
+	sec := int64(time.Second)
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	var alerts []kstat.Alert
+	a := kstat.NewAlerter(kstat.Rule{
+		Selector:  sel,
+		Rate:      true,
+		Threshold: 15,
+		For:       2,
+		Func:      func(al kstat.Alert) { alerts = append(alerts, al) },
+	})
+
+	// Rates are 10, 20, 20, 20, 10, 20, 20.
+	total := uint64(0)
+	for i, inc := range []uint64{0, 10, 20, 20, 20, 10, 20, 20} {
+		total += inc
+		a.Process(&kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{counter(int64(i+1)*sec, total)}}})
+		switch i {
+		case 3:
+			if len(alerts) != 1 || alerts[0].X != 20 || alerts[0].Count != 2 || alerts[0].Value.Snaptime != 4*sec {
+				t.Fatalf("bad first alert: %+v", alerts)
+			}
+		case 5:
+			if len(alerts) != 1 {
+				t.Fatalf("alert repeated: %+v", alerts)
+			}
+		}
+	}
+	if len(alerts) != 2 || alerts[1].Rule.Threshold != 15 {
+		t.Fatalf("alert did not re-trigger: %+v", alerts)
+	}
+}
+
+func TestAlerterBelow(t *testing.T) {
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	n := 0
+	a := kstat.NewAlerter(kstat.Rule{Selector: sel, Threshold: 5, Below: true, Func: func(kstat.Alert) { n++ }})
+	for i, v := range []uint64{10, 4, 6, 3} {
+		a.Process(&kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{counter(int64(i), v)}}})
+	}
+	if n != 2 {
+		t.Fatalf("below-threshold rule triggered %d times, not 2", n)
+	}
+}
@@ -0,0 +1,241 @@
+//
+// Reading many KStats with a single cgo call.
+
+package kstat
+
+// #include <errno.h>
+// #include <kstat.h>
+//
+// /* kstat_read() each of n kstats, recording the errno of each
+//    one that fails (and 0 for each one that doesn't). */
+// static void read_batch(kstat_ctl_t *kc, kstat_t **ksps, int n, int *errs) {
+//	int i;
+//	for (i = 0; i < n; i++) {
+//		errno = 0;
+//		if (kstat_read(kc, ksps[i], NULL) == -1)
+//			errs[i] = errno ? errno : EIO;
+//		else
+//			errs[i] = 0;
+//	}
+// }
+//
+// /* kstat_read() every kstat in the chain, up to n of them, recording
+//    each one's address in ksps and its errno as read_batch() does.
+//    It returns the number of kstats in the chain, which is more than
+//    n if the chain has grown since the caller counted it. */
+// static int read_chain(kstat_ctl_t *kc, kstat_t **ksps, int n, int *errs) {
+//	kstat_t *ksp;
+//	int i = 0;
+//	for (ksp = kc->kc_chain; ksp != NULL; ksp = ksp->ks_next, i++) {
+//		if (i >= n)
+//			continue;
+//		ksps[i] = ksp;
+//		errno = 0;
+//		if (kstat_read(kc, ksp, NULL) == -1)
+//			errs[i] = errno ? errno : EIO;
+//		else
+//			errs[i] = 0;
+//	}
+//	return i;
+// }
+//
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// readBatch refreshes a list of KStats all at once, in a loop on the
+// C side, so that there is only one cgo call no matter how many
+// KStats there are. It keeps its buffers so that they can be reused
+// from read to read.
+type readBatch struct {
+	ksps []*C.kstat_t
+	errs []C.int
+	idx  []int
+}
+
+// read refreshes all of the KStats in one tight pass, doing nothing
+// but kstat_read() calls, so that their data is as close to being
+// from the same moment as we can make it. It returns the error (if
+// any) from refreshing each of them.
+func (rb *readBatch) read(lst []sampled) []error {
+	errs := make([]error, len(lst))
+	rb.ksps, rb.idx = rb.ksps[:0], rb.idx[:0]
+	var tok *Token
+	for i, sk := range lst {
+		if sk.k.invalid() {
+			errs[i] = errors.New("invalid KStat or closed token")
+			continue
+		}
+		rb.ksps = append(rb.ksps, sk.k.ksp)
+		rb.idx = append(rb.idx, i)
+		tok = sk.k.tok
+	}
+	if len(rb.ksps) == 0 {
+		return errs
+	}
+	if cap(rb.errs) < len(rb.ksps) {
+		rb.errs = make([]C.int, len(rb.ksps))
+	}
+	rb.errs = rb.errs[:len(rb.ksps)]
+
+	C.read_batch(tok.kc, &rb.ksps[0], C.int(len(rb.ksps)), &rb.errs[0])
+
+	for j, i := range rb.idx {
+		if rb.errs[j] != 0 {
+			errs[i] = syscall.Errno(rb.errs[j])
+			continue
+		}
+		lst[i].k.readDone()
+	}
+	return errs
+}
+
+// ReadAll refreshes every KStat that matches at least one of the
+// selectors (every KStat, if there are none) and returns them in
+// sorted order. The kstat_read() calls are all made in a single cgo
+// call, so on a system with thousands of kstats this is much faster
+// than calling Refresh() on each of them. With no selectors, even
+// walking the kstat chain is done on the C side.
+//
+// KStats that can't be refreshed are left out, and ReadAll returns
+// the rest along with a KStatErrors for them, the same as Snapshot.
+// It only fails outright if the Token is unusable.
+func (t *Token) ReadAll(sels ...Selector) ([]*KStat, error) {
+	if t == nil || t.kc == nil {
+		return nil, errors.New("Token not valid or closed")
+	}
+	if len(sels) > 0 {
+		lst := t.matching(sels)
+		var rb readBatch
+		var ks []*KStat
+		var kerrs KStatErrors
+		for i, err := range rb.read(lst) {
+			if err != nil {
+				kerrs = append(kerrs, fmt.Errorf("%s: %w", lst[i].k, err))
+				continue
+			}
+			ks = append(ks, lst[i].k)
+		}
+		if kerrs != nil {
+			return ks, kerrs
+		}
+		return ks, nil
+	}
+
+	n := 0
+	for r := t.kc.kc_chain; r != nil; r = r.ks_next {
+		n++
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	ksps := make([]*C.kstat_t, n)
+	errs := make([]C.int, n)
+	if got := int(C.read_chain(t.kc, &ksps[0], C.int(n), &errs[0])); got < n {
+		n = got
+	}
+
+	ks := make([]*KStat, 0, n)
+	var kerrs KStatErrors
+	for i := 0; i < n; i++ {
+		k := newKStat(t, ksps[i])
+		if errs[i] != 0 {
+			kerrs = append(kerrs, fmt.Errorf("%s: %w", k, syscall.Errno(errs[i])))
+			continue
+		}
+		k.readDone()
+		ks = append(ks, k)
+	}
+	sort.Slice(ks, func(i, j int) bool {
+		return ksLess(ks[i], ks[j])
+	})
+	if kerrs != nil {
+		return ks, kerrs
+	}
+	return ks, nil
+}
+
+// refreshChunk is how many KStats RefreshMany reads in each cgo call
+// before handing them off to be decoded.
+const refreshChunk = 64
+
+// RefreshMany refreshes all of the KStats in ks and decodes their
+// statistics, returning the Values of ks[i] (as from KStat.Values)
+// in vals[i]. The kstat_read() calls are all made from the calling
+// goroutine, a chunk of KStats at a time, because libkstat can't be
+// used from several goroutines at once; decoding each chunk into
+// Values is done by a pool of goroutines while the next chunk is
+// being read. On a machine with many CPUs and thousands of KStats
+// this takes much less wall clock time than refreshing and decoding
+// them one by one.
+//
+// All of the KStats must come from this Token. If any of them can't
+// be refreshed or decoded, RefreshMany fails with the first such
+// error (in the order of ks), although it still refreshes all of the
+// ones that it can.
+func (t *Token) RefreshMany(ks []*KStat) ([][]Value, error) {
+	if t == nil || t.kc == nil {
+		return nil, errors.New("Token not valid or closed")
+	}
+	// A KStat listed twice would otherwise be read again while
+	// its first copy was still being decoded.
+	var lst []sampled
+	where := make(map[*KStat]int, len(ks))
+	for _, k := range ks {
+		if !k.invalid() && k.tok != t {
+			return nil, fmt.Errorf("kstat %s is from a different Token", k)
+		}
+		if _, ok := where[k]; !ok {
+			where[k] = len(lst)
+			lst = append(lst, sampled{k: k})
+		}
+	}
+	vals := make([][]Value, len(lst))
+	errs := make([]error, len(lst))
+
+	type chunk struct{ start, end int }
+	work := make(chan chunk)
+	var wg sync.WaitGroup
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				for i := c.start; i < c.end; i++ {
+					if errs[i] == nil {
+						vals[i], errs[i] = lst[i].k.Values()
+					}
+				}
+			}
+		}()
+	}
+
+	var rb readBatch
+	for start := 0; start < len(lst); start += refreshChunk {
+		end := start + refreshChunk
+		if end > len(lst) {
+			end = len(lst)
+		}
+		copy(errs[start:end], rb.read(lst[start:end]))
+		work <- chunk{start, end}
+	}
+	close(work)
+	wg.Wait()
+
+	res := make([][]Value, len(ks))
+	for i, k := range ks {
+		j := where[k]
+		if errs[j] != nil {
+			return nil, errs[j]
+		}
+		res[i] = vals[j]
+	}
+	return res, nil
+}
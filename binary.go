@@ -0,0 +1,364 @@
+//
+// Compact binary encoding of streams of Snapshots.
+
+package kstat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The binary stream format starts with a header of snapshotMagic and
+// a version byte. This is followed by Snapshot records, each of which
+// is a uvarint length followed by that many bytes of record.
+//
+// Within records, integers are varints (signed ones zigzag encoded)
+// and bytes are a uvarint length followed by that many bytes. Names
+// are string table references. The string table is shared across
+// the whole stream, so that the kstat and statistic names that
+// appear in every Snapshot are only written out once; a reference is
+// a uvarint index into the table, or 0 followed by the bytes of a
+// new string that is then added to the end of the table. Because of
+// the string table, a record can only be decoded after all of the
+// records before it. String values can change from Snapshot to
+// Snapshot, so they're written out as bytes instead of going into
+// the table, which would otherwise grow for as long as the stream
+// does.
+//
+// A record is:
+//
+//	varint     Time, in Unix nanoseconds
+//	uvarint    number of kstats
+//	for each kstat:
+//	    string   Module
+//	    varint   Instance
+//	    string   Name
+//	    string   Class
+//	    uvarint  Type
+//	    varint   Crtime
+//	    varint   Snaptime
+//	    uvarint  number of statistics
+//	    for each statistic:
+//	        string   name
+//	        uvarint  Type
+//	        value    varint (IntVal), uvarint (UintVal), or bytes (StringVal)
+const (
+	snapshotMagic         = "KSTATSNP"
+	SnapshotBinaryVersion = 1
+)
+
+// maxRecord is the largest record we'll read, as a sanity check.
+const maxRecord = 1 << 30
+
+// SnapshotWriter writes a stream of Snapshots to an io.Writer in a
+// compact binary form, which can be read back with a SnapshotReader.
+type SnapshotWriter struct {
+	w       io.Writer
+	started bool
+	strs    map[string]uint64
+	added   []string
+	err     error
+	buf     bytes.Buffer
+	out     []byte
+	tmp     [binary.MaxVarintLen64]byte
+}
+
+// NewSnapshotWriter creates a new SnapshotWriter that writes to w.
+// The stream header is written along with the first Snapshot.
+func NewSnapshotWriter(w io.Writer) *SnapshotWriter {
+	return &SnapshotWriter{w: w, strs: make(map[string]uint64)}
+}
+
+func (sw *SnapshotWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(sw.tmp[:], v)
+	sw.buf.Write(sw.tmp[:n])
+}
+
+func (sw *SnapshotWriter) varint(v int64) {
+	n := binary.PutVarint(sw.tmp[:], v)
+	sw.buf.Write(sw.tmp[:n])
+}
+
+func (sw *SnapshotWriter) bytes(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.buf.WriteString(s)
+}
+
+func (sw *SnapshotWriter) str(s string) {
+	if i, ok := sw.strs[s]; ok {
+		sw.uvarint(i)
+		return
+	}
+	sw.uvarint(0)
+	sw.bytes(s)
+	sw.strs[s] = uint64(len(sw.strs) + 1)
+	sw.added = append(sw.added, s)
+}
+
+// Write writes a Snapshot to the stream. If writing to the
+// underlying io.Writer fails after some of the record has been
+// written, the stream is corrupt and every later Write fails with
+// the same error; if nothing was written, Write may be retried.
+func (sw *SnapshotWriter) Write(snap *Snapshot) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	// Check for bad Values before we start, so that we don't
+	// make string table additions for a record we won't write.
+	for _, v := range snap.Values {
+		if _, ok := namedTypes[v.Type.String()]; !ok {
+			return fmt.Errorf("%s has unknown type %s", v, v.Type)
+		}
+	}
+
+	sw.buf.Reset()
+	sw.added = sw.added[:0]
+	sw.varint(snap.Time.UnixNano())
+	grps := snap.groups()
+	sw.uvarint(uint64(len(grps)))
+	for _, g := range grps {
+		sw.str(g.info.Module)
+		sw.varint(int64(g.info.Instance))
+		sw.str(g.info.Name)
+		sw.str(g.info.Class)
+		sw.uvarint(uint64(g.info.Type))
+		sw.varint(g.info.Crtime)
+		sw.varint(g.info.Snaptime)
+		sw.uvarint(uint64(len(g.vals)))
+		for _, v := range g.vals {
+			sw.str(v.Stat)
+			sw.uvarint(uint64(v.Type))
+			switch v.Type {
+			case CharData, String:
+				sw.bytes(v.StringVal)
+			case Int32, Int64:
+				sw.varint(v.IntVal)
+			default:
+				sw.uvarint(v.UintVal)
+			}
+		}
+	}
+
+	// The record goes after the stream header (if this is the
+	// first record) and its length.
+	sw.out = sw.out[:0]
+	if !sw.started {
+		sw.out = append(sw.out, snapshotMagic...)
+		sw.out = append(sw.out, SnapshotBinaryVersion)
+	}
+	sw.out = binary.AppendUvarint(sw.out, uint64(sw.buf.Len()))
+	sw.out = append(sw.out, sw.buf.Bytes()...)
+	n, err := sw.w.Write(sw.out)
+	switch {
+	case err == nil:
+		sw.started = true
+	case n == 0:
+		// The reader never sees this record, so it must not
+		// see its strings in the table either.
+		for _, s := range sw.added {
+			delete(sw.strs, s)
+		}
+	default:
+		sw.err = err
+	}
+	return err
+}
+
+// SnapshotReader reads a stream of Snapshots written by a
+// SnapshotWriter.
+type SnapshotReader struct {
+	r       *bufio.Reader
+	started bool
+	strs    []string
+	rec     *bytes.Reader
+}
+
+// NewSnapshotReader creates a new SnapshotReader that reads from r.
+func NewSnapshotReader(r io.Reader) *SnapshotReader {
+	return &SnapshotReader{r: bufio.NewReader(r)}
+}
+
+var errBadSnapshotStream = errors.New("bad Snapshot stream")
+
+func (sr *SnapshotReader) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(sr.rec)
+	if err != nil {
+		return 0, errBadSnapshotStream
+	}
+	return v, nil
+}
+
+func (sr *SnapshotReader) varint() (int64, error) {
+	v, err := binary.ReadVarint(sr.rec)
+	if err != nil {
+		return 0, errBadSnapshotStream
+	}
+	return v, nil
+}
+
+func (sr *SnapshotReader) bytes() (string, error) {
+	n, err := sr.uvarint()
+	if err != nil || n > uint64(sr.rec.Len()) {
+		return "", errBadSnapshotStream
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(sr.rec, b); err != nil {
+		return "", errBadSnapshotStream
+	}
+	return string(b), nil
+}
+
+func (sr *SnapshotReader) str() (string, error) {
+	i, err := sr.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if i > 0 {
+		if i > uint64(len(sr.strs)) {
+			return "", errBadSnapshotStream
+		}
+		return sr.strs[i-1], nil
+	}
+	s, err := sr.bytes()
+	if err != nil {
+		return "", err
+	}
+	sr.strs = append(sr.strs, s)
+	return s, nil
+}
+
+// Read reads the next Snapshot from the stream. It returns io.EOF
+// when there are no more Snapshots. The Snapshot's Time is in the
+// local time zone.
+func (sr *SnapshotReader) Read() (*Snapshot, error) {
+	if !sr.started {
+		hdr := make([]byte, len(snapshotMagic)+1)
+		if _, err := io.ReadFull(sr.r, hdr); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, errBadSnapshotStream
+		}
+		if string(hdr[:len(snapshotMagic)]) != snapshotMagic {
+			return nil, errBadSnapshotStream
+		}
+		if hdr[len(snapshotMagic)] != SnapshotBinaryVersion {
+			return nil, fmt.Errorf("unsupported Snapshot stream version %d", hdr[len(snapshotMagic)])
+		}
+		sr.started = true
+	}
+
+	n, err := binary.ReadUvarint(sr.r)
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil || n > maxRecord {
+		return nil, errBadSnapshotStream
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(sr.r, b); err != nil {
+		return nil, errBadSnapshotStream
+	}
+	sr.rec = bytes.NewReader(b)
+	return sr.record()
+}
+
+// record decodes the current record.
+func (sr *SnapshotReader) record() (*Snapshot, error) {
+	t, err := sr.varint()
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{Time: time.Unix(0, t)}
+	nks, err := sr.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	for ; nks > 0; nks-- {
+		var ki KStatInfo
+		var inst int64
+		var utp, nst uint64
+		if ki.Module, err = sr.str(); err != nil {
+			return nil, err
+		}
+		if inst, err = sr.varint(); err != nil {
+			return nil, err
+		}
+		if ki.Name, err = sr.str(); err != nil {
+			return nil, err
+		}
+		if ki.Class, err = sr.str(); err != nil {
+			return nil, err
+		}
+		if utp, err = sr.uvarint(); err != nil {
+			return nil, err
+		}
+		if ki.Crtime, err = sr.varint(); err != nil {
+			return nil, err
+		}
+		if ki.Snaptime, err = sr.varint(); err != nil {
+			return nil, err
+		}
+		if nst, err = sr.uvarint(); err != nil {
+			return nil, err
+		}
+		ki.Instance = int(inst)
+		ki.Type = KSType(utp)
+		snap.KStats = append(snap.KStats, ki)
+
+		for ; nst > 0; nst-- {
+			var stat string
+			if stat, err = sr.str(); err != nil {
+				return nil, err
+			}
+			if utp, err = sr.uvarint(); err != nil {
+				return nil, err
+			}
+			v := ki.value(stat, NamedType(utp))
+			switch v.Type {
+			case CharData, String:
+				v.StringVal, err = sr.bytes()
+			case Int32, Int64:
+				v.IntVal, err = sr.varint()
+			case Uint32, Uint64:
+				v.UintVal, err = sr.uvarint()
+			default:
+				err = fmt.Errorf("%s has unknown type %s", v, v.Type)
+			}
+			if err != nil {
+				return nil, err
+			}
+			snap.Values = append(snap.Values, v)
+		}
+	}
+	if sr.rec.Len() != 0 {
+		return nil, errBadSnapshotStream
+	}
+	return snap, nil
+}
+
+// MarshalBinary encodes a single Snapshot as a complete binary
+// stream of one Snapshot.
+func (snap Snapshot) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	if err := NewSnapshotWriter(&b).Write(&snap); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Snapshot encoded by MarshalBinary (or the
+// first Snapshot of any binary stream).
+func (snap *Snapshot) UnmarshalBinary(data []byte) error {
+	nsnap, err := NewSnapshotReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		return err
+	}
+	*snap = *nsnap
+	return nil
+}
@@ -0,0 +1,49 @@
+//
+// The binary stream's string table is internal, so checking what goes
+// into it needs a test inside the package.
+
+package kstat
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// String values change from Snapshot to Snapshot, so they must not
+// go into the string table, which would then grow without bound.
+func TestSnapshotStringTable(t *testing.T) {
+	ki := KStatInfo{Module: "cpu_info", Name: "cpu_info0", Class: "misc", Type: NamedStat}
+	var b bytes.Buffer
+	sw := NewSnapshotWriter(&b)
+	var want []string
+	for i := 0; i < 5; i++ {
+		ki.Snaptime = int64(i + 1)
+		v := ki.value("state", String)
+		v.StringVal = fmt.Sprintf("on-line since %d", i)
+		snap := &Snapshot{Time: time.Unix(int64(i), 0), KStats: []KStatInfo{ki}, Values: []Value{v}}
+		if err := sw.Write(snap); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+		// module, name, class, and the statistic name.
+		if len(sw.strs) != 4 {
+			t.Fatalf("string table has %d entries after %d Snapshots", len(sw.strs), i+1)
+		}
+		want = append(want, v.StringVal)
+	}
+
+	sr := NewSnapshotReader(&b)
+	for _, s := range want {
+		snap, err := sr.Read()
+		if err != nil {
+			t.Fatalf("Read failed: %s", err)
+		}
+		if len(snap.Values) != 1 || snap.Values[0].StringVal != s {
+			t.Fatalf("read back %+v, not %q", snap.Values, s)
+		}
+		if len(sr.strs) != 4 {
+			t.Fatalf("reader string table has %d entries", len(sr.strs))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+//
+// Test binary encoding.
+
+package kstat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// flakyWriter fails writes while fail is set, after writing partial
+// bytes of them.
+type flakyWriter struct {
+	bytes.Buffer
+	fail    bool
+	partial int
+}
+
+func (fw *flakyWriter) Write(p []byte) (int, error) {
+	if fw.fail {
+		fw.Buffer.Write(p[:fw.partial])
+		return fw.partial, errors.New("write failed")
+	}
+	return fw.Buffer.Write(p)
+}
+
+// A failed Write must not leave string table entries behind that the
+// reader never saw.
+func TestSnapshotWriteFailure(t *testing.T) {
+	snap := testSnapshot()
+	snap.Time = snap.Time.Local()
+	fw := &flakyWriter{fail: true}
+	sw := kstat.NewSnapshotWriter(fw)
+	if err := sw.Write(snap); err == nil {
+		t.Fatalf("Write to a failing writer succeeded")
+	}
+	fw.fail = false
+	if err := sw.Write(snap); err != nil {
+		t.Fatalf("retried Write failed: %s", err)
+	}
+	r, err := kstat.NewSnapshotReader(&fw.Buffer).Read()
+	if err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	r.Time = r.Time.Local()
+	if !reflect.DeepEqual(snap, r) {
+		t.Fatalf("Snapshot did not round trip:\n%+v\n%+v", snap, r)
+	}
+
+	// Once part of a record has been written, the stream is
+	// broken for good.
+	fw = &flakyWriter{fail: true, partial: 3}
+	sw = kstat.NewSnapshotWriter(fw)
+	if err := sw.Write(snap); err == nil {
+		t.Fatalf("Write to a failing writer succeeded")
+	}
+	fw.fail = false
+	if err := sw.Write(snap); err == nil {
+		t.Fatalf("Write after a partial write succeeded")
+	}
+}
+
+func TestSnapshotStream(t *testing.T) {
+	snap := testSnapshot()
+	snap.Time = snap.Time.Local()
+	snap2 := testSnapshot()
+	snap2.Time = snap.Time.Add(time.Second)
+	snap2.Values[0].UintVal = 5
+	snap2.Values[3].StringVal = "new brand"
+
+	var buf bytes.Buffer
+	sw := kstat.NewSnapshotWriter(&buf)
+	for _, s := range []*kstat.Snapshot{snap, snap2} {
+		if err := sw.Write(s); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+	}
+	l1 := buf.Len()
+
+	// The binary form should be much smaller than JSON, and the
+	// second Snapshot much smaller than the first because of the
+	// string table.
+	jb, _ := json.Marshal(snap)
+	var one bytes.Buffer
+	if err := kstat.NewSnapshotWriter(&one).Write(snap); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if one.Len()*2 > len(jb) || (l1-one.Len())*2 > one.Len() {
+		t.Fatalf("binary encoding is not compact: JSON %d, first %d, both %d", len(jb), one.Len(), l1)
+	}
+
+	sr := kstat.NewSnapshotReader(&buf)
+	for _, s := range []*kstat.Snapshot{snap, snap2} {
+		r, err := sr.Read()
+		if err != nil {
+			t.Fatalf("Read failed: %s", err)
+		}
+		r.Time = r.Time.Local()
+		if !reflect.DeepEqual(s, r) {
+			t.Fatalf("Snapshot did not round trip:\n%+v\n%+v", s, r)
+		}
+	}
+	if _, err := sr.Read(); err != io.EOF {
+		t.Fatalf("Read at end did not give EOF: %v", err)
+	}
+
+	// Truncated and corrupt streams should fail.
+	b := one.Bytes()
+	for _, bad := range [][]byte{b[:5], b[:len(b)-1], append([]byte("NOTASNAP"), b[8:]...)} {
+		if _, err := kstat.NewSnapshotReader(bytes.NewReader(bad)).Read(); err == nil || err == io.EOF {
+			t.Fatalf("Read of bad stream gave %v", err)
+		}
+	}
+}
+
+func TestSnapshotMarshalBinary(t *testing.T) {
+	snap := testSnapshot()
+	b, err := snap.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+	var s2 kstat.Snapshot
+	if err = s2.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+	s2.Time = s2.Time.UTC()
+	if !reflect.DeepEqual(*snap, s2) {
+		t.Fatalf("Snapshot did not round trip:\n%+v\n%+v", *snap, s2)
+	}
+
+	snap.Values[0].Type = kstat.NamedType(77)
+	if _, err = snap.MarshalBinary(); err == nil {
+		t.Fatalf("MarshalBinary of bad type succeeded")
+	}
+}
@@ -0,0 +1,309 @@
+//
+// Binding the statistics of a kstat to the fields of a struct.
+
+package kstat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fieldTag is a parsed `kstat:"..."` struct tag.
+type fieldTag struct {
+	name   string
+	skip   bool
+	prefix string
+	unit   string
+}
+
+// parseTag parses the kstat tag of a struct field, which is the
+// statistic name followed by comma-separated options. The name
+// defaults to the lowercased field name; a name of "-" means the field
+// is not bound. As with encoding/json, unknown options are ignored.
+func parseTag(f reflect.StructField) fieldTag {
+	parts := strings.Split(f.Tag.Get("kstat"), ",")
+	ft := fieldTag{name: parts[0]}
+	if ft.name == "-" {
+		return fieldTag{skip: true}
+	}
+	if ft.name == "" {
+		ft.name = strings.ToLower(f.Name)
+	}
+	for _, opt := range parts[1:] {
+		switch {
+		case strings.HasPrefix(opt, "prefix="):
+			ft.prefix = opt[len("prefix="):]
+		case strings.HasPrefix(opt, "unit="):
+			ft.unit = opt[len("unit="):]
+		}
+	}
+	return ft
+}
+
+// checkPtr checks that ptr is a non-nil pointer to a settable struct
+// and returns the struct, panicking if it isn't.
+func checkPtr(what string, ptr interface{}) reflect.Value {
+	if ptr == nil {
+		panic(what + " given nil pointer")
+	}
+	vp := reflect.ValueOf(ptr)
+	if vp.Kind() != reflect.Ptr {
+		panic(what + " not given a pointer")
+	}
+	if vp.IsNil() {
+		panic(what + " given nil pointer")
+	}
+	dst := vp.Elem()
+	if dst.Kind() != reflect.Struct {
+		panic(what + ": not pointer to struct")
+	}
+	if !dst.CanSet() {
+		panic(what + ": struct cannot be set for some reason")
+	}
+	return dst
+}
+
+// CopyValues copies statistics into the exported fields of a struct
+// that you supply a pointer to. Each field gets the statistic named
+// by its `kstat:"name"` struct tag, or if it has no tag, the statistic
+// with the field's name in lower case; fields tagged `kstat:"-"` are
+// skipped. Fields with no matching statistic are left alone.
+//
+// Fields that are structs are filled in the same way, which lets you
+// group the statistics of large kstats into sub-structs. The fields
+// of embedded structs are treated as part of the outer struct. Other
+// struct fields may have a `kstat:",prefix=p"` tag, in which case p
+// is put in front of the names of all of their statistics; for
+// example, a Receive field tagged with prefix=r could have Bytes64
+// and Packets64 fields for the rbytes64 and rpackets64 statistics.
+//
+// A `kstat:"name,unit=u"` tag converts a numeric statistic from the
+// unit u to bytes or nanoseconds before it's copied into the field,
+// so a field of type time.Duration (or any other integer type) gets
+// nanoseconds. The units are pages (see CopyOptions.PageSize), kb,
+// nsec, usec, msec, and sec.
+//
+// Numeric statistics can be copied into fields of any integer,
+// floating point, or boolean type (where non-zero is true), with the
+// usual Go conversions. String and CharData statistics can only be
+// copied into string fields, but string fields can hold any statistic
+// (numbers are formatted in decimal).
+//
+// As with KStat.CopyTo, CopyValues panics if ptr is not a pointer to
+// a struct.
+func CopyValues(vals []Value, ptr interface{}) error {
+	return CopyValuesWith(vals, ptr, CopyOptions{})
+}
+
+// CopyOptions control how strictly CopyValuesWith and
+// KStat.CopyToWith bind statistics to struct fields, so that changes
+// in kstats between OS releases can be caught instead of silently
+// leaving fields zero.
+type CopyOptions struct {
+	// Strict makes it an error if a field has no statistic, and
+	// also if a value doesn't fit in its field (for example, a
+	// negative value for an unsigned field).
+	Strict bool
+	// Complete makes it an error if a statistic has no field.
+	Complete bool
+	// PageSize is the page size used to convert statistics with
+	// unit=pages. The default is os.Getpagesize(), which is only
+	// right for statistics from the current system.
+	PageSize int
+}
+
+// CopyValuesWith is CopyValues with CopyOptions. All problems are
+// reported together in the error.
+func CopyValuesWith(vals []Value, ptr interface{}, opts CopyOptions) error {
+	dst := checkPtr("CopyValues", ptr)
+	byName := make(map[string]Value, len(vals))
+	for _, v := range vals {
+		byName[v.Stat] = v
+	}
+	return bindStruct(byName, dst, opts)
+}
+
+// binding is the state of binding statistics to a struct and the
+// structs nested in it.
+type binding struct {
+	byName  map[string]Value
+	opts    CopyOptions
+	used    map[string]bool
+	missing []string
+}
+
+func bindStruct(byName map[string]Value, dst reflect.Value, opts CopyOptions) error {
+	b := &binding{byName: byName, opts: opts, used: make(map[string]bool, len(byName))}
+	if err := b.bind(dst, ""); err != nil {
+		return err
+	}
+
+	var problems []string
+	if opts.Strict && len(b.missing) > 0 {
+		problems = append(problems, "no statistics for fields "+strings.Join(b.missing, ", "))
+	}
+	if opts.Complete {
+		var extra []string
+		for name := range byName {
+			if !b.used[name] {
+				extra = append(extra, name)
+			}
+		}
+		if len(extra) > 0 {
+			sort.Strings(extra)
+			problems = append(problems, "no fields for statistics "+strings.Join(extra, ", "))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// bind binds the fields of a struct, with prefix put in front of all
+// of their statistic names. Fields that are themselves structs have
+// their fields bound in turn; embedded structs are bound as if their
+// fields were part of the outer struct, and other struct fields can
+// add to the prefix with a prefix= tag option.
+func (b *binding) bind(dst reflect.Value, prefix string) error {
+	st := dst.Type()
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := parseTag(f)
+		if tag.skip {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct {
+			if err := b.bind(dst.Field(i), prefix+tag.prefix); err != nil {
+				return fmt.Errorf("field %s: %s", f.Name, err)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := prefix + tag.name
+		v, ok := b.byName[name]
+		if !ok {
+			b.missing = append(b.missing, name)
+			continue
+		}
+		b.used[name] = true
+		if tag.unit != "" {
+			var err error
+			if v, err = b.convert(v, tag.unit); err != nil {
+				return fmt.Errorf("field %s: %s", f.Name, err)
+			}
+		}
+		if err := setField(dst.Field(i), v, b.opts.Strict); err != nil {
+			return fmt.Errorf("field %s: %s", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// unitScales are how many bytes or nanoseconds there are in each
+// unit, except for pages.
+var unitScales = map[string]int64{
+	"kb":   1024,
+	"nsec": 1,
+	"usec": int64(time.Microsecond),
+	"msec": int64(time.Millisecond),
+	"sec":  int64(time.Second),
+}
+
+// convert converts a numeric Value from a unit to bytes or
+// nanoseconds.
+func (b *binding) convert(v Value, unit string) (Value, error) {
+	scale, ok := unitScales[unit]
+	if unit == "pages" {
+		scale, ok = int64(b.opts.PageSize), true
+		if scale <= 0 {
+			scale = int64(os.Getpagesize())
+		}
+	}
+	if !ok {
+		return v, fmt.Errorf("unknown unit %q", unit)
+	}
+	overflow := fmt.Errorf("statistic %s overflows when converted from %s", v, unit)
+	switch v.Type {
+	case Int32, Int64:
+		r := v.IntVal * scale
+		if v.IntVal != 0 && r/scale != v.IntVal {
+			return v, overflow
+		}
+		v.IntVal = r
+	case Uint32, Uint64:
+		r := v.UintVal * uint64(scale)
+		if v.UintVal != 0 && r/uint64(scale) != v.UintVal {
+			return v, overflow
+		}
+		v.UintVal = r
+	default:
+		return v, fmt.Errorf("%s statistic %s cannot have a unit", v.Type, v)
+	}
+	return v, nil
+}
+
+// setField sets a struct field from a Value, converting it as
+// necessary. If strict is set, values that don't fit are an error.
+func setField(fv reflect.Value, v Value, strict bool) error {
+	if fv.Kind() == reflect.String {
+		switch v.Type {
+		case CharData, String:
+			fv.SetString(v.StringVal)
+		case Int32, Int64:
+			fv.SetString(strconv.FormatInt(v.IntVal, 10))
+		default:
+			fv.SetString(strconv.FormatUint(v.UintVal, 10))
+		}
+		return nil
+	}
+
+	var iv int64
+	var uv uint64
+	// fits is whether the value fits in an int64 or a uint64.
+	var ifits, ufits bool
+	switch v.Type {
+	case Int32, Int64:
+		iv, uv = v.IntVal, uint64(v.IntVal)
+		ifits, ufits = true, v.IntVal >= 0
+	case Uint32, Uint64:
+		iv, uv = int64(v.UintVal), v.UintVal
+		ifits, ufits = v.UintVal <= math.MaxInt64, true
+	default:
+		return fmt.Errorf("cannot store %s statistic %s in a %s", v.Type, v, fv.Type())
+	}
+	overflow := fmt.Errorf("value %s of statistic %s does not fit in a %s", valueText(v), v, fv.Type())
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if strict && (!ifits || fv.OverflowInt(iv)) {
+			return overflow
+		}
+		fv.SetInt(iv)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if strict && (!ufits || fv.OverflowUint(uv)) {
+			return overflow
+		}
+		fv.SetUint(uv)
+	case reflect.Float32, reflect.Float64:
+		f, _ := v.Float()
+		fv.SetFloat(f)
+	case reflect.Bool:
+		fv.SetBool(uv != 0)
+	default:
+		return fmt.Errorf("cannot store statistic %s in a %s", v, fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+//
+// Test struct binding of Values.
+
+package kstat_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestCopyValues(t *testing.T) {
+	vals := []kstat.Value{
+		{Stat: "syscall", Type: kstat.Uint64, UintVal: 300},
+		{Stat: "sysread", Type: kstat.Uint32, UintVal: 70000},
+		{Stat: "temp", Type: kstat.Int32, IntVal: -5},
+		{Stat: "brand", Type: kstat.String, StringVal: "i86pc"},
+		{Stat: "state", Type: kstat.CharData, StringVal: "on-line"},
+	}
+	var r struct {
+		Syscall   uint64
+		Reads     int16 `kstat:"sysread"`
+		Temp      float64
+		Online    bool `kstat:"syscall"`
+		Brand     string
+		State     string `kstat:"state,x"`
+		TempStr   string `kstat:"temp"`
+		Sysread   uint64 `kstat:"-"`
+		Missing   int
+		unexposed int
+	}
+	r.Missing = 42
+	if err := kstat.CopyValues(vals, &r); err != nil {
+		t.Fatalf("CopyValues failed: %s", err)
+	}
+	// Conversions truncate, as they do in Go.
+	if r.Syscall != 300 || r.Reads != 70000-65536 || r.Temp != -5 || !r.Online {
+		t.Fatalf("bad numeric fields: %+v", r)
+	}
+	if r.Brand != "i86pc" || r.State != "on-line" || r.TempStr != "-5" {
+		t.Fatalf("bad string fields: %+v", r)
+	}
+	if r.Sysread != 0 || r.Missing != 42 || r.unexposed != 0 {
+		t.Fatalf("fields changed that shouldn't have been: %+v", r)
+	}
+
+	var bad struct {
+		Brand int
+	}
+	if err := kstat.CopyValues(vals, &bad); err == nil {
+		t.Fatalf("CopyValues put a string into an int")
+	}
+}
+
+func TestCopyValuesStrict(t *testing.T) {
+	vals := []kstat.Value{
+		{Stat: "syscall", Type: kstat.Uint64, UintVal: 300},
+		{Stat: "temp", Type: kstat.Int32, IntVal: -5},
+		{Stat: "extra", Type: kstat.Uint32, UintVal: 1},
+	}
+	var r struct {
+		Syscall uint64
+		Temp    int8
+		Gone    uint32
+	}
+	strict := kstat.CopyOptions{Strict: true}
+	complete := kstat.CopyOptions{Complete: true}
+	if err := kstat.CopyValues(vals, &r); err != nil {
+		t.Fatalf("CopyValues failed: %s", err)
+	}
+	err := kstat.CopyValuesWith(vals, &r, strict)
+	if err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Fatalf("strict CopyValuesWith did not report a missing statistic: %v", err)
+	}
+	err = kstat.CopyValuesWith(vals, &r, complete)
+	if err == nil || !strings.Contains(err.Error(), "extra") || strings.Contains(err.Error(), "gone") {
+		t.Fatalf("complete CopyValuesWith did not report an extra statistic: %v", err)
+	}
+
+	var ok struct {
+		Syscall uint64
+		Temp    int8
+		Extra   uint8
+	}
+	if err = kstat.CopyValuesWith(vals, &ok, kstat.CopyOptions{Strict: true, Complete: true}); err != nil {
+		t.Fatalf("strict and complete CopyValuesWith failed: %s", err)
+	}
+
+	var small struct {
+		Syscall uint8
+	}
+	if err = kstat.CopyValuesWith(vals[:1], &small, strict); err == nil {
+		t.Fatalf("strict CopyValuesWith allowed an overflow")
+	}
+	var unsigned struct {
+		Temp uint64
+	}
+	if err = kstat.CopyValuesWith(vals[1:2], &unsigned, strict); err == nil {
+		t.Fatalf("strict CopyValuesWith allowed a negative unsigned value")
+	}
+}
+
+type linkCommon struct {
+	Ierrors uint32
+}
+
+func TestCopyValuesNested(t *testing.T) {
+	vals := []kstat.Value{
+		{Stat: "rbytes64", Type: kstat.Uint64, UintVal: 1000},
+		{Stat: "ipackets64", Type: kstat.Uint64, UintVal: 10},
+		{Stat: "obytes64", Type: kstat.Uint64, UintVal: 2000},
+		{Stat: "ierrors", Type: kstat.Uint32, UintVal: 3},
+		{Stat: "link_state", Type: kstat.Uint32, UintVal: 1},
+	}
+	var r struct {
+		linkCommon
+		Receive struct {
+			Bytes64 uint64
+		} `kstat:",prefix=r"`
+		Out struct {
+			Bytes64   uint64
+			Packets64 uint64 `kstat:"packets64"`
+			Missing   uint64
+		} `kstat:",prefix=o"`
+		Input struct {
+			Packets struct {
+				Count uint64 `kstat:"64"`
+			} `kstat:",prefix=packets"`
+		} `kstat:",prefix=i"`
+		Link struct {
+			State uint32
+		} `kstat:",prefix=link_"`
+	}
+	err := kstat.CopyValuesWith(vals, &r, kstat.CopyOptions{Strict: true, Complete: true})
+	if err == nil || !strings.Contains(err.Error(), "opackets64") || !strings.Contains(err.Error(), "omissing") {
+		t.Fatalf("strict nested CopyValuesWith gave the wrong error: %v", err)
+	}
+	if r.Receive.Bytes64 != 1000 || r.Out.Bytes64 != 2000 || r.Input.Packets.Count != 10 || r.Ierrors != 3 || r.Link.State != 1 {
+		t.Fatalf("bad nested CopyValues result: %+v", r)
+	}
+}
+
+func TestCopyValuesUnits(t *testing.T) {
+	vals := []kstat.Value{
+		{Stat: "pp_kernel", Type: kstat.Uint64, UintVal: 10},
+		{Stat: "cpu_nsec_user", Type: kstat.Uint64, UintVal: 1500000000},
+		{Stat: "lbolt", Type: kstat.Int64, IntVal: 3},
+		{Stat: "physmem", Type: kstat.Uint64, UintVal: 2},
+		{Stat: "huge", Type: kstat.Uint64, UintVal: math.MaxUint64 / 2},
+	}
+	var r struct {
+		Kernel  uint64        `kstat:"pp_kernel,unit=pages"`
+		User    time.Duration `kstat:"cpu_nsec_user,unit=nsec"`
+		Lbolt   time.Duration `kstat:"lbolt,unit=sec"`
+		Physmem float64       `kstat:",unit=kb"`
+	}
+	if err := kstat.CopyValuesWith(vals, &r, kstat.CopyOptions{PageSize: 8192}); err != nil {
+		t.Fatalf("CopyValuesWith failed: %s", err)
+	}
+	if r.Kernel != 81920 || r.User != 1500*time.Millisecond || r.Lbolt != 3*time.Second || r.Physmem != 2048 {
+		t.Fatalf("bad unit conversions: %+v", r)
+	}
+
+	var bad struct {
+		Kernel uint64 `kstat:"pp_kernel,unit=furlongs"`
+	}
+	if err := kstat.CopyValues(vals, &bad); err == nil {
+		t.Fatalf("CopyValues accepted an unknown unit")
+	}
+	var over struct {
+		Huge uint64 `kstat:",unit=kb"`
+	}
+	if err := kstat.CopyValues(vals, &over); err == nil {
+		t.Fatalf("CopyValues allowed a unit conversion to overflow")
+	}
+}
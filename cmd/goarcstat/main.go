@@ -0,0 +1,148 @@
+// goarcstat prints arcstat style reports of ZFS ARC activity from the
+// zfs:0:arcstats kstat:
+//
+//	goarcstat [interval [count]]
+//
+// Each line has the reads, hits, and hit rate of the ARC as a whole,
+// the hits and hit rates of demand and prefetch reads, how fast data
+// is being evicted, and the ARC's current size and target size. The
+// first line covers the time since the ARC was created (usually since
+// boot) and the rest cover each interval.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+const headerEvery = 20
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "goarcstat: %s\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: goarcstat [interval [count]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// size formats a size or rate in bytes in the compact way that
+// arcstat does, with a binary K, M, G, or T suffix.
+func size(n float64) string {
+	for _, s := range []string{"", "K", "M", "G"} {
+		if n < 1024 {
+			return strconv.FormatFloat(n, 'f', 0, 64) + s
+		}
+		n /= 1024
+	}
+	return strconv.FormatFloat(n, 'f', 0, 64) + "T"
+}
+
+func pct(n, d float64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n * 100 / d
+}
+
+// arcReport is one line of the report.
+type arcReport struct {
+	rates map[string]float64
+	gauge map[string]uint64
+}
+
+func (r arcReport) sum(stats ...string) float64 {
+	t := 0.0
+	for _, s := range stats {
+		t += r.rates[s]
+	}
+	return t
+}
+
+func header() {
+	fmt.Printf("%8s %6s %6s %4s %6s %4s %6s %4s %6s %6s %6s\n",
+		"time", "read", "hits", "hit%", "dhit", "dh%", "phit", "ph%", "evict", "arcsz", "c")
+}
+
+func (r arcReport) print(t time.Time) {
+	hits, misses := r.sum("hits"), r.sum("misses")
+	dhit := r.sum("demand_data_hits", "demand_metadata_hits")
+	dmis := r.sum("demand_data_misses", "demand_metadata_misses")
+	phit := r.sum("prefetch_data_hits", "prefetch_metadata_hits")
+	pmis := r.sum("prefetch_data_misses", "prefetch_metadata_misses")
+	evict := r.sum("evict_l2_cached", "evict_l2_eligible", "evict_l2_ineligible")
+	fmt.Printf("%8s %6s %6s %4.0f %6s %4.0f %6s %4.0f %6s %6s %6s\n",
+		t.Format("15:04:05"), size(hits+misses), size(hits), pct(hits, hits+misses),
+		size(dhit), pct(dhit, dhit+dmis), size(phit), pct(phit, phit+pmis),
+		size(evict), size(float64(r.gauge["size"])), size(float64(r.gauge["c"])))
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	var interval time.Duration
+	count := 1
+	if flag.NArg() > 2 {
+		usage()
+	}
+	for i, a := range flag.Args() {
+		n, err := strconv.Atoi(a)
+		if err != nil || n <= 0 {
+			usage()
+		}
+		if i == 0 {
+			interval, count = time.Duration(n)*time.Second, 0
+		} else {
+			count = n
+		}
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+	ks, err := tok.Lookup("zfs", 0, "arcstats")
+	if err != nil {
+		fatal(err)
+	}
+
+	ct := kstat.NewCounterTracker()
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		if err := ks.Refresh(); err != nil {
+			fatal(err)
+		}
+		vals, err := ks.Values()
+		if err != nil {
+			fatal(err)
+		}
+		r := arcReport{rates: make(map[string]float64), gauge: make(map[string]uint64)}
+		for _, v := range vals {
+			if i == 0 {
+				// Start the counters from zero when the ARC was
+				// created, so the first line is since then.
+				z := v
+				z.Snaptime, z.IntVal, z.UintVal = v.Crtime, 0, 0
+				ct.Update(z)
+			}
+			if rt, ok := ct.Update(v); ok {
+				r.rates[v.Stat] = rt.Rate
+			}
+			r.gauge[v.Stat] = v.UintVal
+		}
+		if i%headerEvery == 0 {
+			header()
+		}
+		r.print(time.Now())
+	}
+}
@@ -0,0 +1,190 @@
+// goiostat prints iostat -x style extended device statistics from the
+// IO kstats, using ComputeDiskMetrics:
+//
+//	goiostat [-anz] [-T u|d] [interval [count]]
+//
+// As with iostat, the first report covers the time since each device
+// was attached (usually since boot) and later ones cover each
+// interval. Devices that appear or disappear between reports are
+// picked up or dropped.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/disk"
+)
+
+var (
+	all    = flag.Bool("a", false, "report on all IO kstats (partitions, NFS mounts, and so on), not just disks")
+	names  = flag.Bool("n", false, "show descriptive device names (c0t0d0, server:/path) instead of kstat names")
+	nozero = flag.Bool("z", false, "don't show devices that had no activity")
+	stamp  = flag.String("T", "", "print a timestamp before each report, as `u` (Unix time) or d (date(1) format)")
+)
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "goiostat: %s\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: goiostat [-anz] [-T u|d] [interval [count]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// ioSelectors returns selectors for the IO kstats that we report on.
+// It's redone whenever the kstat chain changes, so that we notice
+// devices coming and going.
+func ioSelectors(tok *kstat.Token) []kstat.Selector {
+	var sels []kstat.Selector
+	for _, k := range tok.AllSorted() {
+		if k.Type == kstat.IoStat && (*all || k.Class == "disk") {
+			sels = append(sels, kstat.Selector{Module: k.Module, Instance: k.Instance, Name: k.Name})
+		}
+	}
+	return sels
+}
+
+// sinceAttach returns a Snapshot of the IO kstats in snap as they
+// were when they were created, with all of their statistics zero, so
+// that the first report covers the time since then.
+func sinceAttach(snap *kstat.Snapshot) *kstat.Snapshot {
+	z := &kstat.Snapshot{Time: snap.Time}
+	for _, ki := range snap.KStats {
+		ki.Snaptime = ki.Crtime
+		z.KStats = append(z.KStats, ki)
+	}
+	for _, v := range snap.Values {
+		v.Snaptime = v.Crtime
+		v.IntVal, v.UintVal = 0, 0
+		z.Values = append(z.Values, v)
+	}
+	return z
+}
+
+// loadDevNames works out the names that iostat -n uses: the
+// descriptive names of disks (from disk.LoadNames) and of NFS mounts
+// (from /etc/mnttab). Whatever it can't work out keeps its kstat name.
+func loadDevNames() disk.Names {
+	dn, err := disk.LoadNames()
+	if err != nil {
+		dn = make(disk.Names)
+	}
+
+	// NFS kstat instances are the minor numbers of the mounts' dev=
+	// options, which are 32-bit device numbers.
+	if b, err := os.ReadFile("/etc/mnttab"); err == nil {
+		for _, l := range strings.Split(string(b), "\n") {
+			f := strings.Split(l, "\t")
+			if len(f) < 4 || f[2] != "nfs" {
+				continue
+			}
+			for _, o := range strings.Split(f[3], ",") {
+				if !strings.HasPrefix(o, "dev=") {
+					continue
+				}
+				if dev, err := strconv.ParseUint(o[4:], 16, 32); err == nil {
+					dn["nfs"+strconv.FormatUint(dev&0x3ffff, 10)] = f[0]
+				}
+			}
+		}
+	}
+	return dn
+}
+
+func report(w *bufio.Writer, dms []kstat.DiskMetrics, dn disk.Names) {
+	fmt.Fprintf(w, "%*s extended device statistics\n", 17, "")
+	fmt.Fprintf(w, "%-8s    r/s    w/s   kr/s   kw/s wait actv  svc_t  %%w  %%b\n", "device")
+	for _, dm := range dms {
+		if *nozero && dm.ReadsPerSec == 0 && dm.WritesPerSec == 0 {
+			continue
+		}
+		name := dn.Name(dm.KStat.Name)
+		fmt.Fprintf(w, "%-8s %6.1f %6.1f %6.1f %6.1f %4.1f %4.1f %6.1f %3.0f %3.0f\n",
+			name, dm.ReadsPerSec, dm.WritesPerSec, dm.KBReadPerSec, dm.KBWrittenPerSec,
+			dm.Wait, dm.Actv, dm.SvcT, dm.PctWait, dm.PctBusy)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *stamp != "" && *stamp != "u" && *stamp != "d" {
+		usage()
+	}
+	var interval time.Duration
+	count := 1
+	if flag.NArg() > 2 {
+		usage()
+	}
+	for i, a := range flag.Args() {
+		n, err := strconv.Atoi(a)
+		if err != nil || n <= 0 {
+			usage()
+		}
+		if i == 0 {
+			interval, count = time.Duration(n)*time.Second, 0
+		} else {
+			count = n
+		}
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+	var dn disk.Names
+	if *names {
+		dn = loadDevNames()
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	sels := ioSelectors(tok)
+	var prev *kstat.Snapshot
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+			changed, err := tok.Update()
+			if err != nil {
+				fatal(err)
+			}
+			if changed {
+				sels = ioSelectors(tok)
+				if *names {
+					dn = loadDevNames()
+				}
+			}
+		}
+		// With no IO kstats, a Snapshot with no selectors would
+		// have everything.
+		snap := &kstat.Snapshot{Time: time.Now()}
+		if len(sels) > 0 {
+			if snap, err = tok.Snapshot(sels...); err != nil {
+				fatal(err)
+			}
+		}
+		if prev == nil {
+			prev = sinceAttach(snap)
+		}
+		switch *stamp {
+		case "u":
+			fmt.Fprintf(w, "%d\n", snap.Time.Unix())
+		case "d":
+			fmt.Fprintf(w, "%s\n", snap.Time.Format(time.UnixDate))
+		}
+		report(w, kstat.ComputeDiskMetrics(prev, snap), dn)
+		if err := w.Flush(); err != nil {
+			fatal(err)
+		}
+		prev = snap
+	}
+}
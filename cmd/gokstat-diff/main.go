@@ -0,0 +1,203 @@
+// gokstat-diff prints the statistics that changed between two
+// Snapshots, with how much they changed by and their rate of change:
+//
+//	gokstat-diff [-a] [-s selectors] before [after]
+//	gokstat-diff [-a] [-s selectors] -w duration
+//	gokstat-diff [-s selectors] -save file
+//
+// before and after are files with either a recording (as written by
+// a Recorder or -save) or a JSON Snapshot. The first Snapshot of
+// before is compared with the last Snapshot of after, so a single
+// recording can be given as both to see what changed over all of it.
+// If after is left out, before is compared with a live Snapshot taken
+// now. -w takes a live Snapshot, waits, and takes another.
+//
+// -save records a live Snapshot to a file, for use as a before or
+// after later; for example, take one when an incident starts and
+// diff it against the system once it's over.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	all    = flag.Bool("a", false, "show all numeric statistics, not just the ones that changed")
+	selStr = flag.String("s", "", "only compare the comma-separated `selectors` (module:instance:name:statistic)")
+	wait   = flag.Duration("w", 0, "compare two live Snapshots taken `duration` apart")
+	saveTo = flag.String("save", "", "record a live Snapshot in `file` and exit")
+)
+
+// recMagic is how recordings start.
+const recMagic = "KSTATSNP"
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "gokstat-diff: %s\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gokstat-diff [-a] [-s selectors] before [after]\n")
+	fmt.Fprintf(os.Stderr, "       gokstat-diff [-a] [-s selectors] -w duration\n")
+	fmt.Fprintf(os.Stderr, "       gokstat-diff [-s selectors] -save file\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// load reads the first and last Snapshots in a file.
+func load(path string) (first, last *kstat.Snapshot, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(b, []byte(recMagic)) {
+		snap := &kstat.Snapshot{}
+		if err := json.Unmarshal(b, snap); err != nil {
+			return nil, nil, fmt.Errorf("%s: not a recording or a JSON Snapshot: %w", path, err)
+		}
+		return snap, snap, nil
+	}
+	sr := kstat.NewSnapshotReader(bytes.NewReader(b))
+	for {
+		snap, err := sr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if first == nil {
+			first = snap
+		}
+		last = snap
+	}
+	if first == nil {
+		return nil, nil, fmt.Errorf("%s: empty recording", path)
+	}
+	return first, last, nil
+}
+
+// live takes a live Snapshot.
+func live(tok *kstat.Token, sels []kstat.Selector) *kstat.Snapshot {
+	if tok == nil {
+		var err error
+		if tok, err = kstat.Open(); err != nil {
+			fatal(err)
+		}
+		defer tok.Close()
+	} else if _, err := tok.Update(); err != nil {
+		fatal(err)
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		fatal(err)
+	}
+	return snap
+}
+
+func number(v kstat.Value) string {
+	switch v.Type {
+	case kstat.Int32, kstat.Int64:
+		return fmt.Sprint(v.IntVal)
+	}
+	return fmt.Sprint(v.UintVal)
+}
+
+func report(w io.Writer, before, after *kstat.Snapshot) {
+	d := after.Diff(before)
+	fmt.Fprintf(w, "%s to %s (%s)\n", before.Time.Format(time.RFC3339), after.Time.Format(time.RFC3339), d.Elapsed)
+	for _, ki := range d.Disappeared {
+		fmt.Fprintf(w, "- %s\n", ki)
+	}
+	for _, ki := range d.Appeared {
+		fmt.Fprintf(w, "+ %s\n", ki)
+	}
+	stats := d.Stats
+	if !*all {
+		stats = d.Changed()
+	}
+	for _, sd := range stats {
+		rate := ""
+		if sd.Elapsed > 0 {
+			rate = fmt.Sprintf("%.6g/s", sd.Rate)
+		}
+		fmt.Fprintf(w, "%-50s %20s -> %-20s %+.6g %s\n", sd.Value.String(), number(sd.Prev), number(sd.Value), sd.Delta, rate)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	var sels []kstat.Selector
+	if *selStr != "" {
+		var err error
+		if sels, err = kstat.ParseSelectors(strings.Split(*selStr, ",")); err != nil {
+			fatal(err)
+		}
+	}
+
+	var before, after *kstat.Snapshot
+	switch {
+	case *saveTo != "":
+		if flag.NArg() != 0 || *wait != 0 {
+			usage()
+		}
+		rec, err := kstat.CreateRecording(*saveTo)
+		if err != nil {
+			fatal(err)
+		}
+		if err := rec.Record(live(nil, sels)); err != nil {
+			fatal(err)
+		}
+		if err := rec.Close(); err != nil {
+			fatal(err)
+		}
+		return
+	case *wait > 0:
+		if flag.NArg() != 0 {
+			usage()
+		}
+		tok, err := kstat.Open()
+		if err != nil {
+			fatal(err)
+		}
+		defer tok.Close()
+		before = live(tok, sels)
+		time.Sleep(*wait)
+		after = live(tok, sels)
+	case flag.NArg() == 1 || flag.NArg() == 2:
+		var err error
+		if before, after, err = load(flag.Arg(0)); err != nil {
+			fatal(err)
+		}
+		if flag.NArg() == 2 {
+			if _, after, err = load(flag.Arg(1)); err != nil {
+				fatal(err)
+			}
+		} else {
+			after = live(nil, sels)
+		}
+		if len(sels) > 0 {
+			before, after = before.Select(sels...), after.Select(sels...)
+		}
+	default:
+		usage()
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	report(w, before, after)
+	if err := w.Flush(); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,91 @@
+// gokstat-record records a timed stream of Snapshots of selected
+// kstats to a file, to be analyzed later (possibly on another
+// machine) with gokstat-replay or anything that reads recordings:
+//
+//	gokstat-record -o file [-i interval] [-c count] [-d duration] [module:instance:name:statistic ...]
+//
+// Without selectors, everything is recorded, which makes for large
+// recordings. Recording stops after count Snapshots, after duration,
+// or on SIGINT or SIGTERM, and the recording is always left complete.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	outFile  = flag.String("o", "", "write the recording to `file` (required)")
+	interval = flag.Duration("i", 10*time.Second, "take a Snapshot every `interval`")
+	count    = flag.Int("c", 0, "stop after `count` Snapshots (0 for no limit)")
+	duration = flag.Duration("d", 0, "stop after `duration` (0 for no limit)")
+	coherent = flag.Bool("coherent", false, "take coherent Snapshots (see Sampler.SetCoherent)")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gokstat-record -o file [flags] [module:instance:name:statistic ...]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "gokstat-record: %s\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *outFile == "" || *interval <= 0 || *count < 0 || *duration < 0 {
+		usage()
+	}
+	sels, err := kstat.ParseSelectors(flag.Args())
+	if err != nil {
+		fatal(err)
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+	rec, err := kstat.CreateRecording(*outFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	s := kstat.NewSampler(tok, *interval, sels...)
+	s.SetCoherent(*coherent)
+	s.AddSink(rec)
+	n := 0
+	err = s.RunContext(ctx, func(sm *kstat.Sample) {
+		for _, e := range sm.Errors {
+			fmt.Fprintf(os.Stderr, "gokstat-record: %s\n", e)
+		}
+		n++
+		if n == *count {
+			s.Stop()
+		}
+	})
+	if cerr := rec.Close(); cerr != nil {
+		fatal(cerr)
+	}
+	if err != nil && ctx.Err() == nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "gokstat-record: recorded %d Snapshots in %s\n", n, *outFile)
+}
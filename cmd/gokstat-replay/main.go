@@ -0,0 +1,114 @@
+// gokstat-replay plays back a recording made by gokstat-record (or
+// any Recorder) through one of the output formats:
+//
+//	gokstat-replay [-f format] [-rates] [-speed x] [-T u|d] [-s selectors] file
+//
+// The formats are text (the default output of kstat), p (kstat -p),
+// json (a JSON Snapshot per line), and csv (a row per Snapshot, with
+// per-second rates instead of values if -rates is given). By default
+// the recording is played back as fast as possible; -speed 1 plays it
+// back with its original timing, -speed 2 twice as fast, and so on.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	format = flag.String("f", "text", "the output `format`: text, p, json, or csv")
+	rates  = flag.Bool("rates", false, "with -f csv, write per-second rates instead of values")
+	speed  = flag.Float64("speed", 0, "play back at `x` times the original speed (0 for as fast as possible)")
+	stamp  = flag.String("T", "", "with -f text or p, print each Snapshot's time first, as `u` (Unix time) or d (date(1) format)")
+	selStr = flag.String("s", "", "only replay the comma-separated `selectors` (module:instance:name:statistic)")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gokstat-replay [-f format] [-rates] [-speed x] [-T u|d] [-s selectors] file\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "gokstat-replay: %s\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || (*stamp != "" && *stamp != "u" && *stamp != "d") {
+		usage()
+	}
+	var sels []kstat.Selector
+	if *selStr != "" {
+		var err error
+		if sels, err = kstat.ParseSelectors(strings.Split(*selStr, ",")); err != nil {
+			fatal(err)
+		}
+	}
+
+	rp, err := kstat.OpenRecording(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	defer rp.Close()
+	rp.SetSpeed(*speed)
+
+	w := bufio.NewWriter(os.Stdout)
+	var write func(sm *kstat.Sample) error
+	switch *format {
+	case "text", "p":
+		write = func(sm *kstat.Sample) error {
+			switch *stamp {
+			case "u":
+				fmt.Fprintf(w, "%d\n", sm.Time.Unix())
+			case "d":
+				fmt.Fprintf(w, "%s\n", sm.Time.Format(time.UnixDate))
+			}
+			if *format == "p" {
+				return sm.Snapshot.WriteParseable(w)
+			}
+			return sm.Snapshot.WriteText(w)
+		}
+	case "json":
+		enc := json.NewEncoder(w)
+		write = func(sm *kstat.Sample) error {
+			return enc.Encode(&sm.Snapshot)
+		}
+	case "csv":
+		cw := kstat.NewCSVWriter(w, sels...)
+		cw.SetRates(*rates)
+		write = cw.Write
+	default:
+		usage()
+	}
+
+	var werr error
+	err = rp.Run(func(sm *kstat.Sample) {
+		if len(sels) > 0 {
+			sm.Snapshot = *sm.Snapshot.Select(sels...)
+		}
+		if werr = write(sm); werr == nil {
+			// Flush as we go, so that slow playback shows up
+			// as it happens.
+			werr = w.Flush()
+		}
+		if werr != nil {
+			rp.Stop()
+		}
+	})
+	if err == nil {
+		err = werr
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,475 @@
+// gokstat-top is an interactive, full screen browser for kstats, for
+// when you don't know the exact module:instance:name you need:
+//
+//	gokstat-top [-i interval]
+//
+// It starts with a list of modules. Pick one to see its instances,
+// pick an instance to see its kstats, and pick a kstat to watch its
+// statistics update live, along with their rates of change. Any
+// statistic can be marked to be watched, and the watch list shows all
+// of the marked statistics together, wherever they came from.
+//
+// Keys:
+//
+//	up/down, k/j        move
+//	pgup/pgdn           move a screen at a time
+//	enter, right, l     open the module, instance, or kstat
+//	left, h, backspace  go back up
+//	/                   filter the list (type to narrow it, enter to
+//	                    keep the filter, esc to clear it)
+//	r                   sort statistics by rate instead of name
+//	space               mark or unmark a statistic for watching
+//	w                   show the watch list
+//	q                   quit
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"golang.org/x/term"
+)
+
+var interval = flag.Duration("i", time.Second, "how often to update the statistics")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gokstat-top [-i interval]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// level is where in the module, instance, name, statistic hierarchy
+// the browser is.
+type level int
+
+const (
+	modules level = iota
+	instances
+	names
+	stats
+	watching
+)
+
+// row is an entry in the list on the screen. key is what filtering
+// matches against and what's opened or marked.
+type row struct {
+	key  string
+	text string
+	rate float64
+}
+
+type browser struct {
+	tok *kstat.Token
+	lvl level
+
+	module   string
+	instance int
+	name     string
+
+	cursor, top int
+	filter      string
+	filtering   bool
+	byRate      bool
+
+	ct      *kstat.CounterTracker
+	vals    []kstat.Value
+	rates   map[string]float64
+	watched map[string]kstat.Selector
+	err     error
+
+	width, height int
+}
+
+func newBrowser(tok *kstat.Token) *browser {
+	return &browser{
+		tok:     tok,
+		ct:      kstat.NewCounterTracker(),
+		rates:   make(map[string]float64),
+		watched: make(map[string]kstat.Selector),
+	}
+}
+
+// refresh rereads the kstat chain and the statistics being shown.
+func (b *browser) refresh() {
+	b.err = nil
+	if _, err := b.tok.Update(); err != nil {
+		b.err = err
+		return
+	}
+	switch b.lvl {
+	case stats:
+		ks, err := b.tok.Lookup(b.module, b.instance, b.name)
+		if err == nil {
+			err = ks.Refresh()
+		}
+		if err == nil {
+			b.vals, err = ks.Values()
+		}
+		if err != nil {
+			b.vals, b.err = nil, err
+		}
+	case watching:
+		var sels []kstat.Selector
+		for _, sel := range b.watched {
+			sels = append(sels, sel)
+		}
+		b.vals = nil
+		if len(sels) > 0 {
+			snap, err := b.tok.Snapshot(sels...)
+			if err != nil {
+				b.err = err
+				return
+			}
+			b.vals = snap.Values
+		}
+	default:
+		return
+	}
+	for _, v := range b.vals {
+		if r, ok := b.ct.Update(v); ok {
+			b.rates[v.String()] = r.Rate
+		}
+	}
+}
+
+// rows returns the filtered list for the current level.
+func (b *browser) rows() []row {
+	var rs []row
+	tr := b.tok.Tree()
+	switch b.lvl {
+	case modules:
+		for _, m := range tr.Modules() {
+			rs = append(rs, row{key: m, text: m})
+		}
+	case instances:
+		for _, i := range tr.Instances(b.module) {
+			s := strconv.Itoa(i)
+			rs = append(rs, row{key: s, text: s})
+		}
+	case names:
+		for _, n := range tr.Names(b.module, b.instance) {
+			text := n
+			if ks := tr.Get(b.module, b.instance, n); ks != nil {
+				text = fmt.Sprintf("%-40s %-12s %s", n, ks.Class, ks.Type)
+			}
+			rs = append(rs, row{key: n, text: text})
+		}
+	case stats, watching:
+		for _, v := range b.vals {
+			key, label := v.String(), v.Stat
+			if b.lvl == watching {
+				label = key
+			}
+			mark := " "
+			if _, ok := b.watched[key]; ok {
+				mark = "*"
+			}
+			val := v.StringVal
+			switch v.Type {
+			case kstat.Int32, kstat.Int64:
+				val = strconv.FormatInt(v.IntVal, 10)
+			case kstat.Uint32, kstat.Uint64:
+				val = strconv.FormatUint(v.UintVal, 10)
+			}
+			rate, ok := b.rates[key]
+			rtext := ""
+			if ok {
+				rtext = fmt.Sprintf("%.6g/s", rate)
+			}
+			rs = append(rs, row{key: key, text: fmt.Sprintf("%s %-40s %20s %16s", mark, label, val, rtext), rate: rate})
+		}
+		if b.byRate {
+			sort.SliceStable(rs, func(i, j int) bool { return abs(rs[i].rate) > abs(rs[j].rate) })
+		}
+	}
+	if b.filter == "" {
+		return rs
+	}
+	var frs []row
+	for _, r := range rs {
+		if strings.Contains(r.key, b.filter) {
+			frs = append(frs, r)
+		}
+	}
+	return frs
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// title describes where the browser is.
+func (b *browser) title() string {
+	switch b.lvl {
+	case instances:
+		return b.module + ":*"
+	case names:
+		return fmt.Sprintf("%s:%d:*", b.module, b.instance)
+	case stats:
+		return fmt.Sprintf("%s:%d:%s", b.module, b.instance, b.name)
+	case watching:
+		return "watch list"
+	}
+	return "modules"
+}
+
+func (b *browser) draw(w *bufio.Writer) {
+	rs := b.rows()
+	if b.cursor >= len(rs) {
+		b.cursor = len(rs) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	page := b.height - 3
+	if page < 1 {
+		page = 1
+	}
+	if b.cursor < b.top {
+		b.top = b.cursor
+	}
+	if b.cursor >= b.top+page {
+		b.top = b.cursor - page + 1
+	}
+
+	w.WriteString("\x1b[H\x1b[2J")
+	order := "name"
+	if b.byRate {
+		order = "rate"
+	}
+	b.line(w, fmt.Sprintf("gokstat-top: %s  (%d, sorted by %s)", b.title(), len(rs), order), true)
+	for i := b.top; i < len(rs) && i < b.top+page; i++ {
+		b.line(w, rs[i].text, i == b.cursor)
+	}
+	for i := len(rs) - b.top; i < page; i++ {
+		w.WriteString("\r\n")
+	}
+	status := "enter open  h back  / filter  r sort  space mark  w watch  q quit"
+	switch {
+	case b.filtering:
+		status = "filter: " + b.filter + "_"
+	case b.err != nil:
+		status = "error: " + b.err.Error()
+	case b.filter != "":
+		status = "filter: " + b.filter + "  (esc clears)"
+	}
+	b.line(w, status, false)
+	w.Flush()
+}
+
+// line writes a line cut to the screen width, in reverse video if
+// it's highlighted.
+func (b *browser) line(w *bufio.Writer, s string, hl bool) {
+	if len(s) > b.width {
+		s = s[:b.width]
+	}
+	if hl {
+		w.WriteString("\x1b[7m" + s + "\x1b[0m\r\n")
+	} else {
+		w.WriteString(s + "\r\n")
+	}
+}
+
+// enter opens the row under the cursor.
+func (b *browser) enter() {
+	rs := b.rows()
+	if b.cursor >= len(rs) {
+		return
+	}
+	key := rs[b.cursor].key
+	switch b.lvl {
+	case modules:
+		b.module, b.lvl = key, instances
+	case instances:
+		b.instance, _ = strconv.Atoi(key)
+		b.lvl = names
+	case names:
+		b.name, b.lvl = key, stats
+	default:
+		return
+	}
+	b.cursor, b.top, b.filter = 0, 0, ""
+	b.refresh()
+}
+
+// back goes up a level.
+func (b *browser) back() {
+	switch b.lvl {
+	case instances:
+		b.lvl = modules
+	case names:
+		b.lvl = instances
+	case stats:
+		b.lvl = names
+	case watching:
+		b.lvl = modules
+		if b.name != "" {
+			b.lvl = stats
+		}
+	default:
+		return
+	}
+	b.cursor, b.top, b.filter = 0, 0, ""
+	b.refresh()
+}
+
+// mark marks or unmarks the statistic under the cursor.
+func (b *browser) mark() {
+	if b.lvl != stats && b.lvl != watching {
+		return
+	}
+	rs := b.rows()
+	if b.cursor >= len(rs) {
+		return
+	}
+	key := rs[b.cursor].key
+	if _, ok := b.watched[key]; ok {
+		delete(b.watched, key)
+		return
+	}
+	for _, v := range b.vals {
+		if v.String() == key {
+			b.watched[key] = kstat.Selector{Module: v.Module, Instance: v.Instance, Name: v.Name, Stat: v.Stat}
+		}
+	}
+}
+
+// key handles a keypress and returns false to quit.
+func (b *browser) key(k string) bool {
+	if b.filtering {
+		switch k {
+		case "\r", "\n":
+			b.filtering = false
+		case "\x1b":
+			b.filtering, b.filter = false, ""
+		case "\x7f", "\b":
+			if b.filter != "" {
+				b.filter = b.filter[:len(b.filter)-1]
+			}
+		default:
+			if len(k) == 1 && k[0] >= ' ' && k[0] < 0x7f {
+				b.filter += k
+				b.cursor, b.top = 0, 0
+			}
+		}
+		return true
+	}
+	page := b.height - 3
+	switch k {
+	case "q", "\x03":
+		return false
+	case "k", "\x1b[A":
+		b.cursor--
+	case "j", "\x1b[B":
+		b.cursor++
+	case "\x1b[5~":
+		b.cursor -= page
+	case "\x1b[6~":
+		b.cursor += page
+	case "\r", "\n", "l", "\x1b[C":
+		b.enter()
+	case "h", "\x7f", "\b", "\x1b[D":
+		b.back()
+	case "\x1b":
+		b.filter = ""
+	case "/":
+		b.filtering, b.filter = true, ""
+	case "r":
+		b.byRate = !b.byRate
+	case " ":
+		b.mark()
+	case "w":
+		b.lvl, b.cursor, b.top, b.filter = watching, 0, 0, ""
+		b.refresh()
+	}
+	return true
+}
+
+// readKeys sends each keypress (or escape sequence) read from the
+// terminal.
+func readKeys(ch chan<- string) {
+	buf := make([]byte, 32)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(ch)
+			return
+		}
+		s := string(buf[:n])
+		for s != "" {
+			l := 1
+			if strings.HasPrefix(s, "\x1b[") && len(s) > 2 {
+				l = 3
+				if i := strings.IndexByte(s, '~'); i > 0 && s[2] >= '0' && s[2] <= '9' {
+					l = i + 1
+				}
+			}
+			ch <- s[:l]
+			s = s[l:]
+		}
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 || *interval <= 0 {
+		usage()
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "gokstat-top: standard input is not a terminal\n")
+		os.Exit(1)
+	}
+	tok, err := kstat.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gokstat-top: %s\n", err)
+		os.Exit(1)
+	}
+	defer tok.Close()
+
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gokstat-top: %s\n", err)
+		os.Exit(1)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	// Use the alternate screen and hide the cursor while we run.
+	w.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		w.WriteString("\x1b[?25h\x1b[?1049l")
+		w.Flush()
+		term.Restore(fd, old)
+	}()
+
+	b := newBrowser(tok)
+	keys := make(chan string)
+	go readKeys(keys)
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		b.width, b.height, err = term.GetSize(fd)
+		if err != nil {
+			b.width, b.height = 80, 24
+		}
+		b.draw(w)
+		select {
+		case k, ok := <-keys:
+			if !ok || !b.key(k) {
+				return
+			}
+		case <-tick.C:
+			b.refresh()
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// gokstat is a clone of kstat(1) built on this package. It takes the
+// same options and operands and writes the same output formats:
+//
+//	gokstat [-Cjlpq] [-T u|d] [-c class] [-m module] [-i instance]
+//		[-n name] [-s statistic] [module:instance:name:statistic ...]
+//		[interval [count]]
+//
+// Module, name, statistic, and class are shell glob patterns; unlike
+// kstat(1), /regexp/ patterns are not supported. The exit status is
+// 0 if any statistics matched, 1 if none did, 2 for bad usage, and 3
+// for any other error.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	colons    = flag.Bool("C", false, "parseable output with a colon before the value instead of a tab")
+	jsonOut   = flag.Bool("j", false, "JSON output in the format of kstat -j")
+	list      = flag.Bool("l", false, "list the matching statistic names without values")
+	parseable = flag.Bool("p", false, "parseable output, one module:instance:name:statistic and value per line")
+	quiet     = flag.Bool("q", false, "no output; just set the exit status")
+	stamp     = flag.String("T", "", "print a timestamp before each report, as `u` (Unix time) or d (date(1) format)")
+	class     = flag.String("c", "", "only show kstats of `class`")
+	module    = flag.String("m", "", "only show kstats of `module`")
+	instance  = flag.Int("i", -1, "only show kstats of `instance`")
+	name      = flag.String("n", "", "only show kstats called `name`")
+	statistic = flag.String("s", "", "only show statistics called `statistic`")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gokstat [-Cjlpq] [-T u|d] [-c class] [-m module] [-i instance]\n")
+	fmt.Fprintf(os.Stderr, "\t[-n name] [-s statistic] [module:instance:name:statistic ...]\n")
+	fmt.Fprintf(os.Stderr, "\t[interval [count]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func warn(err error) {
+	fmt.Fprintf(os.Stderr, "gokstat: %s\n", err)
+}
+
+func fatal(err error) {
+	warn(err)
+	os.Exit(3)
+}
+
+// parseArgs splits the operands into selectors and the interval and
+// count, which are the trailing operands that are numbers.
+func parseArgs(args []string) ([]kstat.Selector, time.Duration, int) {
+	var nums []int
+	for len(args) > 0 && len(nums) < 2 {
+		n, err := strconv.Atoi(args[len(args)-1])
+		if err != nil {
+			break
+		}
+		if n <= 0 {
+			fmt.Fprintf(os.Stderr, "gokstat: interval and count must be positive\n")
+			usage()
+		}
+		nums = append([]int{n}, nums...)
+		args = args[:len(args)-1]
+	}
+	var interval time.Duration
+	count := 1
+	switch len(nums) {
+	case 1:
+		interval, count = time.Duration(nums[0])*time.Second, 0
+	case 2:
+		interval, count = time.Duration(nums[0])*time.Second, nums[1]
+	}
+
+	flagSel := *module != "" || *instance >= 0 || *name != "" || *statistic != ""
+	if flagSel && len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "gokstat: -m, -i, -n, and -s can't be used with module:instance:name:statistic operands\n")
+		usage()
+	}
+	if flagSel {
+		return []kstat.Selector{{Module: *module, Instance: *instance, Name: *name, Stat: *statistic}}, interval, count
+	}
+	sels, err := kstat.ParseSelectors(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gokstat: %s\n", err)
+		usage()
+	}
+	return sels, interval, count
+}
+
+// statOK reports whether a statistic of a kstat is selected. kstat(1)
+// applies the statistic pattern to the pseudo-statistics too, so
+// 'kstat -p cpu:0:sys:syscall' doesn't print cpu:0:sys:class.
+func statOK(sels []kstat.Selector, ki kstat.KStatInfo, stat string) bool {
+	if len(sels) == 0 {
+		return true
+	}
+	for _, sel := range sels {
+		if sel.MatchKStat(ki.Module, ki.Instance, ki.Name) && sel.MatchStat(stat) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonKStat is a kstat in the format of kstat -j.
+type jsonKStat struct {
+	Module   string                     `json:"module"`
+	Instance int                        `json:"instance"`
+	Name     string                     `json:"name"`
+	Class    string                     `json:"class"`
+	Type     int                        `json:"type"`
+	Snaptime json.Number                `json:"snaptime"`
+	Data     map[string]json.RawMessage `json:"data"`
+}
+
+func hrtime(t int64) json.Number {
+	return json.Number(fmt.Sprintf("%d.%09d", t/1e9, t%1e9))
+}
+
+func jsonValue(v kstat.Value) json.RawMessage {
+	switch v.Type {
+	case kstat.Int32, kstat.Int64:
+		return json.RawMessage(strconv.FormatInt(v.IntVal, 10))
+	case kstat.Uint32, kstat.Uint64:
+		return json.RawMessage(strconv.FormatUint(v.UintVal, 10))
+	}
+	b, _ := json.Marshal(v.StringVal)
+	return b
+}
+
+// filterLines copies lines from src to w, dropping the lines of the
+// pseudo-statistics that aren't selected. isPseudo returns the name
+// of the pseudo-statistic on a line, if it's one.
+func filterLines(w io.Writer, src []byte, keep func(string) bool, isPseudo func(string) (string, bool)) {
+	for _, l := range strings.SplitAfter(string(src), "\n") {
+		if stat, ok := isPseudo(l); ok && !keep(stat) {
+			continue
+		}
+		io.WriteString(w, l)
+	}
+}
+
+// report writes the selected part of a Snapshot in the chosen format
+// and returns whether anything matched.
+func report(w io.Writer, snap *kstat.Snapshot, sels []kstat.Selector) (bool, error) {
+	vals := make(map[string][]kstat.Value)
+	for _, v := range snap.Values {
+		k := fmt.Sprintf("%s:%d:%s", v.Module, v.Instance, v.Name)
+		vals[k] = append(vals[k], v)
+	}
+	pseudo := []string{"crtime", "snaptime"}
+	if *parseable || *colons || *list {
+		pseudo = append(pseudo, "class")
+	}
+
+	matched := false
+	var jks []jsonKStat
+	for _, ki := range snap.KStats {
+		if *class != "" {
+			if ok, _ := path.Match(*class, ki.Class); !ok {
+				continue
+			}
+		}
+		keep := func(stat string) bool { return statOK(sels, ki, stat) }
+		prefix := fmt.Sprintf("%s:%d:%s", ki.Module, ki.Instance, ki.Name)
+		kvals := vals[prefix]
+		var pseudos []string
+		for _, p := range pseudo {
+			if keep(p) {
+				pseudos = append(pseudos, p)
+			}
+		}
+		if len(kvals) == 0 && len(pseudos) == 0 {
+			continue
+		}
+		matched = true
+		if *quiet {
+			continue
+		}
+
+		one := &kstat.Snapshot{Time: snap.Time, KStats: []kstat.KStatInfo{ki}, Values: kvals}
+		var b bytes.Buffer
+		switch {
+		case *jsonOut:
+			jk := jsonKStat{Module: ki.Module, Instance: ki.Instance, Name: ki.Name, Class: ki.Class,
+				Type: int(ki.Type), Snaptime: hrtime(ki.Snaptime), Data: make(map[string]json.RawMessage)}
+			if keep("crtime") {
+				jk.Data["crtime"] = json.RawMessage(hrtime(ki.Crtime))
+			}
+			if keep("snaptime") {
+				jk.Data["snaptime"] = json.RawMessage(hrtime(ki.Snaptime))
+			}
+			for _, v := range kvals {
+				jk.Data[v.Stat] = jsonValue(v)
+			}
+			jks = append(jks, jk)
+			continue
+		case *parseable || *colons || *list:
+			if err := one.WriteParseable(&b); err != nil {
+				return matched, err
+			}
+			var out bytes.Buffer
+			filterLines(&out, b.Bytes(), keep, func(l string) (string, bool) {
+				for _, p := range pseudo {
+					if strings.HasPrefix(l, prefix+":"+p+"\t") {
+						return p, true
+					}
+				}
+				return "", false
+			})
+			for _, l := range strings.SplitAfter(out.String(), "\n") {
+				switch {
+				case l == "":
+				case *list:
+					l = l[:strings.IndexByte(l, '\t')] + "\n"
+				case *colons:
+					l = strings.Replace(l, "\t", ":", 1)
+				}
+				if _, err := io.WriteString(w, l); err != nil {
+					return matched, err
+				}
+			}
+		default:
+			if err := one.WriteText(&b); err != nil {
+				return matched, err
+			}
+			filterLines(w, b.Bytes(), keep, func(l string) (string, bool) {
+				for _, p := range pseudo {
+					if strings.HasPrefix(l, fmt.Sprintf("\t%-30s  ", p)) {
+						return p, true
+					}
+				}
+				return "", false
+			})
+		}
+	}
+	if *jsonOut && !*quiet {
+		if jks == nil {
+			jks = []jsonKStat{}
+		}
+		b, err := json.MarshalIndent(jks, "", "\t")
+		if err != nil {
+			return matched, err
+		}
+		if _, err = w.Write(append(b, '\n')); err != nil {
+			return matched, err
+		}
+	}
+	return matched, nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *stamp != "" && *stamp != "u" && *stamp != "d" {
+		usage()
+	}
+	sels, interval, count := parseArgs(flag.Args())
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	matched := false
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+			if _, err := tok.Update(); err != nil {
+				fatal(err)
+			}
+		}
+		snap, err := tok.Snapshot(sels...)
+		if kerrs, ok := err.(kstat.KStatErrors); ok {
+			// Like kstat(1), report what we can.
+			for _, e := range kerrs {
+				warn(e)
+			}
+		} else if err != nil {
+			fatal(err)
+		}
+		switch {
+		case *quiet:
+		case *stamp == "u":
+			fmt.Fprintf(w, "%d\n", snap.Time.Unix())
+		case *stamp == "d":
+			fmt.Fprintf(w, "%s\n", snap.Time.Format(time.UnixDate))
+		}
+		m, err := report(w, snap, sels)
+		if err != nil {
+			fatal(err)
+		}
+		matched = matched || m
+		if err := w.Flush(); err != nil {
+			fatal(err)
+		}
+	}
+	if !matched {
+		os.Exit(1)
+	}
+}
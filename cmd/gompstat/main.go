@@ -0,0 +1,175 @@
+// gompstat prints mpstat style per-CPU statistics from the cpu:N:sys
+// and cpu:N:vm kstats, using ComputeCPUMetrics:
+//
+//	gompstat [-T u|d] [interval [count]]
+//
+// As with mpstat, the first report covers the time since boot (or
+// since each CPU came online) and later ones cover each interval.
+// Only CPUs that are online are shown. When CPUs go offline or come
+// online, the report says so with a "<<State change>>" line; CPUs that
+// have come online are reported on from the time that they did.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var stamp = flag.String("T", "", "print a timestamp before each report, as `u` (Unix time) or d (date(1) format)")
+
+// sels selects each CPU's kstats. Since they're patterns, CPUs that
+// are added or removed are handled by just taking another Snapshot.
+var sels = []kstat.Selector{
+	{Module: "cpu", Instance: -1, Name: "sys"},
+	{Module: "cpu", Instance: -1, Name: "vm"},
+	{Module: "cpu_info", Instance: -1, Stat: "state"},
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "gompstat: %s\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gompstat [-T u|d] [interval [count]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// online returns the CPUs that are online (which includes CPUs that
+// are running but not taking interrupts) in a Snapshot.
+func online(snap *kstat.Snapshot) map[int]bool {
+	cpus := make(map[int]bool)
+	for _, v := range snap.Values {
+		if v.Module == "cpu_info" && v.Stat == "state" && (v.StringVal == "on-line" || v.StringVal == "no-intr") {
+			cpus[v.Instance] = true
+		}
+	}
+	return cpus
+}
+
+// withNew returns prev plus the cpu kstats in cur that aren't in prev
+// (because they're new, or have been recreated), as they were when
+// they were created with all of their statistics zero. For the first
+// report, prev is empty and this covers everything since boot.
+func withNew(prev, cur *kstat.Snapshot) *kstat.Snapshot {
+	type key struct {
+		inst   int
+		name   string
+		crtime int64
+	}
+	have := make(map[key]bool)
+	for _, ki := range prev.KStats {
+		have[key{ki.Instance, ki.Name, ki.Crtime}] = true
+	}
+	nsnap := &kstat.Snapshot{Time: prev.Time}
+	nsnap.KStats = append(nsnap.KStats, prev.KStats...)
+	nsnap.Values = append(nsnap.Values, prev.Values...)
+	for _, ki := range cur.KStats {
+		if ki.Module == "cpu" && !have[key{ki.Instance, ki.Name, ki.Crtime}] {
+			ki.Snaptime = ki.Crtime
+			nsnap.KStats = append(nsnap.KStats, ki)
+		}
+	}
+	for _, v := range cur.Values {
+		if v.Module == "cpu" && !have[key{v.Instance, v.Name, v.Crtime}] {
+			v.Snaptime = v.Crtime
+			v.IntVal, v.UintVal = 0, 0
+			nsnap.Values = append(nsnap.Values, v)
+		}
+	}
+	return nsnap
+}
+
+func report(w *bufio.Writer, cms []kstat.CPUMetrics, cpus map[int]bool) {
+	fmt.Fprintf(w, "CPU minf mjf xcal  intr ithr  csw icsw migr smtx  srw syscl  usr sys  wt idl\n")
+	for _, cm := range cms {
+		if !cpus[cm.CPU] {
+			continue
+		}
+		fmt.Fprintf(w, "%3d %4.0f %3.0f %4.0f %5.0f %4.0f %4.0f %4.0f %4.0f %4.0f %4.0f %5.0f %4.0f %3.0f %3d %3.0f\n",
+			cm.CPU, cm.MinorFaults, cm.MajorFaults, cm.Xcalls, cm.Interrupts, cm.IntrThreads,
+			cm.CtxSwitches, cm.InvSwitches, cm.Migrations, cm.MutexSpins, cm.RWFails, cm.Syscalls,
+			cm.PctUser, cm.PctSystem, 0, cm.PctIdle)
+	}
+}
+
+func sameCPUs(a, b map[int]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for c := range a {
+		if !b[c] {
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *stamp != "" && *stamp != "u" && *stamp != "d" {
+		usage()
+	}
+	var interval time.Duration
+	count := 1
+	if flag.NArg() > 2 {
+		usage()
+	}
+	for i, a := range flag.Args() {
+		n, err := strconv.Atoi(a)
+		if err != nil || n <= 0 {
+			usage()
+		}
+		if i == 0 {
+			interval, count = time.Duration(n)*time.Second, 0
+		} else {
+			count = n
+		}
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	prev := &kstat.Snapshot{}
+	var prevCPUs map[int]bool
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+			// Update notices CPUs being added or removed.
+			if _, err := tok.Update(); err != nil {
+				fatal(err)
+			}
+		}
+		snap, err := tok.Snapshot(sels...)
+		if err != nil {
+			fatal(err)
+		}
+		cpus := online(snap)
+		if prevCPUs != nil && !sameCPUs(prevCPUs, cpus) {
+			fmt.Fprintf(w, "<<State change>>\n")
+		}
+		switch *stamp {
+		case "u":
+			fmt.Fprintf(w, "%d\n", snap.Time.Unix())
+		case "d":
+			fmt.Fprintf(w, "%s\n", snap.Time.Format(time.UnixDate))
+		}
+		report(w, kstat.ComputeCPUMetrics(withNew(prev, snap), snap), cpus)
+		if err := w.Flush(); err != nil {
+			fatal(err)
+		}
+		prev, prevCPUs = snap, cpus
+	}
+}
@@ -0,0 +1,187 @@
+// gonicstat prints nicstat style reports of network link activity
+// from the link:0:* kstats:
+//
+//	gonicstat [-i link,...] [-z zone] [interval [count]]
+//
+// For each link it shows kilobytes and packets read and written per
+// second, the average packet sizes, the link's utilization, its
+// saturation (packets per second dropped for lack of buffers), and
+// errors per second. The first report covers the time since each
+// link's kstat was created and the rest cover each interval.
+//
+// In the global zone, the links of other zones have kstats named
+// zone/link; -z shows only one zone's links (-z global shows the
+// global zone's own links).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	links = flag.String("i", "", "only show the comma-separated `links`")
+	zone  = flag.String("z", "", "only show the links of `zone`")
+)
+
+var sel = kstat.Selector{Module: "link", Instance: 0}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "gonicstat: %s\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gonicstat [-i link,...] [-z zone] [interval [count]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// wanted reports whether a link kstat is one that we show.
+func wanted(name string) bool {
+	lz, link := "global", name
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		lz, link = name[:i], name[i+1:]
+	}
+	if *zone != "" && lz != *zone {
+		return false
+	}
+	if *links == "" {
+		return true
+	}
+	for _, l := range strings.Split(*links, ",") {
+		if l == link || l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// linkStats is one link's statistics for one report: the rates of its
+// counters and its current ifspeed and link_duplex.
+type linkStats struct {
+	rates  map[string]float64
+	speed  uint64
+	duplex uint64
+}
+
+func (ls *linkStats) sum(stats ...string) float64 {
+	t := 0.0
+	for _, s := range stats {
+		t += ls.rates[s]
+	}
+	return t
+}
+
+func avg(n, d float64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func printLink(t time.Time, name string, ls *linkStats) {
+	rb, wb := ls.sum("rbytes64"), ls.sum("obytes64")
+	rp, wp := ls.sum("ipackets64"), ls.sum("opackets64")
+	// ifspeed is in bits per second. On a half duplex link (a
+	// link_duplex of 1), reads and writes share the bandwidth.
+	util := 0.0
+	if ls.speed > 0 {
+		bits := rb
+		if wb > bits {
+			bits = wb
+		}
+		if ls.duplex == 1 {
+			bits = rb + wb
+		}
+		util = bits * 8 * 100 / float64(ls.speed)
+		if util > 100 {
+			util = 100
+		}
+	}
+	fmt.Printf("%8s %8s %7.2f %7.2f %7.2f %7.2f %7.2f %7.2f %5.2f %6.2f %6.2f\n",
+		t.Format("15:04:05"), name, rb/1024, wb/1024, rp, wp, avg(rb, rp), avg(wb, wp),
+		util, ls.sum("norcvbuf", "noxmtbuf"), ls.sum("ierrors", "oerrors"))
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	var interval time.Duration
+	count := 1
+	if flag.NArg() > 2 {
+		usage()
+	}
+	for i, a := range flag.Args() {
+		n, err := strconv.Atoi(a)
+		if err != nil || n <= 0 {
+			usage()
+		}
+		if i == 0 {
+			interval, count = time.Duration(n)*time.Second, 0
+		} else {
+			count = n
+		}
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+
+	ct := kstat.NewCounterTracker()
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+			// Links come and go (for example, with zones).
+			if _, err := tok.Update(); err != nil {
+				fatal(err)
+			}
+		}
+		snap, err := tok.Snapshot(sel)
+		if err != nil {
+			fatal(err)
+		}
+		var names []string
+		stats := make(map[string]*linkStats)
+		for _, v := range snap.Values {
+			if !wanted(v.Name) {
+				continue
+			}
+			ls := stats[v.Name]
+			if ls == nil {
+				ls = &linkStats{rates: make(map[string]float64)}
+				stats[v.Name] = ls
+				names = append(names, v.Name)
+			}
+			switch v.Stat {
+			case "ifspeed":
+				ls.speed = v.UintVal
+			case "link_duplex":
+				ls.duplex = v.UintVal
+			}
+			if i == 0 {
+				// Start the counters from zero when the kstat
+				// was created, so the first report is since then.
+				z := v
+				z.Snaptime, z.IntVal, z.UintVal = v.Crtime, 0, 0
+				ct.Update(z)
+			}
+			if r, ok := ct.Update(v); ok {
+				ls.rates[v.Stat] = r.Rate
+			}
+		}
+		fmt.Printf("%8s %8s %7s %7s %7s %7s %7s %7s %5s %6s %6s\n",
+			"Time", "Int", "rKB/s", "wKB/s", "rPk/s", "wPk/s", "rAvs", "wAvs", "%Util", "Sat", "Errs")
+		for _, n := range names {
+			printLink(snap.Time, n, stats[n])
+		}
+	}
+}
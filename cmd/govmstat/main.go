@@ -0,0 +1,206 @@
+// govmstat prints vmstat style reports of kernel threads, memory,
+// paging, disk, fault, and CPU activity, using ComputeVMMetrics and
+// ComputeDiskMetrics:
+//
+//	govmstat [-S] [-T u|d] [interval [count]]
+//
+// The kthr and memory columns come from the raw unix:0:sysinfo and
+// unix:0:vminfo kstats, which the kernel only updates once a second;
+// for intervals where vminfo didn't change, free memory is the current
+// freemem from unix:0:system_pages. The disk columns are the
+// operations per second of the first four disks. As with vmstat, the
+// first report covers the time since boot.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	swapping = flag.Bool("S", false, "show swapping (si and so) instead of reclaims and minor faults (re and mf)")
+	stamp    = flag.String("T", "", "print a timestamp before each report, as `u` (Unix time) or d (date(1) format)")
+)
+
+const maxDisks = 4
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "govmstat: %s\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: govmstat [-S] [-T u|d] [interval [count]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// selectors returns the selectors for everything we report on: the
+// system-wide kstats, every CPU's kstats, and the first few disks.
+func selectors(tok *kstat.Token) []kstat.Selector {
+	sels := []kstat.Selector{
+		{Module: "unix", Instance: 0, Name: "sysinfo"},
+		{Module: "unix", Instance: 0, Name: "vminfo"},
+		{Module: "unix", Instance: 0, Name: "system_pages", Stat: "freemem"},
+		{Module: "cpu", Instance: -1, Name: "sys"},
+		{Module: "cpu", Instance: -1, Name: "vm"},
+	}
+	disks := 0
+	for _, k := range tok.AllSorted() {
+		if disks < maxDisks && k.Type == kstat.IoStat && k.Class == "disk" {
+			sels = append(sels, kstat.Selector{Module: k.Module, Instance: k.Instance, Name: k.Name})
+			disks++
+		}
+	}
+	return sels
+}
+
+// sinceCreated returns a Snapshot of the kstats in snap as they were
+// when they were created, with all of their statistics zero, so that
+// the first report covers the time since boot.
+func sinceCreated(snap *kstat.Snapshot) *kstat.Snapshot {
+	z := &kstat.Snapshot{Time: snap.Time}
+	for _, ki := range snap.KStats {
+		ki.Snaptime = ki.Crtime
+		z.KStats = append(z.KStats, ki)
+	}
+	for _, v := range snap.Values {
+		v.Snaptime = v.Crtime
+		v.IntVal, v.UintVal = 0, 0
+		z.Values = append(z.Values, v)
+	}
+	return z
+}
+
+// diskName abbreviates a disk's kstat name the way vmstat does, so
+// that sd0 is s0.
+func diskName(name string) string {
+	if i := strings.IndexAny(name, "0123456789"); i > 0 {
+		return name[:1] + name[i:]
+	}
+	return name
+}
+
+func header(w *bufio.Writer, dms []kstat.DiskMetrics) {
+	fmt.Fprintf(w, " kthr      memory            page            disk          faults      cpu\n")
+	fmt.Fprintf(w, " r b w   swap  free  ")
+	if *swapping {
+		fmt.Fprintf(w, "si  so")
+	} else {
+		fmt.Fprintf(w, "re  mf")
+	}
+	fmt.Fprintf(w, " pi po fr de sr")
+	for i := 0; i < maxDisks; i++ {
+		if i < len(dms) {
+			fmt.Fprintf(w, " %-2.2s", diskName(dms[i].KStat.Name))
+		} else {
+			fmt.Fprintf(w, " --")
+		}
+	}
+	fmt.Fprintf(w, "   in   sy   cs us sy id\n")
+}
+
+func report(w *bufio.Writer, vm kstat.VMMetrics, dms []kstat.DiskMetrics) {
+	a, b := vm.Reclaims, vm.MinorFaults
+	if *swapping {
+		a, b = vm.SwapInKB, vm.SwapOutKB
+	}
+	fmt.Fprintf(w, " %1.0f %1.0f %1.0f %6.0f %5.0f %3.0f %3.0f %2.0f %2.0f %2.0f %2d %2.0f",
+		vm.RunQueue, vm.Blocked, vm.Swapped, vm.SwapKB, vm.FreeKB, a, b,
+		vm.PageInKB, vm.PageOutKB, vm.FreedKB, 0, vm.ScanRate)
+	for i := 0; i < maxDisks; i++ {
+		if i < len(dms) {
+			fmt.Fprintf(w, " %2.0f", dms[i].ReadsPerSec+dms[i].WritesPerSec)
+		} else {
+			fmt.Fprintf(w, "  0")
+		}
+	}
+	fmt.Fprintf(w, " %4.0f %4.0f %4.0f %2.0f %2.0f %2.0f\n",
+		vm.Interrupts, vm.Syscalls, vm.CtxSwitches, vm.PctUser, vm.PctSystem, vm.PctIdle)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *stamp != "" && *stamp != "u" && *stamp != "d" {
+		usage()
+	}
+	var interval time.Duration
+	count := 1
+	if flag.NArg() > 2 {
+		usage()
+	}
+	for i, a := range flag.Args() {
+		n, err := strconv.Atoi(a)
+		if err != nil || n <= 0 {
+			usage()
+		}
+		if i == 0 {
+			interval, count = time.Duration(n)*time.Second, 0
+		} else {
+			count = n
+		}
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		fatal(err)
+	}
+	defer tok.Close()
+	pageSize := os.Getpagesize()
+
+	w := bufio.NewWriter(os.Stdout)
+	sels := selectors(tok)
+	var prev *kstat.Snapshot
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+			changed, err := tok.Update()
+			if err != nil {
+				fatal(err)
+			}
+			if changed {
+				sels = selectors(tok)
+			}
+		}
+		snap, err := tok.Snapshot(sels...)
+		if err != nil {
+			fatal(err)
+		}
+		if prev == nil {
+			prev = sinceCreated(snap)
+		}
+		vm, ok := kstat.ComputeVMMetrics(prev, snap, pageSize)
+		if !ok {
+			fatal(fmt.Errorf("no CPU statistics"))
+		}
+		if vm.FreeKB == 0 {
+			if v, ok := snap.Get("unix", 0, "system_pages", "freemem"); ok {
+				vm.FreeKB = float64(v.UintVal) * float64(pageSize) / 1024
+			}
+		}
+		dms := kstat.ComputeDiskMetrics(prev, snap)
+
+		switch *stamp {
+		case "u":
+			fmt.Fprintf(w, "%d\n", snap.Time.Unix())
+		case "d":
+			fmt.Fprintf(w, "%s\n", snap.Time.Format(time.UnixDate))
+		}
+		if i == 0 {
+			header(w, dms)
+		}
+		report(w, vm, dms)
+		if err := w.Flush(); err != nil {
+			fatal(err)
+		}
+		prev = snap
+	}
+}
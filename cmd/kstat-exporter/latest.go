@@ -0,0 +1,163 @@
+//
+// Merging Samples so that everything collected can be served.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// latestKStat is the most recent reading of a kstat's statistics.
+type latestKStat struct {
+	info  kstat.KStatInfo
+	vals  []kstat.Value
+	taken time.Time
+}
+
+// latest holds the most recent reading of every statistic that's
+// been collected. Since a Collection's groups can be collected at
+// different intervals, a Sample only has some of them; latest merges
+// Samples together so that everything can be served at any time.
+// Kstats that haven't been collected for maxAge (because they've gone
+// away, or are no longer collected) are dropped.
+//
+// It's a Sink for the Sampler, and a kstatrpc.Source for the JSON
+// API that serves what's been collected.
+type latest struct {
+	mu     sync.Mutex
+	kstats map[string]*latestKStat
+	maxAge time.Duration
+}
+
+func newLatest(maxAge time.Duration) *latest {
+	return &latest{kstats: make(map[string]*latestKStat), maxAge: maxAge}
+}
+
+func ksKey(module string, instance int, name string) string {
+	return fmt.Sprintf("%s:%d:%s", module, instance, name)
+}
+
+// Write merges a Sample's Values into what we have.
+func (l *latest) Write(sm *kstat.Sample) error {
+	info := make(map[string]kstat.KStatInfo, len(sm.KStats))
+	for _, ki := range sm.KStats {
+		info[ksKey(ki.Module, ki.Instance, ki.Name)] = ki
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, v := range sm.Values {
+		k := ksKey(v.Module, v.Instance, v.Name)
+		lk := l.kstats[k]
+		ki, ok := info[k]
+		if !ok {
+			continue
+		}
+		if lk == nil || lk.info.Crtime != ki.Crtime {
+			// A new kstat or a new incarnation of one.
+			lk = &latestKStat{}
+			l.kstats[k] = lk
+		}
+		lk.info, lk.taken = ki, sm.Time
+		replaced := false
+		for i := range lk.vals {
+			if lk.vals[i].Stat == v.Stat {
+				lk.vals[i], replaced = v, true
+				break
+			}
+		}
+		if !replaced {
+			lk.vals = append(lk.vals, v)
+		}
+	}
+	return nil
+}
+
+// Flush does nothing.
+func (l *latest) Flush() error { return nil }
+
+// Close does nothing.
+func (l *latest) Close() error { return nil }
+
+// reset forgets everything, for when the configuration changes.
+func (l *latest) reset() {
+	l.mu.Lock()
+	l.kstats = make(map[string]*latestKStat)
+	l.mu.Unlock()
+}
+
+// current returns the kstats that aren't stale, sorted.
+func (l *latest) current() []*latestKStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var lst []*latestKStat
+	for k, lk := range l.kstats {
+		if time.Since(lk.taken) > l.maxAge {
+			delete(l.kstats, k)
+			continue
+		}
+		lst = append(lst, &latestKStat{info: lk.info, vals: append([]kstat.Value(nil), lk.vals...), taken: lk.taken})
+	}
+	sort.Slice(lst, func(i, j int) bool {
+		a, b := lst[i].info, lst[j].info
+		if a.Module != b.Module {
+			return a.Module < b.Module
+		}
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Name < b.Name
+	})
+	return lst
+}
+
+// Snapshot returns a Snapshot of everything we have.
+func (l *latest) Snapshot() (*kstat.Snapshot, error) {
+	snap := &kstat.Snapshot{Time: time.Now()}
+	for _, lk := range l.current() {
+		snap.KStats = append(snap.KStats, lk.info)
+		snap.Values = append(snap.Values, lk.vals...)
+	}
+	return snap, nil
+}
+
+// All returns the kstats that we have.
+func (l *latest) All(ctx context.Context) ([]kstat.KStatInfo, error) {
+	var lst []kstat.KStatInfo
+	for _, lk := range l.current() {
+		lst = append(lst, lk.info)
+	}
+	return lst, nil
+}
+
+// Lookup returns a kstat that we have and its Values.
+func (l *latest) Lookup(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	k := ksKey(module, instance, name)
+	for _, lk := range l.current() {
+		if ksKey(lk.info.Module, lk.info.Instance, lk.info.Name) == k {
+			return lk.info, lk.vals, nil
+		}
+	}
+	return kstat.KStatInfo{}, nil, fmt.Errorf("%s is not being collected", k)
+}
+
+// Refresh is the same as Lookup, since we only have what the Sampler
+// last collected.
+func (l *latest) Refresh(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	return l.Lookup(ctx, module, instance, name)
+}
+
+// Sample returns a Snapshot of what we have that matches the
+// selectors.
+func (l *latest) Sample(ctx context.Context, sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	snap, err := l.Snapshot()
+	if err != nil || len(sels) == 0 {
+		return snap, err
+	}
+	return snap.Select(sels...), nil
+}
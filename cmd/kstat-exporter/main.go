@@ -0,0 +1,132 @@
+// kstat-exporter is a metrics exporter daemon for Solaris and illumos
+// hosts. It collects kstats as set out in a collection configuration
+// file (see kstat.Config) and serves them:
+//
+//	/metrics  in the Prometheus or OpenMetrics text format (or as a
+//	          JSON Snapshot), as the client's Accept header asks
+//	/api/     through the REST/JSON API of the restapi package
+//
+// Usage:
+//
+//	kstat-exporter -config /etc/kstat-exporter.json [-listen :9165]
+//
+// What's served is the most recent collection of each statistic, so
+// scrapes never read kstats themselves and cost the same however
+// often they come. The configuration is reloaded on SIGHUP (a bad new
+// configuration is logged and the old one kept), and SIGINT or
+// SIGTERM shut the exporter down gracefully, letting requests in
+// progress finish.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/restapi"
+)
+
+var (
+	configFile = flag.String("config", "", "the collection configuration `file` (required)")
+	listen     = flag.String("listen", ":9165", "the `address` to serve on")
+	namespace  = flag.String("namespace", "kstat", "the `prefix` of metric names")
+	maxAge     = flag.Duration("max-age", 5*time.Minute, "stop serving statistics that haven't been collected for this `long`")
+	coherent   = flag.Bool("coherent", false, "take coherent Samples (see Sampler.SetCoherent)")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: kstat-exporter -config file [flags]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kstat-exporter: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *configFile == "" || flag.NArg() != 0 {
+		usage()
+	}
+
+	coll, err := kstat.LoadCollection(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tok, err := kstat.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tok.Close()
+
+	last := newLatest(*maxAge)
+	s := kstat.NewSampler(tok, coll.Interval())
+	s.SetCoherent(*coherent)
+	s.AddProcessor(coll)
+	s.AddSink(last)
+	coll.Attach(s)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", kstat.NewMetricsHandler(last.Snapshot, kstat.OpenMetricsOptions{
+		Namespace: *namespace,
+		Naming:    coll.Naming(),
+	}))
+	mux.Handle("/api/", http.StripPrefix("/api", restapi.NewHandler(last)))
+	srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := coll.ReloadFile(*configFile); err != nil {
+				log.Printf("keeping the old configuration: %s", err)
+				continue
+			}
+			// Statistics that are no longer collected shouldn't
+			// linger until they go stale.
+			last.reset()
+			log.Printf("reloaded %s", *configFile)
+		}
+	}()
+
+	sampled := make(chan error, 1)
+	go func() { sampled <- s.RunContext(ctx, func(*kstat.Sample) {}) }()
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+	log.Printf("serving on %s", *listen)
+
+	failed := false
+	select {
+	case err = <-served:
+		log.Print(err)
+		failed = true
+	case err = <-sampled:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("sampling failed: %s", err)
+			failed = true
+		}
+	case <-ctx.Done():
+	}
+
+	cancel()
+	sctx, scancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer scancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		log.Print(err)
+	}
+	log.Print("stopped")
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,182 @@
+// kstatgen generates a Go struct for a named or IO kstat, along with
+// a function to read the kstat into it, by looking at the kstat on
+// the current system. It's meant to be used with go:generate:
+//
+//	//go:generate kstatgen -o arcstats.go -type ARCStats zfs:0:arcstats
+//
+// The generated struct has a field for every statistic, with the
+// kstat struct tags that KStat.CopyTo uses. If the instance is given
+// as * (or left out), the generated Read function takes the instance
+// as an argument.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+var (
+	outFile  = flag.String("o", "", "write the generated code to `file` instead of standard output")
+	pkgName  = flag.String("package", "", "the `package` of the generated code (default: $GOPACKAGE or main)")
+	typeName = flag.String("type", "", "the `name` of the generated struct (default: from the kstat name)")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: kstatgen [flags] module:instance:name\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// goName turns a statistic or kstat name into an exported Go
+// identifier, so that "cpu_nsec_user" becomes "CpuNsecUser".
+func goName(s string) string {
+	var b strings.Builder
+	up := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			up = true
+			continue
+		}
+		if up {
+			r = unicode.ToUpper(r)
+			up = false
+		}
+		b.WriteRune(r)
+	}
+	n := b.String()
+	if n == "" || !unicode.IsLetter(rune(n[0])) {
+		n = "X" + n
+	}
+	return n
+}
+
+// goType returns the Go type for a statistic type.
+func goType(t kstat.NamedType) string {
+	switch t {
+	case kstat.Int32:
+		return "int32"
+	case kstat.Uint32:
+		return "uint32"
+	case kstat.Int64:
+		return "int64"
+	case kstat.Uint64:
+		return "uint64"
+	}
+	return "string"
+}
+
+// generate writes the code for a kstat with the given statistics.
+func generate(b *bytes.Buffer, sel kstat.Selector, ks *kstat.KStat, vals []kstat.Value) {
+	tname := *typeName
+	if tname == "" {
+		tname = goName(ks.Name)
+	}
+	pkg := *pkgName
+	if pkg == "" {
+		pkg = os.Getenv("GOPACKAGE")
+	}
+	if pkg == "" {
+		pkg = "main"
+	}
+	inst := strconv.Itoa(sel.Instance)
+	if sel.Instance < 0 {
+		inst = "*"
+	}
+	src := fmt.Sprintf("%s:%s:%s", ks.Module, inst, ks.Name)
+
+	fmt.Fprintf(b, "// Code generated by kstatgen from %s; DO NOT EDIT.\n\n", src)
+	fmt.Fprintf(b, "package %s\n\n", pkg)
+	fmt.Fprintf(b, "import \"github.com/siebenmann/go-kstat\"\n\n")
+	fmt.Fprintf(b, "// %s holds the statistics of %s (class %s).\n", tname, src, ks.Class)
+	fmt.Fprintf(b, "type %s struct {\n", tname)
+	seen := make(map[string]int)
+	for _, v := range vals {
+		fname := goName(v.Stat)
+		seen[fname]++
+		if seen[fname] > 1 {
+			fname = fmt.Sprintf("%s%d", fname, seen[fname])
+		}
+		fmt.Fprintf(b, "\t%s %s `kstat:%q`\n", fname, goType(v.Type), v.Stat)
+	}
+	fmt.Fprintf(b, "}\n\n")
+
+	if sel.Instance < 0 {
+		fmt.Fprintf(b, "// Read%s refreshes %s for an instance and reads it into a %s.\n", tname, src, tname)
+		fmt.Fprintf(b, "func Read%s(tok *kstat.Token, instance int) (*%s, error) {\n", tname, tname)
+		fmt.Fprintf(b, "\tks, err := tok.Lookup(%q, instance, %q)\n", ks.Module, ks.Name)
+	} else {
+		fmt.Fprintf(b, "// Read%s refreshes %s and reads it into a %s.\n", tname, src, tname)
+		fmt.Fprintf(b, "func Read%s(tok *kstat.Token) (*%s, error) {\n", tname, tname)
+		fmt.Fprintf(b, "\tks, err := tok.Lookup(%q, %d, %q)\n", ks.Module, sel.Instance, ks.Name)
+	}
+	fmt.Fprintf(b, `	if err != nil {
+		return nil, err
+	}
+	if err = ks.Refresh(); err != nil {
+		return nil, err
+	}
+	r := &%s{}
+	if err = ks.CopyTo(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+`, tname)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kstatgen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+	sel, err := kstat.ParseSelector(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sel.Module == "" || sel.Name == "" || strings.ContainsAny(sel.Module+sel.Name, "*?[") {
+		log.Fatalf("%s must name a specific kstat", flag.Arg(0))
+	}
+
+	tok, err := kstat.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tok.Close()
+	ks, err := tok.Lookup(sel.Module, sel.Instance, sel.Name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ks.Type != kstat.NamedStat && ks.Type != kstat.IoStat {
+		log.Fatalf("%s is a %s kstat, not a named or IO one", ks, ks.Type)
+	}
+	vals, err := ks.Values()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	generate(&b, sel, ks, vals)
+	code, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %s", err)
+	}
+	if *outFile == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	if err = os.WriteFile(*outFile, code, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,171 @@
+//
+// Writing Samples as collectd Exec plugin PUTVAL commands.
+
+package kstat
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CollectdOptions control how a CollectdWriter writes Samples.
+type CollectdOptions struct {
+	// Host is the host part of value identifiers. If it's blank,
+	// it's $COLLECTD_HOSTNAME (which the Exec plugin sets) or
+	// else the system's host name.
+	Host string
+
+	// Interval is the interval between Samples, which collectd
+	// uses to decide when values are missing. If it's zero, it's
+	// $COLLECTD_INTERVAL (which the Exec plugin sets), or else
+	// it's left for collectd to use its default.
+	Interval time.Duration
+
+	// Counters pick out the statistics that are counters. They are
+	// written with the type "derive", so collectd turns them into
+	// rates itself (and copes with resets). Everything else is
+	// written with the type "gauge".
+	Counters []Selector
+
+	// Naming maps statistics to value identifiers. For each
+	// statistic that it maps, the plugin instance is the label
+	// values joined with underscores and the type instance is the
+	// mapped name; the plugin is still the kstat's module.
+	Naming *Naming
+}
+
+// CollectdWriter writes Samples as PUTVAL commands for collectd's
+// Exec plugin, one per numeric statistic:
+//
+//	PUTVAL "host/cpu-0_sys/derive-syscall" interval=10 1440756000:1234
+//
+// The plugin is the kstat's module, the plugin instance is its
+// instance and name, and the type instance is the statistic.
+// Characters that collectd can't have in these ('/' anywhere and
+// '-' in the plugin and type) are turned into underscores. Derived
+// values are written as gauges of the plugin kstat_derived.
+type CollectdWriter struct {
+	out      io.Writer
+	w        *bufio.Writer
+	opts     CollectdOptions
+	interval string
+}
+
+// NewCollectdWriter creates a CollectdWriter that writes to w, which
+// for the Exec plugin is standard output.
+func NewCollectdWriter(w io.Writer, opts CollectdOptions) *CollectdWriter {
+	if opts.Host == "" {
+		opts.Host = os.Getenv("COLLECTD_HOSTNAME")
+	}
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	cw := &CollectdWriter{out: w, w: bufio.NewWriter(w), opts: opts}
+	if opts.Interval > 0 {
+		cw.interval = strconv.FormatFloat(opts.Interval.Seconds(), 'f', -1, 64)
+	} else if iv := os.Getenv("COLLECTD_INTERVAL"); iv != "" {
+		if f, err := strconv.ParseFloat(iv, 64); err == nil && f > 0 {
+			cw.interval = iv
+		}
+	}
+	return cw
+}
+
+// Write writes a Sample's numeric statistics and Derived values.
+// The lines are flushed at the end, since collectd reads them as
+// they come.
+func (cw *CollectdWriter) Write(sm *Sample) error {
+	cw.snapshot(&sm.Snapshot)
+	ts := strconv.FormatInt(sm.Time.Unix(), 10)
+	for _, d := range sm.Derived {
+		cw.putval("kstat_derived", "", "gauge", d.Name, ts, strconv.FormatFloat(d.Value, 'g', -1, 64))
+	}
+	return cw.w.Flush()
+}
+
+// WriteSnapshot writes a Snapshot's numeric statistics.
+func (cw *CollectdWriter) WriteSnapshot(snap *Snapshot) error {
+	cw.snapshot(snap)
+	return cw.w.Flush()
+}
+
+func (cw *CollectdWriter) snapshot(snap *Snapshot) {
+	ts := strconv.FormatInt(snap.Time.Unix(), 10)
+	for _, v := range snap.Values {
+		var num string
+		switch v.Type {
+		case Int32, Int64:
+			num = strconv.FormatInt(v.IntVal, 10)
+		case Uint32, Uint64:
+			num = strconv.FormatUint(v.UintVal, 10)
+		default:
+			continue
+		}
+		tp := "gauge"
+		for _, sel := range cw.opts.Counters {
+			if sel.Match(v) {
+				tp = "derive"
+				break
+			}
+		}
+		if mn, ok := cw.opts.Naming.Map(v); ok {
+			var lvals []string
+			for _, l := range mn.Labels {
+				lvals = append(lvals, l.Value)
+			}
+			cw.putval(v.Module, strings.Join(lvals, "_"), tp, mn.Name, ts, num)
+		} else {
+			cw.putval(v.Module, strconv.Itoa(v.Instance)+"_"+v.Name, tp, v.Stat, ts, num)
+		}
+	}
+}
+
+// Flush writes out any buffered lines. Write and WriteSnapshot flush
+// when they're done, so this is only needed if they failed.
+func (cw *CollectdWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// Close flushes the CollectdWriter and closes its writer, if it's an
+// io.Closer.
+func (cw *CollectdWriter) Close() error {
+	err := cw.w.Flush()
+	if cerr := closeWriter(cw.out); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+var (
+	collectdPart     = strings.NewReplacer("/", "_", `"`, "_", "\n", "_")
+	collectdNoHyphen = strings.NewReplacer("/", "_", `"`, "_", "\n", "_", "-", "_")
+)
+
+func (cw *CollectdWriter) putval(plugin, pinst, tp, tinst, ts, num string) {
+	cw.w.WriteString(`PUTVAL "`)
+	cw.w.WriteString(collectdPart.Replace(cw.opts.Host))
+	cw.w.WriteByte('/')
+	cw.w.WriteString(collectdNoHyphen.Replace(plugin))
+	if pinst != "" {
+		cw.w.WriteByte('-')
+		cw.w.WriteString(collectdPart.Replace(pinst))
+	}
+	cw.w.WriteByte('/')
+	cw.w.WriteString(tp)
+	cw.w.WriteByte('-')
+	cw.w.WriteString(collectdPart.Replace(tinst))
+	cw.w.WriteByte('"')
+	if cw.interval != "" {
+		cw.w.WriteString(" interval=")
+		cw.w.WriteString(cw.interval)
+	}
+	cw.w.WriteByte(' ')
+	cw.w.WriteString(ts)
+	cw.w.WriteByte(':')
+	cw.w.WriteString(num)
+	cw.w.WriteByte('\n')
+}
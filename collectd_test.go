@@ -0,0 +1,43 @@
+//
+// Test collectd output.
+
+package kstat_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestCollectdWriter(t *testing.T) {
+	sel, _ := kstat.ParseSelector("cpu::sys:syscall")
+	var b bytes.Buffer
+	cw := kstat.NewCollectdWriter(&b, kstat.CollectdOptions{Host: "h1", Interval: 10 * time.Second, Counters: []kstat.Selector{sel}})
+	sm := &kstat.Sample{Snapshot: *testSnapshot()}
+	sm.Derived = []kstat.Derived{{Name: "ewma(cpu:0:sys:syscall)", Value: 1.5}}
+	if err := cw.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	exp := `PUTVAL "h1/cpu-0_sys/derive-syscall" interval=10 1440756000:18446744073709551615
+PUTVAL "h1/cpu-0_sys/gauge-delta" interval=10 1440756000:-5
+PUTVAL "h1/kstat_derived/gauge-ewma(cpu:0:sys:syscall)" interval=10 1440756000:1.5
+`
+	if b.String() != exp {
+		t.Fatalf("wrong output:\n%s", b.String())
+	}
+
+	// The Exec plugin's environment supplies defaults.
+	t.Setenv("COLLECTD_HOSTNAME", "h/2")
+	t.Setenv("COLLECTD_INTERVAL", "60.000")
+	b.Reset()
+	cw = kstat.NewCollectdWriter(&b, kstat.CollectdOptions{})
+	sm.Values = sm.Values[1:2]
+	if err := cw.WriteSnapshot(&sm.Snapshot); err != nil {
+		t.Fatalf("WriteSnapshot failed: %s", err)
+	}
+	if exp = "PUTVAL \"h_2/cpu-0_sys/gauge-delta\" interval=60.000 1440756000:-5\n"; b.String() != exp {
+		t.Fatalf("wrong output with environment:\n%s", b.String())
+	}
+}
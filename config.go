@@ -0,0 +1,359 @@
+//
+// Collection configuration files, with reloading.
+
+package kstat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that is written in configuration files
+// as a string in the form accepted by time.ParseDuration, such as
+// "10s" or "1m30s".
+type Duration time.Duration
+
+// MarshalText encodes a Duration as a string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText decodes a Duration from a string.
+func (d *Duration) UnmarshalText(b []byte) error {
+	td, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(td)
+	return nil
+}
+
+// Config describes what to collect and how to name it:
+//
+//	{
+//	  "interval": "10s",
+//	  "collect": [
+//	    {"selectors": ["cpu::sys", "unix:0:system_misc"]},
+//	    {"selectors": ["zfs:0:arcstats"], "interval": "1m"}
+//	  ],
+//	  "exclude": ["cpu::sys:cpu_ticks_*"],
+//	  "rename": [
+//	    {"match": "link:\\d+:(?P<nic>[^:]+):(.*)", "name": "link_$2", "labels": {"interface": "$nic"}}
+//	  ]
+//	}
+//
+// Collect is the allowlist: groups of selectors (in the form of
+// ParseSelector) with the interval they're collected at, which is
+// Interval if a group doesn't give one. If there are no groups,
+// everything is collected. Exclude is the denylist of statistics
+// that are never collected, even if a group selects them. Rename is
+// the rules of a Naming for the exporters.
+//
+// The same Config can also be written in YAML, with the same field
+// names; LoadConfig reads a file as YAML if it ends in .yaml or .yml.
+type Config struct {
+	Interval Duration        `json:"interval" yaml:"interval"`
+	Collect  []CollectConfig `json:"collect,omitempty" yaml:"collect,omitempty"`
+	Exclude  []string        `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Rename   []NamingRule    `json:"rename,omitempty" yaml:"rename,omitempty"`
+}
+
+// CollectConfig is a group of selectors in a Config.
+type CollectConfig struct {
+	Selectors []string `json:"selectors" yaml:"selectors"`
+	Interval  Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// ParseConfig parses a JSON Config. Unknown fields are errors, so
+// that typos don't go unnoticed.
+func ParseConfig(b []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	cfg := &Config{}
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("bad config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ParseYAMLConfig parses a YAML Config. As with ParseConfig, unknown
+// fields are errors.
+func ParseYAMLConfig(b []byte) (*Config, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	cfg := &Config{}
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("bad config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadConfig reads and parses a Config file, which is YAML if its
+// name ends in .yaml or .yml and JSON otherwise.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parse := ParseConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		parse = ParseYAMLConfig
+	}
+	cfg, err := parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Reconfigurable is something that collects statistics and whose
+// selectors and interval can be changed while it runs, such as a
+// Sampler.
+type Reconfigurable interface {
+	SetSelectors(sels ...Selector)
+	SetInterval(interval time.Duration)
+}
+
+// collectGroup is a compiled CollectConfig.
+type collectGroup struct {
+	key      string
+	sels     []Selector
+	interval time.Duration
+}
+
+// Collection applies a Config. It's a Processor that drops the
+// statistics that the Config doesn't collect at the time of each
+// Sample (because they're excluded, or not selected, or their
+// group's interval hasn't come around yet), it has the Naming for
+// exporters, and it can be reloaded with a new Config while in use.
+//
+// A Sampler for a Collection samples at the Collection's Interval,
+// which is the shortest interval of any group, and collects the
+// Collection's Selectors:
+//
+//	coll, err := kstat.LoadCollection(path)
+//	...
+//	s := kstat.NewSampler(tok, coll.Interval())
+//	s.AddProcessor(coll)
+//	coll.Attach(s)
+//	stop := coll.ReloadOnSignal(path, func(err error) { log.Print(err) })
+//	defer stop()
+//
+// Reloading changes what's collected and how it's named without
+// restarting anything, so Processors, Sinks, and exporters keep their
+// state (such as the previous readings of counters). Groups that
+// are the same in the new Config keep their schedules.
+type Collection struct {
+	mu       sync.Mutex
+	groups   []collectGroup
+	exclude  []Selector
+	interval time.Duration
+	naming   *Naming
+	last     map[string]time.Time
+	targets  []Reconfigurable
+}
+
+// NewCollection creates a Collection from a Config.
+func NewCollection(cfg *Config) (*Collection, error) {
+	c := &Collection{naming: &Naming{}, last: make(map[string]time.Time)}
+	if err := c.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCollection creates a Collection from a Config file, as read
+// by LoadConfig.
+func LoadCollection(path string) (*Collection, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCollection(cfg)
+}
+
+// Reload replaces the Collection's Config, and sets the new
+// selectors and interval on everything Attached to it. If the new
+// Config is bad, nothing is changed.
+func (c *Collection) Reload(cfg *Config) error {
+	if cfg.Interval <= 0 {
+		return errors.New("config interval must be positive")
+	}
+	var groups []collectGroup
+	interval := time.Duration(cfg.Interval)
+	for _, cc := range cfg.Collect {
+		sels, err := ParseSelectors(cc.Selectors)
+		if err != nil {
+			return err
+		}
+		g := collectGroup{sels: sels, interval: time.Duration(cc.Interval)}
+		if g.interval <= 0 {
+			g.interval = time.Duration(cfg.Interval)
+		}
+		if g.interval < interval {
+			interval = g.interval
+		}
+		g.key = g.interval.String() + " " + strings.Join(cc.Selectors, " ")
+		groups = append(groups, g)
+	}
+	exclude, err := ParseSelectors(cfg.Exclude)
+	if err != nil {
+		return err
+	}
+	// The Naming is shared with exporters, so it's changed in place.
+	if err := c.naming.SetRules(cfg.Rename...); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.groups, c.exclude, c.interval = groups, exclude, interval
+	last := make(map[string]time.Time)
+	for _, g := range groups {
+		if t, ok := c.last[g.key]; ok {
+			last[g.key] = t
+		}
+	}
+	c.last = last
+	targets := c.targets
+	c.mu.Unlock()
+	for _, r := range targets {
+		c.apply(r)
+	}
+	return nil
+}
+
+// ReloadFile reloads the Collection from a Config file, as read by
+// LoadConfig.
+func (c *Collection) ReloadFile(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return c.Reload(cfg)
+}
+
+// ReloadOnSignal reloads the Collection from a Config file
+// every time the process gets a SIGHUP, calling errf (if it's not
+// nil) with any error; a bad Config leaves the current one in
+// place. It returns a function that stops it.
+func (c *Collection) ReloadOnSignal(path string, errf func(error)) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := c.ReloadFile(path); err != nil && errf != nil {
+					errf(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// Attach sets a Reconfigurable's selectors and interval from the
+// Collection now and whenever it's reloaded.
+func (c *Collection) Attach(r Reconfigurable) {
+	c.mu.Lock()
+	c.targets = append(c.targets, r)
+	c.mu.Unlock()
+	c.apply(r)
+}
+
+func (c *Collection) apply(r Reconfigurable) {
+	r.SetSelectors(c.Selectors()...)
+	r.SetInterval(c.Interval())
+}
+
+// Selectors returns the selectors of all of the Collection's groups,
+// which is what a Sampler for it should collect. If it has no groups,
+// there are no selectors, which collects everything.
+func (c *Collection) Selectors() []Selector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var sels []Selector
+	for _, g := range c.groups {
+		sels = append(sels, g.sels...)
+	}
+	return sels
+}
+
+// Interval returns the shortest interval of any of the Collection's
+// groups, which is how often a Sampler for it should take Samples.
+func (c *Collection) Interval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interval
+}
+
+// Naming returns the Collection's Naming, for exporters. It's the
+// same Naming for the life of the Collection; reloading changes its
+// rules.
+func (c *Collection) Naming() *Naming {
+	return c.naming
+}
+
+// Process drops the Values in a Sample that the Collection doesn't
+// collect at the Sample's Time. A group's Values are kept if at
+// least its interval (less half of the Collection's interval, to
+// allow for jitter) has passed since they were last kept.
+func (c *Collection) Process(sm *Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var due []collectGroup
+	for _, g := range c.groups {
+		last, ok := c.last[g.key]
+		if !ok || sm.Time.Sub(last) >= g.interval-c.interval/2 {
+			due = append(due, g)
+			c.last[g.key] = sm.Time
+		}
+	}
+	vals := sm.Values[:0]
+	for _, v := range sm.Values {
+		if c.keep(v, due) {
+			vals = append(vals, v)
+		}
+	}
+	sm.Values = vals
+}
+
+func (c *Collection) keep(v Value, due []collectGroup) bool {
+	for _, sel := range c.exclude {
+		if sel.Match(v) {
+			return false
+		}
+	}
+	if len(c.groups) == 0 {
+		return true
+	}
+	for _, g := range due {
+		for _, sel := range g.sels {
+			if sel.Match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+//
+// Test Collections and their configuration.
+
+package kstat_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+const testConfig = `{
+  "interval": "10s",
+  "collect": [
+    {"selectors": ["cpu::sys"]},
+    {"selectors": ["link"], "interval": "30s"}
+  ],
+  "exclude": ["cpu::sys:delta"],
+  "rename": [{"match": "link:.*", "name": "net_$stat"}]
+}`
+
+const testYAMLConfig = `
+interval: 10s
+collect:
+  - selectors: ["cpu::sys"]
+  - selectors: ["link"]
+    interval: 30s
+exclude: ["cpu::sys:delta"]
+rename:
+  - match: "link:.*"
+    name: net_$stat
+`
+
+// fakeSampler is a Reconfigurable that records what it's set to.
+type fakeSampler struct {
+	sels     []kstat.Selector
+	interval time.Duration
+}
+
+func (f *fakeSampler) SetSelectors(sels ...kstat.Selector) { f.sels = sels }
+func (f *fakeSampler) SetInterval(iv time.Duration)        { f.interval = iv }
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := kstat.ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %s", err)
+	}
+	if cfg.Interval != kstat.Duration(10*time.Second) || len(cfg.Collect) != 2 || cfg.Collect[1].Interval != kstat.Duration(30*time.Second) || cfg.Rename[0].Name != "net_$stat" {
+		t.Fatalf("wrong Config: %+v", cfg)
+	}
+	for _, bad := range []string{`{"interval": "10"}`, `{"interval": "1s", "colect": []}`, `{"interval": "1s", "exclude": ["a:b:c:d:e"]}`, `{}`} {
+		cfg, err := kstat.ParseConfig([]byte(bad))
+		if err == nil {
+			_, err = kstat.NewCollection(cfg)
+		}
+		if err == nil {
+			t.Errorf("bad config accepted: %s", bad)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	jpath, ypath := filepath.Join(dir, "config.json"), filepath.Join(dir, "config.yaml")
+	os.WriteFile(jpath, []byte(testConfig), 0666)
+	os.WriteFile(ypath, []byte(testYAMLConfig), 0666)
+	want, err := kstat.LoadConfig(jpath)
+	if err != nil {
+		t.Fatalf("LoadConfig JSON failed: %s", err)
+	}
+	cfg, err := kstat.LoadConfig(ypath)
+	if err != nil {
+		t.Fatalf("LoadConfig YAML failed: %s", err)
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("YAML Config differs:\n%+v\n%+v", cfg, want)
+	}
+	os.WriteFile(ypath, []byte("interval: 10s\ncolect: []\n"), 0666)
+	if _, err := kstat.LoadConfig(ypath); err == nil {
+		t.Fatalf("unknown YAML field accepted")
+	}
+}
+
+func TestCollection(t *testing.T) {
+	cfg, _ := kstat.ParseConfig([]byte(testConfig))
+	coll, err := kstat.NewCollection(cfg)
+	if err != nil {
+		t.Fatalf("NewCollection failed: %s", err)
+	}
+	var fs fakeSampler
+	coll.Attach(&fs)
+	if fs.interval != 10*time.Second || len(fs.sels) != 2 || fs.sels[1].Module != "link" {
+		t.Fatalf("wrong Attach: %+v", fs)
+	}
+
+	// Every 10 seconds, cpu:0:sys:syscall is collected, delta is
+	// excluded, and link stats are only collected every third time.
+	link := linkValue("e1000g0", 1)
+	other := kstat.Value{Module: "unix", Name: "system_misc", Stat: "nproc", Type: kstat.Int32}
+	base := time.Unix(1000, 0)
+	var got [][]string
+	for i := 0; i < 4; i++ {
+		sm := &kstat.Sample{Snapshot: *testSnapshot()}
+		sm.Values = append(sm.Values, link, other)
+		sm.Time = base.Add(time.Duration(i) * 10 * time.Second)
+		coll.Process(sm)
+		var stats []string
+		for _, v := range sm.Values {
+			stats = append(stats, v.Stat)
+		}
+		got = append(got, stats)
+	}
+	exp := [][]string{{"syscall", "rbytes64"}, {"syscall"}, {"syscall"}, {"syscall", "rbytes64"}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("wrong statistics collected: %v", got)
+	}
+	if mn, ok := coll.Naming().Map(link); !ok || mn.Name != "net_rbytes64" {
+		t.Fatalf("wrong naming: %+v", mn)
+	}
+
+	// Reloading changes everything in place.
+	naming := coll.Naming()
+	cfg, _ = kstat.ParseConfig([]byte(`{"interval": "5s", "rename": [{"match": "link:.*"}]}`))
+	if err := coll.Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %s", err)
+	}
+	if fs.interval != 5*time.Second || fs.sels != nil {
+		t.Fatalf("Reload did not reconfigure: %+v", fs)
+	}
+	if mn, _ := naming.Map(link); mn.Name != "link_rbytes64" {
+		t.Fatalf("Reload did not rename: %+v", mn)
+	}
+	sm := &kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{link, other}}}
+	if coll.Process(sm); len(sm.Values) != 2 {
+		t.Fatalf("everything not collected: %v", sm.Values)
+	}
+	cfg.Rename[0].Match = "("
+	if err := coll.Reload(cfg); err == nil || coll.Interval() != 5*time.Second {
+		t.Fatalf("bad Reload accepted: %v", err)
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(testConfig), 0666)
+	coll, err := kstat.LoadCollection(path)
+	if err != nil {
+		t.Fatalf("LoadCollection failed: %s", err)
+	}
+	errs := make(chan error, 1)
+	stop := coll.ReloadOnSignal(path, func(err error) { errs <- err })
+	defer stop()
+
+	os.WriteFile(path, []byte(`{"interval": "1m"}`), 0666)
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGHUP)
+	for i := 0; i < 100 && coll.Interval() != time.Minute; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if coll.Interval() != time.Minute {
+		t.Fatalf("Collection not reloaded: %s", coll.Interval())
+	}
+
+	os.WriteFile(path, []byte(`{"interval": "1m"`), 0666)
+	p.Signal(syscall.SIGHUP)
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatalf("nil error reported")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("bad reload not reported")
+	}
+}
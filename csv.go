@@ -0,0 +1,143 @@
+//
+// Writing series of Samples as CSV.
+
+package kstat
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVWriter writes a series of Samples as CSV, for spreadsheets,
+// pandas, and the like. The first column is the Sample's Time, and
+// every other column is a numeric statistic (or a Derived value);
+// each Sample is a row. The first row is a header with the column
+// names, which are "time", the module:instance:name:stat of each
+// statistic, and the names of Derived values.
+//
+// The columns are fixed by the first Sample written, since CSV can't
+// grow columns. Statistics that show up later are left out, and ones
+// that go missing have empty cells.
+type CSVWriter struct {
+	out   io.Writer
+	w     *csv.Writer
+	sels  []Selector
+	rates bool
+	ct    *CounterTracker
+
+	cols  []string
+	index map[string]int
+	row   []string
+}
+
+// NewCSVWriter creates a CSVWriter that writes to w. Its columns are
+// the statistics picked out by sels, or all of them if there are no
+// selectors, and all Derived values.
+func NewCSVWriter(w io.Writer, sels ...Selector) *CSVWriter {
+	return &CSVWriter{out: w, w: csv.NewWriter(w), sels: sels, ct: NewCounterTracker()}
+}
+
+// SetRates sets whether the CSVWriter writes the per-second rates of
+// statistics (as computed by ComputeRate) instead of their values.
+// In the first row, and for statistics that don't have a rate in a
+// Sample, the cells are empty. Derived values are always written as
+// they are. SetRates must be called before the first Write.
+func (cw *CSVWriter) SetRates(rates bool) {
+	cw.rates = rates
+}
+
+func (cw *CSVWriter) wanted(v Value) bool {
+	if _, ok := v.Float(); !ok {
+		return false
+	}
+	if len(cw.sels) == 0 {
+		return true
+	}
+	for _, sel := range cw.sels {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes a Sample as a row, first writing the header if this
+// is the first Sample. The row is flushed to the underlying writer.
+func (cw *CSVWriter) Write(sm *Sample) error {
+	if cw.cols == nil {
+		cw.cols = []string{"time"}
+		cw.index = make(map[string]int)
+		for _, v := range sm.Values {
+			if cw.wanted(v) {
+				cw.addColumn(v.String())
+			}
+		}
+		for _, d := range sm.Derived {
+			cw.addColumn(d.Name)
+		}
+		cw.row = make([]string, len(cw.cols))
+		if err := cw.w.Write(cw.cols); err != nil {
+			return err
+		}
+	}
+
+	for i := range cw.row {
+		cw.row[i] = ""
+	}
+	cw.row[0] = sm.Time.Format(time.RFC3339Nano)
+	if cw.rates {
+		for _, r := range cw.ct.UpdateSample(sm) {
+			if i, ok := cw.index[r.Value.String()]; ok {
+				cw.row[i] = strconv.FormatFloat(r.Rate, 'g', -1, 64)
+			}
+		}
+	} else {
+		for _, v := range sm.Values {
+			i, ok := cw.index[v.String()]
+			switch {
+			case !ok:
+			case v.Type == Int32 || v.Type == Int64:
+				cw.row[i] = strconv.FormatInt(v.IntVal, 10)
+			case v.Type == Uint32 || v.Type == Uint64:
+				cw.row[i] = strconv.FormatUint(v.UintVal, 10)
+			}
+		}
+	}
+	for _, d := range sm.Derived {
+		if i, ok := cw.index[d.Name]; ok {
+			cw.row[i] = strconv.FormatFloat(d.Value, 'g', -1, 64)
+		}
+	}
+	if err := cw.w.Write(cw.row); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Flush writes out anything buffered. Write flushes each row, so
+// this is only needed if it failed.
+func (cw *CSVWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Close flushes the CSVWriter and closes its writer, if it's an
+// io.Closer.
+func (cw *CSVWriter) Close() error {
+	err := cw.Flush()
+	if cerr := closeWriter(cw.out); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (cw *CSVWriter) addColumn(name string) {
+	if _, ok := cw.index[name]; ok {
+		return
+	}
+	cw.index[name] = len(cw.cols)
+	cw.cols = append(cw.cols, name)
+}
@@ -0,0 +1,65 @@
+//
+// Test CSV output.
+
+package kstat_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestCSVWriter(t *testing.T) {
+	nproc := kstat.Value{Module: "unix", Instance: 0, Name: "system_misc", Stat: "nproc", Type: kstat.Int32, IntVal: 42}
+	state := kstat.Value{Module: "cpu_info", Name: "cpu_info0", Stat: "state", Type: kstat.CharData, StringVal: "on-line"}
+	samples := func() []*kstat.Sample {
+		var sms []*kstat.Sample
+		for i := 0; i < 3; i++ {
+			sm := &kstat.Sample{}
+			sm.Time = time.Date(2015, 8, 28, 10, 0, i, 0, time.UTC)
+			sm.Values = []kstat.Value{counter(int64(i+1)*1e9, uint64(100*i*i)), nproc, state}
+			if i == 2 {
+				sm.Values = sm.Values[:1]
+			}
+			sm.Derived = []kstat.Derived{{Name: "mean", Value: float64(i) / 2}}
+			sms = append(sms, sm)
+		}
+		return sms
+	}
+
+	var b bytes.Buffer
+	cw := kstat.NewCSVWriter(&b)
+	for _, sm := range samples() {
+		if err := cw.Write(sm); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+	}
+	exp := `time,cpu:0:sys:syscall,unix:0:system_misc:nproc,mean
+2015-08-28T10:00:00Z,0,42,0
+2015-08-28T10:00:01Z,100,42,0.5
+2015-08-28T10:00:02Z,400,,1
+`
+	if b.String() != exp {
+		t.Fatalf("wrong CSV:\n%s", b.String())
+	}
+
+	b.Reset()
+	sel, _ := kstat.ParseSelector("cpu")
+	cw = kstat.NewCSVWriter(&b, sel)
+	cw.SetRates(true)
+	for _, sm := range samples() {
+		if err := cw.Write(sm); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+	}
+	exp = `time,cpu:0:sys:syscall,mean
+2015-08-28T10:00:00Z,,0
+2015-08-28T10:00:01Z,100,0.5
+2015-08-28T10:00:02Z,300,1
+`
+	if b.String() != exp {
+		t.Fatalf("wrong rate CSV:\n%s", b.String())
+	}
+}
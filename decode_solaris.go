@@ -0,0 +1,108 @@
+//
+// Turning the kernel's kstat data structures into Values. This
+// doesn't need cgo, only the layout of the structures.
+
+package kstat
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func (ki KStatInfo) uintValue(stat string, tp NamedType, v uint64) Value {
+	r := ki.value(stat, tp)
+	r.UintVal = v
+	return r
+}
+
+func (ki KStatInfo) intValue(stat string, tp NamedType, v int64) Value {
+	r := ki.value(stat, tp)
+	r.IntVal = v
+	return r
+}
+
+// IOValues returns the fields of an IO, from the kstat described by
+// ki, as Values. The names are the ones that kstat(1) uses.
+func (ki KStatInfo) IOValues(io *IO) []Value {
+	return []Value{
+		ki.uintValue("nread", Uint64, io.Nread),
+		ki.uintValue("nwritten", Uint64, io.Nwritten),
+		ki.uintValue("reads", Uint32, uint64(io.Reads)),
+		ki.uintValue("writes", Uint32, uint64(io.Writes)),
+		ki.intValue("wtime", Int64, io.Wtime),
+		ki.intValue("wlentime", Int64, io.Wlentime),
+		ki.intValue("wlastupdate", Int64, io.Wlastupdate),
+		ki.intValue("rtime", Int64, io.Rtime),
+		ki.intValue("rlentime", Int64, io.Rlentime),
+		ki.intValue("rlastupdate", Int64, io.Rlastupdate),
+		ki.uintValue("wcnt", Uint32, uint64(io.Wcnt)),
+		ki.uintValue("rcnt", Uint32, uint64(io.Rcnt)),
+	}
+}
+
+// RawValues returns Values for the data of a raw kstat described by
+// ki, if it is one of the unix:0:sysinfo, unix:0:vminfo, and
+// unix:0:var kstats that we know how to decode. The names are the
+// ones that kstat(1) uses. Unknown raw kstats have no Values.
+func (ki KStatInfo) RawValues(data []byte) ([]Value, error) {
+	if ki.Module != "unix" || ki.Instance != 0 {
+		return nil, nil
+	}
+	var size uintptr
+	switch ki.Name {
+	case "sysinfo":
+		size = unsafe.Sizeof(Sysinfo{})
+	case "vminfo":
+		size = unsafe.Sizeof(Vminfo{})
+	case "var":
+		size = unsafe.Sizeof(Var{})
+	default:
+		return nil, nil
+	}
+	if uintptr(len(data)) != size {
+		return nil, fmt.Errorf("%s is wrong size %d (should be %d)", ki, len(data), size)
+	}
+	p := unsafe.Pointer(&data[0])
+
+	switch ki.Name {
+	case "sysinfo":
+		si := *((*Sysinfo)(p))
+		return []Value{
+			ki.uintValue("updates", Uint32, uint64(si.Updates)),
+			ki.uintValue("runque", Uint32, uint64(si.Runque)),
+			ki.uintValue("runocc", Uint32, uint64(si.Runocc)),
+			ki.uintValue("swpque", Uint32, uint64(si.Swpque)),
+			ki.uintValue("swpocc", Uint32, uint64(si.Swpocc)),
+			ki.uintValue("waiting", Uint32, uint64(si.Waiting)),
+		}, nil
+	case "vminfo":
+		vi := *((*Vminfo)(p))
+		return []Value{
+			ki.uintValue("freemem", Uint64, vi.Freemem),
+			ki.uintValue("swap_resv", Uint64, vi.Resv),
+			ki.uintValue("swap_alloc", Uint64, vi.Alloc),
+			ki.uintValue("swap_avail", Uint64, vi.Avail),
+			ki.uintValue("swap_free", Uint64, vi.Free),
+			ki.uintValue("updates", Uint64, vi.Updates),
+		}, nil
+	default:
+		v := *((*Var)(p))
+		return []Value{
+			ki.intValue("v_buf", Int32, int64(v.Buf)),
+			ki.intValue("v_call", Int32, int64(v.Call)),
+			ki.intValue("v_proc", Int32, int64(v.Proc)),
+			ki.intValue("v_maxupttl", Int32, int64(v.Maxupttl)),
+			ki.intValue("v_nglobpris", Int32, int64(v.Nglobpris)),
+			ki.intValue("v_maxsyspri", Int32, int64(v.Maxsyspri)),
+			ki.intValue("v_clist", Int32, int64(v.Clist)),
+			ki.intValue("v_maxup", Int32, int64(v.Maxup)),
+			ki.intValue("v_hbuf", Int32, int64(v.Hbuf)),
+			ki.intValue("v_hmask", Int32, int64(v.Hmask)),
+			ki.intValue("v_pbuf", Int32, int64(v.Pbuf)),
+			ki.intValue("v_sptmap", Int32, int64(v.Sptmap)),
+			ki.intValue("v_maxpmem", Int32, int64(v.Maxpmem)),
+			ki.intValue("v_autoup", Int32, int64(v.Autoup)),
+			ki.intValue("v_bufhwm", Int32, int64(v.Bufhwm)),
+		}, nil
+	}
+}
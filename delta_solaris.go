@@ -0,0 +1,187 @@
+//
+// Differences in KStat statistics between refreshes.
+
+package kstat
+
+// #include <sys/types.h>
+// #include <kstat.h>
+//
+// /* These are in kstat_solaris.go. */
+// uint64_t get_named_uint(kstat_named_t *knp);
+// int64_t get_named_int(kstat_named_t *knp);
+//
+// /* get_nth_named() for a copy of a named kstat's data. */
+// static kstat_named_t *get_nth_named_buf(void *buf, uint_t n) {
+//	return ((kstat_named_t *)buf) + n;
+// }
+//
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// Delta is the change in the numeric statistics of a KStat between
+// two refreshes of it.
+type Delta struct {
+	// Deltas maps statistic names to how much they changed.
+	// Statistics that only exist in one of the two refreshes are
+	// not included. Neither are string statistics. 32-bit
+	// statistics that wrapped around are corrected for (see
+	// ComputeRate), but other statistics that went down have
+	// negative deltas.
+	Deltas map[string]int64
+	// Elapsed is the time between the two refreshes, according
+	// to the KStat's Snaptime.
+	Elapsed time.Duration
+	// Snaptime is the Snaptime of the more recent refresh.
+	Snaptime int64
+	KStat    *KStat
+}
+
+// Rate returns the per-second rate of change of a statistic in a
+// Delta, or 0 if the statistic isn't in it.
+func (d *Delta) Rate(stat string) float64 {
+	if d.Elapsed <= 0 {
+		return 0
+	}
+	return float64(d.Deltas[stat]) / d.Elapsed.Seconds()
+}
+
+// saved is a copy of the data of a named or IO kstat from one
+// refresh, for Delta().
+type saved struct {
+	data     []byte
+	ndata    uint
+	snaptime int64
+}
+
+// save copies the KStat's current data. We reuse the buffer where
+// possible, since many KStats are refreshed over and over.
+func (sv *saved) save(k *KStat) {
+	n := int(k.ksp.ks_data_size)
+	if cap(sv.data) < n {
+		sv.data = make([]byte, n)
+	}
+	sv.data = sv.data[:n]
+	copy(sv.data, unsafe.Slice((*byte)(k.ksp.ks_data), n))
+	sv.ndata = uint(k.ksp.ks_ndata)
+	sv.snaptime = k.Snaptime
+}
+
+// TrackDelta makes the KStat keep copies of its data from its two
+// most recent refreshes, which is what Delta() compares. Since this
+// costs a copy of the data on every refresh, KStats don't do it
+// unless asked. If the KStat already has data, that counts as the
+// first refresh, so one more Refresh() is enough for Delta().
+func (k *KStat) TrackDelta() error {
+	if k.invalid() {
+		return errors.New("invalid KStat or closed token")
+	}
+	if k.Type != NamedStat && k.Type != IoStat {
+		return fmt.Errorf("kstat %s (type %s) is not a named or IO kstat", k, k.Type)
+	}
+	if k.track {
+		return nil
+	}
+	k.track = true
+	if k.ksp.ks_data != nil && k.Snaptime != 0 {
+		k.last.save(k)
+	}
+	return nil
+}
+
+// readDone is called after every successful kstat_read() of the
+// KStat. If we're tracking deltas, it saves a copy of the new data
+// and keeps the previous copy for Delta().
+func (k *KStat) readDone() {
+	k.Snaptime = int64(k.ksp.ks_snaptime)
+	if !k.track || k.ksp.ks_data == nil {
+		return
+	}
+	k.prev, k.last = k.last, k.prev
+	k.last.save(k)
+}
+
+// Delta returns the changes in the statistics of a named or IO KStat
+// between its two most recent refreshes, which requires that you
+// have called TrackDelta() first. It does not refresh the KStat
+// itself; the usual pattern is to call .Refresh() and then .Delta()
+// every so often. Delta fails if the KStat has not been refreshed at
+// least twice since TrackDelta().
+//
+// IO KStats have Deltas for all of the fields of IO, using the same
+// names as kstat(1) and .Values().
+func (k *KStat) Delta() (*Delta, error) {
+	if k.invalid() {
+		return nil, errors.New("invalid KStat or closed token")
+	}
+	if k.Type != NamedStat && k.Type != IoStat {
+		return nil, fmt.Errorf("kstat %s (type %s) is not a named or IO kstat", k, k.Type)
+	}
+	if !k.track {
+		return nil, fmt.Errorf("kstat %s is not tracking deltas", k)
+	}
+	if len(k.prev.data) == 0 || len(k.last.data) == 0 {
+		return nil, fmt.Errorf("kstat %s has not been refreshed twice", k)
+	}
+
+	d := &Delta{
+		Deltas:   make(map[string]int64),
+		Elapsed:  time.Duration(k.last.snaptime - k.prev.snaptime),
+		Snaptime: k.last.snaptime,
+		KStat:    k,
+	}
+
+	if k.Type == IoStat {
+		for _, sv := range []*saved{&k.prev, &k.last} {
+			if uintptr(len(sv.data)) != unsafe.Sizeof(IO{}) {
+				return nil, fmt.Errorf("kstat %s saved data is wrong size %d", k, len(sv.data))
+			}
+		}
+		old := *((*IO)(unsafe.Pointer(&k.prev.data[0])))
+		cur := *((*IO)(unsafe.Pointer(&k.last.data[0])))
+		prev := k.ioValues(&old)
+		for i, v := range k.ioValues(&cur) {
+			if dv, ok := delta(prev[i], v); ok {
+				dv, _ = unwrap32(v.Type, dv)
+				d.Deltas[v.Stat] = int64(dv)
+			}
+		}
+		return d, nil
+	}
+
+	buf := unsafe.Pointer(&k.prev.data[0])
+	prev := make(map[string]*C.struct_kstat_named, k.prev.ndata)
+	for i := uint(0); i < k.prev.ndata; i++ {
+		knp := C.get_nth_named_buf(buf, C.uint_t(i))
+		prev[strndup((*C.char)(unsafe.Pointer(&knp.name)), C.KSTAT_STRLEN)] = knp
+	}
+	buf = unsafe.Pointer(&k.last.data[0])
+	for i := uint(0); i < k.last.ndata; i++ {
+		cur := C.get_nth_named_buf(buf, C.uint_t(i))
+		name := strndup((*C.char)(unsafe.Pointer(&cur.name)), C.KSTAT_STRLEN)
+		knp, ok := prev[name]
+		tp := NamedType(cur.data_type)
+		if !ok || NamedType(knp.data_type) != tp {
+			continue
+		}
+		var dv int64
+		switch tp {
+		case Int32, Int64:
+			dv = int64(C.get_named_int(cur)) - int64(C.get_named_int(knp))
+		case Uint32, Uint64:
+			dv = int64(uint64(C.get_named_uint(cur)) - uint64(C.get_named_uint(knp)))
+		default:
+			continue
+		}
+		if (tp == Int32 || tp == Uint32) && dv < -(1<<31) {
+			dv += 1 << 32
+		}
+		d.Deltas[name] = dv
+	}
+	return d, nil
+}
@@ -0,0 +1,122 @@
+//
+// Differences between Snapshots.
+
+package kstat
+
+import (
+	"time"
+)
+
+// StatDiff is the change in a numeric statistic between two
+// Snapshots.
+type StatDiff struct {
+	// Value and Prev are the newer and older readings.
+	Value Value
+	Prev  Value
+	// Delta is Value - Prev, corrected for 32-bit statistics
+	// wrapping around.
+	Delta float64
+	// Rate is the per-second rate of change, based on the
+	// readings' Snaptimes. It is zero if no time has elapsed.
+	Rate float64
+	// Elapsed is the time between the readings according to
+	// their Snaptimes.
+	Elapsed time.Duration
+}
+
+// SnapshotDiff is the difference between two Snapshots, as produced
+// by Snapshot.Diff().
+type SnapshotDiff struct {
+	// Elapsed is the wall clock time between the Snapshots.
+	Elapsed time.Duration
+	// Stats has a StatDiff for every numeric statistic that is
+	// in both Snapshots, in the order of the newer Snapshot.
+	Stats []StatDiff
+	// Appeared and Disappeared are the kstats that are only in
+	// the newer and only in the older Snapshot respectively. A
+	// kstat that was recreated (ie has a different Crtime) is
+	// counted as both disappearing and appearing.
+	Appeared    []KStatInfo
+	Disappeared []KStatInfo
+}
+
+// kstatKey identifies a particular incarnation of a kstat.
+type kstatKey struct {
+	module   string
+	instance int
+	name     string
+	crtime   int64
+}
+
+func (ki KStatInfo) key() kstatKey {
+	return kstatKey{ki.Module, ki.Instance, ki.Name, ki.Crtime}
+}
+
+// statKey identifies a particular statistic in a particular
+// incarnation of a kstat.
+type statKey struct {
+	kstatKey
+	stat string
+}
+
+func (v Value) key() statKey {
+	return statKey{kstatKey{v.Module, v.Instance, v.Name, v.Crtime}, v.Stat}
+}
+
+// Diff returns the differences between a Snapshot and an older one.
+func (snap *Snapshot) Diff(older *Snapshot) *SnapshotDiff {
+	d := &SnapshotDiff{Elapsed: snap.Time.Sub(older.Time)}
+
+	oldks := make(map[kstatKey]bool, len(older.KStats))
+	for _, ki := range older.KStats {
+		oldks[ki.key()] = true
+	}
+	newks := make(map[kstatKey]bool, len(snap.KStats))
+	for _, ki := range snap.KStats {
+		newks[ki.key()] = true
+		if !oldks[ki.key()] {
+			d.Appeared = append(d.Appeared, ki)
+		}
+	}
+	for _, ki := range older.KStats {
+		if !newks[ki.key()] {
+			d.Disappeared = append(d.Disappeared, ki)
+		}
+	}
+
+	oldvals := make(map[statKey]Value, len(older.Values))
+	for _, v := range older.Values {
+		oldvals[v.key()] = v
+	}
+	for _, v := range snap.Values {
+		prev, ok := oldvals[v.key()]
+		if !ok || prev.Type != v.Type {
+			continue
+		}
+		dv, ok := delta(prev, v)
+		if !ok {
+			continue
+		}
+		dv, _ = unwrap32(v.Type, dv)
+		sd := StatDiff{Value: v, Prev: prev, Delta: dv}
+		// Not all statistics are counters, so unlike ComputeRate
+		// we allow negative rates.
+		if v.Crtime == prev.Crtime && v.Snaptime > prev.Snaptime {
+			sd.Elapsed = time.Duration(v.Snaptime - prev.Snaptime)
+			sd.Rate = dv / sd.Elapsed.Seconds()
+		}
+		d.Stats = append(d.Stats, sd)
+	}
+	return d
+}
+
+// Changed returns only the StatDiffs for statistics that changed.
+func (d *SnapshotDiff) Changed() []StatDiff {
+	var lst []StatDiff
+	for _, sd := range d.Stats {
+		if sd.Delta != 0 {
+			lst = append(lst, sd)
+		}
+	}
+	return lst
+}
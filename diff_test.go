@@ -0,0 +1,58 @@
+//
+// Test Snapshot diffing.
+
+package kstat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	sec := int64(time.Second)
+	now := time.Now()
+	disk := kstat.KStatInfo{Module: "sd", Instance: 1, Name: "sd1", Crtime: 50}
+	cpu := kstat.KStatInfo{Module: "cpu", Instance: 0, Name: "sys", Crtime: 100}
+	older := &kstat.Snapshot{
+		Time:   now,
+		KStats: []kstat.KStatInfo{cpu, disk},
+		Values: []kstat.Value{
+			counter(sec, 100),
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "sysread", Type: kstat.Uint64, UintVal: 5, Crtime: 100, Snaptime: sec},
+			{Module: "sd", Instance: 1, Name: "sd1", Stat: "reads", Type: kstat.Uint32, UintVal: 5, Crtime: 50, Snaptime: sec},
+		},
+	}
+	// sd1 has been recreated and an sd2 has appeared.
+	disk2 := kstat.KStatInfo{Module: "sd", Instance: 2, Name: "sd2", Crtime: 150}
+	ndisk := disk
+	ndisk.Crtime = 300
+	newer := &kstat.Snapshot{
+		Time:   now.Add(2 * time.Second),
+		KStats: []kstat.KStatInfo{cpu, ndisk, disk2},
+		Values: []kstat.Value{
+			counter(3*sec, 300),
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "sysread", Type: kstat.Uint64, UintVal: 5, Crtime: 100, Snaptime: 3 * sec},
+			{Module: "sd", Instance: 1, Name: "sd1", Stat: "reads", Type: kstat.Uint32, UintVal: 1, Crtime: 300, Snaptime: 3 * sec},
+		},
+	}
+
+	d := newer.Diff(older)
+	if d.Elapsed != 2*time.Second {
+		t.Fatalf("bad Elapsed: %s", d.Elapsed)
+	}
+	if len(d.Stats) != 2 {
+		t.Fatalf("wrong number of StatDiffs: %+v", d.Stats)
+	}
+	ch := d.Changed()
+	if len(ch) != 1 || ch[0].Value.Stat != "syscall" || ch[0].Delta != 200 || ch[0].Rate != 100 || ch[0].Elapsed != 2*time.Second {
+		t.Fatalf("bad changed StatDiffs: %+v", ch)
+	}
+	if len(d.Appeared) != 2 || d.Appeared[0] != ndisk || d.Appeared[1] != disk2 {
+		t.Fatalf("bad Appeared: %+v", d.Appeared)
+	}
+	if len(d.Disappeared) != 1 || d.Disappeared[0] != disk {
+		t.Fatalf("bad Disappeared: %+v", d.Disappeared)
+	}
+}
@@ -32,6 +32,16 @@
 // (IO stats are retrieved all at once with GetIO(), because they come
 // to us from the kernel as one single struct so that's what you get.)
 //
+// If you want to collect some set of statistics periodically, a
+// Sampler will do the work of refreshing kstats and handling kstat
+// chain updates for you. You tell it what to collect with Selectors,
+// which are module:instance:name:statistic patterns in the style of
+// kstat(1), and it gives you Samples of Values, which are copies of
+// statistics that don't depend on the Token they came from. For a
+// one-off copy of some or all kstats, use Token.Snapshot(). Selectors,
+// Values, Samples, and Snapshots are usable on any platform, not just
+// Solaris.
+//
 // This is a cgo-based package. Cross compilation is up to you.
 // Goroutine safety is in no way guaranteed because the underlying
 // C kstat library is probably not thread or goroutine safe (and
@@ -0,0 +1,117 @@
+//
+// Histories that keep older readings at lower resolution.
+
+package kstat
+
+import (
+	"math"
+	"time"
+)
+
+// Tier is one level of a TieredHistory: it holds readings at
+// Resolution for Span.
+type Tier struct {
+	Resolution time.Duration
+	Span       time.Duration
+}
+
+// bucket accumulates the readings for one Resolution-sized interval
+// of a downsampled tier.
+type bucket struct {
+	start int64
+	sum   float64
+	n     int
+}
+
+// TieredHistory is a History that downsamples older readings, so that
+// it can cover a long time with a bounded amount of memory. For
+// example, the tiers {time.Second, 5 * time.Minute} and
+// {10 * time.Second, time.Hour} keep the last five minutes at one
+// second resolution and the last hour at ten second resolution, in
+// 660 Points in all.
+//
+// The first tier holds the raw readings; its Resolution should be how
+// often you add them and is only used to decide how many to keep.
+// Each further tier holds the mean of the readings in each
+// Resolution-long interval (by Snaptime), with the Snaptime of the
+// start of the interval. An interval's Point appears once a reading
+// from a later interval is added.
+type TieredHistory struct {
+	tiers []Tier
+	hists []*History
+	accs  []bucket
+}
+
+// NewTieredHistory creates a TieredHistory with the given tiers, which
+// should go from finest to coarsest resolution.
+func NewTieredHistory(tiers ...Tier) *TieredHistory {
+	th := &TieredHistory{tiers: tiers, accs: make([]bucket, len(tiers))}
+	for _, t := range tiers {
+		size := 1
+		if t.Resolution > 0 {
+			size = int(t.Span / t.Resolution)
+		}
+		th.hists = append(th.hists, NewHistory(size))
+	}
+	return th
+}
+
+// Add adds a reading to the TieredHistory.
+func (th *TieredHistory) Add(snaptime int64, v float64) {
+	for i, h := range th.hists {
+		res := int64(th.tiers[i].Resolution)
+		if i == 0 || res <= 0 {
+			h.Add(snaptime, v)
+			continue
+		}
+		b := &th.accs[i]
+		start := snaptime - snaptime%res
+		if b.n > 0 && start != b.start {
+			h.Add(b.start, b.sum/float64(b.n))
+			b.n, b.sum = 0, 0
+		}
+		b.start = start
+		b.sum += v
+		b.n++
+	}
+}
+
+// AddValue adds a numeric Value to the TieredHistory. It returns false
+// (and adds nothing) if the Value is not numeric.
+func (th *TieredHistory) AddValue(v Value) bool {
+	f, ok := v.Float()
+	if ok {
+		th.Add(v.Snaptime, f)
+	}
+	return ok
+}
+
+// Tier returns the History for the i'th tier.
+func (th *TieredHistory) Tier(i int) *History {
+	return th.hists[i]
+}
+
+// Points returns the TieredHistory's readings at the best available
+// resolution, oldest first: the raw readings for as far back as they
+// go, then the Points from the next tier that come before them, and
+// so on.
+func (th *TieredHistory) Points() []Point {
+	var res []Point
+	cutoff := int64(math.MaxInt64)
+	for i, h := range th.hists {
+		width := int64(0)
+		if i > 0 {
+			width = int64(th.tiers[i].Resolution)
+		}
+		pts := h.Points()
+		n := 0
+		for n < len(pts) && pts[n].Snaptime+width <= cutoff {
+			n++
+		}
+		if n > 0 {
+			res = append(pts[:n:n], res...)
+			cutoff = pts[0].Snaptime
+		}
+	}
+	return res
+}
@@ -0,0 +1,47 @@
+//
+// Test downsampling.
+
+package kstat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestTieredHistory(t *testing.T) {
+	sec := int64(time.Second)
+	th := kstat.NewTieredHistory(
+		kstat.Tier{Resolution: time.Second, Span: 5 * time.Second},
+		kstat.Tier{Resolution: 10 * time.Second, Span: time.Minute},
+	)
+	// One reading a second for 40 seconds, with the value being the
+	// second.
+	for i := int64(0); i < 40; i++ {
+		th.Add(i*sec, float64(i))
+	}
+	if h := th.Tier(0); h.Len() != 5 || h.Min() != 35 {
+		t.Fatalf("bad raw tier: %+v", h.Points())
+	}
+	// The 30-39 interval isn't complete yet.
+	h := th.Tier(1)
+	if h.Len() != 3 || h.Cap() != 6 {
+		t.Fatalf("bad downsampled tier: %+v", h.Points())
+	}
+	if p, _ := h.Last(); p.Snaptime != 20*sec || p.Value != 24.5 {
+		t.Fatalf("bad downsampled Point: %+v", p)
+	}
+
+	// Points should be the three complete ten second intervals,
+	// ending before the raw readings, followed by the raw readings.
+	pts := th.Points()
+	if len(pts) != 8 || pts[0].Value != 4.5 || pts[2].Value != 24.5 || pts[3].Value != 35 || pts[7].Value != 39 {
+		t.Fatalf("bad Points: %+v", pts)
+	}
+	for i := 1; i < len(pts); i++ {
+		if pts[i].Snaptime <= pts[i-1].Snaptime {
+			t.Fatalf("Points out of order: %+v", pts)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+//
+// Exponentially weighted moving averages of statistics.
+
+package kstat
+
+// EWMA is an exponentially weighted moving average. Each new value x
+// moves the average to alpha*x + (1-alpha)*average, so higher alphas
+// follow changes faster and lower ones smooth more. The first value
+// becomes the initial average.
+type EWMA struct {
+	alpha float64
+	value float64
+	valid bool
+}
+
+// NewEWMA creates an EWMA with the given alpha, which should be
+// between 0 and 1.
+func NewEWMA(alpha float64) *EWMA {
+	return &EWMA{alpha: alpha}
+}
+
+// Update adds a value to the EWMA and returns the new average.
+func (e *EWMA) Update(x float64) float64 {
+	if !e.valid {
+		e.value = x
+		e.valid = true
+	} else {
+		e.value = e.alpha*x + (1-e.alpha)*e.value
+	}
+	return e.value
+}
+
+// Value returns the current average, or false if there have been no
+// values yet.
+func (e *EWMA) Value() (float64, bool) {
+	return e.value, e.valid
+}
+
+// Smoother is a Processor that keeps EWMAs of selected statistics
+// and adds them to each Sample as Derived values. A value Smoother
+// smooths the values of statistics, which is what you want for gauges
+// such as free memory; it names them "ewma(<stat>)". A rate Smoother
+// smooths the per-second rates of counters, and names them
+// "ewma_rate(<stat>)".
+type Smoother struct {
+	alpha float64
+	sels  []Selector
+	ct    *CounterTracker
+	ewmas map[string]*EWMA
+}
+
+// NewValueSmoother creates a Smoother for the values of the
+// statistics selected by sels (or of all numeric statistics, if there
+// are no selectors).
+func NewValueSmoother(alpha float64, sels ...Selector) *Smoother {
+	return &Smoother{alpha: alpha, sels: sels, ewmas: make(map[string]*EWMA)}
+}
+
+// NewRateSmoother creates a Smoother for the rates of the counters
+// selected by sels (or of all numeric statistics, if there are no
+// selectors). There is no rate, and so no Derived value, until a
+// counter has been seen in two Samples.
+func NewRateSmoother(alpha float64, sels ...Selector) *Smoother {
+	s := NewValueSmoother(alpha, sels...)
+	s.ct = NewCounterTracker()
+	return s
+}
+
+func (s *Smoother) wanted(v Value) bool {
+	if len(s.sels) == 0 {
+		return true
+	}
+	for _, sel := range s.sels {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Process updates the EWMAs from a Sample and adds their current
+// values to it.
+func (s *Smoother) Process(sm *Sample) {
+	for _, v := range sm.Values {
+		if !s.wanted(v) {
+			continue
+		}
+		x, ok := v.Float()
+		if !ok {
+			continue
+		}
+		name := "ewma(" + v.String() + ")"
+		if s.ct != nil {
+			r, ok := s.ct.Update(v)
+			if !ok {
+				continue
+			}
+			x = r.Rate
+			name = "ewma_rate(" + v.String() + ")"
+		}
+		e, ok := s.ewmas[name]
+		if !ok {
+			e = NewEWMA(s.alpha)
+			s.ewmas[name] = e
+		}
+		sm.Derived = append(sm.Derived, Derived{Name: name, Value: e.Update(x)})
+	}
+}
+
+// Get returns the current smoothed value of a statistic, by its
+// Derived name.
+func (s *Smoother) Get(name string) (float64, bool) {
+	if e, ok := s.ewmas[name]; ok {
+		return e.Value()
+	}
+	return 0, false
+}
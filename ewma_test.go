@@ -0,0 +1,78 @@
+//
+// Test EWMAs.
+
+package kstat_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestEWMA(t *testing.T) {
+	e := kstat.NewEWMA(0.5)
+	if _, ok := e.Value(); ok {
+		t.Fatalf("new EWMA has a value")
+	}
+	for _, c := range []struct{ in, out float64 }{{10, 10}, {20, 15}, {15, 15}, {35, 25}} {
+		if r := e.Update(c.in); r != c.out {
+			t.Fatalf("EWMA Update(%f) gave %f, expected %f", c.in, r, c.out)
+		}
+	}
+}
+
+func TestSmoothers(t *testing.T) {
+	sec := int64(time.Second)
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	vs := kstat.NewValueSmoother(0.5, sel)
+	rs := kstat.NewRateSmoother(0.5, sel)
+	samples := []*kstat.Sample{}
+	for i, v := range []uint64{0, 10, 40, 70} {
+		sm := &kstat.Sample{}
+		sm.Values = []kstat.Value{counter(int64(i+1)*sec, v)}
+		vs.Process(sm)
+		rs.Process(sm)
+		samples = append(samples, sm)
+	}
+	// Values: 0, 5, 22.5, 46.25. Rates: -, 10, 30, 30 -> 10, 20, 25.
+	if v, ok := samples[3].Get("ewma(cpu:0:sys:syscall)"); !ok || v != 46.25 {
+		t.Fatalf("bad smoothed value: %v %f", ok, v)
+	}
+	if _, ok := samples[0].Get("ewma_rate(cpu:0:sys:syscall)"); ok {
+		t.Fatalf("smoothed rate from a single Sample")
+	}
+	if v, ok := samples[3].Get("ewma_rate(cpu:0:sys:syscall)"); !ok || v != 25 {
+		t.Fatalf("bad smoothed rate: %v %f", ok, v)
+	}
+	if v, ok := rs.Get("ewma_rate(cpu:0:sys:syscall)"); !ok || v != 25 {
+		t.Fatalf("bad Smoother Get: %v %f", ok, v)
+	}
+}
+
+// Replayers run Processors on the Samples they produce.
+func TestReplayProcessor(t *testing.T) {
+	var buf bytes.Buffer
+	r := kstat.NewRecorder(&buf)
+	for i := 0; i < 2; i++ {
+		if err := r.Record(testSnapshot()); err != nil {
+			t.Fatalf("Record failed: %s", err)
+		}
+	}
+	r.Flush()
+
+	rp := kstat.NewReplayer(&buf)
+	rp.AddProcessor(kstat.ProcessorFunc(func(sm *kstat.Sample) {
+		sm.Derived = append(sm.Derived, kstat.Derived{Name: "count", Value: float64(len(sm.Values))})
+	}))
+	for i := 0; i < 2; i++ {
+		sm, err := rp.Sample()
+		if err != nil {
+			t.Fatalf("Sample failed: %s", err)
+		}
+		if v, ok := sm.Get("count"); !ok || v != 4 {
+			t.Fatalf("Processor did not run: %+v", sm.Derived)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+//
+// Derived metrics defined by arithmetic expressions over statistics.
+
+package kstat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expr is a parsed arithmetic expression over statistics, used to
+// define derived metrics such as a cache hit ratio. Expressions are
+// made up of numbers, statistic references, the operators + - * /,
+// and parentheses. A statistic reference is a selector in the form
+// accepted by ParseSelector; its value is the sum of the values of
+// all of the numeric statistics it matches, so "cpu:*:sys:syscall"
+// is the total across all CPUs. Two functions can be applied to
+// references:
+//
+//	rate(ref)   the sum of the per-second rates of the statistics
+//	delta(ref)  the sum of their changes since the previous Sample
+//
+// For example, the DNLC hit ratio over each interval is:
+//
+//	delta(unix:0:dnlcstats:hits) / (delta(unix:0:dnlcstats:hits) + delta(unix:0:dnlcstats:misses))
+//
+// Since statistic names and globs may contain '-' and '*', an
+// operator that follows a reference must be separated from it by
+// whitespace.
+//
+// Expressions with rate() or delta() keep the previous readings of
+// their statistics, so an Expr should be evaluated on each Sample in
+// turn and not shared between different streams of Samples.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+type exprNode interface {
+	eval(sm *Sample) (float64, bool)
+}
+
+type numNode float64
+
+func (n numNode) eval(*Sample) (float64, bool) {
+	return float64(n), true
+}
+
+type negNode struct {
+	x exprNode
+}
+
+func (n negNode) eval(sm *Sample) (float64, bool) {
+	x, ok := n.x.eval(sm)
+	return -x, ok
+}
+
+type binNode struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n binNode) eval(sm *Sample) (float64, bool) {
+	// Both sides are always evaluated so that any rate() and
+	// delta() references see every Sample.
+	l, lok := n.l.eval(sm)
+	r, rok := n.r.eval(sm)
+	if !lok || !rok {
+		return 0, false
+	}
+	var x float64
+	switch n.op {
+	case '+':
+		x = l + r
+	case '-':
+		x = l - r
+	case '*':
+		x = l * r
+	default:
+		x = l / r
+	}
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, false
+	}
+	return x, true
+}
+
+// refNode is a statistic reference, possibly inside rate() or
+// delta().
+type refNode struct {
+	sel  Selector
+	fn   string
+	last map[string]Value
+}
+
+func (n *refNode) eval(sm *Sample) (float64, bool) {
+	sum := 0.0
+	found := false
+	last := make(map[string]Value)
+	for _, v := range sm.Values {
+		if !n.sel.Match(v) {
+			continue
+		}
+		x, ok := v.Float()
+		if !ok {
+			continue
+		}
+		if n.fn != "" {
+			key := v.String()
+			last[key] = v
+			prev, ok := n.last[key]
+			if !ok {
+				continue
+			}
+			r, ok := ComputeRate(prev, v)
+			if !ok {
+				continue
+			}
+			x = r.Rate
+			if n.fn == "delta" {
+				x = r.Delta
+			}
+		}
+		sum += x
+		found = true
+	}
+	if n.fn != "" {
+		n.last = last
+	}
+	return sum, found
+}
+
+// ParseExpr parses an expression.
+func ParseExpr(s string) (*Expr, error) {
+	p := &exprParser{src: s}
+	p.next()
+	root, err := p.expr()
+	if err == nil && p.tok != "" {
+		err = p.errorf("unexpected %q", p.tok)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+// Eval evaluates the expression against a Sample. It returns false if
+// the expression has no value, because a reference matched no
+// numeric statistics, a rate() or delta() has no previous reading, or
+// the result is infinite or not a number (for example, from a
+// division by zero).
+func (e *Expr) Eval(sm *Sample) (float64, bool) {
+	return e.root.eval(sm)
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// exprParser is a recursive descent parser for expressions. tok is
+// the current token, which is "" at the end of the input.
+type exprParser struct {
+	src string
+	pos int
+	tok string
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q: %s", p.src, fmt.Sprintf(format, args...))
+}
+
+func isRefChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_.:$*?-,", c) >= 0
+}
+
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	switch {
+	case p.pos == len(p.src):
+	case strings.IndexByte("+-*/()", p.src[p.pos]) >= 0:
+		p.pos++
+	case p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		// Statistic references can start with a digit.
+		if p.pos < len(p.src) && isRefChar(p.src[p.pos]) && p.src[p.pos] != '*' && p.src[p.pos] != '-' {
+			for p.pos < len(p.src) && isRefChar(p.src[p.pos]) {
+				p.pos++
+			}
+		}
+	default:
+		for p.pos < len(p.src) && isRefChar(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == start {
+			p.pos++
+		}
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// expr := term { ('+' | '-') term }
+func (p *exprParser) expr() (exprNode, error) {
+	l, err := p.term()
+	for err == nil && (p.tok == "+" || p.tok == "-") {
+		op := p.tok[0]
+		p.next()
+		var r exprNode
+		if r, err = p.term(); err == nil {
+			l = binNode{op, l, r}
+		}
+	}
+	return l, err
+}
+
+// term := unary { ('*' | '/') unary }
+func (p *exprParser) term() (exprNode, error) {
+	l, err := p.unary()
+	for err == nil && (p.tok == "*" || p.tok == "/") {
+		op := p.tok[0]
+		p.next()
+		var r exprNode
+		if r, err = p.unary(); err == nil {
+			l = binNode{op, l, r}
+		}
+	}
+	return l, err
+}
+
+// unary := '-' unary | primary
+func (p *exprParser) unary() (exprNode, error) {
+	if p.tok == "-" {
+		p.next()
+		x, err := p.unary()
+		return negNode{x}, err
+	}
+	return p.primary()
+}
+
+// primary := number | ref | ('rate' | 'delta') '(' ref ')' | '(' expr ')'
+func (p *exprParser) primary() (exprNode, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, p.errorf("unexpected end")
+	case tok == "(":
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return x, nil
+	case tok == "rate" || tok == "delta":
+		p.next()
+		if p.tok != "(" {
+			return nil, p.errorf("%s must be followed by (", tok)
+		}
+		p.next()
+		ref, err := p.ref()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, p.errorf("missing ) after %s(", tok)
+		}
+		p.next()
+		ref.fn = tok
+		return ref, nil
+	case strings.IndexByte(tok, ':') >= 0:
+		return p.ref()
+	}
+	f, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return nil, p.errorf("unexpected %q", tok)
+	}
+	p.next()
+	return numNode(f), nil
+}
+
+func (p *exprParser) ref() (*refNode, error) {
+	if strings.IndexByte(p.tok, ':') < 0 {
+		return nil, p.errorf("%q is not a statistic", p.tok)
+	}
+	sel, err := ParseSelector(p.tok)
+	if err != nil {
+		return nil, p.errorf("%s", err)
+	}
+	p.next()
+	return &refNode{sel: sel}, nil
+}
+
+// Metric is a Processor that evaluates an Expr on each Sample and
+// adds the result as a Derived value with the Metric's name, if the
+// Expr has a value. Add Metrics to a Sampler (or Replayer) with
+// AddProcessor to have them emitted with every Sample.
+type Metric struct {
+	Name string
+	Expr *Expr
+}
+
+// NewMetric creates a Metric from a name and an expression.
+func NewMetric(name, expr string) (*Metric, error) {
+	e, err := ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Metric{Name: name, Expr: e}, nil
+}
+
+// Process evaluates the Metric and adds it to the Sample.
+func (m *Metric) Process(sm *Sample) {
+	if x, ok := m.Expr.Eval(sm); ok {
+		sm.Derived = append(sm.Derived, Derived{Name: m.Name, Value: x})
+	}
+}
@@ -0,0 +1,81 @@
+//
+// Test expressions.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func dnlcSample(snaptime int64, hits, misses uint64) *kstat.Sample {
+	h := counter(snaptime, hits)
+	h.Module, h.Name, h.Stat = "unix", "dnlcstats", "hits"
+	m := h
+	m.Stat, m.UintVal = "misses", misses
+	return &kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{h, m}}}
+}
+
+func TestExprEval(t *testing.T) {
+	sm := &kstat.Sample{Snapshot: *cpuSnapshot(1, 10, 30)}
+	for src, want := range map[string]float64{
+		"1 + 2 * 3":             7,
+		"(1 + 2) * 3":           9,
+		"-2 - -3":               1,
+		"8/4/2":                 1,
+		"1e3":                   1000,
+		"cpu:0:sys:syscall":     10,
+		"cpu:*:sys:syscall / 2": 20,
+		"100 * cpu:1:sys:syscall / (cpu:0:sys:syscall + cpu:1:sys:syscall)": 75,
+	} {
+		e, err := kstat.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) failed: %s", src, err)
+		}
+		if x, ok := e.Eval(sm); !ok || math.Abs(x-want) > 1e-9 {
+			t.Fatalf("%q evaluated to %v %f, not %f", src, ok, x, want)
+		}
+	}
+	for _, src := range []string{"cpu:0:sys:nosuch", "1 / 0", "cpu:0:sys:syscall / (1 - 1)"} {
+		e, _ := kstat.ParseExpr(src)
+		if x, ok := e.Eval(sm); ok {
+			t.Fatalf("%q has a value: %f", src, x)
+		}
+	}
+}
+
+func TestExprParseErrors(t *testing.T) {
+	for _, src := range []string{"", "1 +", "(1", "1 2", "rate(1)", "rate cpu:0:sys:x", "foo", "cpu:x:sys:y", "1 + )"} {
+		if _, err := kstat.ParseExpr(src); err == nil {
+			t.Fatalf("ParseExpr(%q) succeeded", src)
+		}
+	}
+}
+
+func TestMetric(t *testing.T) {
+	sec := int64(time.Second)
+	m, err := kstat.NewMetric("dnlc_hit_ratio", "delta(unix:0:dnlcstats:hits) / (delta(unix:0:dnlcstats:hits) + delta(unix:0:dnlcstats:misses))")
+	if err != nil {
+		t.Fatalf("NewMetric failed: %s", err)
+	}
+	r, _ := kstat.NewMetric("hits_per_sec", "rate(unix:0:dnlcstats:hits)")
+
+	sm := dnlcSample(sec, 100, 100)
+	m.Process(sm)
+	r.Process(sm)
+	if len(sm.Derived) != 0 {
+		t.Fatalf("Metrics have values without a previous Sample: %+v", sm.Derived)
+	}
+	sm = dnlcSample(3*sec, 190, 110)
+	m.Process(sm)
+	r.Process(sm)
+	if v, ok := sm.Get("dnlc_hit_ratio"); !ok || v != 0.9 {
+		t.Fatalf("bad dnlc_hit_ratio: %v %f", ok, v)
+	}
+	if v, ok := sm.Get("hits_per_sec"); !ok || v != 45 {
+		t.Fatalf("bad hits_per_sec: %v %f", ok, v)
+	}
+}
@@ -0,0 +1,112 @@
+//
+// Publishing Snapshots through expvar.
+
+package kstat
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// SnapshotVar is an expvar.Var whose value is a Snapshot, in the JSON
+// form that Snapshot.MarshalJSON produces. Its Snapshot can come from
+// a function that is called when the variable is read, or be set from
+// outside (for example by a Sampler, since a SnapshotVar is also a
+// Processor), or both.
+type SnapshotVar struct {
+	mu     sync.Mutex
+	fn     func() (*Snapshot, error)
+	maxAge time.Duration
+	snap   *Snapshot
+	taken  time.Time
+	err    error
+}
+
+// NewSnapshotVar creates a SnapshotVar that gets its Snapshot by
+// calling fn when it's read, unless its current Snapshot is less than
+// maxAge old. A maxAge of 0 calls fn on every read. If fn is nil, the
+// SnapshotVar only has what's given to Set or Process. Because fn is
+// called with the SnapshotVar locked, it can use a Token that nothing
+// else uses without further locking, for example:
+//
+//	kstat.NewSnapshotVar(func() (*kstat.Snapshot, error) { return tok.Snapshot(sels...) }, 0)
+func NewSnapshotVar(fn func() (*Snapshot, error), maxAge time.Duration) *SnapshotVar {
+	return &SnapshotVar{fn: fn, maxAge: maxAge}
+}
+
+// PublishSnapshot creates a SnapshotVar with NewSnapshotVar and
+// publishes it under name with expvar.Publish, which panics if the
+// name is already in use.
+func PublishSnapshot(name string, fn func() (*Snapshot, error), maxAge time.Duration) *SnapshotVar {
+	sv := NewSnapshotVar(fn, maxAge)
+	expvar.Publish(name, sv)
+	return sv
+}
+
+// Set sets the SnapshotVar's current Snapshot. The SnapshotVar
+// keeps the Snapshot, so it must not be changed afterward.
+func (sv *SnapshotVar) Set(snap *Snapshot) {
+	sv.mu.Lock()
+	sv.snap, sv.taken, sv.err = snap, time.Now(), nil
+	sv.mu.Unlock()
+}
+
+// Process sets the SnapshotVar's current Snapshot to the Sample's
+// Snapshot, so that adding a SnapshotVar to a Sampler with
+// AddProcessor publishes each Sample as it's taken.
+func (sv *SnapshotVar) Process(sm *Sample) {
+	snap := sm.Snapshot
+	sv.Set(&snap)
+}
+
+// Write sets the SnapshotVar's current Snapshot to the Sample's
+// Snapshot, the same as Process. With Write, Flush, and Close, a
+// SnapshotVar is a Sink that holds the latest Sample; its Snapshot
+// method can then feed a MetricsHandler or anything else that wants
+// a func() (*Snapshot, error).
+func (sv *SnapshotVar) Write(sm *Sample) error {
+	sv.Process(sm)
+	return nil
+}
+
+// Flush does nothing.
+func (sv *SnapshotVar) Flush() error {
+	return nil
+}
+
+// Close does nothing; a SnapshotVar can't be unpublished.
+func (sv *SnapshotVar) Close() error {
+	return nil
+}
+
+// Snapshot returns the SnapshotVar's current Snapshot, refreshing it
+// first if necessary, or the error from refreshing it.
+func (sv *SnapshotVar) Snapshot() (*Snapshot, error) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if sv.fn != nil && (sv.snap == nil || time.Since(sv.taken) >= sv.maxAge) {
+		snap, err := sv.fn()
+		if err == nil {
+			sv.snap = snap
+		}
+		sv.taken, sv.err = time.Now(), err
+	}
+	return sv.snap, sv.err
+}
+
+// String returns the JSON form of the SnapshotVar's current Snapshot,
+// or {"error": "..."} if it couldn't be refreshed. A SnapshotVar that
+// has no Snapshot yet is null.
+func (sv *SnapshotVar) String() string {
+	snap, err := sv.Snapshot()
+	var b []byte
+	if err == nil {
+		b, err = json.Marshal(snap)
+	}
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return string(b)
+}
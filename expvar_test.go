@@ -0,0 +1,57 @@
+//
+// Test publishing through expvar.
+
+package kstat_test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestSnapshotVar(t *testing.T) {
+	calls := 0
+	sv := kstat.PublishSnapshot("kstat-test", func() (*kstat.Snapshot, error) {
+		calls++
+		return testSnapshot(), nil
+	}, time.Hour)
+	if expvar.Get("kstat-test") != sv {
+		t.Fatalf("SnapshotVar not published")
+	}
+
+	var snap kstat.Snapshot
+	for i := 0; i < 2; i++ {
+		if err := json.Unmarshal([]byte(sv.String()), &snap); err != nil {
+			t.Fatalf("bad JSON %s: %s", sv, err)
+		}
+	}
+	if calls != 1 || !reflect.DeepEqual(snap, *testSnapshot()) {
+		t.Fatalf("wrong Snapshot after %d calls: %+v", calls, snap)
+	}
+
+	// Samples replace the Snapshot.
+	sm := &kstat.Sample{Snapshot: *testSnapshot()}
+	sm.Values = sm.Values[:1]
+	sv.Process(sm)
+	if s, _ := sv.Snapshot(); calls != 1 || len(s.Values) != 1 {
+		t.Fatalf("Process did not set the Snapshot: %+v", s)
+	}
+}
+
+func TestSnapshotVarError(t *testing.T) {
+	sv := kstat.NewSnapshotVar(nil, 0)
+	if s := sv.String(); s != "null" {
+		t.Fatalf("empty SnapshotVar is %s", s)
+	}
+	sv = kstat.NewSnapshotVar(func() (*kstat.Snapshot, error) {
+		return nil, errors.New("no kstats")
+	}, 0)
+	if s := sv.String(); s != `{"error":"no kstats"}` {
+		t.Fatalf("failing SnapshotVar is %s", s)
+	}
+}
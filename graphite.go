@@ -0,0 +1,156 @@
+//
+// Sending Samples to Graphite.
+
+package kstat
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// GraphiteOptions control how a GraphiteSink sends statistics.
+type GraphiteOptions struct {
+	// Prefix is put in front of every metric path, with a "."
+	// after it if it's not blank. It's normally the host name.
+	// Dots in it are kept, so it can be several path components.
+	Prefix string
+
+	// Dial connects to the Graphite server. If it's nil,
+	// GraphiteSink uses a TCP connection with a 10 second timeout.
+	Dial func(addr string) (net.Conn, error)
+
+	// MinBackoff and MaxBackoff bound how long a GraphiteSink waits
+	// before trying to reconnect after a failure. The wait starts
+	// at MinBackoff and doubles with each failure up to MaxBackoff.
+	// They default to one second and one minute.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Naming maps statistics to metric paths. The Prefix is put
+	// in front of them and label values are added to the end as
+	// extra components.
+	Naming *Naming
+}
+
+// GraphiteSink sends Samples to a Graphite (Carbon) server in its
+// plaintext protocol, one "path value timestamp" line per numeric
+// statistic. Paths are prefix.module.instance.name.stat, with dots
+// and other troublesome characters in the components turned into
+// underscores. Derived values are sent under their sanitized names.
+//
+// A GraphiteSink connects lazily and reconnects if the connection
+// fails. Rather than block its caller, it fails Writes while it's
+// waiting to reconnect, so Samples during an outage are dropped.
+type GraphiteSink struct {
+	addr    string
+	opts    GraphiteOptions
+	conn    net.Conn
+	backoff time.Duration
+	retry   time.Time
+	buf     bytes.Buffer
+}
+
+// NewGraphiteSink creates a GraphiteSink that sends to the Graphite
+// server at addr (a host:port). It doesn't connect until the first
+// Write.
+func NewGraphiteSink(addr string, opts GraphiteOptions) *GraphiteSink {
+	if opts.Dial == nil {
+		opts.Dial = func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, 10*time.Second)
+		}
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+	return &GraphiteSink{addr: addr, opts: opts}
+}
+
+// Write sends a Sample's numeric statistics and Derived values,
+// connecting first if necessary. If the send fails, the connection
+// is closed and the next Write reconnects once the backoff has
+// passed.
+func (g *GraphiteSink) Write(sm *Sample) error {
+	if g.conn == nil {
+		if time.Now().Before(g.retry) {
+			return fmt.Errorf("graphite %s: not reconnecting until %s", g.addr, g.retry.Format(time.TimeOnly))
+		}
+		conn, err := g.opts.Dial(g.addr)
+		if err != nil {
+			g.failed()
+			return err
+		}
+		g.conn = conn
+	}
+
+	ts := strconv.FormatInt(sm.Time.Unix(), 10)
+	g.buf.Reset()
+	for _, v := range sm.Values {
+		f, ok := v.Float()
+		if !ok {
+			continue
+		}
+		if mn, ok := g.opts.Naming.Map(v); ok {
+			g.line(dottedName(mn.dotted()...), f, ts)
+		} else {
+			g.line(dottedName(v.Module, strconv.Itoa(v.Instance), v.Name, v.Stat), f, ts)
+		}
+	}
+	for _, d := range sm.Derived {
+		g.line(dottedName(d.Name), d.Value, ts)
+	}
+	if _, err := g.conn.Write(g.buf.Bytes()); err != nil {
+		g.conn.Close()
+		g.conn = nil
+		g.failed()
+		return err
+	}
+	g.backoff = 0
+	return nil
+}
+
+func (g *GraphiteSink) line(path string, f float64, ts string) {
+	if g.opts.Prefix != "" {
+		g.buf.WriteString(g.opts.Prefix)
+		g.buf.WriteByte('.')
+	}
+	g.buf.WriteString(path)
+	g.buf.WriteByte(' ')
+	g.buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	g.buf.WriteByte(' ')
+	g.buf.WriteString(ts)
+	g.buf.WriteByte('\n')
+}
+
+// failed schedules the next connection attempt.
+func (g *GraphiteSink) failed() {
+	if g.backoff == 0 {
+		g.backoff = g.opts.MinBackoff
+	} else if g.backoff *= 2; g.backoff > g.opts.MaxBackoff {
+		g.backoff = g.opts.MaxBackoff
+	}
+	g.retry = time.Now().Add(g.backoff)
+}
+
+// Flush does nothing, since Write sends everything immediately.
+func (g *GraphiteSink) Flush() error {
+	return nil
+}
+
+// Close closes the GraphiteSink's connection, if it has one.
+func (g *GraphiteSink) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
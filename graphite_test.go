@@ -0,0 +1,78 @@
+//
+// Test sending to Graphite.
+
+package kstat_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestGraphiteSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+
+	g := kstat.NewGraphiteSink(ln.Addr().String(), kstat.GraphiteOptions{Prefix: "servers.h1"})
+	defer g.Close()
+	sm := &kstat.Sample{}
+	sm.Time = time.Unix(1440756000, 0)
+	sm.Values = []kstat.Value{counter(1e9, 100), {Module: "zfs", Name: "arcstats", Stat: "c", Type: kstat.Uint64, UintVal: 4096}}
+	sm.Derived = []kstat.Derived{{Name: "avg.load", Value: 0.5}}
+	if err = g.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	for _, exp := range []string{
+		"servers.h1.cpu.0.sys.syscall 100 1440756000",
+		"servers.h1.zfs.0.arcstats.c 4096 1440756000",
+		"servers.h1.avg_load 0.5 1440756000",
+	} {
+		if l := <-lines; l != exp {
+			t.Fatalf("wrong line %q, expected %q", l, exp)
+		}
+	}
+}
+
+func TestGraphiteBackoff(t *testing.T) {
+	dials := 0
+	g := kstat.NewGraphiteSink("nowhere:2003", kstat.GraphiteOptions{
+		Dial: func(addr string) (net.Conn, error) {
+			dials++
+			return nil, errors.New("connection refused")
+		},
+		MinBackoff: 50 * time.Millisecond,
+	})
+	sm := &kstat.Sample{}
+	for i := 0; i < 3; i++ {
+		if err := g.Write(sm); err == nil {
+			t.Fatalf("Write %d did not fail", i)
+		}
+	}
+	if dials != 1 {
+		t.Fatalf("reconnected during backoff: %d dials", dials)
+	}
+	time.Sleep(60 * time.Millisecond)
+	g.Write(sm)
+	if dials != 2 {
+		t.Fatalf("did not reconnect after backoff: %d dials", dials)
+	}
+}
@@ -0,0 +1,106 @@
+//
+// Serving Snapshots over HTTP.
+
+package kstat
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content types that MetricsHandler serves.
+const (
+	openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	promTextType    = "text/plain; version=0.0.4; charset=utf-8"
+	jsonType        = "application/json"
+)
+
+// MetricsHandler is an http.Handler that takes a Snapshot for every
+// request and serves it as metrics. It serves the OpenMetrics text
+// format, the Prometheus text format, or the JSON form of the
+// Snapshot, depending on which the request's Accept header prefers;
+// if there's no Accept header (or it accepts none of them), it serves
+// the Prometheus text format, as a Prometheus server expects.
+//
+// To bolt kstat metrics onto an existing server:
+//
+//	http.Handle("/metrics", kstat.NewMetricsHandler(func() (*kstat.Snapshot, error) {
+//		return tok.Snapshot(sels...)
+//	}, kstat.OpenMetricsOptions{}))
+type MetricsHandler struct {
+	mu   sync.Mutex
+	fn   func() (*Snapshot, error)
+	opts OpenMetricsOptions
+}
+
+// NewMetricsHandler creates a MetricsHandler that gets Snapshots from
+// fn and writes them in the text formats with opts. Calls to fn are
+// serialized, so it can use a Token that nothing else is using.
+func NewMetricsHandler(fn func() (*Snapshot, error), opts OpenMetricsOptions) *MetricsHandler {
+	return &MetricsHandler{fn: fn, opts: opts}
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	snap, err := h.fn()
+	h.mu.Unlock()
+	if err != nil {
+		http.Error(w, "taking kstat snapshot: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var b bytes.Buffer
+	ctype := negotiate(r.Header.Get("Accept"))
+	switch ctype {
+	case jsonType:
+		err = json.NewEncoder(&b).Encode(snap)
+	case openMetricsType:
+		err = snap.WriteOpenMetrics(&b, h.opts)
+	default:
+		err = snap.WritePrometheusText(&b, h.opts)
+	}
+	if err != nil {
+		http.Error(w, "encoding kstat snapshot: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	w.Write(b.Bytes())
+}
+
+// negotiate picks the content type to serve for an Accept header.
+// It takes the supported media type with the highest q value, with
+// ties going to the first one listed.
+func negotiate(accept string) string {
+	best, bestq := promTextType, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		var ctype string
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case "application/json":
+			ctype = jsonType
+		case "application/openmetrics-text":
+			ctype = openMetricsType
+		case "text/plain":
+			ctype = promTextType
+		default:
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > bestq {
+			best, bestq = ctype, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,56 @@
+//
+// Test serving metrics over HTTP.
+
+package kstat_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	h := kstat.NewMetricsHandler(func() (*kstat.Snapshot, error) {
+		return testSnapshot(), nil
+	}, kstat.OpenMetricsOptions{})
+
+	for _, c := range []struct {
+		accept, ctype, prefix string
+	}{
+		{"", "text/plain; version=0.0.4", "# TYPE kstat_cpu_syscall untyped"},
+		{"application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+			"application/openmetrics-text", "# TYPE kstat_cpu_syscall unknown"},
+		{"text/plain;q=0.5, application/json", "application/json", `{"version":1,`},
+		{"image/png", "text/plain", "# TYPE"},
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), c.ctype) || !strings.HasPrefix(rec.Body.String(), c.prefix) {
+			t.Fatalf("Accept %q: got %d %q\n%s", c.accept, rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+		}
+		if c.ctype == "application/json" {
+			var snap kstat.Snapshot
+			if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+				t.Fatalf("bad JSON: %s", err)
+			}
+		}
+	}
+
+	h = kstat.NewMetricsHandler(func() (*kstat.Snapshot, error) {
+		return nil, errors.New("no kstats")
+	}, kstat.OpenMetricsOptions{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "no kstats") {
+		t.Fatalf("failing Snapshot gave %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,184 @@
+//
+// Short in-memory histories of statistics.
+
+package kstat
+
+import (
+	"math"
+)
+
+// Point is one reading in a History.
+type Point struct {
+	Snaptime int64
+	Value    float64
+}
+
+// History holds the last N readings of a numeric statistic in a ring
+// buffer, for things like dashboards that want a short history of
+// values without a full time series database. To track a Named, add
+// its .Value() each time you get it.
+type History struct {
+	pts   []Point
+	start int
+	n     int
+}
+
+// NewHistory creates a History that holds up to size readings.
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+	return &History{pts: make([]Point, size)}
+}
+
+// Add adds a reading to the History, discarding the oldest reading if
+// the History is full.
+func (h *History) Add(snaptime int64, v float64) {
+	h.pts[(h.start+h.n)%len(h.pts)] = Point{snaptime, v}
+	if h.n < len(h.pts) {
+		h.n++
+	} else {
+		h.start = (h.start + 1) % len(h.pts)
+	}
+}
+
+// AddValue adds a numeric Value to the History. It returns false
+// (and adds nothing) if the Value is not numeric.
+func (h *History) AddValue(v Value) bool {
+	f, ok := v.Float()
+	if ok {
+		h.Add(v.Snaptime, f)
+	}
+	return ok
+}
+
+// Len returns how many readings the History currently holds.
+func (h *History) Len() int {
+	return h.n
+}
+
+// Cap returns how many readings the History can hold.
+func (h *History) Cap() int {
+	return len(h.pts)
+}
+
+// Points returns the readings in the History, oldest first.
+func (h *History) Points() []Point {
+	lst := make([]Point, h.n)
+	for i := range lst {
+		lst[i] = h.pts[(h.start+i)%len(h.pts)]
+	}
+	return lst
+}
+
+// Last returns the most recent reading, or false if the History is
+// empty.
+func (h *History) Last() (Point, bool) {
+	if h.n == 0 {
+		return Point{}, false
+	}
+	return h.pts[(h.start+h.n-1)%len(h.pts)], true
+}
+
+// Min returns the smallest value in the History, or NaN if it's
+// empty.
+func (h *History) Min() float64 {
+	if h.n == 0 {
+		return math.NaN()
+	}
+	m := math.Inf(1)
+	for _, p := range h.Points() {
+		m = math.Min(m, p.Value)
+	}
+	return m
+}
+
+// Max returns the largest value in the History, or NaN if it's
+// empty.
+func (h *History) Max() float64 {
+	if h.n == 0 {
+		return math.NaN()
+	}
+	m := math.Inf(-1)
+	for _, p := range h.Points() {
+		m = math.Max(m, p.Value)
+	}
+	return m
+}
+
+// Mean returns the mean of the values in the History, or NaN if it's
+// empty.
+func (h *History) Mean() float64 {
+	if h.n == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, p := range h.Points() {
+		sum += p.Value
+	}
+	return sum / float64(h.n)
+}
+
+// HistorySet keeps a History for every numeric statistic matched by
+// a set of Selectors, fed from Samples or Snapshots.
+type HistorySet struct {
+	size  int
+	sels  []Selector
+	hists map[string]*History
+}
+
+// NewHistorySet creates a HistorySet that keeps size readings of
+// every statistic matched by at least one of sels (or of every
+// statistic, if there are no selectors).
+func NewHistorySet(size int, sels ...Selector) *HistorySet {
+	return &HistorySet{size: size, sels: sels, hists: make(map[string]*History)}
+}
+
+func (hs *HistorySet) wanted(v Value) bool {
+	if len(hs.sels) == 0 {
+		return true
+	}
+	for _, sel := range hs.sels {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSnapshot adds the selected Values from a Snapshot (or a Sample's
+// Snapshot) to their Histories, creating new Histories as necessary.
+func (hs *HistorySet) AddSnapshot(snap *Snapshot) {
+	for _, v := range snap.Values {
+		if !hs.wanted(v) {
+			continue
+		}
+		key := v.String()
+		h, ok := hs.hists[key]
+		if !ok {
+			if _, ok = v.Float(); !ok {
+				continue
+			}
+			h = NewHistory(hs.size)
+			hs.hists[key] = h
+		}
+		h.AddValue(v)
+	}
+}
+
+// Get returns the History for a statistic, identified by its
+// module:instance:name:statistic name (ie, Value.String()), or nil
+// if there is no History for it.
+func (hs *HistorySet) Get(stat string) *History {
+	return hs.hists[stat]
+}
+
+// Stats returns the names of all of the statistics that have
+// Histories, in no particular order.
+func (hs *HistorySet) Stats() []string {
+	lst := make([]string, 0, len(hs.hists))
+	for k := range hs.hists {
+		lst = append(lst, k)
+	}
+	return lst
+}
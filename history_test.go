@@ -0,0 +1,57 @@
+//
+// Test Histories.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestHistory(t *testing.T) {
+	h := kstat.NewHistory(3)
+	if h.Len() != 0 || !math.IsNaN(h.Mean()) || !math.IsNaN(h.Min()) {
+		t.Fatalf("empty History is not empty")
+	}
+	if _, ok := h.Last(); ok {
+		t.Fatalf("empty History has a Last")
+	}
+	for i := 1; i <= 5; i++ {
+		h.Add(int64(i), float64(i*10))
+	}
+	pts := h.Points()
+	if h.Len() != 3 || h.Cap() != 3 || len(pts) != 3 || pts[0].Value != 30 || pts[2].Snaptime != 5 {
+		t.Fatalf("History did not wrap properly: %+v", pts)
+	}
+	if h.Min() != 30 || h.Max() != 50 || h.Mean() != 40 {
+		t.Fatalf("bad History min/max/mean: %f %f %f", h.Min(), h.Max(), h.Mean())
+	}
+	if p, ok := h.Last(); !ok || p.Value != 50 {
+		t.Fatalf("bad History Last: %+v", p)
+	}
+	if h.AddValue(kstat.Value{Type: kstat.String, StringVal: "x"}) {
+		t.Fatalf("History accepted a String Value")
+	}
+}
+
+func TestHistorySet(t *testing.T) {
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	hs := kstat.NewHistorySet(10, sel)
+	other := counter(1, 5)
+	other.Stat = "sysread"
+	for i := int64(1); i <= 3; i++ {
+		hs.AddSnapshot(&kstat.Snapshot{Values: []kstat.Value{counter(i, uint64(i)), other}})
+	}
+	if len(hs.Stats()) != 1 {
+		t.Fatalf("HistorySet has unselected statistics: %v", hs.Stats())
+	}
+	h := hs.Get("cpu:0:sys:syscall")
+	if h == nil || h.Len() != 3 || h.Mean() != 2 {
+		t.Fatalf("bad History for cpu:0:sys:syscall: %+v", h)
+	}
+	if hs.Get("cpu:0:sys:sysread") != nil {
+		t.Fatalf("HistorySet has a History for an unselected statistic")
+	}
+}
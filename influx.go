@@ -0,0 +1,297 @@
+//
+// Writing Snapshots in InfluxDB line protocol.
+
+package kstat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// InfluxOptions control how an InfluxWriter writes Snapshots.
+type InfluxOptions struct {
+	// Host is the value of the host tag. If it's blank, there's
+	// no host tag.
+	Host string
+
+	// Measurement returns the measurement for a kstat. If it's
+	// nil, the measurement is the kstat's module (its instance
+	// and name are tags).
+	Measurement func(ki KStatInfo) string
+
+	// BatchSize is how many lines are buffered before they're
+	// written out. If it's 0, everything is written out at the end
+	// of every Write.
+	BatchSize int
+
+	// Naming maps statistics to measurements and tags. Each
+	// statistic that it maps is written as a line of its own,
+	// with the mapped name as the measurement, the labels as tags
+	// (after the host tag), and the statistic as the field
+	// "value". The rest of a kstat's statistics are written as
+	// usual.
+	Naming *Naming
+}
+
+// InfluxWriter writes Snapshots in InfluxDB line protocol, one line
+// per kstat:
+//
+//	cpu,host=h1,instance=0,name=sys,class=misc syscall=1234i,intr=50i 1440770400123456789
+//
+// The statistics of the kstat are its fields. Integer statistics
+// are written as integers, except for unsigned ones too big for an
+// int64, which are written as floats; CharData and String statistics
+// are written as strings. The timestamp is the Snapshot's Time in
+// nanoseconds.
+//
+// An InfluxWriter with a BatchSize buffers lines and writes them in
+// batches, so you must call Flush or Close when you're done with it
+// to write out the last batch.
+type InfluxWriter struct {
+	w     io.Writer
+	opts  InfluxOptions
+	buf   bytes.Buffer
+	lines int
+}
+
+// NewInfluxWriter creates an InfluxWriter that writes to w. Each batch
+// is written with a single Write call.
+func NewInfluxWriter(w io.Writer, opts InfluxOptions) *InfluxWriter {
+	return &InfluxWriter{w: w, opts: opts}
+}
+
+// NewInfluxHTTPWriter creates an InfluxWriter that POSTs each batch to
+// url, which is an InfluxDB write endpoint such as
+// http://localhost:8086/write?db=kstats (for InfluxDB 1.x) or
+// http://localhost:8086/api/v2/write?org=o&bucket=b (for 2.x, where
+// you'll need a client that adds an Authorization header). If client
+// is nil, http.DefaultClient is used.
+func NewInfluxHTTPWriter(client *http.Client, url string, opts InfluxOptions) *InfluxWriter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return NewInfluxWriter(&influxPoster{client: client, url: url}, opts)
+}
+
+// WriteSnapshot writes a line for every kstat in a Snapshot that has
+// Values.
+func (iw *InfluxWriter) WriteSnapshot(snap *Snapshot) error {
+	if err := iw.snapshot(snap); err != nil {
+		return err
+	}
+	return iw.written()
+}
+
+// Write writes a Sample's Snapshot, plus a "derived" measurement
+// line with the Sample's Derived values as its fields.
+func (iw *InfluxWriter) Write(sm *Sample) error {
+	if err := iw.snapshot(&sm.Snapshot); err != nil {
+		return err
+	}
+	if len(sm.Derived) > 0 {
+		b := iw.start("derived")
+		b = append(b, ' ')
+		for i, d := range sm.Derived {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = influxEscape(b, d.Name, ",= ")
+			b = append(b, '=')
+			b = strconv.AppendFloat(b, d.Value, 'g', -1, 64)
+		}
+		if err := iw.end(b, sm.Time.UnixNano()); err != nil {
+			return err
+		}
+	}
+	return iw.written()
+}
+
+func (iw *InfluxWriter) snapshot(snap *Snapshot) error {
+	ts := snap.Time.UnixNano()
+	for _, g := range snap.groups() {
+		vals := g.vals[:0:0]
+		for _, v := range g.vals {
+			mn, ok := iw.opts.Naming.Map(v)
+			if !ok {
+				vals = append(vals, v)
+				continue
+			}
+			if err := iw.mappedLine(mn, v, ts); err != nil {
+				return err
+			}
+		}
+		g.vals = vals
+		if len(g.vals) == 0 {
+			continue
+		}
+		if err := iw.line(g, ts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// written flushes the InfluxWriter at the end of a Write if it isn't
+// batching.
+func (iw *InfluxWriter) written() error {
+	if iw.opts.BatchSize == 0 {
+		return iw.Flush()
+	}
+	return nil
+}
+
+// start starts a line with the measurement and the host tag.
+func (iw *InfluxWriter) start(meas string) []byte {
+	b := influxEscape(nil, meas, ", ")
+	if iw.opts.Host != "" {
+		b = append(b, ",host="...)
+		b = influxEscape(b, iw.opts.Host, ",= ")
+	}
+	return b
+}
+
+// end finishes a line with its timestamp and adds it to the batch.
+func (iw *InfluxWriter) end(b []byte, ts int64) error {
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, ts, 10)
+	b = append(b, '\n')
+	iw.buf.Write(b)
+	iw.lines++
+	if iw.opts.BatchSize > 0 && iw.lines >= iw.opts.BatchSize {
+		return iw.Flush()
+	}
+	return nil
+}
+
+func (iw *InfluxWriter) line(g kstatGroup, ts int64) error {
+	meas := g.info.Module
+	if iw.opts.Measurement != nil {
+		meas = iw.opts.Measurement(g.info)
+	}
+	b := iw.start(meas)
+	b = append(b, ",instance="...)
+	b = strconv.AppendInt(b, int64(g.info.Instance), 10)
+	b = append(b, ",name="...)
+	b = influxEscape(b, g.info.Name, ",= ")
+	if g.info.Class != "" {
+		b = append(b, ",class="...)
+		b = influxEscape(b, g.info.Class, ",= ")
+	}
+	b = append(b, ' ')
+	for i, v := range g.vals {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = influxEscape(b, v.Stat, ",= ")
+		b = append(b, '=')
+		var err error
+		if b, err = influxValue(b, v); err != nil {
+			return err
+		}
+	}
+	return iw.end(b, ts)
+}
+
+// mappedLine writes a line for a statistic that the Naming maps.
+func (iw *InfluxWriter) mappedLine(mn MetricName, v Value, ts int64) error {
+	b := iw.start(mn.Name)
+	for _, l := range mn.Labels {
+		b = append(b, ',')
+		b = influxEscape(b, l.Name, ",= ")
+		b = append(b, '=')
+		b = influxEscape(b, l.Value, ",= ")
+	}
+	b = append(b, " value="...)
+	b, err := influxValue(b, v)
+	if err != nil {
+		return err
+	}
+	return iw.end(b, ts)
+}
+
+// influxValue appends the field value of a statistic.
+func influxValue(b []byte, v Value) ([]byte, error) {
+	switch v.Type {
+	case Int32, Int64:
+		b = strconv.AppendInt(b, v.IntVal, 10)
+		b = append(b, 'i')
+	case Uint32, Uint64:
+		if v.UintVal > math.MaxInt64 {
+			b = strconv.AppendFloat(b, float64(v.UintVal), 'g', -1, 64)
+		} else {
+			b = strconv.AppendUint(b, v.UintVal, 10)
+			b = append(b, 'i')
+		}
+	case CharData, String:
+		b = append(b, '"')
+		b = influxEscape(b, v.StringVal, `"\`)
+		b = append(b, '"')
+	default:
+		return nil, fmt.Errorf("%s has unknown type %s", v, v.Type)
+	}
+	return b, nil
+}
+
+// influxEscape appends s to b with a backslash in front of any of the
+// characters in special. Newlines can't be escaped, so they become
+// spaces (which are then escaped if they're special).
+func influxEscape(b []byte, s, special string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\n' {
+			c = ' '
+		}
+		if strings.IndexByte(special, c) >= 0 {
+			b = append(b, '\\')
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// Flush writes out any buffered lines.
+func (iw *InfluxWriter) Flush() error {
+	if iw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := iw.w.Write(iw.buf.Bytes())
+	iw.buf.Reset()
+	iw.lines = 0
+	return err
+}
+
+// Close flushes the InfluxWriter and then closes its writer, if it's
+// an io.Closer.
+func (iw *InfluxWriter) Close() error {
+	err := iw.Flush()
+	if cerr := closeWriter(iw.w); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// influxPoster is an io.Writer that POSTs each Write to an InfluxDB
+// write endpoint.
+type influxPoster struct {
+	client *http.Client
+	url    string
+}
+
+func (p *influxPoster) Write(b []byte) (int, error) {
+	resp, err := p.client.Post(p.url, "text/plain; charset=utf-8", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("InfluxDB write failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return len(b), nil
+}
@@ -0,0 +1,73 @@
+//
+// Test writing InfluxDB line protocol.
+
+package kstat_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestInfluxWriter(t *testing.T) {
+	var w writes
+	iw := kstat.NewInfluxWriter(&w, kstat.InfluxOptions{Host: "h 1"})
+	sm := &kstat.Sample{Snapshot: *testSnapshot()}
+	sm.Derived = []kstat.Derived{{Name: "ewma(cpu:0:sys:syscall)", Value: 1.5}}
+	if err := iw.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	exp := `cpu,host=h\ 1,instance=0,name=sys,class=misc syscall=1.8446744073709552e+19,delta=-5i 1440756000123456789
+cpu_info,host=h\ 1,instance=0,name=cpu_info0,class=misc state="on-line",brand="Some \"CPU\"" 1440756000123456789
+derived,host=h\ 1 ewma(cpu:0:sys:syscall)=1.5 1440756000123456789
+`
+	if len(w) != 1 || w[0] != exp {
+		t.Fatalf("wrong lines:\n%q", w)
+	}
+}
+
+func TestInfluxBatching(t *testing.T) {
+	var w writes
+	iw := kstat.NewInfluxWriter(&w, kstat.InfluxOptions{
+		BatchSize:   3,
+		Measurement: func(ki kstat.KStatInfo) string { return ki.Module + "_" + ki.Name },
+	})
+	for i := 0; i < 2; i++ {
+		if err := iw.WriteSnapshot(testSnapshot()); err != nil {
+			t.Fatalf("WriteSnapshot failed: %s", err)
+		}
+	}
+	if len(w) != 1 || strings.Count(w[0], "\n") != 3 || !strings.HasPrefix(w[0], "cpu_sys,") {
+		t.Fatalf("wrong batch: %q", w)
+	}
+	if err := iw.Close(); err != nil || len(w) != 2 || strings.Count(w[1], "\n") != 1 {
+		t.Fatalf("Close did not flush: %v %q", err, w)
+	}
+}
+
+func TestInfluxHTTP(t *testing.T) {
+	var bodies []string
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.URL.RawQuery+" "+string(b))
+		rw.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	iw := kstat.NewInfluxHTTPWriter(nil, ts.URL+"/write?db=k", kstat.InfluxOptions{})
+	if err := iw.WriteSnapshot(testSnapshot()); err != nil {
+		t.Fatalf("WriteSnapshot failed: %s", err)
+	}
+	if len(bodies) != 1 || !strings.HasPrefix(bodies[0], "db=k cpu,instance=0") {
+		t.Fatalf("wrong POSTs: %q", bodies)
+	}
+	status = http.StatusBadRequest
+	if err := iw.WriteSnapshot(testSnapshot()); err == nil {
+		t.Fatalf("failed POST did not fail")
+	}
+}
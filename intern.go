@@ -0,0 +1,88 @@
+//
+// Sharing one copy of the strings that kstats repeat over and over.
+
+package kstat
+
+import (
+	"sync"
+)
+
+// maxInterned bounds how many strings an Interner will hold. Past
+// this it hands out fresh copies, so that something that interns an
+// endless stream of different strings doesn't grow it forever.
+const maxInterned = 1 << 16
+
+// Interner hands out a single shared copy of each distinct string
+// that it's given. Kstat module, name, class, and statistic names
+// are a few hundred distinct strings repeated across thousands of
+// kstats and every sample taken of them, so a long-lived collector
+// that interns them holds far less memory.
+//
+// The package interns these names for the KStats and Nameds that
+// Tokens create, and so for Values and Snapshots taken from them. You
+// can use an Interner of your own for Snapshots from elsewhere, for
+// example ones decoded from JSON. The zero Interner is ready to use,
+// and an Interner is safe for concurrent use.
+type Interner struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+// names is the Interner for everything that comes from Tokens.
+var names Interner
+
+// Bytes returns the shared copy of string(b). It doesn't allocate if
+// the Interner already has the string.
+func (in *Interner) Bytes(b []byte) string {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if s, ok := in.m[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	in.add(s)
+	return s
+}
+
+// String returns the shared copy of s.
+func (in *Interner) String(s string) string {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if is, ok := in.m[s]; ok {
+		return is
+	}
+	in.add(s)
+	return s
+}
+
+// add adds s if there's room. in.mu must be held.
+func (in *Interner) add(s string) {
+	if in.m == nil {
+		in.m = make(map[string]string)
+	}
+	if len(in.m) < maxInterned {
+		in.m[s] = s
+	}
+}
+
+// Len returns how many strings the Interner holds.
+func (in *Interner) Len() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return len(in.m)
+}
+
+// Snapshot replaces the module, name, class, and statistic names of
+// all of the KStats and Values in snap with their shared copies.
+// String values are left alone, since they're rarely repeated.
+func (in *Interner) Snapshot(snap *Snapshot) {
+	for i := range snap.KStats {
+		ki := &snap.KStats[i]
+		ki.Module, ki.Name, ki.Class = in.String(ki.Module), in.String(ki.Name), in.String(ki.Class)
+	}
+	for i := range snap.Values {
+		v := &snap.Values[i]
+		v.Module, v.Name, v.Class = in.String(v.Module), in.String(v.Name), in.String(v.Class)
+		v.Stat = in.String(v.Stat)
+	}
+}
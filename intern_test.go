@@ -0,0 +1,41 @@
+//
+// Test interning strings.
+
+package kstat_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// same reports whether a and b share their storage.
+func same(a, b string) bool {
+	return len(a) == len(b) && unsafe.StringData(a) == unsafe.StringData(b)
+}
+
+func TestInterner(t *testing.T) {
+	var in kstat.Interner
+	a := in.Bytes([]byte("cpu"))
+	b := in.Bytes([]byte("cpu"))
+	c := in.String(string([]byte("cpu")))
+	if a != "cpu" || !same(a, b) || !same(a, c) {
+		t.Fatalf("interned copies of cpu are not shared")
+	}
+	if n := in.Len(); n != 1 {
+		t.Fatalf("Interner holds %d strings, not 1", n)
+	}
+
+	snap := &kstat.Snapshot{
+		KStats: []kstat.KStatInfo{{Module: string([]byte("cpu")), Name: "sys", Class: "misc"}},
+		Values: []kstat.Value{{Module: string([]byte("cpu")), Name: "sys", Class: "misc", Stat: "syscall"}},
+	}
+	in.Snapshot(snap)
+	if !same(snap.KStats[0].Module, a) || !same(snap.Values[0].Module, a) {
+		t.Fatalf("Snapshot did not intern its modules")
+	}
+	if !same(snap.KStats[0].Class, snap.Values[0].Class) {
+		t.Fatalf("Snapshot did not intern its classes")
+	}
+}
@@ -0,0 +1,134 @@
+//
+// iostat-style metrics computed from IO kstats.
+
+package kstat
+
+import (
+	"time"
+)
+
+// DiskMetrics are the iostat(1M) metrics for one IO kstat over the
+// interval between two readings of it, computed the same way that
+// iostat -x computes them.
+type DiskMetrics struct {
+	KStat   KStatInfo
+	Elapsed time.Duration
+
+	// ReadsPerSec and WritesPerSec are r/s and w/s.
+	ReadsPerSec  float64
+	WritesPerSec float64
+	// KBReadPerSec and KBWrittenPerSec are kr/s and kw/s.
+	KBReadPerSec    float64
+	KBWrittenPerSec float64
+
+	// Wait and Actv are the average number of transactions waiting
+	// for service and being serviced (the wait and actv columns).
+	Wait float64
+	Actv float64
+
+	// SvcT is the average response time of transactions in
+	// milliseconds (svc_t), which is the sum of the average time
+	// spent waiting (WaitSvcT, wsvc_t) and the average time spent
+	// being serviced (ActvSvcT, asvc_t).
+	SvcT     float64
+	WaitSvcT float64
+	ActvSvcT float64
+
+	// PctWait and PctBusy are the percentage of time that there
+	// were transactions waiting and that the device was busy (%w
+	// and %b).
+	PctWait float64
+	PctBusy float64
+}
+
+// ComputeDiskMetrics computes DiskMetrics for every IO kstat that is
+// in both Snapshots (as the same incarnation of the kstat), in the
+// order they are in cur. The Snapshots must have the IO kstats'
+// statistics as produced by KStat.Values.
+func ComputeDiskMetrics(prev, cur *Snapshot) []DiskMetrics {
+	old := make(map[kstatKey]kstatGroup)
+	for _, g := range prev.groups() {
+		if g.info.Type == IoStat {
+			old[g.info.key()] = g
+		}
+	}
+	var lst []DiskMetrics
+	for _, g := range cur.groups() {
+		if g.info.Type != IoStat {
+			continue
+		}
+		if pg, ok := old[g.info.key()]; ok {
+			if dm, ok := diskMetrics(pg, g); ok {
+				lst = append(lst, dm)
+			}
+		}
+	}
+	return lst
+}
+
+// statDeltas returns the changes in the numeric counter statistics
+// between two readings of a kstat. Counters that were reset are
+// left out.
+func statDeltas(prev, cur kstatGroup) map[string]float64 {
+	pv := make(map[string]Value, len(prev.vals))
+	for _, v := range prev.vals {
+		pv[v.Stat] = v
+	}
+	d := make(map[string]float64, len(cur.vals))
+	for _, v := range cur.vals {
+		if p, ok := pv[v.Stat]; ok && p.Type == v.Type {
+			if x, _, ok := counterDelta(p, v); ok {
+				d[v.Stat] = x
+			}
+		}
+	}
+	return d
+}
+
+func diskMetrics(prev, cur kstatGroup) (DiskMetrics, bool) {
+	hrEtime := float64(cur.info.Snaptime - prev.info.Snaptime)
+	if hrEtime <= 0 {
+		return DiskMetrics{}, false
+	}
+	d := statDeltas(prev, cur)
+	for _, s := range []string{"nread", "nwritten", "reads", "writes", "wtime", "wlentime", "rtime", "rlentime"} {
+		if _, ok := d[s]; !ok {
+			return DiskMetrics{}, false
+		}
+	}
+	etime := hrEtime / float64(time.Second)
+
+	dm := DiskMetrics{KStat: cur.info, Elapsed: time.Duration(hrEtime)}
+	dm.ReadsPerSec = d["reads"] / etime
+	dm.WritesPerSec = d["writes"] / etime
+	dm.KBReadPerSec = d["nread"] / 1024 / etime
+	dm.KBWrittenPerSec = d["nwritten"] / 1024 / etime
+
+	// wlentime and rlentime are the Riemann sums of the wait and
+	// run queue lengths over time (in nanoseconds), so dividing
+	// their change by the elapsed time gives the average queue
+	// lengths. Likewise wtime and rtime are the total time that
+	// the queues were non-empty.
+	dm.Wait = d["wlentime"] / hrEtime
+	dm.Actv = d["rlentime"] / hrEtime
+	dm.PctWait = pct(d["wtime"], hrEtime)
+	dm.PctBusy = pct(d["rtime"], hrEtime)
+
+	// By Little's law, the average time in a queue is its average
+	// length divided by the throughput.
+	if tps := dm.ReadsPerSec + dm.WritesPerSec; tps > 0 {
+		dm.WaitSvcT = dm.Wait * 1000 / tps
+		dm.ActvSvcT = dm.Actv * 1000 / tps
+		dm.SvcT = dm.WaitSvcT + dm.ActvSvcT
+	}
+	return dm, true
+}
+
+// pct returns n/d as a percentage, capped at 100% as iostat does.
+func pct(n, d float64) float64 {
+	p := n * 100 / d
+	if p > 100 {
+		p = 100
+	}
+	return p
+}
@@ -0,0 +1,76 @@
+//
+// Test disk metrics.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// ioSnapshot returns a Snapshot of sd:0:sd0 with the given IO
+// statistics.
+func ioSnapshot(snaptime int64, stats map[string]int64) *kstat.Snapshot {
+	var vals []kstat.Value
+	for _, s := range []string{"nread", "nwritten", "reads", "writes", "wtime", "wlentime", "rtime", "rlentime"} {
+		v := kstat.Value{Stat: s, Type: kstat.Int64, IntVal: stats[s]}
+		if s == "nread" || s == "nwritten" {
+			v.Type, v.IntVal, v.UintVal = kstat.Uint64, 0, uint64(stats[s])
+		}
+		vals = append(vals, v)
+	}
+	snap := &kstat.Snapshot{}
+	kstattest.AddValues(snap, kstat.KStatInfo{Module: "sd", Instance: 0, Name: "sd0", Class: "disk", Type: kstat.IoStat, Crtime: 1, Snaptime: snaptime}, vals...)
+	return snap
+}
+
+func TestComputeDiskMetrics(t *testing.T) {
+	sec := int64(time.Second)
+	prev := ioSnapshot(10*sec, map[string]int64{})
+	// Over two seconds: 100 reads of 1 MB total, 300 writes of 3 MB
+	// total, an average of 0.5 transactions waiting (for half of
+	// the time) and 2 active (for the whole time).
+	cur := ioSnapshot(12*sec, map[string]int64{
+		"nread": 1024 * 1024, "nwritten": 3 * 1024 * 1024,
+		"reads": 100, "writes": 300,
+		"wlentime": sec, "wtime": sec,
+		"rlentime": 4 * sec, "rtime": 3 * sec,
+	})
+	lst := kstat.ComputeDiskMetrics(prev, cur)
+	if len(lst) != 1 {
+		t.Fatalf("wrong number of DiskMetrics: %+v", lst)
+	}
+	dm := lst[0]
+	want := []struct {
+		name     string
+		got, exp float64
+	}{
+		{"r/s", dm.ReadsPerSec, 50},
+		{"w/s", dm.WritesPerSec, 150},
+		{"kr/s", dm.KBReadPerSec, 512},
+		{"kw/s", dm.KBWrittenPerSec, 1536},
+		{"wait", dm.Wait, 0.5},
+		{"actv", dm.Actv, 2},
+		{"wsvc_t", dm.WaitSvcT, 2.5},
+		{"asvc_t", dm.ActvSvcT, 10},
+		{"svc_t", dm.SvcT, 12.5},
+		{"%w", dm.PctWait, 50},
+		{"%b", dm.PctBusy, 100},
+	}
+	for _, w := range want {
+		if math.Abs(w.got-w.exp) > 1e-9 {
+			t.Fatalf("bad %s: %f (should be %f)", w.name, w.got, w.exp)
+		}
+	}
+	if dm.Elapsed != 2*time.Second || dm.KStat.Name != "sd0" {
+		t.Fatalf("bad DiskMetrics: %+v", dm)
+	}
+
+	if lst = kstat.ComputeDiskMetrics(cur, cur); len(lst) != 0 {
+		t.Fatalf("DiskMetrics without elapsed time: %+v", lst)
+	}
+}
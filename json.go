@@ -0,0 +1,201 @@
+//
+// JSON encoding of Snapshots.
+
+package kstat
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SnapshotJSONVersion is the version of the JSON schema for
+// Snapshots. It will be incremented if the schema ever changes
+// incompatibly.
+const SnapshotJSONVersion = 1
+
+// The JSON form of a Snapshot groups Values under their kstats, so
+// that the kstat information isn't repeated for every statistic. It
+// looks like this:
+//
+//	{
+//	  "version": 1,
+//	  "time": "2015-08-28T10:00:00.123456789-04:00",
+//	  "kstats": [
+//	    {
+//	      "module": "cpu", "instance": 0, "name": "sys",
+//	      "class": "misc", "type": "named",
+//	      "crtime": 100, "snaptime": 2000,
+//	      "stats": [
+//	        {"name": "syscall", "type": "uint64", "value": 1234},
+//	        ...
+//	      ]
+//	    },
+//	    ...
+//	  ]
+//	}
+//
+// "time" is the Snapshot's Time in RFC 3339 format. "type" for kstats
+// and statistics is the String() of their KSType or NamedType.
+// "value" is a JSON number for numeric statistics and a JSON string
+// for CharData and String ones. Kstats without any statistics have no
+// "stats".
+//
+// Values that don't belong to any of the Snapshot's KStats (which
+// can only happen with Snapshots you've assembled yourself) are
+// grouped under kstats created from the Value's information. They
+// become part of KStats when the JSON is decoded.
+
+type jsonSnapshot struct {
+	Version int         `json:"version"`
+	Time    time.Time   `json:"time"`
+	KStats  []jsonKStat `json:"kstats"`
+}
+
+type jsonKStat struct {
+	Module   string     `json:"module"`
+	Instance int        `json:"instance"`
+	Name     string     `json:"name"`
+	Class    string     `json:"class"`
+	Type     string     `json:"type"`
+	Crtime   int64      `json:"crtime"`
+	Snaptime int64      `json:"snaptime"`
+	Stats    []jsonStat `json:"stats,omitempty"`
+}
+
+type jsonStat struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ksTypes and namedTypes map the String() form of the types back to
+// them.
+var ksTypes = map[string]KSType{}
+var namedTypes = map[string]NamedType{}
+
+func init() {
+	for _, t := range []KSType{RawStat, NamedStat, IntrStat, IoStat, TimerStat} {
+		ksTypes[t.String()] = t
+	}
+	for _, t := range []NamedType{CharData, Int32, Uint32, Int64, Uint64, String} {
+		namedTypes[t.String()] = t
+	}
+}
+
+// MarshalJSON encodes a Snapshot in the JSON form described above.
+func (snap Snapshot) MarshalJSON() ([]byte, error) {
+	js := jsonSnapshot{Version: SnapshotJSONVersion, Time: snap.Time, KStats: []jsonKStat{}}
+	for _, g := range snap.groups() {
+		jk, err := jsonKStatOf(g.info, g.vals)
+		if err != nil {
+			return nil, err
+		}
+		js.KStats = append(js.KStats, jk)
+	}
+	return json.Marshal(js)
+}
+
+// jsonKStatOf returns the JSON form of a kstat and its Values.
+func jsonKStatOf(ki KStatInfo, vals []Value) (jsonKStat, error) {
+	jk := jsonKStat{
+		Module: ki.Module, Instance: ki.Instance, Name: ki.Name,
+		Class: ki.Class, Type: ki.Type.String(),
+		Crtime: ki.Crtime, Snaptime: ki.Snaptime,
+	}
+	for _, v := range vals {
+		raw, err := jsonValueOf(v)
+		if err != nil {
+			return jk, err
+		}
+		jk.Stats = append(jk.Stats, jsonStat{Name: v.Stat, Type: v.Type.String(), Value: raw})
+	}
+	return jk, nil
+}
+
+// jsonValueOf returns the JSON form of the value of a Value.
+func jsonValueOf(v Value) (json.RawMessage, error) {
+	switch v.Type {
+	case CharData, String, Int32, Int64, Uint32, Uint64:
+		return json.Marshal(v.native())
+	}
+	return nil, fmt.Errorf("%s has unknown type %s", v, v.Type)
+}
+
+// The JSON form of a single statistic, as encoded for a Named, is:
+//
+//	{"module": "cpu", "instance": 0, "name": "sys", "statistic": "syscall",
+//	 "type": "uint64", "value": 1234, "crtime": 100, "snaptime": 2000}
+//
+// with "type" and "value" as for statistics in Snapshots. A KStat is
+// encoded as a kstat is in a Snapshot.
+type jsonNamed struct {
+	Module   string          `json:"module"`
+	Instance int             `json:"instance"`
+	Name     string          `json:"name"`
+	Stat     string          `json:"statistic"`
+	Type     string          `json:"type"`
+	Value    json.RawMessage `json:"value"`
+	Crtime   int64           `json:"crtime"`
+	Snaptime int64           `json:"snaptime"`
+}
+
+func jsonNamedOf(v Value) ([]byte, error) {
+	raw, err := jsonValueOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonNamed{
+		Module: v.Module, Instance: v.Instance, Name: v.Name, Stat: v.Stat,
+		Type: v.Type.String(), Value: raw,
+		Crtime: v.Crtime, Snaptime: v.Snaptime,
+	})
+}
+
+// UnmarshalJSON decodes a Snapshot from the JSON form described
+// above.
+func (snap *Snapshot) UnmarshalJSON(data []byte) error {
+	var js jsonSnapshot
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	if js.Version != SnapshotJSONVersion {
+		return fmt.Errorf("unsupported Snapshot JSON version %d", js.Version)
+	}
+
+	nsnap := Snapshot{Time: js.Time}
+	for _, jk := range js.KStats {
+		kt, ok := ksTypes[jk.Type]
+		if !ok {
+			return fmt.Errorf("kstat %s:%d:%s has unknown type %q", jk.Module, jk.Instance, jk.Name, jk.Type)
+		}
+		ki := KStatInfo{
+			Module: jk.Module, Instance: jk.Instance, Name: jk.Name,
+			Class: jk.Class, Type: kt,
+			Crtime: jk.Crtime, Snaptime: jk.Snaptime,
+		}
+		nsnap.KStats = append(nsnap.KStats, ki)
+		for _, st := range jk.Stats {
+			tp, ok := namedTypes[st.Type]
+			v := ki.value(st.Name, tp)
+			if !ok {
+				return fmt.Errorf("%s has unknown type %q", v, st.Type)
+			}
+			var err error
+			switch v.Type {
+			case CharData, String:
+				err = json.Unmarshal(st.Value, &v.StringVal)
+			case Int32, Int64:
+				err = json.Unmarshal(st.Value, &v.IntVal)
+			default:
+				err = json.Unmarshal(st.Value, &v.UintVal)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: bad value: %s", v, err)
+			}
+			nsnap.Values = append(nsnap.Values, v)
+		}
+	}
+	*snap = nsnap
+	return nil
+}
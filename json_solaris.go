@@ -0,0 +1,37 @@
+//go:build cgo
+// +build cgo
+
+//
+// JSON encoding of KStats and Nameds.
+
+package kstat
+
+import (
+	"encoding/json"
+)
+
+// MarshalJSON encodes a KStat in the same form as a kstat in the JSON
+// form of a Snapshot (see SnapshotJSONVersion). If the KStat's data
+// has been loaded (by Refresh, GetNamed, and so on), its statistics
+// are included as "stats", as Values would return them. MarshalJSON
+// never loads or refreshes the KStat itself.
+func (k *KStat) MarshalJSON() ([]byte, error) {
+	var vals []Value
+	if !k.invalid() && k.ksp.ks_data != nil {
+		var err error
+		if vals, err = k.Values(); err != nil {
+			return nil, err
+		}
+	}
+	jk, err := jsonKStatOf(k.info(), vals)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jk)
+}
+
+// MarshalJSON encodes a Named as a single statistic, including the
+// module, instance, and name of its KStat.
+func (ks *Named) MarshalJSON() ([]byte, error) {
+	return jsonNamedOf(ks.Value())
+}
@@ -0,0 +1,72 @@
+//
+// Test JSON encoding.
+
+package kstat_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// testSnapshot returns a Snapshot with a variety of things in it.
+func testSnapshot() *kstat.Snapshot {
+	cpu := kstat.KStatInfo{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: 100, Snaptime: 2000}
+	info := kstat.KStatInfo{Module: "cpu_info", Instance: 0, Name: "cpu_info0", Class: "misc", Type: kstat.NamedStat, Crtime: 100, Snaptime: 2000}
+	hdrs := kstat.KStatInfo{Module: "unix", Instance: 0, Name: "kstat_headers", Class: "kstat", Type: kstat.RawStat, Crtime: 10, Snaptime: 2000}
+	snap := &kstat.Snapshot{Time: time.Date(2015, 8, 28, 10, 0, 0, 123456789, time.UTC)}
+	kstattest.AddValues(snap, cpu,
+		kstat.Value{Stat: "syscall", Type: kstat.Uint64, UintVal: 1<<64 - 1},
+		kstat.Value{Stat: "delta", Type: kstat.Int64, IntVal: -5})
+	kstattest.AddValues(snap, info,
+		kstat.Value{Stat: "state", Type: kstat.CharData, StringVal: "on-line"},
+		kstattest.String("brand", "Some \"CPU\""))
+	kstattest.AddValues(snap, hdrs)
+	return snap
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	snap := testSnapshot()
+	b, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if !strings.Contains(string(b), `"value":18446744073709551615`) {
+		t.Fatalf("uint64 not encoded exactly: %s", b)
+	}
+	var s2 kstat.Snapshot
+	if err = json.Unmarshal(b, &s2); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if !reflect.DeepEqual(*snap, s2) {
+		t.Fatalf("Snapshot did not round trip:\n%+v\n%+v", *snap, s2)
+	}
+
+	// Values without a KStatInfo get one made for them.
+	snap.KStats = nil
+	b, err = json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if err = json.Unmarshal(b, &s2); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if len(s2.KStats) != 2 || !reflect.DeepEqual(snap.Values, s2.Values) {
+		t.Fatalf("bad KStat-less round trip: %+v", s2)
+	}
+
+	for _, bad := range []string{
+		`{"version": 2}`,
+		`{"version": 1, "kstats": [{"type": "nosuch"}]}`,
+		`{"version": 1, "kstats": [{"type": "named", "stats": [{"type": "uint64", "value": "x"}]}]}`,
+	} {
+		if err = json.Unmarshal([]byte(bad), &s2); err == nil {
+			t.Fatalf("Unmarshal of %s succeeded", bad)
+		}
+	}
+}
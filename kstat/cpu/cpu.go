@@ -0,0 +1,183 @@
+// Package cpu reads the statistics of each CPU from the cpu:N:sys
+// kstats, with the per-CPU and total user, system, and idle time and
+// the common activity counters in typed fields:
+//
+//	r, err := cpu.Read(tok)
+//	...
+//	time.Sleep(time.Second)
+//	r2, err := cpu.Read(tok)
+//	...
+//	for _, u := range cpu.Utilization(r, r2) {
+//		fmt.Printf("cpu %d: %.1f%% busy\n", u.CPU, u.User+u.System)
+//	}
+//
+// Read finds the CPUs itself each time, so CPUs that are added,
+// removed, or taken offline and brought back are handled; Utilization
+// only reports on CPUs that are in both readings as the same
+// incarnation of their kstat.
+//
+// ReadInfo reads what each CPU is and where it is in the system's
+// topology from the cpu_info kstats. ReadPower and Residency show how
+// much time CPUs spend in each idle state (C-state); the kernel only
+// has the current clock speed, not the time spent at each speed.
+package cpu
+
+import (
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selector selects the kstats that this package reads.
+var Selector = kstat.Selector{Module: "cpu", Instance: -1, Name: "sys"}
+
+// Stats are the statistics of a CPU from its cpu:N:sys kstat. All of
+// them count up from when the CPU's kstat was created.
+type Stats struct {
+	// CPU is the CPU's id, or -1 for the Total of all CPUs.
+	CPU int `kstat:"-"`
+	// Crtime and Snaptime are those of the kstat. For a Total,
+	// they're from the first CPU.
+	Crtime   int64 `kstat:"-"`
+	Snaptime int64 `kstat:"-"`
+
+	User   time.Duration `kstat:"cpu_nsec_user"`
+	Kernel time.Duration `kstat:"cpu_nsec_kernel"`
+	Idle   time.Duration `kstat:"cpu_nsec_idle"`
+	Intr   time.Duration `kstat:"cpu_nsec_intr"`
+	DTrace time.Duration `kstat:"cpu_nsec_dtrace"`
+
+	Syscalls    uint64 `kstat:"syscall"`
+	Interrupts  uint64 `kstat:"intr"`
+	IntrThreads uint64 `kstat:"intrthread"`
+	CtxSwitches uint64 `kstat:"pswitch"`
+	InvSwitches uint64 `kstat:"inv_swtch"`
+	Xcalls      uint64 `kstat:"xcalls"`
+	Migrations  uint64 `kstat:"cpumigrate"`
+	Forks       uint64 `kstat:"sysfork"`
+	Execs       uint64 `kstat:"sysexec"`
+	Traps       uint64 `kstat:"trap"`
+}
+
+// Reading is the Stats of every CPU at one time.
+type Reading struct {
+	Time time.Time
+	// CPUs are in order of CPU id.
+	CPUs []Stats
+	// Total is the sum of the Stats of all of the CPUs.
+	Total Stats
+}
+
+// FromSnapshot gets a Reading from a Snapshot that has the cpu:N:sys
+// kstats. Other kstats in the Snapshot are ignored, and so are
+// statistics that Stats doesn't have.
+func FromSnapshot(snap *kstat.Snapshot) (*Reading, error) {
+	r := &Reading{Time: snap.Time, Total: Stats{CPU: -1}}
+	byCPU := make(map[int][]kstat.Value)
+	for _, v := range snap.Values {
+		if Selector.Match(v) {
+			byCPU[v.Instance] = append(byCPU[v.Instance], v)
+		}
+	}
+	for _, ki := range snap.KStats {
+		vals := byCPU[ki.Instance]
+		if !Selector.MatchKStat(ki.Module, ki.Instance, ki.Name) || len(vals) == 0 {
+			continue
+		}
+		st := Stats{CPU: ki.Instance, Crtime: ki.Crtime, Snaptime: ki.Snaptime}
+		if err := kstat.CopyValues(vals, &st); err != nil {
+			return nil, err
+		}
+		r.CPUs = append(r.CPUs, st)
+	}
+	for i, st := range r.CPUs {
+		if i == 0 {
+			r.Total.Crtime, r.Total.Snaptime = st.Crtime, st.Snaptime
+		}
+		r.Total.add(st)
+	}
+	return r, nil
+}
+
+func (s *Stats) add(o Stats) {
+	s.User += o.User
+	s.Kernel += o.Kernel
+	s.Idle += o.Idle
+	s.Intr += o.Intr
+	s.DTrace += o.DTrace
+	s.Syscalls += o.Syscalls
+	s.Interrupts += o.Interrupts
+	s.IntrThreads += o.IntrThreads
+	s.CtxSwitches += o.CtxSwitches
+	s.InvSwitches += o.InvSwitches
+	s.Xcalls += o.Xcalls
+	s.Migrations += o.Migrations
+	s.Forks += o.Forks
+	s.Execs += o.Execs
+	s.Traps += o.Traps
+}
+
+// Usage is how a CPU (or all of them) spent the time between two
+// Readings. User, System, and Idle are percentages that add up to
+// 100; as in mpstat, they're relative to the total of the three times
+// rather than to the elapsed time. Syscalls, Interrupts, and
+// CtxSwitches are per second.
+type Usage struct {
+	// CPU is the CPU's id, or -1 for all CPUs together.
+	CPU     int
+	Elapsed time.Duration
+
+	User   float64
+	System float64
+	Idle   float64
+
+	Syscalls    float64
+	Interrupts  float64
+	CtxSwitches float64
+}
+
+// Utilization returns the Usage of each CPU that's in both Readings
+// (as the same incarnation of its kstat, so CPUs that were taken
+// offline and brought back in between are left out), followed by the
+// Usage of all of those CPUs together.
+func Utilization(prev, cur *Reading) []Usage {
+	old := make(map[int]Stats, len(prev.CPUs))
+	for _, st := range prev.CPUs {
+		old[st.CPU] = st
+	}
+	var lst []Usage
+	tprev, tcur := Stats{CPU: -1}, Stats{CPU: -1}
+	for _, st := range cur.CPUs {
+		p, ok := old[st.CPU]
+		if !ok || p.Crtime != st.Crtime || st.Snaptime <= p.Snaptime {
+			continue
+		}
+		lst = append(lst, usage(p, st))
+		if len(lst) == 1 {
+			tprev.Snaptime, tcur.Snaptime = p.Snaptime, st.Snaptime
+		}
+		tprev.add(p)
+		tcur.add(st)
+	}
+	if len(lst) > 0 {
+		lst = append(lst, usage(tprev, tcur))
+	}
+	return lst
+}
+
+func usage(p, c Stats) Usage {
+	el := time.Duration(c.Snaptime - p.Snaptime)
+	secs := el.Seconds()
+	u := Usage{
+		CPU:         c.CPU,
+		Elapsed:     el,
+		Syscalls:    float64(c.Syscalls-p.Syscalls) / secs,
+		Interrupts:  float64(c.Interrupts-p.Interrupts) / secs,
+		CtxSwitches: float64(c.CtxSwitches-p.CtxSwitches) / secs,
+	}
+	usr, sys, idl := float64(c.User-p.User), float64(c.Kernel-p.Kernel), float64(c.Idle-p.Idle)
+	if total := usr + sys + idl; total > 0 {
+		u.User, u.System, u.Idle = usr*100/total, sys*100/total, idl*100/total
+	}
+	return u
+}
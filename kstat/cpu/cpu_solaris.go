@@ -0,0 +1,66 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading CPU statistics from a Token.
+
+package cpu
+
+import (
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that any CPUs that have come or
+// gone are noticed, and reads every CPU's statistics.
+func Read(tok *kstat.Token) (*Reading, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.CoherentSnapshot(Selector)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
+
+// Sample reads the CPU statistics, waits for d, reads them again,
+// and returns the Utilization over that time.
+func Sample(tok *kstat.Token, d time.Duration) ([]Usage, error) {
+	prev, err := Read(tok)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(d)
+	cur, err := Read(tok)
+	if err != nil {
+		return nil, err
+	}
+	return Utilization(prev, cur), nil
+}
+
+// ReadInfo updates tok's kstat chain and reads the Info of every CPU.
+func ReadInfo(tok *kstat.Token) ([]Info, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.Snapshot(InfoSelector)
+	if err != nil {
+		return nil, err
+	}
+	return InfoFromSnapshot(snap)
+}
+
+// ReadPower updates tok's kstat chain and reads the Power of every
+// CPU.
+func ReadPower(tok *kstat.Token) ([]Power, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.Snapshot(PowerSelectors...)
+	if err != nil {
+		return nil, err
+	}
+	return PowerFromSnapshot(snap)
+}
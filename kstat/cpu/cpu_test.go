@@ -0,0 +1,80 @@
+//
+// Test reading CPU statistics from Snapshots.
+
+package cpu_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/cpu"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// snapshot returns a Snapshot of cpu:N:sys for CPUs with the given
+// crtimes and statistics, all at snaptime.
+func snapshot(snaptime int64, crtimes map[int]int64, stats map[int]map[string]uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{Time: time.Unix(0, snaptime)}
+	for c := 0; c < 8; c++ {
+		st, ok := stats[c]
+		if !ok {
+			continue
+		}
+		all := make(map[string]uint64)
+		for _, s := range []string{"cpu_nsec_user", "cpu_nsec_kernel", "cpu_nsec_idle", "syscall", "pswitch", "not_a_field"} {
+			all[s] = st[s]
+		}
+		kstattest.Add(snap, kstat.KStatInfo{Module: "cpu", Instance: c, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: crtimes[c], Snaptime: snaptime}, all)
+	}
+	return snap
+}
+
+func TestFromSnapshot(t *testing.T) {
+	snap := snapshot(10e9, map[int]int64{0: 1, 1: 1}, map[int]map[string]uint64{
+		0: {"cpu_nsec_user": 100, "cpu_nsec_kernel": 200, "syscall": 5},
+		1: {"cpu_nsec_user": 1000, "cpu_nsec_idle": 50, "syscall": 7},
+	})
+	r, err := cpu.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(r.CPUs) != 2 || r.CPUs[0].CPU != 0 || r.CPUs[1].CPU != 1 {
+		t.Fatalf("wrong CPUs: %+v", r.CPUs)
+	}
+	if r.CPUs[0].Kernel != 200 || r.CPUs[1].Syscalls != 7 || r.CPUs[1].Snaptime != 10e9 {
+		t.Errorf("wrong stats: %+v", r.CPUs)
+	}
+	tot := r.Total
+	if tot.CPU != -1 || tot.User != 1100 || tot.Kernel != 200 || tot.Idle != 50 || tot.Syscalls != 12 {
+		t.Errorf("wrong Total: %+v", tot)
+	}
+}
+
+func TestUtilization(t *testing.T) {
+	prev, _ := cpu.FromSnapshot(snapshot(10e9, map[int]int64{0: 1, 1: 1, 2: 1}, map[int]map[string]uint64{
+		0: {"cpu_nsec_user": 100, "cpu_nsec_kernel": 100, "cpu_nsec_idle": 100, "syscall": 10},
+		1: {"cpu_nsec_user": 100, "cpu_nsec_kernel": 100, "cpu_nsec_idle": 100},
+		2: {"cpu_nsec_idle": 100},
+	}))
+	// CPU 1 was recreated (it went offline and came back), CPU 2
+	// has gone, and CPU 3 is new.
+	cur, _ := cpu.FromSnapshot(snapshot(12e9, map[int]int64{0: 1, 1: 11e9, 3: 11e9}, map[int]map[string]uint64{
+		0: {"cpu_nsec_user": 400, "cpu_nsec_kernel": 200, "cpu_nsec_idle": 700, "syscall": 30},
+		1: {"cpu_nsec_user": 5},
+		3: {"cpu_nsec_user": 5},
+	}))
+	us := cpu.Utilization(prev, cur)
+	if len(us) != 2 || us[0].CPU != 0 || us[1].CPU != -1 {
+		t.Fatalf("wrong CPUs: %+v", us)
+	}
+	u := us[0]
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if u.Elapsed != 2*time.Second || !near(u.User, 30) || !near(u.System, 10) || !near(u.Idle, 60) || !near(u.Syscalls, 10) {
+		t.Errorf("wrong Usage: %+v", u)
+	}
+	if us[1].Elapsed != u.Elapsed || !near(us[1].User, u.User) {
+		t.Errorf("total %+v doesn't match the only CPU %+v", us[1], u)
+	}
+}
@@ -0,0 +1,100 @@
+//
+// CPU inventory and topology from the cpu_info kstats.
+
+package cpu
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// InfoSelector selects the cpu_info:N:cpu_infoN kstats.
+var InfoSelector = kstat.Selector{Module: "cpu_info", Instance: -1}
+
+// Info is what a CPU is and where it is, from its cpu_info kstat.
+type Info struct {
+	CPU int `kstat:"-"`
+
+	Brand    string `kstat:"brand"`
+	Vendor   string `kstat:"vendor_string"`
+	CPUType  string `kstat:"cpu_type"`
+	ClockMHz uint64 `kstat:"clock_MHz"`
+
+	// ChipID is the socket, and CoreID the core in it.
+	ChipID int64 `kstat:"chip_id"`
+	CoreID int64 `kstat:"core_id"`
+
+	// State is the CPU's state, such as on-line, off-line, or
+	// no-intr, and StateBegin when it entered it, in seconds since
+	// the epoch.
+	State      string `kstat:"state"`
+	StateBegin int64  `kstat:"state_begin"`
+
+	// CurrentHz is the current clock speed, and SupportedHz the
+	// speeds that it can run at, for CPUs with power management.
+	CurrentHz   uint64   `kstat:"current_clock_Hz"`
+	SupportedHz []uint64 `kstat:"-"`
+}
+
+// Online reports whether the CPU is on line, which includes CPUs that
+// are on line but don't take interrupts.
+func (in *Info) Online() bool {
+	return in.State == "on-line" || in.State == "no-intr"
+}
+
+// parseFreqs parses a supported_frequencies_Hz statistic, which is
+// the frequencies separated by colons.
+func parseFreqs(s string) []uint64 {
+	var freqs []uint64
+	for _, f := range strings.Split(s, ":") {
+		if n, err := strconv.ParseUint(f, 10, 64); err == nil {
+			freqs = append(freqs, n)
+		}
+	}
+	return freqs
+}
+
+// InfoFromSnapshot gets the Info of each CPU in a Snapshot, in the
+// Snapshot's order.
+func InfoFromSnapshot(snap *kstat.Snapshot) ([]Info, error) {
+	byCPU := make(map[int][]kstat.Value)
+	for _, v := range snap.Values {
+		if InfoSelector.Match(v) {
+			byCPU[v.Instance] = append(byCPU[v.Instance], v)
+		}
+	}
+	var lst []Info
+	for _, ki := range snap.KStats {
+		if !InfoSelector.MatchKStat(ki.Module, ki.Instance, ki.Name) {
+			continue
+		}
+		vals := byCPU[ki.Instance]
+		in := Info{CPU: ki.Instance}
+		if err := kstat.CopyValues(vals, &in); err != nil {
+			return nil, err
+		}
+		for _, v := range vals {
+			if v.Stat == "supported_frequencies_Hz" {
+				in.SupportedHz = parseFreqs(v.StringVal)
+			}
+		}
+		lst = append(lst, in)
+	}
+	return lst, nil
+}
+
+// Topology groups CPUs by chip and then by core, for aggregating
+// statistics by socket or core: Topology(infos)[chip][core] is the
+// ids of the CPUs (hardware threads) of that core.
+func Topology(infos []Info) map[int64]map[int64][]int {
+	topo := make(map[int64]map[int64][]int)
+	for _, in := range infos {
+		if topo[in.ChipID] == nil {
+			topo[in.ChipID] = make(map[int64][]int)
+		}
+		topo[in.ChipID][in.CoreID] = append(topo[in.ChipID][in.CoreID], in.CPU)
+	}
+	return topo
+}
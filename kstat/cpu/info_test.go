@@ -0,0 +1,49 @@
+package cpu_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/cpu"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestInfo(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	for c := 0; c < 4; c++ {
+		state := "on-line"
+		if c == 3 {
+			state = "off-line"
+		}
+		kstattest.AddValues(snap, kstat.KStatInfo{Module: "cpu_info", Instance: c, Name: "cpu_info" + strconv.Itoa(c), Class: "misc", Type: kstat.NamedStat},
+			kstattest.String("brand", "Intel(r) Xeon(r)"),
+			kstat.Value{Stat: "state", Type: kstat.CharData, StringVal: state},
+			kstat.Value{Stat: "clock_MHz", Type: kstat.Int64, IntVal: 2400},
+			kstat.Value{Stat: "chip_id", Type: kstat.Int32, IntVal: int64(c / 2)},
+			kstat.Value{Stat: "core_id", Type: kstat.Int32, IntVal: 0},
+			kstattest.String("supported_frequencies_Hz", "1200000000:2400000000"))
+	}
+
+	infos, err := cpu.InfoFromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("InfoFromSnapshot failed: %s", err)
+	}
+	if len(infos) != 4 {
+		t.Fatalf("expected 4 CPUs, got %+v", infos)
+	}
+	in := infos[2]
+	if in.CPU != 2 || in.Brand != "Intel(r) Xeon(r)" || in.ClockMHz != 2400 || in.ChipID != 1 || !in.Online() ||
+		!reflect.DeepEqual(in.SupportedHz, []uint64{1200000000, 2400000000}) {
+		t.Errorf("wrong cpu 2: %+v", in)
+	}
+	if infos[3].Online() {
+		t.Errorf("cpu 3 is on line: %+v", infos[3])
+	}
+
+	topo := cpu.Topology(infos)
+	if !reflect.DeepEqual(topo, map[int64]map[int64][]int{0: {0: {0, 1}}, 1: {0: {2, 3}}}) {
+		t.Errorf("wrong Topology: %v", topo)
+	}
+}
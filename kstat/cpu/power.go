@@ -0,0 +1,133 @@
+//
+// CPU idle states (C-states) and clock speeds.
+
+package cpu
+
+import (
+	"sort"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// PowerSelectors select the kstats that Power comes from: the
+// cstate:N:cN kstats of each idle state of each CPU, and the CPUs'
+// current state and clock speed from cpu_info.
+var PowerSelectors = []kstat.Selector{
+	{Module: "cstate", Instance: -1},
+	{Module: "cpu_info", Instance: -1, Stat: "current_*"},
+}
+
+// CState is the statistics of an idle state of a CPU.
+type CState struct {
+	// Name is the state's name, such as c1.
+	Name string `kstat:"-"`
+	// Latency is how long it takes to come out of the state, and
+	// Power the power used in it, as the firmware gives them.
+	Latency uint64 `kstat:"latency"`
+	Power   uint64 `kstat:"power"`
+	// Usage is the number of times that the CPU has entered the
+	// state, and Time the total time it has spent in it.
+	Usage uint64        `kstat:"usage"`
+	Time  time.Duration `kstat:"time"`
+}
+
+// Power is the power management state of a CPU.
+type Power struct {
+	CPU      int
+	Snaptime int64
+	// CurrentHz and CurrentCState are the CPU's clock speed and
+	// idle state when it was read.
+	CurrentHz     uint64
+	CurrentCState uint64
+	// CStates are in order of name. They're empty on platforms
+	// without cstate kstats, such as SPARC.
+	CStates []CState
+}
+
+// PowerFromSnapshot gets the Power of each CPU in a Snapshot, in
+// order of CPU id.
+func PowerFromSnapshot(snap *kstat.Snapshot) ([]Power, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		if v.Module == "cstate" || v.Module == "cpu_info" {
+			k := key{v.Module, v.Instance, v.Name}
+			vals[k] = append(vals[k], v)
+		}
+	}
+	byCPU := make(map[int]*Power)
+	get := func(ki kstat.KStatInfo) *Power {
+		if byCPU[ki.Instance] == nil {
+			byCPU[ki.Instance] = &Power{CPU: ki.Instance}
+		}
+		p := byCPU[ki.Instance]
+		if ki.Snaptime > p.Snaptime {
+			p.Snaptime = ki.Snaptime
+		}
+		return p
+	}
+	for _, ki := range snap.KStats {
+		kv := vals[key{ki.Module, ki.Instance, ki.Name}]
+		switch ki.Module {
+		case "cstate":
+			cs := CState{Name: ki.Name}
+			if err := kstat.CopyValues(kv, &cs); err != nil {
+				return nil, err
+			}
+			p := get(ki)
+			p.CStates = append(p.CStates, cs)
+		case "cpu_info":
+			p := get(ki)
+			for _, v := range kv {
+				switch v.Stat {
+				case "current_clock_Hz":
+					p.CurrentHz = v.UintVal
+				case "current_cstate":
+					p.CurrentCState = v.UintVal
+				}
+			}
+		}
+	}
+	var lst []Power
+	for _, p := range byCPU {
+		sort.Slice(p.CStates, func(i, j int) bool { return p.CStates[i].Name < p.CStates[j].Name })
+		lst = append(lst, *p)
+	}
+	sort.Slice(lst, func(i, j int) bool { return lst[i].CPU < lst[j].CPU })
+	return lst, nil
+}
+
+// Residency returns the percentage of the time between two readings
+// that each CPU spent in each of its idle states, by CPU id and then
+// state name. The rest of the time it was running.
+func Residency(prev, cur []Power) map[int]map[string]float64 {
+	old := make(map[int]Power, len(prev))
+	for _, p := range prev {
+		old[p.CPU] = p
+	}
+	res := make(map[int]map[string]float64)
+	for _, c := range cur {
+		p, ok := old[c.CPU]
+		el := c.Snaptime - p.Snaptime
+		if !ok || el <= 0 {
+			continue
+		}
+		ptime := make(map[string]time.Duration, len(p.CStates))
+		for _, cs := range p.CStates {
+			ptime[cs.Name] = cs.Time
+		}
+		r := make(map[string]float64)
+		for _, cs := range c.CStates {
+			if pt, ok := ptime[cs.Name]; ok && cs.Time >= pt {
+				r[cs.Name] = float64(cs.Time-pt) * 100 / float64(el)
+			}
+		}
+		res[c.CPU] = r
+	}
+	return res
+}
@@ -0,0 +1,41 @@
+package cpu_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/cpu"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func powerSnapshot(snaptime int64, c1, c2 time.Duration) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	add := func(module, name string, stats map[string]uint64) {
+		kstattest.Add(snap, kstat.KStatInfo{Module: module, Instance: 0, Name: name, Class: "misc", Type: kstat.NamedStat, Snaptime: snaptime}, stats)
+	}
+	add("cpu_info", "cpu_info0", map[string]uint64{"current_clock_Hz": 2e9, "current_cstate": 2})
+	add("cstate", "c2", map[string]uint64{"latency": 100, "usage": 5, "time": uint64(c2)})
+	add("cstate", "c1", map[string]uint64{"latency": 1, "usage": 50, "time": uint64(c1)})
+	return snap
+}
+
+func TestPower(t *testing.T) {
+	prev, err := cpu.PowerFromSnapshot(powerSnapshot(int64(time.Second), 0, 0))
+	if err != nil {
+		t.Fatalf("PowerFromSnapshot failed: %s", err)
+	}
+	if len(prev) != 1 || prev[0].CurrentHz != 2e9 || prev[0].CurrentCState != 2 || len(prev[0].CStates) != 2 ||
+		prev[0].CStates[0] != (cpu.CState{Name: "c1", Latency: 1, Usage: 50}) {
+		t.Fatalf("wrong Power: %+v", prev)
+	}
+	cur, err := cpu.PowerFromSnapshot(powerSnapshot(int64(3*time.Second), 500*time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatalf("PowerFromSnapshot failed: %s", err)
+	}
+	res := cpu.Residency(prev, cur)
+	if !reflect.DeepEqual(res, map[int]map[string]float64{0: {"c1": 25, "c2": 50}}) {
+		t.Errorf("wrong Residency: %v", res)
+	}
+}
@@ -0,0 +1,142 @@
+// Package disk reads the statistics of disks: the IO kstat of each
+// disk, its descriptive device name (such as c0t0d0), and its error
+// counters from the matching device_error kstat, all in one Disk:
+//
+//	names, _ := disk.LoadNames()
+//	disks, err := disk.Read(tok, names)
+//	...
+//	for _, d := range disks {
+//		if d.Errors != nil && d.Errors.Hard > 0 {
+//			fmt.Printf("%s has %d hard errors\n", d.DevName, d.Errors.Hard)
+//		}
+//	}
+//
+// The device_error kstat of a disk whose IO kstat is sd0 is the kstat
+// named "sd0,err" (in the sderr module, for sd, and ssderr for ssd).
+// ReadFailing finds the disks whose errors say that they're failing.
+package disk
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// IO is the statistics of a disk's IO kstat, which count up from
+// when the kstat was created. The times are in nanoseconds.
+type IO struct {
+	NRead       uint64 `kstat:"nread"`
+	NWritten    uint64 `kstat:"nwritten"`
+	Reads       uint64 `kstat:"reads"`
+	Writes      uint64 `kstat:"writes"`
+	WTime       int64  `kstat:"wtime"`
+	WLenTime    int64  `kstat:"wlentime"`
+	WLastUpdate int64  `kstat:"wlastupdate"`
+	RTime       int64  `kstat:"rtime"`
+	RLenTime    int64  `kstat:"rlentime"`
+	RLastUpdate int64  `kstat:"rlastupdate"`
+	WCnt        uint32 `kstat:"wcnt"`
+	RCnt        uint32 `kstat:"rcnt"`
+}
+
+// Errors is the statistics of a disk's device_error kstat: its error
+// counters and what the disk says it is.
+type Errors struct {
+	Soft      uint64 `kstat:"Soft Errors"`
+	Hard      uint64 `kstat:"Hard Errors"`
+	Transport uint64 `kstat:"Transport Errors"`
+
+	// The kinds of hard errors.
+	Media          uint64 `kstat:"Media Error"`
+	NotReady       uint64 `kstat:"Device Not Ready"`
+	NoDevice       uint64 `kstat:"No Device"`
+	Recoverable    uint64 `kstat:"Recoverable"`
+	IllegalRequest uint64 `kstat:"Illegal Request"`
+	// PredictiveFailure counts the times that the disk has
+	// reported that it expects to fail (SMART).
+	PredictiveFailure uint64 `kstat:"Predictive Failure Analysis"`
+
+	Vendor   string `kstat:"Vendor"`
+	Product  string `kstat:"Product"`
+	Revision string `kstat:"Revision"`
+	Serial   string `kstat:"Serial No"`
+	// Size is the disk's size in bytes.
+	Size uint64 `kstat:"Size"`
+}
+
+// Failing reports whether the disk has had hard or transport errors
+// or has predicted its own failure.
+func (e *Errors) Failing() bool {
+	return e.Hard > 0 || e.Transport > 0 || e.PredictiveFailure > 0
+}
+
+// Disk is a disk and its statistics.
+type Disk struct {
+	// KStat is the disk's IO kstat.
+	KStat kstat.KStatInfo
+	// Name is the kstat name, such as sd0, and DevName is the
+	// descriptive name, such as c0t0d0, or Name if it's not known.
+	Name    string
+	DevName string
+
+	IO IO
+	// Errors is nil if the disk has no device_error kstat.
+	Errors *Errors
+}
+
+// Failing returns the disks that are Failing, by their Errors.
+// Disks without a device_error kstat are never Failing.
+func Failing(disks []Disk) []Disk {
+	var lst []Disk
+	for _, d := range disks {
+		if d.Errors != nil && d.Errors.Failing() {
+			lst = append(lst, d)
+		}
+	}
+	return lst
+}
+
+// errName returns the name of the device_error kstat for a disk.
+func errName(name string) string {
+	return name + ",err"
+}
+
+// FromSnapshot gets the Disks from a Snapshot that has their IO
+// kstats and, optionally, their device_error kstats, giving them
+// descriptive names from names (which may be nil). Disks are the IO
+// kstats of class "disk"; partitions and the like are left out.
+func FromSnapshot(snap *kstat.Snapshot, names Names) ([]Disk, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name}
+		vals[k] = append(vals[k], v)
+	}
+	errs := make(map[string]kstat.KStatInfo)
+	for _, ki := range snap.KStats {
+		if ki.Class == "device_error" {
+			errs[ki.Name] = ki
+		}
+	}
+
+	var disks []Disk
+	for _, ki := range snap.KStats {
+		if ki.Type != kstat.IoStat || ki.Class != "disk" {
+			continue
+		}
+		d := Disk{KStat: ki, Name: ki.Name, DevName: names.Name(ki.Name)}
+		if err := kstat.CopyValues(vals[key{ki.Module, ki.Instance, ki.Name}], &d.IO); err != nil {
+			return nil, err
+		}
+		if eki, ok := errs[errName(ki.Name)]; ok {
+			d.Errors = &Errors{}
+			if err := kstat.CopyValues(vals[key{eki.Module, eki.Instance, eki.Name}], d.Errors); err != nil {
+				return nil, err
+			}
+		}
+		disks = append(disks, d)
+	}
+	return disks, nil
+}
@@ -0,0 +1,44 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading disk statistics from a Token.
+
+package disk
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that disks that have come or
+// gone are noticed, and reads the statistics of every disk, naming
+// them with names (which may be nil).
+func Read(tok *kstat.Token, names Names) ([]Disk, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	var sels []kstat.Selector
+	for _, k := range tok.AllSorted() {
+		if (k.Type == kstat.IoStat && k.Class == "disk") || k.Class == "device_error" {
+			sels = append(sels, kstat.Selector{Module: k.Module, Instance: k.Instance, Name: k.Name})
+		}
+	}
+	if len(sels) == 0 {
+		return nil, nil
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap, names)
+}
+
+// ReadFailing reads the statistics of every disk and returns the
+// ones that are Failing.
+func ReadFailing(tok *kstat.Token, names Names) ([]Disk, error) {
+	disks, err := Read(tok, names)
+	if err != nil {
+		return nil, err
+	}
+	return Failing(disks), nil
+}
@@ -0,0 +1,110 @@
+//
+// Test reading disk statistics from Snapshots.
+
+package disk_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/disk"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func diskSnapshot() *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	add := func(ki kstat.KStatInfo, stats map[string]uint64) {
+		kstattest.Add(snap, ki, stats)
+	}
+	add(kstat.KStatInfo{Module: "sd", Instance: 0, Name: "sd0", Class: "disk", Type: kstat.IoStat, Crtime: 1, Snaptime: 2},
+		map[string]uint64{"nread": 4096, "reads": 2})
+	add(kstat.KStatInfo{Module: "sd", Instance: 0, Name: "sd0,a", Class: "partition", Type: kstat.IoStat, Crtime: 1, Snaptime: 2},
+		map[string]uint64{"nread": 4096, "reads": 2})
+	add(kstat.KStatInfo{Module: "sd", Instance: 1, Name: "sd1", Class: "disk", Type: kstat.IoStat, Crtime: 1, Snaptime: 2},
+		map[string]uint64{"nwritten": 512, "writes": 1})
+	add(kstat.KStatInfo{Module: "sderr", Instance: 0, Name: "sd0,err", Class: "device_error", Type: kstat.NamedStat, Crtime: 1, Snaptime: 2},
+		map[string]uint64{"Soft Errors": 0, "Hard Errors": 3, "Transport Errors": 1})
+	return snap
+}
+
+func TestFromSnapshot(t *testing.T) {
+	disks, err := disk.FromSnapshot(diskSnapshot(), disk.Names{"sd0": "c0t0d0"})
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(disks) != 2 {
+		t.Fatalf("expected 2 disks, got %+v", disks)
+	}
+	d0, d1 := disks[0], disks[1]
+	if d0.Name != "sd0" || d0.DevName != "c0t0d0" || d0.IO.NRead != 4096 || d0.IO.Reads != 2 {
+		t.Errorf("wrong sd0: %+v", d0)
+	}
+	if d0.Errors == nil || *d0.Errors != (disk.Errors{Hard: 3, Transport: 1}) {
+		t.Errorf("wrong sd0 errors: %+v", d0.Errors)
+	}
+	if d1.Name != "sd1" || d1.DevName != "sd1" || d1.IO.NWritten != 512 || d1.Errors != nil {
+		t.Errorf("wrong sd1: %+v", d1)
+	}
+}
+
+func TestFailing(t *testing.T) {
+	snap := diskSnapshot()
+	for s, x := range map[string]string{"Vendor": "SEAGATE", "Serial No": "Z1Z0ABCD"} {
+		snap.Values = append(snap.Values, kstat.Value{
+			Module: "sderr", Instance: 0, Name: "sd0,err", Class: "device_error",
+			Stat: s, Type: kstat.CharData, StringVal: x,
+		})
+	}
+	disks, err := disk.FromSnapshot(snap, nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if e := disks[0].Errors; e.Vendor != "SEAGATE" || e.Serial != "Z1Z0ABCD" {
+		t.Errorf("wrong sd0 errors: %+v", e)
+	}
+	failing := disk.Failing(disks)
+	if len(failing) != 1 || failing[0].Name != "sd0" {
+		t.Errorf("wrong failing disks: %+v", failing)
+	}
+	if (&disk.Errors{Soft: 10}).Failing() || !(&disk.Errors{PredictiveFailure: 1}).Failing() {
+		t.Errorf("wrong Errors.Failing")
+	}
+}
+
+func TestLoadNamesFrom(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "etc"), 0o755)
+	os.MkdirAll(filepath.Join(root, "dev/dsk"), 0o755)
+	p2i := `#	Caution! This file contains critical kernel state
+#
+"/pci@0,0/pci15ad,1976@10/sd@0,0" 0 "sd"
+"/pci@0,0/pci15ad,1976@10/sd@1,0" 1 "sd"
+"/pci@0,0/pci15ad,1976@10" 0 "mpt"
+`
+	if err := os.WriteFile(filepath.Join(root, "etc/path_to_inst"), []byte(p2i), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for l, target := range map[string]string{
+		"c1t0d0s0": "../../devices/pci@0,0/pci15ad,1976@10/sd@0,0:a",
+		"c1t0d0p0": "../../devices/pci@0,0/pci15ad,1976@10/sd@0,0:q",
+		"c1t1d0s2": "../../devices/pci@0,0/pci15ad,1976@10/sd@1,0:c",
+		"c9t9d9s0": "../../devices/nowhere@0/sd@9,0:a",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, "dev/dsk", l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := disk.LoadNamesFrom(root)
+	if err != nil {
+		t.Fatalf("LoadNamesFrom failed: %s", err)
+	}
+	if exp := (disk.Names{"sd0": "c1t0d0", "sd1": "c1t1d0"}); !reflect.DeepEqual(names, exp) {
+		t.Errorf("got %v, expected %v", names, exp)
+	}
+	if n := names.Name("sd1,c"); n != "c1t1d0,c" {
+		t.Errorf("partition name is %q", n)
+	}
+}
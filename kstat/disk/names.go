@@ -0,0 +1,98 @@
+//
+// Descriptive names for disks.
+
+package disk
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Names maps the kstat names of disks (such as sd0) to their
+// descriptive names (such as c0t0d0), the ones that iostat -n uses.
+type Names map[string]string
+
+// Name returns the descriptive name for a kstat name, which may be a
+// disk (sd0) or a partition of one (sd0,a). Names that aren't known
+// are returned as they are. A nil Names knows no names.
+func (n Names) Name(kname string) string {
+	if dn, ok := n[kname]; ok {
+		return dn
+	}
+	if i := strings.IndexByte(kname, ','); i > 0 {
+		if dn, ok := n[kname[:i]]; ok {
+			return dn + kname[i:]
+		}
+	}
+	return kname
+}
+
+// LoadNames works out the descriptive names of the system's disks
+// from /etc/path_to_inst, which maps the physical device paths of
+// devices to their driver and instance (and so their kstat name),
+// and the /dev/dsk links, which point to physical device paths.
+func LoadNames() (Names, error) {
+	return LoadNamesFrom("/")
+}
+
+// LoadNamesFrom is LoadNames with the files under root instead of
+// under /, for example in a copy of another system's /etc and /dev.
+func LoadNamesFrom(root string) (Names, error) {
+	f, err := os.Open(filepath.Join(root, "etc/path_to_inst"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Lines are "physical path" instance "driver".
+	byPath := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		l := sc.Text()
+		fs := strings.Fields(l)
+		if len(fs) != 3 || strings.HasPrefix(l, "#") {
+			continue
+		}
+		byPath[strings.Trim(fs[0], `"`)] = strings.Trim(fs[2], `"`) + fs[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	n := make(Names)
+	links, err := filepath.Glob(filepath.Join(root, "dev/dsk/*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		target, err := os.Readlink(l)
+		if err != nil {
+			continue
+		}
+		// The links are to ../../devices/<physical path>:<minor>.
+		i := strings.Index(target, "/devices/")
+		if i < 0 {
+			continue
+		}
+		phys := target[i+len("/devices"):]
+		if j := strings.LastIndexByte(phys, ':'); j >= 0 {
+			phys = phys[:j]
+		}
+		kname, ok := byPath[phys]
+		if !ok {
+			continue
+		}
+		// c0t0d0s0 and c0t0d0p0 are slices of c0t0d0.
+		base := filepath.Base(l)
+		if j := strings.LastIndexAny(base, "sp"); j > 0 {
+			if _, err := strconv.Atoi(base[j+1:]); err == nil {
+				base = base[:j]
+			}
+		}
+		n[kname] = base
+	}
+	return n, nil
+}
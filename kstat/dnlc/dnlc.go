@@ -0,0 +1,96 @@
+// Package dnlc reads the statistics of the directory name lookup
+// cache from unix:0:dnlcstats, and works out how well it's doing
+// over an interval:
+//
+//	prev, err := dnlc.Read(tok)
+//	...
+//	time.Sleep(time.Minute)
+//	cur, err := dnlc.Read(tok)
+//	...
+//	if e := dnlc.Efficiency(prev, cur); e.Lookups > 1000 && e.HitRatio < 90 {
+//		fmt.Printf("DNLC hit ratio is only %.1f%%\n", e.HitRatio)
+//	}
+package dnlc
+
+import (
+	"errors"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selector selects the kstat that this package reads.
+var Selector = kstat.Selector{Module: "unix", Instance: 0, Name: "dnlcstats"}
+
+// Stats are the statistics of unix:0:dnlcstats, which count up from
+// boot.
+type Stats struct {
+	Snaptime int64 `kstat:"-"`
+
+	Hits   uint64 `kstat:"hits"`
+	Misses uint64 `kstat:"misses"`
+	// NegativeHits is the hits (included in Hits) of negative
+	// entries, which record names that don't exist.
+	NegativeHits uint64 `kstat:"negative_cache_hits"`
+	Enters       uint64 `kstat:"enters"`
+	DoubleEnters uint64 `kstat:"double_enters"`
+	// PurgeTotal is the number of entries purged from the cache.
+	PurgeTotal uint64 `kstat:"purge_total_entries"`
+}
+
+// FromSnapshot gets the Stats from a Snapshot. It's an error if the
+// Snapshot doesn't have unix:0:dnlcstats.
+func FromSnapshot(snap *kstat.Snapshot) (*Stats, error) {
+	ki, ok := snap.KStat("unix", 0, "dnlcstats")
+	if !ok {
+		return nil, errors.New("no unix:0:dnlcstats kstat")
+	}
+	st := &Stats{Snaptime: ki.Snaptime}
+	if err := kstat.CopyValues(snap.Select(Selector).Values, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Result is how well the DNLC did over an interval.
+type Result struct {
+	// Lookups is the number of lookups, and LookupRate the
+	// lookups per second.
+	Lookups    uint64
+	LookupRate float64
+	// HitRatio is the percentage of lookups that hit, and
+	// NegativeRatio the percentage of hits that were of negative
+	// entries. They're 0 if there were no lookups.
+	HitRatio      float64
+	NegativeRatio float64
+	// Enters and Purges are the entries added to and purged from
+	// the cache.
+	Enters uint64
+	Purges uint64
+}
+
+// Efficiency returns how well the DNLC did between two readings of
+// its Stats.
+func Efficiency(prev, cur *Stats) Result {
+	d := func(c, p uint64) uint64 {
+		if c < p {
+			return 0
+		}
+		return c - p
+	}
+	hits, misses := d(cur.Hits, prev.Hits), d(cur.Misses, prev.Misses)
+	r := Result{
+		Lookups: hits + misses,
+		Enters:  d(cur.Enters, prev.Enters),
+		Purges:  d(cur.PurgeTotal, prev.PurgeTotal),
+	}
+	if el := cur.Snaptime - prev.Snaptime; el > 0 {
+		r.LookupRate = float64(r.Lookups) * 1e9 / float64(el)
+	}
+	if r.Lookups > 0 {
+		r.HitRatio = float64(hits) * 100 / float64(r.Lookups)
+	}
+	if hits > 0 {
+		r.NegativeRatio = float64(d(cur.NegativeHits, prev.NegativeHits)) * 100 / float64(hits)
+	}
+	return r
+}
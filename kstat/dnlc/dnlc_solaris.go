@@ -0,0 +1,20 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading DNLC statistics from a Token.
+
+package dnlc
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read reads the DNLC statistics.
+func Read(tok *kstat.Token) (*Stats, error) {
+	snap, err := tok.Snapshot(Selector)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
@@ -0,0 +1,40 @@
+//
+// Test reading DNLC statistics from Snapshots.
+
+package dnlc_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/dnlc"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func dnlcSnapshot(snaptime int64, stats map[string]uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "unix", Instance: 0, Name: "dnlcstats", Class: "misc", Type: kstat.NamedStat, Snaptime: snaptime}, stats)
+	return snap
+}
+
+func TestEfficiency(t *testing.T) {
+	prev, err := dnlc.FromSnapshot(dnlcSnapshot(1e9, map[string]uint64{"hits": 100, "misses": 100, "negative_cache_hits": 10}))
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	cur, err := dnlc.FromSnapshot(dnlcSnapshot(3e9, map[string]uint64{"hits": 280, "misses": 120, "negative_cache_hits": 55, "enters": 20}))
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	r := dnlc.Efficiency(prev, cur)
+	if r != (dnlc.Result{Lookups: 200, LookupRate: 100, HitRatio: 90, NegativeRatio: 25, Enters: 20}) {
+		t.Errorf("wrong Result: %+v", r)
+	}
+
+	if r := dnlc.Efficiency(cur, cur); r.HitRatio != 0 || r.Lookups != 0 {
+		t.Errorf("wrong Result with no lookups: %+v", r)
+	}
+	if _, err := dnlc.FromSnapshot(&kstat.Snapshot{}); err == nil {
+		t.Errorf("FromSnapshot of an empty Snapshot didn't fail")
+	}
+}
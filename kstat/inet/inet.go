@@ -0,0 +1,117 @@
+// Package inet reads the TCP, UDP, and IP statistics of the
+// tcp:0:tcp, udp:0:udp, and ip:0:ip kstats, which have the SNMP MIB-II
+// counters (the ones netstat -s reports):
+//
+//	st, err := inet.Read(tok)
+//	...
+//	if st.TCP != nil {
+//		fmt.Printf("%d connections, %d segments retransmitted\n", st.TCP.CurrEstab, st.TCP.RetransSegs)
+//	}
+//
+// These are the statistics of the global zone's IP stack; zones with
+// exclusive IP stacks have their own instances of these kstats.
+package inet
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selectors select the kstats that this package reads.
+var Selectors = []kstat.Selector{
+	{Module: "tcp", Instance: 0, Name: "tcp"},
+	{Module: "udp", Instance: 0, Name: "udp"},
+	{Module: "ip", Instance: 0, Name: "ip"},
+}
+
+// TCP is the statistics of tcp:0:tcp.
+type TCP struct {
+	ActiveOpens  uint64 `kstat:"activeOpens"`
+	PassiveOpens uint64 `kstat:"passiveOpens"`
+	AttemptFails uint64 `kstat:"attemptFails"`
+	EstabResets  uint64 `kstat:"estabResets"`
+	// CurrEstab is the number of connections that are currently
+	// established, not a counter.
+	CurrEstab uint64 `kstat:"currEstab"`
+
+	InSegs       uint64 `kstat:"inSegs"`
+	OutSegs      uint64 `kstat:"outSegs"`
+	OutDataBytes uint64 `kstat:"outDataBytes"`
+	RetransSegs  uint64 `kstat:"retransSegs"`
+	RetransBytes uint64 `kstat:"retransBytes"`
+	OutRsts      uint64 `kstat:"outRsts"`
+	InDupAck     uint64 `kstat:"inDupAck"`
+	InClosed     uint64 `kstat:"inClosed"`
+
+	// The drops of incoming connections: ListenDrop and
+	// ListenDropQ0 when the listen queues are full, and
+	// HalfOpenDrop of half open connections.
+	ListenDrop     uint64 `kstat:"listenDrop"`
+	ListenDropQ0   uint64 `kstat:"listenDropQ0"`
+	HalfOpenDrop   uint64 `kstat:"halfOpenDrop"`
+	TimRetransDrop uint64 `kstat:"timRetransDrop"`
+}
+
+// UDP is the statistics of udp:0:udp.
+type UDP struct {
+	InDatagrams  uint64 `kstat:"inDatagrams"`
+	InErrors     uint64 `kstat:"inErrors"`
+	OutDatagrams uint64 `kstat:"outDatagrams"`
+	OutErrors    uint64 `kstat:"outErrors"`
+}
+
+// IP is the statistics of ip:0:ip.
+type IP struct {
+	InReceives      uint64 `kstat:"inReceives"`
+	InHdrErrors     uint64 `kstat:"inHdrErrors"`
+	InAddrErrors    uint64 `kstat:"inAddrErrors"`
+	InUnknownProtos uint64 `kstat:"inUnknownProtos"`
+	InDiscards      uint64 `kstat:"inDiscards"`
+	InDelivers      uint64 `kstat:"inDelivers"`
+	ForwDatagrams   uint64 `kstat:"forwDatagrams"`
+	OutRequests     uint64 `kstat:"outRequests"`
+	OutDiscards     uint64 `kstat:"outDiscards"`
+	OutNoRoutes     uint64 `kstat:"outNoRoutes"`
+
+	ReasmReqds  uint64 `kstat:"reasmReqds"`
+	ReasmOKs    uint64 `kstat:"reasmOKs"`
+	ReasmFails  uint64 `kstat:"reasmFails"`
+	FragOKs     uint64 `kstat:"fragOKs"`
+	FragFails   uint64 `kstat:"fragFails"`
+	FragCreates uint64 `kstat:"fragCreates"`
+}
+
+// Stats is the TCP, UDP, and IP statistics. Each is nil if its kstat
+// is missing. They count up from boot.
+type Stats struct {
+	Snaptime int64
+	TCP      *TCP
+	UDP      *UDP
+	IP       *IP
+}
+
+// FromSnapshot gets the Stats from a Snapshot.
+func FromSnapshot(snap *kstat.Snapshot) (*Stats, error) {
+	st := &Stats{}
+	for _, ki := range snap.KStats {
+		var dst interface{}
+		switch {
+		case Selectors[0].MatchKStat(ki.Module, ki.Instance, ki.Name):
+			st.TCP = &TCP{}
+			dst = st.TCP
+		case Selectors[1].MatchKStat(ki.Module, ki.Instance, ki.Name):
+			st.UDP = &UDP{}
+			dst = st.UDP
+		case Selectors[2].MatchKStat(ki.Module, ki.Instance, ki.Name):
+			st.IP = &IP{}
+			dst = st.IP
+		default:
+			continue
+		}
+		st.Snaptime = ki.Snaptime
+		sel := kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name}
+		if err := kstat.CopyValues(snap.Select(sel).Values, dst); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,20 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading TCP, UDP, and IP statistics from a Token.
+
+package inet
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read reads the TCP, UDP, and IP statistics.
+func Read(tok *kstat.Token) (*Stats, error) {
+	snap, err := tok.Snapshot(Selectors...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
@@ -0,0 +1,36 @@
+//
+// Test reading TCP, UDP, and IP statistics from Snapshots.
+
+package inet_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/inet"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	add := func(module string, stats map[string]uint64) {
+		ki := kstat.KStatInfo{Module: module, Instance: 0, Name: module, Class: "mib2", Type: kstat.NamedStat, Snaptime: 3}
+		kstattest.AddValues(snap, ki, kstattest.Uints(kstat.Uint32, stats)...)
+	}
+	add("tcp", map[string]uint64{"currEstab": 12, "retransSegs": 4, "listenDrop": 1})
+	add("udp", map[string]uint64{"inDatagrams": 100, "inErrors": 2})
+
+	st, err := inet.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if st.TCP == nil || st.TCP.CurrEstab != 12 || st.TCP.RetransSegs != 4 || st.TCP.ListenDrop != 1 {
+		t.Errorf("wrong TCP: %+v", st.TCP)
+	}
+	if st.UDP == nil || *st.UDP != (inet.UDP{InDatagrams: 100, InErrors: 2}) {
+		t.Errorf("wrong UDP: %+v", st.UDP)
+	}
+	if st.IP != nil || st.Snaptime != 3 {
+		t.Errorf("wrong Stats: %+v", st)
+	}
+}
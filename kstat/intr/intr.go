@@ -0,0 +1,162 @@
+// Package intr reads how interrupts are spread over CPUs, like
+// intrstat(1M) but from kstats instead of DTrace, for diagnosing
+// interrupt imbalance:
+//
+//	prev, err := intr.Read(tok)
+//	...
+//	time.Sleep(time.Second)
+//	cur, err := intr.Read(tok)
+//	...
+//	for _, c := range intr.Distribution(prev, cur) {
+//		fmt.Printf("cpu %d: %.0f intr/s\n", c.CPU, c.Rate)
+//		for _, d := range c.Devices {
+//			fmt.Printf("\t%s %.1f%%\n", d.Device, d.Busy)
+//		}
+//	}
+//
+// Each device interrupt has a pci_intrs:<n>:<nexus> kstat (of
+// class interrupts) with the device's name, the CPU the interrupt is
+// bound to, and the time spent in its handler; the number of
+// interrupts that each CPU takes comes from cpu:N:sys. Device
+// interrupt kstats only exist on platforms with PCI interrupt
+// support (which is most), so on other platforms only the per-CPU
+// counts are available.
+package intr
+
+import (
+	"sort"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selectors select the kstats that this package reads.
+var Selectors = []kstat.Selector{
+	{Module: "pci_intrs", Instance: -1},
+	{Module: "cpu", Instance: -1, Name: "sys", Stat: "intr"},
+}
+
+// Source is an interrupt source of a device.
+type Source struct {
+	KStat kstat.KStatInfo `kstat:"-"`
+
+	// Device is the device's driver and instance, such as
+	// e1000g#0, and Type is the type of interrupt, such as fixed
+	// or msi.
+	Device  string `kstat:"name"`
+	Type    string `kstat:"type"`
+	BusPath string `kstat:"buspath"`
+	// CPU is the CPU that the interrupt is currently bound to.
+	CPU int    `kstat:"cpu"`
+	PIL int    `kstat:"pil"`
+	Ino uint64 `kstat:"ino"`
+	// Time is the total time spent in the interrupt's handler.
+	Time time.Duration `kstat:"time"`
+}
+
+// Reading is the interrupt statistics at one time.
+type Reading struct {
+	Snaptime int64
+	Sources  []Source
+	// CPUIntrs is the count of interrupts that each CPU has taken,
+	// by CPU id.
+	CPUIntrs map[int]uint64
+}
+
+// FromSnapshot gets a Reading from a Snapshot.
+func FromSnapshot(snap *kstat.Snapshot) (*Reading, error) {
+	r := &Reading{CPUIntrs: make(map[int]uint64)}
+	for _, ki := range snap.KStats {
+		switch {
+		case ki.Module == "pci_intrs" && ki.Class == "interrupts":
+			src := Source{KStat: ki}
+			sel := kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name}
+			if err := kstat.CopyValues(snap.Select(sel).Values, &src); err != nil {
+				return nil, err
+			}
+			r.Sources = append(r.Sources, src)
+		case ki.Module == "cpu" && ki.Name == "sys":
+			if v, ok := snap.Get("cpu", ki.Instance, "sys", "intr"); ok {
+				r.CPUIntrs[ki.Instance] = v.UintVal
+			}
+		default:
+			continue
+		}
+		if ki.Snaptime > r.Snaptime {
+			r.Snaptime = ki.Snaptime
+		}
+	}
+	return r, nil
+}
+
+// DeviceUsage is the interrupt load of a device on a CPU.
+type DeviceUsage struct {
+	Device string
+	Type   string
+	// Busy is the percentage of the CPU's time spent in the
+	// device's interrupt handler.
+	Busy float64
+}
+
+// CPUUsage is the interrupt load of a CPU.
+type CPUUsage struct {
+	CPU int
+	// Rate is the interrupts per second that the CPU took.
+	Rate float64
+	// Busy is the percentage of the CPU's time spent in device
+	// interrupt handlers, the total of Devices.
+	Busy    float64
+	Devices []DeviceUsage
+}
+
+// Distribution returns the interrupt load of each CPU between two
+// Readings, in order of CPU id. Devices are in decreasing order of
+// Busy. An interrupt that moved to a different CPU between the
+// Readings is counted against the CPU it's on in cur.
+func Distribution(prev, cur *Reading) []CPUUsage {
+	el := cur.Snaptime - prev.Snaptime
+	if el <= 0 {
+		return nil
+	}
+	secs := float64(el) / 1e9
+	cpus := make(map[int]*CPUUsage)
+	get := func(id int) *CPUUsage {
+		if cpus[id] == nil {
+			cpus[id] = &CPUUsage{CPU: id}
+		}
+		return cpus[id]
+	}
+	for id, n := range cur.CPUIntrs {
+		if p, ok := prev.CPUIntrs[id]; ok && n >= p {
+			get(id).Rate = float64(n-p) / secs
+		}
+	}
+
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	old := make(map[key]Source)
+	for _, s := range prev.Sources {
+		old[key{s.KStat.Module, s.KStat.Instance, s.KStat.Name}] = s
+	}
+	for _, s := range cur.Sources {
+		p, ok := old[key{s.KStat.Module, s.KStat.Instance, s.KStat.Name}]
+		if !ok || s.Time < p.Time {
+			continue
+		}
+		busy := float64(s.Time-p.Time) * 100 / float64(el)
+		c := get(s.CPU)
+		c.Busy += busy
+		c.Devices = append(c.Devices, DeviceUsage{Device: s.Device, Type: s.Type, Busy: busy})
+	}
+
+	var lst []CPUUsage
+	for _, c := range cpus {
+		sort.SliceStable(c.Devices, func(i, j int) bool { return c.Devices[i].Busy > c.Devices[j].Busy })
+		lst = append(lst, *c)
+	}
+	sort.Slice(lst, func(i, j int) bool { return lst[i].CPU < lst[j].CPU })
+	return lst
+}
@@ -0,0 +1,24 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading interrupt statistics from a Token.
+
+package intr
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that interrupts and CPUs that
+// have come or gone are noticed, and reads the interrupt statistics.
+func Read(tok *kstat.Token) (*Reading, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.Snapshot(Selectors...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
@@ -0,0 +1,60 @@
+//
+// Test reading interrupt statistics from Snapshots.
+
+package intr_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/intr"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// intrSnapshot makes a Snapshot at snaptime with two CPUs that have
+// taken intrs interrupts and an e1000g#0 interrupt bound to cpu that
+// has taken handler nanoseconds.
+func intrSnapshot(snaptime int64, intrs [2]uint64, cpu, handler uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	add := func(ki kstat.KStatInfo, vals ...kstat.Value) {
+		ki.Snaptime = snaptime
+		kstattest.AddValues(snap, ki, vals...)
+	}
+	for i, n := range intrs {
+		add(kstat.KStatInfo{Module: "cpu", Instance: i, Name: "sys", Class: "misc", Type: kstat.NamedStat},
+			kstat.Value{Stat: "intr", Type: kstat.Uint64, UintVal: n})
+	}
+	add(kstat.KStatInfo{Module: "pci_intrs", Instance: 3, Name: "npe", Class: "interrupts", Type: kstat.NamedStat},
+		kstat.Value{Stat: "name", Type: kstat.CharData, StringVal: "e1000g#0"},
+		kstat.Value{Stat: "type", Type: kstat.CharData, StringVal: "msi"},
+		kstat.Value{Stat: "cpu", Type: kstat.Uint64, UintVal: cpu},
+		kstat.Value{Stat: "time", Type: kstat.Uint64, UintVal: handler})
+	return snap
+}
+
+func TestDistribution(t *testing.T) {
+	prev, err := intr.FromSnapshot(intrSnapshot(1e9, [2]uint64{100, 100}, 1, 0))
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(prev.Sources) != 1 || prev.Sources[0].Device != "e1000g#0" || prev.Sources[0].CPU != 1 || prev.CPUIntrs[1] != 100 {
+		t.Fatalf("wrong Reading: %+v", prev)
+	}
+	cur, err := intr.FromSnapshot(intrSnapshot(3e9, [2]uint64{120, 2100}, 1, uint64(200*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+
+	dist := intr.Distribution(prev, cur)
+	if len(dist) != 2 {
+		t.Fatalf("expected 2 CPUs, got %+v", dist)
+	}
+	if c := dist[0]; c.CPU != 0 || c.Rate != 10 || c.Busy != 0 || len(c.Devices) != 0 {
+		t.Errorf("wrong cpu 0: %+v", c)
+	}
+	c := dist[1]
+	if c.CPU != 1 || c.Rate != 1000 || c.Busy != 10 || len(c.Devices) != 1 || c.Devices[0] != (intr.DeviceUsage{Device: "e1000g#0", Type: "msi", Busy: 10}) {
+		t.Errorf("wrong cpu 1: %+v", c)
+	}
+}
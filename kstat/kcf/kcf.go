@@ -0,0 +1,112 @@
+// Package kcf reads the statistics of the kernel cryptographic
+// framework: the operation counts of each crypto provider, and the
+// state of the framework's request queues and worker threads, for
+// seeing whether work is going to hardware crypto providers and
+// whether it's backing up:
+//
+//	st, err := kcf.Read(tok)
+//	...
+//	for _, p := range st.Providers {
+//		fmt.Printf("%s: %d operations, %d failed\n", p.Name, p.Total, p.Failed)
+//	}
+//
+// Each provider has a named kstat of class crypto with kcf_ops_*
+// statistics (usually kcf:0:<provider>_provider_stats), and the
+// framework has kcf:0:kcf_stats. The kernel only counts operations
+// per provider; it has no per-mechanism kstats, so per-mechanism
+// counts have to come from DTrace.
+package kcf
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Provider is the operation counts of a crypto provider, which count
+// up from when it registered.
+type Provider struct {
+	// Name is the provider's kstat's name.
+	Name  string          `kstat:"-"`
+	KStat kstat.KStatInfo `kstat:"-"`
+
+	Total  uint64 `kstat:"kcf_ops_total"`
+	Passed uint64 `kstat:"kcf_ops_passed"`
+	Failed uint64 `kstat:"kcf_ops_failed"`
+	// Busy is the number of requests the provider turned away
+	// because it was busy.
+	Busy uint64 `kstat:"kcf_ops_returned_busy"`
+}
+
+// Queues is the state of the framework's worker threads and request
+// queues, from kcf:0:kcf_stats. These are current values, not
+// counters.
+type Queues struct {
+	Threads     uint64 `kstat:"total threads in pool"`
+	IdleThreads uint64 `kstat:"idle threads in pool"`
+	MinThreads  uint64 `kstat:"min threads in pool"`
+	MaxThreads  uint64 `kstat:"max threads in pool"`
+
+	// Requests is the number of requests in the global software
+	// queue, and MaxRequests the most it can hold.
+	Requests    uint64 `kstat:"requests in gswq"`
+	MaxRequests uint64 `kstat:"max requests in gswq"`
+
+	HWThreads  uint64 `kstat:"threads for HW taskq"`
+	HWMinAlloc uint64 `kstat:"minalloc for HW taskq"`
+	HWMaxAlloc uint64 `kstat:"maxalloc for HW taskq"`
+}
+
+// Stats is the statistics of the cryptographic framework.
+type Stats struct {
+	// Providers are in the Snapshot's order.
+	Providers []Provider
+	// Queues is nil if there's no kcf:0:kcf_stats kstat.
+	Queues *Queues
+}
+
+// FromSnapshot gets the Stats from a Snapshot. Providers are the
+// kstats of class crypto that have a kcf_ops_total statistic.
+func FromSnapshot(snap *kstat.Snapshot) (*Stats, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		if v.Class == "crypto" {
+			k := key{v.Module, v.Instance, v.Name}
+			vals[k] = append(vals[k], v)
+		}
+	}
+
+	st := &Stats{}
+	for _, ki := range snap.KStats {
+		if ki.Class != "crypto" {
+			continue
+		}
+		kv := vals[key{ki.Module, ki.Instance, ki.Name}]
+		if ki.Module == "kcf" && ki.Name == "kcf_stats" {
+			st.Queues = &Queues{}
+			if err := kstat.CopyValues(kv, st.Queues); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		isProv := false
+		for _, v := range kv {
+			if v.Stat == "kcf_ops_total" {
+				isProv = true
+				break
+			}
+		}
+		if !isProv {
+			continue
+		}
+		p := Provider{Name: ki.Name, KStat: ki}
+		if err := kstat.CopyValues(kv, &p); err != nil {
+			return nil, err
+		}
+		st.Providers = append(st.Providers, p)
+	}
+	return st, nil
+}
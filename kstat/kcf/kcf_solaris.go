@@ -0,0 +1,34 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading cryptographic framework statistics from a Token.
+
+package kcf
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that providers that have come
+// or gone are noticed, and reads the statistics of the cryptographic
+// framework.
+func Read(tok *kstat.Token) (*Stats, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	var sels []kstat.Selector
+	for _, k := range tok.AllSorted() {
+		if k.Class == "crypto" {
+			sels = append(sels, kstat.Selector{Module: k.Module, Instance: k.Instance, Name: k.Name})
+		}
+	}
+	if len(sels) == 0 {
+		return &Stats{}, nil
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
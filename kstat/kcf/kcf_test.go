@@ -0,0 +1,41 @@
+//
+// Test reading cryptographic framework statistics from Snapshots.
+
+package kcf_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/kcf"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	add := func(module, name, class string, stats map[string]uint64) {
+		kstattest.Add(snap, kstat.KStatInfo{Module: module, Instance: 0, Name: name, Class: class, Type: kstat.NamedStat}, stats)
+	}
+	add("kcf", "aes_provider_stats", "crypto", map[string]uint64{"kcf_ops_total": 100, "kcf_ops_passed": 98, "kcf_ops_failed": 2})
+	add("kcf", "kcf_stats", "crypto", map[string]uint64{"total threads in pool": 8, "idle threads in pool": 6, "requests in gswq": 3})
+	add("kcf", "other", "crypto", map[string]uint64{"something": 1})
+	add("n2cp", "n2cp_0_provider_stats", "crypto", map[string]uint64{"kcf_ops_total": 50, "kcf_ops_returned_busy": 5})
+	add("unix", "system_misc", "misc", map[string]uint64{"kcf_ops_total": 1})
+
+	st, err := kcf.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(st.Providers) != 2 {
+		t.Fatalf("expected 2 providers, got %+v", st.Providers)
+	}
+	if p := st.Providers[0]; p.Name != "aes_provider_stats" || p.Total != 100 || p.Passed != 98 || p.Failed != 2 {
+		t.Errorf("wrong aes provider: %+v", p)
+	}
+	if p := st.Providers[1]; p.Name != "n2cp_0_provider_stats" || p.Total != 50 || p.Busy != 5 {
+		t.Errorf("wrong n2cp provider: %+v", p)
+	}
+	if q := st.Queues; q == nil || *q != (kcf.Queues{Threads: 8, IdleThreads: 6, Requests: 3}) {
+		t.Errorf("wrong Queues: %+v", q)
+	}
+}
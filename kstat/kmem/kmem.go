@@ -0,0 +1,112 @@
+// Package kmem reads the statistics of the kernel memory allocator's
+// caches from their unix:0:<cache> kstats (of class kmem_cache),
+// which is the information that mdb's ::kmastat shows:
+//
+//	caches, err := kmem.Read(tok)
+//	...
+//	sum := kmem.Summarize(caches)
+//	for _, c := range sum.Largest {
+//		fmt.Printf("%-30s %d bytes\n", c.Name, c.Memory())
+//	}
+package kmem
+
+import (
+	"sort"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Cache is the statistics of a kmem cache.
+type Cache struct {
+	Name string `kstat:"-"`
+
+	// BufSize is the size of the cache's buffers, and ChunkSize
+	// the space each takes in a slab.
+	BufSize   uint64 `kstat:"buf_size"`
+	ChunkSize uint64 `kstat:"chunk_size"`
+	SlabSize  uint64 `kstat:"slab_size"`
+
+	// Alloc and Free count allocations and frees, and AllocFail
+	// the allocations that failed.
+	Alloc     uint64 `kstat:"alloc"`
+	Free      uint64 `kstat:"free"`
+	AllocFail uint64 `kstat:"alloc_fail"`
+
+	// The buffers: how many are allocated, constructed and
+	// available in the cache, in total, and at most ever.
+	BufInUse uint64 `kstat:"buf_inuse"`
+	BufAvail uint64 `kstat:"buf_avail"`
+	BufTotal uint64 `kstat:"buf_total"`
+	BufMax   uint64 `kstat:"buf_max"`
+
+	SlabCreate  uint64 `kstat:"slab_create"`
+	SlabDestroy uint64 `kstat:"slab_destroy"`
+}
+
+// Memory returns the memory that the cache's slabs take up, in bytes.
+func (c *Cache) Memory() uint64 {
+	if c.SlabDestroy > c.SlabCreate {
+		return 0
+	}
+	return (c.SlabCreate - c.SlabDestroy) * c.SlabSize
+}
+
+// InUse returns the memory of the cache's allocated buffers, in
+// bytes.
+func (c *Cache) InUse() uint64 {
+	return c.BufInUse * c.BufSize
+}
+
+// FromSnapshot gets the Caches from a Snapshot, in the Snapshot's
+// order.
+func FromSnapshot(snap *kstat.Snapshot) ([]Cache, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name}
+		vals[k] = append(vals[k], v)
+	}
+	var caches []Cache
+	for _, ki := range snap.KStats {
+		if ki.Class != "kmem_cache" {
+			continue
+		}
+		c := Cache{Name: ki.Name}
+		if err := kstat.CopyValues(vals[key{ki.Module, ki.Instance, ki.Name}], &c); err != nil {
+			return nil, err
+		}
+		caches = append(caches, c)
+	}
+	return caches, nil
+}
+
+// Summary is a summary of the kernel memory in kmem caches.
+type Summary struct {
+	Caches int
+	// Memory and InUse are the totals of the caches' Memory and
+	// InUse, and AllocFail of their failed allocations.
+	Memory    uint64
+	InUse     uint64
+	AllocFail uint64
+	// Largest is all of the caches in decreasing order of Memory.
+	Largest []Cache
+}
+
+// Summarize summarizes the memory in caches.
+func Summarize(caches []Cache) Summary {
+	s := Summary{Caches: len(caches), Largest: make([]Cache, len(caches))}
+	copy(s.Largest, caches)
+	for i := range caches {
+		s.Memory += caches[i].Memory()
+		s.InUse += caches[i].InUse()
+		s.AllocFail += caches[i].AllocFail
+	}
+	sort.SliceStable(s.Largest, func(i, j int) bool {
+		return s.Largest[i].Memory() > s.Largest[j].Memory()
+	})
+	return s
+}
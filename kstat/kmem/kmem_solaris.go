@@ -0,0 +1,34 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading kmem cache statistics from a Token.
+
+package kmem
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that caches that have been
+// created or destroyed are noticed, and reads the statistics of
+// every kmem cache.
+func Read(tok *kstat.Token) ([]Cache, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	var sels []kstat.Selector
+	for _, k := range tok.AllSorted() {
+		if k.Class == "kmem_cache" {
+			sels = append(sels, kstat.Selector{Module: k.Module, Instance: k.Instance, Name: k.Name})
+		}
+	}
+	if len(sels) == 0 {
+		return nil, nil
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
@@ -0,0 +1,38 @@
+//
+// Test reading kmem cache statistics from Snapshots.
+
+package kmem_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/kmem"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestCaches(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	add := func(name, class string, stats map[string]uint64) {
+		kstattest.Add(snap, kstat.KStatInfo{Module: "unix", Instance: 0, Name: name, Class: class, Type: kstat.NamedStat}, stats)
+	}
+	add("kmem_alloc_8", "kmem_cache", map[string]uint64{"buf_size": 8, "slab_size": 4096, "slab_create": 3, "slab_destroy": 1, "buf_inuse": 100})
+	add("system_pages", "pages", map[string]uint64{"freemem": 1})
+	add("zio_buf_512", "kmem_cache", map[string]uint64{"buf_size": 512, "slab_size": 8192, "slab_create": 10, "buf_inuse": 50, "alloc_fail": 2})
+
+	caches, err := kmem.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(caches) != 2 || caches[0].Name != "kmem_alloc_8" || caches[0].Memory() != 2*4096 || caches[0].InUse() != 800 {
+		t.Fatalf("wrong caches: %+v", caches)
+	}
+
+	s := kmem.Summarize(caches)
+	if s.Caches != 2 || s.Memory != 2*4096+10*8192 || s.InUse != 800+50*512 || s.AllocFail != 2 {
+		t.Errorf("wrong Summary: %+v", s)
+	}
+	if s.Largest[0].Name != "zio_buf_512" || caches[0].Name != "kmem_alloc_8" {
+		t.Errorf("wrong order: %+v", s.Largest)
+	}
+}
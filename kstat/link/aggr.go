@@ -0,0 +1,153 @@
+//
+// Rates of datalinks, and the ports of aggregations.
+
+package link
+
+import (
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Rate is the per second traffic of a datalink between two readings
+// of its Stats.
+type Rate struct {
+	Name     string
+	Zone     string
+	RBytes   float64
+	OBytes   float64
+	IPackets float64
+	OPackets float64
+	Errors   float64
+}
+
+func rate(prev, cur uint64, elapsed int64) float64 {
+	if cur < prev || elapsed <= 0 {
+		return 0
+	}
+	return float64(cur-prev) * 1e9 / float64(elapsed)
+}
+
+func linkRate(p, c Stats) Rate {
+	el := c.KStat.Snaptime - p.KStat.Snaptime
+	return Rate{
+		Name:     c.Name,
+		Zone:     c.Zone,
+		RBytes:   rate(p.RBytes, c.RBytes, el),
+		OBytes:   rate(p.OBytes, c.OBytes, el),
+		IPackets: rate(p.IPackets, c.IPackets, el),
+		OPackets: rate(p.OPackets, c.OPackets, el),
+		Errors:   rate(p.IErrors+p.OErrors, c.IErrors+c.OErrors, el),
+	}
+}
+
+// Rates returns the Rate of each datalink in cur that's also in prev
+// as the same incarnation of its kstat, in cur's order. VNICs are
+// datalinks like any other, so this gives the traffic of each VNIC
+// (and so of each tenant or zone that has one); which links are
+// VNICs is up to dladm show-vnic, since kstats don't say.
+func Rates(prev, cur []Stats) []Rate {
+	type key struct {
+		module string
+		name   string
+	}
+	old := make(map[key]Stats, len(prev))
+	for _, s := range prev {
+		old[key{s.KStat.Module, s.KStat.Name}] = s
+	}
+	var lst []Rate
+	for _, s := range cur {
+		p, ok := old[key{s.KStat.Module, s.KStat.Name}]
+		if !ok || p.KStat.Crtime != s.KStat.Crtime {
+			continue
+		}
+		lst = append(lst, linkRate(p, s))
+	}
+	return lst
+}
+
+// Aggr is a link aggregation and its ports. The aggregation's own
+// Stats are the total of its ports.
+type Aggr struct {
+	Stats
+	Ports []Stats
+}
+
+// isPort reports whether a kstat is the kstat of a port of an
+// aggregation, which is <aggr>:0:<port> (of class net). The MAC
+// layer's per-ring kstats are also in a module named after the
+// link, but have names starting with mac_.
+func isPort(ki kstat.KStatInfo, links map[string]bool) bool {
+	return links[ki.Module] && ki.Class == "net" && ki.Type == kstat.NamedStat && !strings.HasPrefix(ki.Name, "mac_")
+}
+
+// AggrsFromSnapshot gets the aggregations in a Snapshot with their
+// ports; the Snapshot needs the link:0:<link> kstats and the
+// aggregations' port kstats. Ports are in the Snapshot's order.
+func AggrsFromSnapshot(snap *kstat.Snapshot) []Aggr {
+	links := FromSnapshot(snap)
+	names := make(map[string]bool, len(links))
+	for _, l := range links {
+		if l.KStat.Module == "link" && l.Zone == "" {
+			names[l.Name] = true
+		}
+	}
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		if names[v.Module] {
+			k := key{v.Module, v.Instance, v.Name}
+			vals[k] = append(vals[k], v)
+		}
+	}
+	ports := make(map[string][]Stats)
+	for _, ki := range snap.KStats {
+		if isPort(ki, names) {
+			ports[ki.Module] = append(ports[ki.Module], fromValues(ki, vals[key{ki.Module, ki.Instance, ki.Name}]))
+		}
+	}
+	var aggrs []Aggr
+	for _, l := range links {
+		if p := ports[l.Name]; len(p) > 0 && l.Zone == "" {
+			aggrs = append(aggrs, Aggr{Stats: l, Ports: p})
+		}
+	}
+	return aggrs
+}
+
+// PortShare is how much of an aggregation's traffic went through
+// one of its ports, as percentages.
+type PortShare struct {
+	Port   string
+	RBytes float64
+	OBytes float64
+}
+
+// Distribution returns how an aggregation's traffic was spread over
+// its ports between two readings, in cur's order of ports. A badly
+// skewed distribution usually means that the aggregation's policy
+// doesn't suit the traffic.
+func Distribution(prev, cur Aggr) []PortShare {
+	rates := Rates(prev.Ports, cur.Ports)
+	var rtot, otot float64
+	for _, r := range rates {
+		rtot += r.RBytes
+		otot += r.OBytes
+	}
+	var lst []PortShare
+	for _, r := range rates {
+		ps := PortShare{Port: r.Name}
+		if rtot > 0 {
+			ps.RBytes = r.RBytes * 100 / rtot
+		}
+		if otot > 0 {
+			ps.OBytes = r.OBytes * 100 / otot
+		}
+		lst = append(lst, ps)
+	}
+	return lst
+}
@@ -0,0 +1,146 @@
+// Package link reads the traffic statistics of network datalinks:
+//
+//	links, err := link.Read(tok)
+//	...
+//	for _, l := range links {
+//		fmt.Printf("%s: %d bytes in, %d bytes out\n", l.Name, l.RBytes, l.OBytes)
+//	}
+//
+// Datalinks are found through the link:0:<link> kstats, which exist
+// for every datalink (physical links, VNICs, aggregations, and so on)
+// under its own name, including vanity names such as net0. On old
+// systems without them, the kstats of class "net" that network
+// drivers have for each of their instances (such as e1000g:0:e1000g0)
+// are used instead.
+//
+// The 64-bit versions of the counters (rbytes64 and so on) are used
+// when a link has them, since the 32-bit ones wrap quickly on fast
+// links.
+//
+// Rates gives the traffic of each link (including VNICs) per second,
+// and ReadAggrs and Distribution show how the traffic of link
+// aggregations is spread over their ports.
+package link
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selector selects the link:0:<link> kstats.
+var Selector = kstat.Selector{Module: "link", Instance: 0}
+
+// Stats are the statistics of a datalink, which count up from when
+// its kstat was created.
+type Stats struct {
+	// Name is the link's name. Zone is the zone that it belongs to,
+	// for the links of other zones (whose kstats in the global zone
+	// are named zone/link), and blank otherwise.
+	Name  string
+	Zone  string
+	KStat kstat.KStatInfo
+
+	RBytes   uint64
+	OBytes   uint64
+	IPackets uint64
+	OPackets uint64
+	IErrors  uint64
+	OErrors  uint64
+	// NoRcvBuf and NoXmtBuf count packets dropped for lack of
+	// buffers.
+	NoRcvBuf uint64
+	NoXmtBuf uint64
+
+	// IfSpeed is the link speed in bits per second, and is 0 if
+	// it's not known. LinkState is 1 if the link is up.
+	IfSpeed   uint64
+	LinkState uint64
+}
+
+// stat returns the value of the first of the statistics that is in
+// byName, preferring the 64-bit versions.
+func stat(byName map[string]kstat.Value, names ...string) uint64 {
+	for _, n := range names {
+		if v, ok := byName[n]; ok {
+			if v.Type == kstat.Int32 || v.Type == kstat.Int64 {
+				return uint64(v.IntVal)
+			}
+			return v.UintVal
+		}
+	}
+	return 0
+}
+
+func fromValues(ki kstat.KStatInfo, vals []kstat.Value) Stats {
+	byName := make(map[string]kstat.Value, len(vals))
+	for _, v := range vals {
+		byName[v.Stat] = v
+	}
+	st := Stats{Name: ki.Name, KStat: ki}
+	if i := strings.IndexByte(ki.Name, '/'); i >= 0 {
+		st.Zone, st.Name = ki.Name[:i], ki.Name[i+1:]
+	}
+	st.RBytes = stat(byName, "rbytes64", "rbytes")
+	st.OBytes = stat(byName, "obytes64", "obytes")
+	st.IPackets = stat(byName, "ipackets64", "ipackets")
+	st.OPackets = stat(byName, "opackets64", "opackets")
+	st.IErrors = stat(byName, "ierrors")
+	st.OErrors = stat(byName, "oerrors")
+	st.NoRcvBuf = stat(byName, "norcvbuf")
+	st.NoXmtBuf = stat(byName, "noxmtbuf")
+	st.IfSpeed = stat(byName, "ifspeed")
+	st.LinkState = stat(byName, "link_state")
+	return st
+}
+
+// isLink reports whether a kstat is a link:0:<link> kstat.
+func isLink(ki kstat.KStatInfo) bool {
+	return Selector.MatchKStat(ki.Module, ki.Instance, ki.Name)
+}
+
+// isDriverLink reports whether a kstat is the per-instance kstat of a
+// network driver, such as e1000g:0:e1000g0.
+func isDriverLink(ki kstat.KStatInfo) bool {
+	return ki.Class == "net" && ki.Type == kstat.NamedStat && ki.Name == ki.Module+strconv.Itoa(ki.Instance)
+}
+
+// linkKStats returns the kstats of the datalinks: the link:0:<link>
+// kstats if there are any and otherwise the drivers' kstats.
+func linkKStats(kstats []kstat.KStatInfo) []kstat.KStatInfo {
+	var links, drivers []kstat.KStatInfo
+	for _, ki := range kstats {
+		switch {
+		case isLink(ki):
+			links = append(links, ki)
+		case isDriverLink(ki):
+			drivers = append(drivers, ki)
+		}
+	}
+	if len(links) > 0 {
+		return links
+	}
+	return drivers
+}
+
+// FromSnapshot gets the Stats of the datalinks in a Snapshot, from
+// the link:0:<link> kstats if it has any and otherwise from the
+// drivers' kstats.
+func FromSnapshot(snap *kstat.Snapshot) []Stats {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name}
+		vals[k] = append(vals[k], v)
+	}
+	var lst []Stats
+	for _, ki := range linkKStats(snap.KStats) {
+		lst = append(lst, fromValues(ki, vals[key{ki.Module, ki.Instance, ki.Name}]))
+	}
+	return lst
+}
@@ -0,0 +1,99 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading datalink statistics from a Token.
+
+package link
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// allKStats updates tok's kstat chain, so that links that have come
+// or gone are noticed, and returns all of its kstats.
+func allKStats(tok *kstat.Token) ([]kstat.KStatInfo, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	var kstats []kstat.KStatInfo
+	for _, k := range tok.AllSorted() {
+		kstats = append(kstats, kstat.KStatInfo{Module: k.Module, Instance: k.Instance, Name: k.Name, Class: k.Class, Type: k.Type})
+	}
+	return kstats, nil
+}
+
+// update updates tok's kstat chain and returns the kstats of the
+// datalinks.
+func update(tok *kstat.Token) ([]kstat.KStatInfo, error) {
+	kstats, err := allKStats(tok)
+	if err != nil {
+		return nil, err
+	}
+	return linkKStats(kstats), nil
+}
+
+// Names returns the names of the datalinks, as they appear in Stats,
+// with the zone/ prefix of the links of other zones.
+func Names(tok *kstat.Token) ([]string, error) {
+	kstats, err := update(tok)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, ki := range kstats {
+		names = append(names, ki.Name)
+	}
+	return names, nil
+}
+
+// Read reads the statistics of every datalink.
+func Read(tok *kstat.Token) ([]Stats, error) {
+	kstats, err := update(tok)
+	if err != nil {
+		return nil, err
+	}
+	if len(kstats) == 0 {
+		return nil, nil
+	}
+	var sels []kstat.Selector
+	for _, ki := range kstats {
+		sels = append(sels, kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name})
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap), nil
+}
+
+// ReadAggrs reads the statistics of every link aggregation and its
+// ports.
+func ReadAggrs(tok *kstat.Token) ([]Aggr, error) {
+	kstats, err := allKStats(tok)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	var sels []kstat.Selector
+	for _, ki := range kstats {
+		if isLink(ki) {
+			names[ki.Name] = true
+			sels = append(sels, kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name})
+		}
+	}
+	n := len(sels)
+	for _, ki := range kstats {
+		if isPort(ki, names) {
+			sels = append(sels, kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name})
+		}
+	}
+	if len(sels) == n {
+		return nil, nil
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		return nil, err
+	}
+	return AggrsFromSnapshot(snap), nil
+}
@@ -0,0 +1,98 @@
+//
+// Test reading datalink statistics from Snapshots.
+
+package link_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/link"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "e1000g", Instance: 0, Name: "e1000g0", Class: "net", Type: kstat.NamedStat},
+		map[string]uint64{"rbytes": 1})
+	kstattest.Add(snap, kstat.KStatInfo{Module: "link", Instance: 0, Name: "net0", Class: "net", Type: kstat.NamedStat},
+		map[string]uint64{"rbytes": 100, "rbytes64": 1 << 33, "obytes": 200, "ipackets64": 5, "ierrors": 2, "ifspeed": 1e9})
+	kstattest.Add(snap, kstat.KStatInfo{Module: "link", Instance: 0, Name: "z1/net0", Class: "net", Type: kstat.NamedStat},
+		map[string]uint64{"opackets": 7})
+
+	links := link.FromSnapshot(snap)
+	if len(links) != 2 {
+		t.Fatalf("expected 2 links, got %+v", links)
+	}
+	l0, l1 := links[0], links[1]
+	if l0.Name != "net0" || l0.Zone != "" || l0.RBytes != 1<<33 || l0.OBytes != 200 || l0.IPackets != 5 ||
+		l0.IErrors != 2 || l0.IfSpeed != 1e9 {
+		t.Errorf("wrong net0: %+v", l0)
+	}
+	if l1.Name != "net0" || l1.Zone != "z1" || l1.OPackets != 7 {
+		t.Errorf("wrong z1/net0: %+v", l1)
+	}
+}
+
+func TestFromSnapshotDrivers(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "e1000g", Instance: 1, Name: "e1000g1", Class: "net", Type: kstat.NamedStat},
+		map[string]uint64{"rbytes": 10, "obytes64": 20})
+	kstattest.Add(snap, kstat.KStatInfo{Module: "e1000g", Instance: 1, Name: "mac", Class: "net", Type: kstat.NamedStat},
+		map[string]uint64{"rbytes": 99})
+
+	links := link.FromSnapshot(snap)
+	if len(links) != 1 || links[0].Name != "e1000g1" || links[0].RBytes != 10 || links[0].OBytes != 20 {
+		t.Errorf("wrong links: %+v", links)
+	}
+}
+
+func TestRates(t *testing.T) {
+	ki := kstat.KStatInfo{Module: "link", Instance: 0, Name: "vnic1", Class: "net", Type: kstat.NamedStat, Crtime: 1, Snaptime: 1e9}
+	prev := []link.Stats{{Name: "vnic1", KStat: ki, RBytes: 1000, OPackets: 10}}
+	ki.Snaptime = 3e9
+	cur := []link.Stats{{Name: "vnic1", KStat: ki, RBytes: 5000, OPackets: 30, IErrors: 2}}
+	rates := link.Rates(prev, cur)
+	if len(rates) != 1 || rates[0] != (link.Rate{Name: "vnic1", RBytes: 2000, OPackets: 10, Errors: 1}) {
+		t.Errorf("wrong Rates: %+v", rates)
+	}
+
+	// A recreated link has no Rate.
+	cur[0].KStat.Crtime = 2
+	if rates := link.Rates(prev, cur); len(rates) != 0 {
+		t.Errorf("wrong Rates for a recreated link: %+v", rates)
+	}
+}
+
+func TestAggrs(t *testing.T) {
+	snapshot := func(snaptime int64, p1, p2 uint64) *kstat.Snapshot {
+		snap := &kstat.Snapshot{}
+		for _, ki := range []kstat.KStatInfo{
+			{Module: "link", Instance: 0, Name: "aggr1"},
+			{Module: "link", Instance: 0, Name: "net0"},
+			{Module: "aggr1", Instance: 0, Name: "net0"},
+			{Module: "aggr1", Instance: 0, Name: "net1"},
+			{Module: "aggr1", Instance: 0, Name: "mac_rx_swlane0"},
+		} {
+			ki.Class, ki.Type, ki.Snaptime = "net", kstat.NamedStat, snaptime
+			x := p1 + p2
+			switch {
+			case ki.Module == "aggr1" && ki.Name == "net0":
+				x = p1
+			case ki.Module == "aggr1" && ki.Name == "net1":
+				x = p2
+			}
+			kstattest.Add(snap, ki, map[string]uint64{"rbytes64": x})
+		}
+		return snap
+	}
+	prev := link.AggrsFromSnapshot(snapshot(1e9, 0, 0))
+	cur := link.AggrsFromSnapshot(snapshot(2e9, 300, 100))
+	if len(cur) != 1 || cur[0].Name != "aggr1" || cur[0].RBytes != 400 || len(cur[0].Ports) != 2 || cur[0].Ports[1].Name != "net1" {
+		t.Fatalf("wrong Aggrs: %+v", cur)
+	}
+	dist := link.Distribution(prev[0], cur[0])
+	if len(dist) != 2 || dist[0] != (link.PortShare{Port: "net0", RBytes: 75}) || dist[1] != (link.PortShare{Port: "net1", RBytes: 25}) {
+		t.Errorf("wrong Distribution: %+v", dist)
+	}
+}
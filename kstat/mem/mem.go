@@ -0,0 +1,77 @@
+// Package mem reads the system's memory statistics from the
+// unix:0:system_pages kstat, in bytes:
+//
+//	m, err := mem.Read(tok)
+//	...
+//	fmt.Printf("%d of %d bytes free\n", m.Free, m.Physical)
+//
+// The kstat reports memory in pages; Read converts it with the page
+// size of the running system. Snapshots from elsewhere need the page
+// size of the system they came from.
+//
+// ReadSwap reads the swap statistics from the unix:0:vminfo kstat.
+package mem
+
+import (
+	"errors"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selector selects the kstat that this package reads.
+var Selector = kstat.Selector{Module: "unix", Instance: 0, Name: "system_pages"}
+
+// Stats are the memory statistics of the system. Everything but the
+// page scanner's rates is in bytes.
+type Stats struct {
+	Snaptime int64 `kstat:"-"`
+
+	// Physical is the memory that the system has, and Total the
+	// memory that it manages (Physical less what the firmware and
+	// early boot take).
+	Physical uint64 `kstat:"physmem,unit=pages"`
+	Total    uint64 `kstat:"pagestotal,unit=pages"`
+	// Free is the free memory, which is what vmstat reports. Avail
+	// is the memory that can still be locked down (availrmem).
+	Free   uint64 `kstat:"freemem,unit=pages"`
+	Avail  uint64 `kstat:"availrmem,unit=pages"`
+	Kernel uint64 `kstat:"pp_kernel,unit=pages"`
+	Locked uint64 `kstat:"pageslocked,unit=pages"`
+
+	// LotsFree, DesFree, and MinFree are the thresholds of free
+	// memory at which the page scanner starts, speeds up, and
+	// becomes desperate.
+	LotsFree uint64 `kstat:"lotsfree,unit=pages"`
+	DesFree  uint64 `kstat:"desfree,unit=pages"`
+	MinFree  uint64 `kstat:"minfree,unit=pages"`
+
+	// The page scanner's current rate and limits, in pages per
+	// second.
+	NScan    uint64 `kstat:"nscan"`
+	DesScan  uint64 `kstat:"desscan"`
+	SlowScan uint64 `kstat:"slowscan"`
+	FastScan uint64 `kstat:"fastscan"`
+}
+
+// Used returns the memory that isn't free.
+func (s *Stats) Used() uint64 {
+	if s.Free > s.Physical {
+		return 0
+	}
+	return s.Physical - s.Free
+}
+
+// FromSnapshot gets the Stats from a Snapshot of a system whose page
+// size is pageSize. It's an error if the Snapshot doesn't have the
+// unix:0:system_pages kstat.
+func FromSnapshot(snap *kstat.Snapshot, pageSize int) (*Stats, error) {
+	ki, ok := snap.KStat("unix", 0, "system_pages")
+	if !ok {
+		return nil, errors.New("no unix:0:system_pages kstat")
+	}
+	st := &Stats{Snaptime: ki.Snaptime}
+	if err := kstat.CopyValuesWith(snap.Select(Selector).Values, st, kstat.CopyOptions{PageSize: pageSize}); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -0,0 +1,39 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading memory statistics from a Token.
+
+package mem
+
+import (
+	"os"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read reads the memory statistics of the running system.
+func Read(tok *kstat.Token) (*Stats, error) {
+	snap, err := tok.Snapshot(Selector)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap, os.Getpagesize())
+}
+
+// ReadSwap reads the swap statistics of the running system. Since
+// the kernel only updates them once a second, it reads them twice,
+// a second and a bit apart.
+func ReadSwap(tok *kstat.Token) (*SwapStats, error) {
+	prev, err := tok.Snapshot(SwapSelector)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(1100 * time.Millisecond)
+	cur, err := tok.Snapshot(SwapSelector)
+	if err != nil {
+		return nil, err
+	}
+	return SwapFromSnapshots(prev, cur, os.Getpagesize())
+}
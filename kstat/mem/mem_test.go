@@ -0,0 +1,33 @@
+//
+// Test reading memory statistics from Snapshots.
+
+package mem_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/mem"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "unix", Instance: 0, Name: "system_pages", Class: "pages", Type: kstat.NamedStat, Snaptime: 5},
+		map[string]uint64{"physmem": 1000, "freemem": 250, "pp_kernel": 100, "nscan": 7})
+
+	m, err := mem.FromSnapshot(snap, 8192)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if m.Physical != 1000*8192 || m.Free != 250*8192 || m.Kernel != 100*8192 || m.NScan != 7 || m.Snaptime != 5 {
+		t.Errorf("wrong Stats: %+v", m)
+	}
+	if m.Used() != 750*8192 {
+		t.Errorf("wrong Used: %d", m.Used())
+	}
+
+	if _, err := mem.FromSnapshot(&kstat.Snapshot{}, 8192); err == nil {
+		t.Errorf("FromSnapshot of an empty Snapshot didn't fail")
+	}
+}
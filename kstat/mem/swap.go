@@ -0,0 +1,81 @@
+//
+// Swap statistics from unix:0:vminfo.
+
+package mem
+
+import (
+	"errors"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// SwapSelector selects the kstat that swap statistics come from.
+var SwapSelector = kstat.Selector{Module: "unix", Instance: 0, Name: "vminfo"}
+
+// vminfo is the raw unix:0:vminfo statistics. The kernel adds the
+// current swap figures (in pages) to the swap_* statistics once a
+// second and counts how many times it has done so in updates, so
+// they're sums, not current values.
+type vminfo struct {
+	Updates   uint64 `kstat:"updates"`
+	SwapResv  uint64 `kstat:"swap_resv"`
+	SwapAlloc uint64 `kstat:"swap_alloc"`
+	SwapAvail uint64 `kstat:"swap_avail"`
+	SwapFree  uint64 `kstat:"swap_free"`
+}
+
+// SwapStats are the system's swap statistics, in bytes, averaged
+// over the time between two readings of vminfo. They're the figures
+// that vmstat and sar -r report.
+type SwapStats struct {
+	// Reserved is the swap that's reserved, including what's
+	// Allocated. Available is the swap that's not reserved, and
+	// Free the swap that's not allocated.
+	Reserved  uint64
+	Allocated uint64
+	Available uint64
+	Free      uint64
+}
+
+func readVMInfo(snap *kstat.Snapshot) (*vminfo, error) {
+	if _, ok := snap.KStat("unix", 0, "vminfo"); !ok {
+		return nil, errors.New("no unix:0:vminfo kstat")
+	}
+	vi := &vminfo{}
+	if err := kstat.CopyValues(snap.Select(SwapSelector).Values, vi); err != nil {
+		return nil, err
+	}
+	return vi, nil
+}
+
+// SwapFromSnapshots gets the SwapStats between two Snapshots of a
+// system whose page size is pageSize. If prev is nil, or the kernel
+// hasn't updated vminfo between them, they're the averages since
+// boot, which is rarely what's wanted. It's an error if a Snapshot
+// doesn't have the unix:0:vminfo kstat.
+func SwapFromSnapshots(prev, cur *kstat.Snapshot, pageSize int) (*SwapStats, error) {
+	c, err := readVMInfo(cur)
+	if err != nil {
+		return nil, err
+	}
+	p := &vminfo{}
+	if prev != nil {
+		if p, err = readVMInfo(prev); err != nil {
+			return nil, err
+		}
+	}
+	if c.Updates <= p.Updates {
+		p = &vminfo{}
+	}
+	n := c.Updates - p.Updates
+	if n == 0 {
+		return &SwapStats{}, nil
+	}
+	avg := func(cv, pv uint64) uint64 { return (cv - pv) / n * uint64(pageSize) }
+	return &SwapStats{
+		Reserved:  avg(c.SwapResv, p.SwapResv),
+		Allocated: avg(c.SwapAlloc, p.SwapAlloc),
+		Available: avg(c.SwapAvail, p.SwapAvail),
+		Free:      avg(c.SwapFree, p.SwapFree),
+	}, nil
+}
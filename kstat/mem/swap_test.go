@@ -0,0 +1,37 @@
+package mem_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/mem"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func vminfo(stats map[string]uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "unix", Instance: 0, Name: "vminfo", Class: "vm", Type: kstat.RawStat}, stats)
+	return snap
+}
+
+func TestSwapFromSnapshots(t *testing.T) {
+	prev := vminfo(map[string]uint64{"updates": 10, "swap_resv": 1000, "swap_alloc": 500, "swap_avail": 2000, "swap_free": 2500})
+	cur := vminfo(map[string]uint64{"updates": 12, "swap_resv": 1400, "swap_alloc": 700, "swap_avail": 2300, "swap_free": 3000})
+
+	sw, err := mem.SwapFromSnapshots(prev, cur, 4096)
+	if err != nil {
+		t.Fatalf("SwapFromSnapshots failed: %s", err)
+	}
+	if *sw != (mem.SwapStats{Reserved: 200 * 4096, Allocated: 100 * 4096, Available: 150 * 4096, Free: 250 * 4096}) {
+		t.Errorf("wrong SwapStats: %+v", sw)
+	}
+
+	// Without a previous reading, they're the averages since boot.
+	sw, err = mem.SwapFromSnapshots(nil, cur, 4096)
+	if err != nil {
+		t.Fatalf("SwapFromSnapshots failed: %s", err)
+	}
+	if sw.Reserved != 1400/12*4096 {
+		t.Errorf("wrong SwapStats since boot: %+v", sw)
+	}
+}
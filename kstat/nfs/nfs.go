@@ -0,0 +1,148 @@
+// Package nfs reads the NFS client's statistics: its overall call
+// counts from nfs:0:nfs_client and the count of each operation for
+// each NFS version from nfs:0:rfsreqcnt_v2, _v3, and _v4, which are
+// what nfsstat -c reports:
+//
+//	prev, err := nfs.ReadClient(tok)
+//	...
+//	time.Sleep(time.Second)
+//	cur, err := nfs.ReadClient(tok)
+//	...
+//	r := nfs.ClientRates(prev, cur)
+//	fmt.Printf("%.1f NFSv3 reads/s\n", r.Ops[3]["read"])
+//
+// ReadServer and ServerRates do the same for the NFS server, from
+// nfs:0:nfs_server and the nfs:0:rfsproccnt_vN kstats (nfsstat -s).
+package nfs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// ClientSelectors select the kstats of the NFS client.
+var ClientSelectors = []kstat.Selector{
+	{Module: "nfs", Instance: 0, Name: "nfs_client"},
+	{Module: "nfs", Instance: 0, Name: "rfsreqcnt_v*"},
+}
+
+// Ops are the counts of each operation of an NFS version, by the
+// names that the kstats use (such as getattr and read).
+type Ops map[string]uint64
+
+// ClientStats are the statistics of nfs:0:nfs_client.
+type ClientStats struct {
+	Calls    uint64 `kstat:"calls"`
+	BadCalls uint64 `kstat:"badcalls"`
+	// CLGets is the number of times a client handle was gotten,
+	// and CLTooMany the number of times that all of the cached
+	// ones were in use.
+	CLGets    uint64 `kstat:"clgets"`
+	CLTooMany uint64 `kstat:"cltoomany"`
+}
+
+// Client is the statistics of the NFS client. All of them count up
+// from when the nfs module was loaded.
+type Client struct {
+	Snaptime int64
+	ClientStats
+	// Ops are the operation counts of each NFS version (2, 3,
+	// and 4) that has them.
+	Ops map[int]Ops
+}
+
+// values returns the Values of the nfs:0:name kstat.
+func values(snap *kstat.Snapshot, name string) ([]kstat.Value, bool) {
+	ki, ok := snap.KStat("nfs", 0, name)
+	if !ok {
+		return nil, false
+	}
+	return snap.Select(kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name}).Values, true
+}
+
+// versionOps gets the Ops of each version from the nfs:0:<prefix>N
+// kstats.
+func versionOps(snap *kstat.Snapshot, prefix string) map[int]Ops {
+	ops := make(map[int]Ops)
+	for _, ki := range snap.KStats {
+		if ki.Module != "nfs" || ki.Instance != 0 || !strings.HasPrefix(ki.Name, prefix) {
+			continue
+		}
+		vers, err := strconv.Atoi(ki.Name[len(prefix):])
+		if err != nil {
+			continue
+		}
+		o := make(Ops)
+		vals, _ := values(snap, ki.Name)
+		for _, v := range vals {
+			o[v.Stat] = v.UintVal
+		}
+		ops[vers] = o
+	}
+	return ops
+}
+
+// ClientFromSnapshot gets the Client statistics from a Snapshot. It's
+// an error if the Snapshot doesn't have nfs:0:nfs_client, which
+// exists once the nfs module has been loaded.
+func ClientFromSnapshot(snap *kstat.Snapshot) (*Client, error) {
+	vals, ok := values(snap, "nfs_client")
+	if !ok {
+		return nil, errors.New("no nfs:0:nfs_client kstat")
+	}
+	c := &Client{Ops: versionOps(snap, "rfsreqcnt_v")}
+	if err := kstat.CopyValues(vals, &c.ClientStats); err != nil {
+		return nil, err
+	}
+	if len(vals) > 0 {
+		c.Snaptime = vals[0].Snaptime
+	}
+	return c, nil
+}
+
+// Rates are per second rates of calls and operations.
+type Rates struct {
+	Calls    float64
+	BadCalls float64
+	// Ops are the rates of each operation of each NFS version.
+	Ops map[int]map[string]float64
+}
+
+// rate returns the per second rate of a counter that went from prev
+// to cur in elapsed nanoseconds. A counter that went backward was
+// reset, so its rate is taken from zero.
+func rate(prev, cur uint64, elapsed int64) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	if cur < prev {
+		prev = 0
+	}
+	return float64(cur-prev) * 1e9 / float64(elapsed)
+}
+
+func opRates(prev, cur map[int]Ops, elapsed int64) map[int]map[string]float64 {
+	rates := make(map[int]map[string]float64)
+	for vers, ops := range cur {
+		r := make(map[string]float64)
+		for op, x := range ops {
+			r[op] = rate(prev[vers][op], x, elapsed)
+		}
+		rates[vers] = r
+	}
+	return rates
+}
+
+// ClientRates returns the rates between two readings of the Client
+// statistics.
+func ClientRates(prev, cur *Client) Rates {
+	el := cur.Snaptime - prev.Snaptime
+	return Rates{
+		Calls:    rate(prev.Calls, cur.Calls, el),
+		BadCalls: rate(prev.BadCalls, cur.BadCalls, el),
+		Ops:      opRates(prev.Ops, cur.Ops, el),
+	}
+}
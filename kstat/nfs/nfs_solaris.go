@@ -0,0 +1,29 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading NFS statistics from a Token.
+
+package nfs
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// ReadClient reads the statistics of the NFS client.
+func ReadClient(tok *kstat.Token) (*Client, error) {
+	snap, err := tok.Snapshot(ClientSelectors...)
+	if err != nil {
+		return nil, err
+	}
+	return ClientFromSnapshot(snap)
+}
+
+// ReadServer reads the statistics of the NFS server.
+func ReadServer(tok *kstat.Token) (*Server, error) {
+	snap, err := tok.Snapshot(ServerSelectors...)
+	if err != nil {
+		return nil, err
+	}
+	return ServerFromSnapshot(snap)
+}
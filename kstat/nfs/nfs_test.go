@@ -0,0 +1,53 @@
+//
+// Test reading NFS statistics from Snapshots.
+
+package nfs_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/nfs"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// nfsSnapshot makes a Snapshot of nfs:0:<name> kstats taken at
+// snaptime.
+func nfsSnapshot(snaptime int64, kstats map[string]map[string]uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	for name, stats := range kstats {
+		kstattest.Add(snap, kstat.KStatInfo{Module: "nfs", Instance: 0, Name: name, Class: "misc", Type: kstat.NamedStat, Snaptime: snaptime}, stats)
+	}
+	return snap
+}
+
+func TestClient(t *testing.T) {
+	prev, err := nfs.ClientFromSnapshot(nfsSnapshot(1e9, map[string]map[string]uint64{
+		"nfs_client":    {"calls": 100, "badcalls": 1},
+		"rfsreqcnt_v3":  {"read": 10, "getattr": 50},
+		"rfsproccnt_v3": {"read": 99},
+	}))
+	if err != nil {
+		t.Fatalf("ClientFromSnapshot failed: %s", err)
+	}
+	if prev.Calls != 100 || prev.BadCalls != 1 || len(prev.Ops) != 1 || prev.Ops[3]["read"] != 10 {
+		t.Errorf("wrong Client: %+v", prev)
+	}
+
+	cur, err := nfs.ClientFromSnapshot(nfsSnapshot(3e9, map[string]map[string]uint64{
+		"nfs_client":   {"calls": 300, "badcalls": 1},
+		"rfsreqcnt_v3": {"read": 30, "getattr": 50},
+		"rfsreqcnt_v4": {"read": 8},
+	}))
+	if err != nil {
+		t.Fatalf("ClientFromSnapshot failed: %s", err)
+	}
+	r := nfs.ClientRates(prev, cur)
+	if r.Calls != 100 || r.BadCalls != 0 || r.Ops[3]["read"] != 10 || r.Ops[3]["getattr"] != 0 || r.Ops[4]["read"] != 4 {
+		t.Errorf("wrong Rates: %+v", r)
+	}
+
+	if _, err := nfs.ClientFromSnapshot(&kstat.Snapshot{}); err == nil {
+		t.Errorf("ClientFromSnapshot of an empty Snapshot didn't fail")
+	}
+}
@@ -0,0 +1,64 @@
+//
+// NFS server statistics.
+
+package nfs
+
+import (
+	"errors"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// ServerSelectors select the kstats of the NFS server.
+var ServerSelectors = []kstat.Selector{
+	{Module: "nfs", Instance: 0, Name: "nfs_server"},
+	{Module: "nfs", Instance: 0, Name: "rfsproccnt_v*"},
+}
+
+// ServerStats are the statistics of nfs:0:nfs_server.
+type ServerStats struct {
+	Calls    uint64 `kstat:"calls"`
+	BadCalls uint64 `kstat:"badcalls"`
+	// Referrals and ReferLinks count NFSv4 referrals.
+	Referrals  uint64 `kstat:"referrals"`
+	ReferLinks uint64 `kstat:"referlinks"`
+}
+
+// Server is the statistics of the NFS server. All of them count up
+// from when the nfssrv module was loaded.
+type Server struct {
+	Snaptime int64
+	ServerStats
+	// Ops are the operation counts of each NFS version (2, 3,
+	// and 4) that has them.
+	Ops map[int]Ops
+}
+
+// ServerFromSnapshot gets the Server statistics from a Snapshot. It's
+// an error if the Snapshot doesn't have nfs:0:nfs_server, which only
+// exists once the NFS server has been started.
+func ServerFromSnapshot(snap *kstat.Snapshot) (*Server, error) {
+	vals, ok := values(snap, "nfs_server")
+	if !ok {
+		return nil, errors.New("no nfs:0:nfs_server kstat")
+	}
+	s := &Server{Ops: versionOps(snap, "rfsproccnt_v")}
+	if err := kstat.CopyValues(vals, &s.ServerStats); err != nil {
+		return nil, err
+	}
+	if len(vals) > 0 {
+		s.Snaptime = vals[0].Snaptime
+	}
+	return s, nil
+}
+
+// ServerRates returns the rates between two readings of the Server
+// statistics.
+func ServerRates(prev, cur *Server) Rates {
+	el := cur.Snaptime - prev.Snaptime
+	return Rates{
+		Calls:    rate(prev.Calls, cur.Calls, el),
+		BadCalls: rate(prev.BadCalls, cur.BadCalls, el),
+		Ops:      opRates(prev.Ops, cur.Ops, el),
+	}
+}
@@ -0,0 +1,36 @@
+package nfs_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat/kstat/nfs"
+)
+
+func TestServer(t *testing.T) {
+	prev, err := nfs.ServerFromSnapshot(nfsSnapshot(1e9, map[string]map[string]uint64{
+		"nfs_server":    {"calls": 10, "referrals": 2},
+		"rfsproccnt_v4": {"compound": 10},
+		"rfsreqcnt_v4":  {"compound": 99},
+	}))
+	if err != nil {
+		t.Fatalf("ServerFromSnapshot failed: %s", err)
+	}
+	if prev.Calls != 10 || prev.Referrals != 2 || len(prev.Ops) != 1 || prev.Ops[4]["compound"] != 10 {
+		t.Errorf("wrong Server: %+v", prev)
+	}
+
+	cur, err := nfs.ServerFromSnapshot(nfsSnapshot(2e9, map[string]map[string]uint64{
+		"nfs_server":    {"calls": 60},
+		"rfsproccnt_v4": {"compound": 30},
+	}))
+	if err != nil {
+		t.Fatalf("ServerFromSnapshot failed: %s", err)
+	}
+	if r := nfs.ServerRates(prev, cur); r.Calls != 50 || r.Ops[4]["compound"] != 20 {
+		t.Errorf("wrong Rates: %+v", r)
+	}
+
+	if _, err := nfs.ServerFromSnapshot(nfsSnapshot(1, map[string]map[string]uint64{"nfs_client": {}})); err == nil {
+		t.Errorf("ServerFromSnapshot without nfs_server didn't fail")
+	}
+}
@@ -0,0 +1,115 @@
+// Package rpc reads the kernel RPC statistics that nfsstat -r
+// reports, from the unix:0:rpc_* kstats:
+//
+//	r, err := rpc.Read(tok)
+//	...
+//	if c := r.CLTSClient; c != nil {
+//		fmt.Printf("%d calls, %d retransmitted\n", c.Calls, c.Retrans)
+//	}
+//
+// There are separate kstats for connection-oriented (COTS),
+// connectionless (CLTS), and RDMA transports, plus the older
+// rpc_client and rpc_server, depending on the release. Not every
+// transport has every statistic; the ones it doesn't have are 0.
+package rpc
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selector selects the kstats that this package reads.
+var Selector = kstat.Selector{Module: "unix", Instance: 0, Name: "rpc_*"}
+
+// ClientStats are the statistics of the RPC client for a transport.
+type ClientStats struct {
+	Calls    uint64 `kstat:"calls"`
+	BadCalls uint64 `kstat:"badcalls"`
+	// Retrans is the number of calls that were retransmitted, and
+	// BadXIDs the number of replies that matched no call.
+	Retrans  uint64 `kstat:"retrans"`
+	BadXIDs  uint64 `kstat:"badxids"`
+	Timeouts uint64 `kstat:"timeouts"`
+	NewCreds uint64 `kstat:"newcreds"`
+	BadVerfs uint64 `kstat:"badverfs"`
+	Timers   uint64 `kstat:"timers"`
+	NoMem    uint64 `kstat:"nomem"`
+	CantSend uint64 `kstat:"cantsend"`
+	CantConn uint64 `kstat:"cantconn"`
+	// Interrupts is the number of calls interrupted by a signal.
+	Interrupts uint64 `kstat:"interrupts"`
+}
+
+// ServerStats are the statistics of the RPC server for a transport.
+type ServerStats struct {
+	Calls    uint64 `kstat:"calls"`
+	BadCalls uint64 `kstat:"badcalls"`
+	NullRecv uint64 `kstat:"nullrecv"`
+	BadLen   uint64 `kstat:"badlen"`
+	XDRCall  uint64 `kstat:"xdrcall"`
+	// DupChecks is the number of calls checked against the
+	// duplicate request cache, and DupReqs the number found in it.
+	DupChecks uint64 `kstat:"dupchecks"`
+	DupReqs   uint64 `kstat:"dupreqs"`
+}
+
+// RPC is the RPC statistics for each transport. A transport's
+// statistics are nil if there's no kstat for it. All of them count
+// up from when the RPC module was loaded.
+type RPC struct {
+	Snaptime int64
+
+	Client     *ClientStats // rpc_client
+	COTSClient *ClientStats // rpc_cots_client
+	CLTSClient *ClientStats // rpc_clts_client
+	RDMAClient *ClientStats // rpc_rdma_client
+
+	Server     *ServerStats // rpc_server
+	COTSServer *ServerStats // rpc_cots_server
+	CLTSServer *ServerStats // rpc_clts_server
+	RDMAServer *ServerStats // rpc_rdma_server
+}
+
+// FromSnapshot gets the RPC statistics from a Snapshot.
+func FromSnapshot(snap *kstat.Snapshot) (*RPC, error) {
+	r := &RPC{}
+	for _, ki := range snap.KStats {
+		if ki.Module != "unix" || ki.Instance != 0 {
+			continue
+		}
+		var dst interface{}
+		switch ki.Name {
+		case "rpc_client":
+			r.Client = &ClientStats{}
+			dst = r.Client
+		case "rpc_cots_client":
+			r.COTSClient = &ClientStats{}
+			dst = r.COTSClient
+		case "rpc_clts_client":
+			r.CLTSClient = &ClientStats{}
+			dst = r.CLTSClient
+		case "rpc_rdma_client":
+			r.RDMAClient = &ClientStats{}
+			dst = r.RDMAClient
+		case "rpc_server":
+			r.Server = &ServerStats{}
+			dst = r.Server
+		case "rpc_cots_server":
+			r.COTSServer = &ServerStats{}
+			dst = r.COTSServer
+		case "rpc_clts_server":
+			r.CLTSServer = &ServerStats{}
+			dst = r.CLTSServer
+		case "rpc_rdma_server":
+			r.RDMAServer = &ServerStats{}
+			dst = r.RDMAServer
+		default:
+			continue
+		}
+		r.Snaptime = ki.Snaptime
+		sel := kstat.Selector{Module: ki.Module, Instance: ki.Instance, Name: ki.Name}
+		if err := kstat.CopyValues(snap.Select(sel).Values, dst); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,20 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading RPC statistics from a Token.
+
+package rpc
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read reads the RPC statistics.
+func Read(tok *kstat.Token) (*RPC, error) {
+	snap, err := tok.Snapshot(Selector)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
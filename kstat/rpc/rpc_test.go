@@ -0,0 +1,40 @@
+//
+// Test reading RPC statistics from Snapshots.
+
+package rpc_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/rpc"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	for name, stats := range map[string]map[string]uint64{
+		"rpc_clts_client": {"calls": 100, "retrans": 3, "badxids": 1},
+		"rpc_cots_client": {"calls": 50, "cantconn": 2},
+		"rpc_cots_server": {"calls": 20, "dupreqs": 1},
+	} {
+		kstattest.Add(snap, kstat.KStatInfo{Module: "unix", Instance: 0, Name: name, Class: "rpc", Type: kstat.NamedStat, Snaptime: 7}, stats)
+	}
+
+	r, err := rpc.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if r.CLTSClient == nil || *r.CLTSClient != (rpc.ClientStats{Calls: 100, Retrans: 3, BadXIDs: 1}) {
+		t.Errorf("wrong CLTSClient: %+v", r.CLTSClient)
+	}
+	if r.COTSClient == nil || r.COTSClient.CantConn != 2 {
+		t.Errorf("wrong COTSClient: %+v", r.COTSClient)
+	}
+	if r.COTSServer == nil || r.COTSServer.DupReqs != 1 || r.Snaptime != 7 {
+		t.Errorf("wrong COTSServer: %+v", r.COTSServer)
+	}
+	if r.Client != nil || r.Server != nil || r.CLTSServer != nil || r.RDMAClient != nil {
+		t.Errorf("unexpected statistics: %+v", r)
+	}
+}
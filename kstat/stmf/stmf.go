@@ -0,0 +1,104 @@
+// Package stmf reads the statistics of COMSTAR, the SCSI target
+// framework, so that storage servers can monitor the IO of each
+// logical unit (LU) that they export and of each target port
+// (such as an iSCSI target) that it goes through:
+//
+//	st, err := stmf.Read(tok)
+//	...
+//	for _, lu := range st.LUs {
+//		fmt.Printf("%s: %d bytes read\n", lu.GUID, lu.IO.NRead)
+//	}
+//
+// STMF has a pair of kstats in the stmf module for each LU and each
+// target: stmf_lu_<id> (or stmf_tgt_<id>), a named kstat that says
+// what it is, and stmf_lu_io_<id> (or stmf_tgt_io_<id>), an IO kstat
+// with its statistics. The id is an internal address that's only
+// useful for pairing the two.
+package stmf
+
+import (
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/disk"
+)
+
+// Selector selects the kstats that this package reads.
+var Selector = kstat.Selector{Module: "stmf", Instance: -1}
+
+// LU is a logical unit and its IO statistics.
+type LU struct {
+	ID    string `kstat:"-"`
+	GUID  string `kstat:"lun-guid"`
+	Alias string `kstat:"lun-alias"`
+	// KStat is the LU's IO kstat.
+	KStat kstat.KStatInfo `kstat:"-"`
+	IO    disk.IO         `kstat:"-"`
+}
+
+// Target is a target port and its IO statistics.
+type Target struct {
+	ID       string `kstat:"-"`
+	Name     string `kstat:"target-name"`
+	Alias    string `kstat:"target-alias"`
+	Protocol string `kstat:"protocol"`
+	// KStat is the target's IO kstat.
+	KStat kstat.KStatInfo `kstat:"-"`
+	IO    disk.IO         `kstat:"-"`
+}
+
+// Stats is the LUs and Targets, each in order of their IO kstats.
+type Stats struct {
+	LUs     []LU
+	Targets []Target
+}
+
+// FromSnapshot gets the Stats from a Snapshot. LUs and Targets
+// without an IO kstat are left out.
+func FromSnapshot(snap *kstat.Snapshot) (*Stats, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name}
+		vals[k] = append(vals[k], v)
+	}
+	info := make(map[string][]kstat.Value)
+	for _, ki := range snap.KStats {
+		if ki.Module == "stmf" && ki.Type == kstat.NamedStat {
+			info[ki.Name] = vals[key{ki.Module, ki.Instance, ki.Name}]
+		}
+	}
+
+	st := &Stats{}
+	for _, ki := range snap.KStats {
+		if ki.Module != "stmf" || ki.Type != kstat.IoStat {
+			continue
+		}
+		io := vals[key{ki.Module, ki.Instance, ki.Name}]
+		switch {
+		case strings.HasPrefix(ki.Name, "stmf_lu_io_"):
+			lu := LU{ID: ki.Name[len("stmf_lu_io_"):], KStat: ki}
+			if err := kstat.CopyValues(info["stmf_lu_"+lu.ID], &lu); err != nil {
+				return nil, err
+			}
+			if err := kstat.CopyValues(io, &lu.IO); err != nil {
+				return nil, err
+			}
+			st.LUs = append(st.LUs, lu)
+		case strings.HasPrefix(ki.Name, "stmf_tgt_io_"):
+			tgt := Target{ID: ki.Name[len("stmf_tgt_io_"):], KStat: ki}
+			if err := kstat.CopyValues(info["stmf_tgt_"+tgt.ID], &tgt); err != nil {
+				return nil, err
+			}
+			if err := kstat.CopyValues(io, &tgt.IO); err != nil {
+				return nil, err
+			}
+			st.Targets = append(st.Targets, tgt)
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,24 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading COMSTAR statistics from a Token.
+
+package stmf
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that LUs and targets that have
+// come or gone are noticed, and reads their statistics.
+func Read(tok *kstat.Token) (*Stats, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.Snapshot(Selector)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
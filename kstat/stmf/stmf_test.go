@@ -0,0 +1,44 @@
+//
+// Test reading COMSTAR statistics from Snapshots.
+
+package stmf_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/stmf"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	add := func(name string, tp kstat.KSType, vals ...kstat.Value) {
+		kstattest.AddValues(snap, kstat.KStatInfo{Module: "stmf", Instance: 0, Name: name, Class: "misc", Type: tp}, vals...)
+	}
+	str := kstattest.String
+	io := func(stats map[string]uint64) []kstat.Value { return kstattest.Uints(kstat.Uint64, stats) }
+
+	add("stmf_lu_ffffff01", kstat.NamedStat, str("lun-guid", "600144F0"), str("lun-alias", "/dev/zvol/rdsk/tank/vol1"))
+	add("stmf_lu_io_ffffff01", kstat.IoStat, io(map[string]uint64{"nread": 4096, "reads": 1})...)
+	add("stmf_tgt_ffffff02", kstat.NamedStat, str("target-name", "iqn.2010-08.org.illumos:02:t1"), str("protocol", "iSCSI"))
+	add("stmf_tgt_io_ffffff02", kstat.IoStat, io(map[string]uint64{"nwritten": 512, "writes": 1})...)
+	add("stmf_lu_io_ffffff03", kstat.IoStat, io(map[string]uint64{"nread": 1})...)
+
+	st, err := stmf.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(st.LUs) != 2 || len(st.Targets) != 1 {
+		t.Fatalf("wrong Stats: %+v", st)
+	}
+	if lu := st.LUs[0]; lu.ID != "ffffff01" || lu.GUID != "600144F0" || lu.Alias != "/dev/zvol/rdsk/tank/vol1" || lu.IO.NRead != 4096 {
+		t.Errorf("wrong LU: %+v", lu)
+	}
+	if lu := st.LUs[1]; lu.ID != "ffffff03" || lu.GUID != "" || lu.IO.NRead != 1 {
+		t.Errorf("wrong LU without info: %+v", lu)
+	}
+	if tgt := st.Targets[0]; tgt.Name != "iqn.2010-08.org.illumos:02:t1" || tgt.Protocol != "iSCSI" || tgt.IO.Writes != 1 {
+		t.Errorf("wrong Target: %+v", tgt)
+	}
+}
@@ -0,0 +1,67 @@
+//
+// Process and LWP counts against their limits.
+
+package system
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// ProcsSelectors select the kstats that Procs come from.
+var ProcsSelectors = []kstat.Selector{
+	Selector,
+	{Module: "unix", Instance: 0, Name: "var"},
+	{Module: "caps", Instance: -1, Name: "lwps_zone_*", Stat: "usage"},
+}
+
+// Procs is the number of processes and LWPs and the limits on them,
+// for watching for a full process table.
+//
+// Processes includes zombies, which take up process table slots
+// too; kstats don't count zombies separately.
+type Procs struct {
+	// Processes is the number of processes, MaxProcesses the
+	// size of the process table (v_proc), and MaxPerUser the
+	// most that one user can have (v_maxup).
+	Processes    uint64
+	MaxProcesses uint64
+	MaxPerUser   uint64
+
+	// LWPs is the number of LWPs, which is the total of the
+	// LWPs of every zone from the zones' lwps caps kstats.
+	// HaveLWPs is false if there are no such kstats.
+	LWPs     uint64
+	HaveLWPs bool
+}
+
+// Used returns the percentage of the process table that's in use.
+func (p *Procs) Used() float64 {
+	if p.MaxProcesses == 0 {
+		return 0
+	}
+	return float64(p.Processes) * 100 / float64(p.MaxProcesses)
+}
+
+// ProcsFromSnapshot gets the Procs from a Snapshot. It's an error if
+// the Snapshot doesn't have unix:0:system_misc and unix:0:var.
+func ProcsFromSnapshot(snap *kstat.Snapshot) (*Procs, error) {
+	nproc, ok1 := snap.Get("unix", 0, "system_misc", "nproc")
+	vproc, ok2 := snap.Get("unix", 0, "var", "v_proc")
+	if !ok1 || !ok2 {
+		return nil, errors.New("no unix:0:system_misc or unix:0:var kstat")
+	}
+	p := &Procs{Processes: nproc.UintVal, MaxProcesses: uint64(vproc.IntVal)}
+	if v, ok := snap.Get("unix", 0, "var", "v_maxup"); ok {
+		p.MaxPerUser = uint64(v.IntVal)
+	}
+	for _, v := range snap.Values {
+		if v.Module == "caps" && strings.HasPrefix(v.Name, "lwps_zone_") && v.Stat == "usage" {
+			p.LWPs += v.UintVal
+			p.HaveLWPs = true
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,37 @@
+package system_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/system"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestProcs(t *testing.T) {
+	snap := snapshot(1, map[string]map[string]uint64{
+		"system_misc": {"nproc": 500},
+	})
+	kstattest.AddValues(snap, kstat.KStatInfo{Module: "unix", Instance: 0, Name: "var", Class: "misc", Type: kstat.RawStat},
+		kstattest.Ints(kstat.Int32, map[string]int64{"v_proc": 2000, "v_maxup": 1995})...)
+	if _, err := system.ProcsFromSnapshot(snap); err != nil {
+		t.Fatalf("ProcsFromSnapshot failed: %s", err)
+	}
+	for i, n := range []uint64{1200, 300} {
+		kstattest.Add(snap, kstat.KStatInfo{Module: "caps", Instance: i, Name: "lwps_zone_" + strconv.Itoa(i), Class: "zone_caps", Type: kstat.NamedStat},
+			map[string]uint64{"usage": n})
+	}
+
+	p, err := system.ProcsFromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("ProcsFromSnapshot failed: %s", err)
+	}
+	if *p != (system.Procs{Processes: 500, MaxProcesses: 2000, MaxPerUser: 1995, LWPs: 1500, HaveLWPs: true}) || p.Used() != 25 {
+		t.Errorf("wrong Procs: %+v", p)
+	}
+
+	if _, err := system.ProcsFromSnapshot(snapshot(1, map[string]map[string]uint64{"system_misc": {"nproc": 1}})); err == nil {
+		t.Errorf("ProcsFromSnapshot without unix:0:var didn't fail")
+	}
+}
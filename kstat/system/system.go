@@ -0,0 +1,88 @@
+// Package system reads the system-wide statistics of the
+// unix:0:system_misc kstat, such as the load averages:
+//
+//	m, err := system.Read(tok)
+//	...
+//	fmt.Printf("up %s, load average: %.2f, %.2f, %.2f\n", m.Uptime(), m.Load1, m.Load5, m.Load15)
+//
+// ReadProcs compares the number of processes with the size of the
+// process table, from system_misc and unix:0:var.
+package system
+
+import (
+	"errors"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selector selects the kstat that this package reads.
+var Selector = kstat.Selector{Module: "unix", Instance: 0, Name: "system_misc"}
+
+// fscale is the scale of the avenrun statistics, which are fixed
+// point numbers with 8 bits of fraction (FSCALE in <sys/param.h>).
+const fscale = 1 << 8
+
+// Misc is the statistics of unix:0:system_misc.
+type Misc struct {
+	// Time is when the kstat was read, and Snaptime the kstat's
+	// snaptime then.
+	Time     time.Time `kstat:"-"`
+	Snaptime int64     `kstat:"-"`
+	// BootTime is when the system booted, to the second.
+	BootTime time.Time `kstat:"-"`
+
+	// Load1, Load5, and Load15 are the 1, 5, and 15 minute load
+	// averages, as uptime reports them.
+	Load1  float64 `kstat:"-"`
+	Load5  float64 `kstat:"-"`
+	Load15 float64 `kstat:"-"`
+
+	// NProc is the number of processes, and NCPUs the number of
+	// CPUs.
+	NProc uint64 `kstat:"nproc"`
+	NCPUs uint64 `kstat:"ncpus"`
+	// Deficit is the scheduler's CPU deficit, and ClkIntr the
+	// count of clock interrupts since boot.
+	Deficit uint64 `kstat:"deficit"`
+	ClkIntr uint64 `kstat:"clk_intr"`
+
+	AvenRun1  uint64 `kstat:"avenrun_1min"`
+	AvenRun5  uint64 `kstat:"avenrun_5min"`
+	AvenRun15 uint64 `kstat:"avenrun_15min"`
+	Boot      int64  `kstat:"boot_time"`
+}
+
+// MiscFromSnapshot gets the Misc statistics from a Snapshot. It's an
+// error if the Snapshot doesn't have unix:0:system_misc.
+func MiscFromSnapshot(snap *kstat.Snapshot) (*Misc, error) {
+	ki, ok := snap.KStat("unix", 0, "system_misc")
+	if !ok {
+		return nil, errors.New("no unix:0:system_misc kstat")
+	}
+	m := &Misc{Time: snap.Time, Snaptime: ki.Snaptime}
+	if err := kstat.CopyValues(snap.Select(Selector).Values, m); err != nil {
+		return nil, err
+	}
+	m.Load1 = float64(m.AvenRun1) / fscale
+	m.Load5 = float64(m.AvenRun5) / fscale
+	m.Load15 = float64(m.AvenRun15) / fscale
+	m.BootTime = time.Unix(m.Boot, 0)
+	return m, nil
+}
+
+// Uptime returns how long the system had been up when the kstat was
+// read.
+func (m *Misc) Uptime() time.Duration {
+	return m.Time.Sub(m.BootTime)
+}
+
+// WallTime converts an hrtime, such as the crtime or snaptime of a
+// kstat (which are nanoseconds since some arbitrary time around
+// boot), into a time, using the Misc's Time and Snaptime as the
+// reference point. This is more accurate than adding an hrtime to
+// BootTime, which is only to the second and isn't quite the same
+// origin.
+func (m *Misc) WallTime(hrtime int64) time.Time {
+	return m.Time.Add(time.Duration(hrtime - m.Snaptime))
+}
@@ -0,0 +1,34 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading system statistics from a Token.
+
+package system
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read reads the statistics of unix:0:system_misc.
+func Read(tok *kstat.Token) (*Misc, error) {
+	snap, err := tok.Snapshot(Selector)
+	if err != nil {
+		return nil, err
+	}
+	return MiscFromSnapshot(snap)
+}
+
+// ReadProcs updates tok's kstat chain, so that zones that have
+// booted or halted are noticed, and reads the process and LWP
+// counts.
+func ReadProcs(tok *kstat.Token) (*Procs, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.Snapshot(ProcsSelectors...)
+	if err != nil {
+		return nil, err
+	}
+	return ProcsFromSnapshot(snap)
+}
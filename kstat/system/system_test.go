@@ -0,0 +1,56 @@
+//
+// Test reading system statistics from Snapshots.
+
+package system_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/system"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// snapshot makes a Snapshot with a unix:0:<name> kstat for each of
+// kstats.
+func snapshot(snaptime int64, kstats map[string]map[string]uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	for name, stats := range kstats {
+		ki := kstat.KStatInfo{Module: "unix", Instance: 0, Name: name, Class: "misc", Type: kstat.NamedStat, Snaptime: snaptime}
+		kstattest.AddValues(snap, ki, kstattest.Uints(kstat.Uint32, stats)...)
+	}
+	return snap
+}
+
+func TestMisc(t *testing.T) {
+	m, err := system.MiscFromSnapshot(snapshot(5, map[string]map[string]uint64{
+		"system_misc": {"avenrun_1min": 512, "avenrun_5min": 384, "avenrun_15min": 64, "nproc": 80, "clk_intr": 1000},
+	}))
+	if err != nil {
+		t.Fatalf("MiscFromSnapshot failed: %s", err)
+	}
+	if m.Load1 != 2 || m.Load5 != 1.5 || m.Load15 != 0.25 || m.NProc != 80 || m.ClkIntr != 1000 || m.Snaptime != 5 {
+		t.Errorf("wrong Misc: %+v", m)
+	}
+	if _, err := system.MiscFromSnapshot(&kstat.Snapshot{}); err == nil {
+		t.Errorf("MiscFromSnapshot of an empty Snapshot didn't fail")
+	}
+}
+
+func TestBootTime(t *testing.T) {
+	snap := snapshot(int64(time.Hour), map[string]map[string]uint64{
+		"system_misc": {"boot_time": 1440770400},
+	})
+	snap.Time = time.Unix(1440770400, 0).Add(time.Hour + time.Second)
+	m, err := system.MiscFromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("MiscFromSnapshot failed: %s", err)
+	}
+	if !m.BootTime.Equal(time.Unix(1440770400, 0)) || m.Uptime() != time.Hour+time.Second {
+		t.Errorf("wrong boot time %s or uptime %s", m.BootTime, m.Uptime())
+	}
+	if w := m.WallTime(int64(time.Minute)); !w.Equal(snap.Time.Add(time.Minute - time.Hour)) {
+		t.Errorf("wrong WallTime: %s", w)
+	}
+}
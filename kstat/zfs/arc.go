@@ -0,0 +1,142 @@
+// Package zfs reads the statistics of ZFS. The ARC's come from the
+// zfs:0:arcstats kstat, along with its hit ratios over an interval:
+//
+//	prev, err := zfs.ReadARC(tok)
+//	...
+//	time.Sleep(time.Second)
+//	cur, err := zfs.ReadARC(tok)
+//	...
+//	r := zfs.HitRatios(prev, cur)
+//	fmt.Printf("ARC %d of %d bytes, %.1f%% hits\n", cur.Size, cur.C, r.Hit)
+//
+// ReadPoolIO reads the IO statistics of pools and their vdevs, from
+// whichever kstats the release has for them.
+package zfs
+
+import (
+	"errors"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// ARCSelector selects the ARC's kstat.
+var ARCSelector = kstat.Selector{Module: "zfs", Instance: 0, Name: "arcstats"}
+
+// ARC is the statistics of the ARC. Sizes are in bytes; the counters
+// count up from boot.
+type ARC struct {
+	Crtime   int64 `kstat:"-"`
+	Snaptime int64 `kstat:"-"`
+
+	// Size is the ARC's current size, C its target size, and CMin
+	// and CMax the limits of C. P is the target size of the MRU.
+	Size uint64 `kstat:"size"`
+	C    uint64 `kstat:"c"`
+	CMin uint64 `kstat:"c_min"`
+	CMax uint64 `kstat:"c_max"`
+	P    uint64 `kstat:"p"`
+
+	DataSize     uint64 `kstat:"data_size"`
+	MetadataSize uint64 `kstat:"metadata_size"`
+	HdrSize      uint64 `kstat:"hdr_size"`
+	OtherSize    uint64 `kstat:"other_size"`
+	MRUSize      uint64 `kstat:"mru_size"`
+	MFUSize      uint64 `kstat:"mfu_size"`
+
+	Hits   uint64 `kstat:"hits"`
+	Misses uint64 `kstat:"misses"`
+
+	DemandDataHits       uint64 `kstat:"demand_data_hits"`
+	DemandDataMisses     uint64 `kstat:"demand_data_misses"`
+	DemandMetadataHits   uint64 `kstat:"demand_metadata_hits"`
+	DemandMetadataMisses uint64 `kstat:"demand_metadata_misses"`
+	PrefetchDataHits     uint64 `kstat:"prefetch_data_hits"`
+	PrefetchDataMisses   uint64 `kstat:"prefetch_data_misses"`
+	PrefetchMetaHits     uint64 `kstat:"prefetch_metadata_hits"`
+	PrefetchMetaMisses   uint64 `kstat:"prefetch_metadata_misses"`
+
+	// MRUHits and MFUHits are hits in the most recently and most
+	// frequently used lists; the ghost hits are of buffers that had
+	// just been evicted from them.
+	MRUHits      uint64 `kstat:"mru_hits"`
+	MRUGhostHits uint64 `kstat:"mru_ghost_hits"`
+	MFUHits      uint64 `kstat:"mfu_hits"`
+	MFUGhostHits uint64 `kstat:"mfu_ghost_hits"`
+
+	Deleted        uint64 `kstat:"deleted"`
+	EvictSkip      uint64 `kstat:"evict_skip"`
+	MemoryThrottle uint64 `kstat:"memory_throttle_count"`
+
+	L2Hits   uint64 `kstat:"l2_hits"`
+	L2Misses uint64 `kstat:"l2_misses"`
+	L2Size   uint64 `kstat:"l2_size"`
+}
+
+// ARCFromSnapshot gets the ARC statistics from a Snapshot. It's an
+// error if the Snapshot doesn't have the ARC's kstat.
+func ARCFromSnapshot(snap *kstat.Snapshot) (*ARC, error) {
+	ks, ok := snap.KStat("zfs", 0, "arcstats")
+	if !ok {
+		return nil, errors.New("no zfs:0:arcstats kstat")
+	}
+	arc := &ARC{Crtime: ks.Crtime, Snaptime: ks.Snaptime}
+	if err := kstat.CopyValues(snap.Select(ARCSelector).Values, arc); err != nil {
+		return nil, err
+	}
+	return arc, nil
+}
+
+// Ratios are the ARC's hit ratios, as percentages of the lookups of
+// each sort. A ratio is 0 if there were no lookups of its sort.
+type Ratios struct {
+	// Hit is of all lookups, and Demand and Prefetch of demand
+	// and prefetch lookups (for data and metadata together).
+	Hit            float64
+	Demand         float64
+	DemandData     float64
+	DemandMetadata float64
+	Prefetch       float64
+	// MFU is the percentage of hits that were in the MFU list
+	// instead of the MRU list.
+	MFU float64
+	// L2 is of the lookups that went to the L2ARC.
+	L2 float64
+}
+
+func pct(x, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(x) * 100 / float64(total)
+}
+
+// HitRatios returns the ARC's hit ratios between two readings of its
+// statistics. If the ARC's kstat was recreated between them, or prev
+// is nil, they're the ratios of cur since boot.
+func HitRatios(prev, cur *ARC) Ratios {
+	if prev == nil || prev.Crtime != cur.Crtime {
+		prev = &ARC{}
+	}
+	d := func(c, p uint64) uint64 { return c - p }
+	hits, misses := d(cur.Hits, prev.Hits), d(cur.Misses, prev.Misses)
+	ddh, ddm := d(cur.DemandDataHits, prev.DemandDataHits), d(cur.DemandDataMisses, prev.DemandDataMisses)
+	dmh, dmm := d(cur.DemandMetadataHits, prev.DemandMetadataHits), d(cur.DemandMetadataMisses, prev.DemandMetadataMisses)
+	ph := d(cur.PrefetchDataHits, prev.PrefetchDataHits) + d(cur.PrefetchMetaHits, prev.PrefetchMetaHits)
+	pm := d(cur.PrefetchDataMisses, prev.PrefetchDataMisses) + d(cur.PrefetchMetaMisses, prev.PrefetchMetaMisses)
+	mru, mfu := d(cur.MRUHits, prev.MRUHits), d(cur.MFUHits, prev.MFUHits)
+	l2h, l2m := d(cur.L2Hits, prev.L2Hits), d(cur.L2Misses, prev.L2Misses)
+	return Ratios{
+		Hit:            pct(hits, hits+misses),
+		Demand:         pct(ddh+dmh, ddh+dmh+ddm+dmm),
+		DemandData:     pct(ddh, ddh+ddm),
+		DemandMetadata: pct(dmh, dmh+dmm),
+		Prefetch:       pct(ph, ph+pm),
+		MFU:            pct(mfu, mru+mfu),
+		L2:             pct(l2h, l2h+l2m),
+	}
+}
+
+// Ratios returns the ARC's hit ratios since boot.
+func (a *ARC) Ratios() Ratios {
+	return HitRatios(nil, a)
+}
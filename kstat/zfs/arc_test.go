@@ -0,0 +1,55 @@
+//
+// Test reading ZFS statistics from Snapshots.
+
+package zfs_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/zfs"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func arcSnapshot(crtime int64, stats map[string]uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "zfs", Instance: 0, Name: "arcstats", Class: "misc", Type: kstat.NamedStat, Crtime: crtime, Snaptime: 10}, stats)
+	return snap
+}
+
+func TestARC(t *testing.T) {
+	prev, err := zfs.ARCFromSnapshot(arcSnapshot(1, map[string]uint64{
+		"size": 100, "hits": 10, "misses": 10, "mru_hits": 5, "mfu_hits": 5,
+	}))
+	if err != nil {
+		t.Fatalf("ARCFromSnapshot failed: %s", err)
+	}
+	if prev.Size != 100 || prev.Crtime != 1 {
+		t.Errorf("wrong ARC: %+v", prev)
+	}
+	if r := prev.Ratios(); r.Hit != 50 || r.MFU != 50 || r.L2 != 0 {
+		t.Errorf("wrong ratios since boot: %+v", r)
+	}
+
+	cur, err := zfs.ARCFromSnapshot(arcSnapshot(1, map[string]uint64{
+		"size": 100, "hits": 100, "misses": 20, "mru_hits": 5, "mfu_hits": 95,
+		"demand_data_hits": 30, "demand_data_misses": 10,
+	}))
+	if err != nil {
+		t.Fatalf("ARCFromSnapshot failed: %s", err)
+	}
+	r := zfs.HitRatios(prev, cur)
+	if r.Hit != 90 || r.MFU != 100 || r.DemandData != 75 || r.Demand != 75 || r.Prefetch != 0 {
+		t.Errorf("wrong ratios: %+v", r)
+	}
+
+	// A recreated kstat starts over.
+	cur.Crtime = 2
+	if r := zfs.HitRatios(prev, cur); r.Hit != 100.0*100/120 {
+		t.Errorf("wrong ratios after recreation: %+v", r)
+	}
+
+	if _, err := zfs.ARCFromSnapshot(&kstat.Snapshot{}); err == nil {
+		t.Errorf("ARCFromSnapshot of an empty Snapshot didn't fail")
+	}
+}
@@ -0,0 +1,63 @@
+//
+// Per-pool and per-vdev IO statistics.
+
+package zfs
+
+import (
+	"strings"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/disk"
+)
+
+// PoolIO is the IO statistics of a pool or of one of its vdevs.
+//
+// Where these come from depends on the release. Pools have an IO
+// kstat in the zfs module named after the pool (zfs:0:tank). Releases
+// that have per-vdev statistics have IO kstats named pool/vdev, in
+// the zfs module or the zfsdisk module. Releases without pool IO
+// kstats have no PoolIOs.
+type PoolIO struct {
+	// Pool is the pool's name, and Vdev is the vdev's name, or
+	// blank for the statistics of the whole pool.
+	Pool  string
+	Vdev  string
+	KStat kstat.KStatInfo
+	IO    disk.IO
+}
+
+// isPoolIO reports whether a kstat is the IO kstat of a pool or vdev.
+func isPoolIO(module string, tp kstat.KSType) bool {
+	return tp == kstat.IoStat && (module == "zfs" || module == "zfsdisk")
+}
+
+// PoolIOFromSnapshot gets the PoolIOs from a Snapshot, in the
+// Snapshot's order (so each pool comes before its vdevs, if the
+// Snapshot is sorted).
+func PoolIOFromSnapshot(snap *kstat.Snapshot) ([]PoolIO, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name}
+		vals[k] = append(vals[k], v)
+	}
+	var lst []PoolIO
+	for _, ki := range snap.KStats {
+		if !isPoolIO(ki.Module, ki.Type) {
+			continue
+		}
+		p := PoolIO{Pool: ki.Name, KStat: ki}
+		if i := strings.IndexByte(ki.Name, '/'); i >= 0 {
+			p.Pool, p.Vdev = ki.Name[:i], ki.Name[i+1:]
+		}
+		if err := kstat.CopyValues(vals[key{ki.Module, ki.Instance, ki.Name}], &p.IO); err != nil {
+			return nil, err
+		}
+		lst = append(lst, p)
+	}
+	return lst, nil
+}
@@ -0,0 +1,33 @@
+package zfs_test
+
+import (
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/zfs"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestPoolIOFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	add := func(module, name string, tp kstat.KSType, stats map[string]uint64) {
+		kstattest.Add(snap, kstat.KStatInfo{Module: module, Instance: 0, Name: name, Class: "misc", Type: tp}, stats)
+	}
+	add("zfs", "arcstats", kstat.NamedStat, map[string]uint64{"size": 1})
+	add("zfs", "tank", kstat.IoStat, map[string]uint64{"nread": 100, "writes": 2})
+	add("zfsdisk", "tank/c0t0d0", kstat.IoStat, map[string]uint64{"nread": 40})
+
+	pools, err := zfs.PoolIOFromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("PoolIOFromSnapshot failed: %s", err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("expected 2 PoolIOs, got %+v", pools)
+	}
+	if p := pools[0]; p.Pool != "tank" || p.Vdev != "" || p.IO.NRead != 100 || p.IO.Writes != 2 {
+		t.Errorf("wrong pool: %+v", p)
+	}
+	if p := pools[1]; p.Pool != "tank" || p.Vdev != "c0t0d0" || p.IO.NRead != 40 {
+		t.Errorf("wrong vdev: %+v", p)
+	}
+}
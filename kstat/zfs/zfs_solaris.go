@@ -0,0 +1,43 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading ZFS statistics from a Token.
+
+package zfs
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// ReadARC reads the ARC's statistics.
+func ReadARC(tok *kstat.Token) (*ARC, error) {
+	snap, err := tok.Snapshot(ARCSelector)
+	if err != nil {
+		return nil, err
+	}
+	return ARCFromSnapshot(snap)
+}
+
+// ReadPoolIO updates tok's kstat chain, so that pools that have been
+// imported or exported are noticed, and reads the IO statistics of
+// every pool and vdev.
+func ReadPoolIO(tok *kstat.Token) ([]PoolIO, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	var sels []kstat.Selector
+	for _, k := range tok.AllSorted() {
+		if isPoolIO(k.Module, k.Type) {
+			sels = append(sels, kstat.Selector{Module: k.Module, Instance: k.Instance, Name: k.Name})
+		}
+	}
+	if len(sels) == 0 {
+		return nil, nil
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		return nil, err
+	}
+	return PoolIOFromSnapshot(snap)
+}
@@ -0,0 +1,175 @@
+// Package zone reads the resource usage and caps of zones from the
+// global zone, keyed by zone name:
+//
+//	zones, err := zone.Read(tok)
+//	...
+//	for name, z := range zones {
+//		if z.Memory != nil && z.Memory.Capped() {
+//			fmt.Printf("%s: %d of %d bytes\n", name, z.Memory.RSS, z.Memory.PhysCap)
+//		}
+//	}
+//
+// The caps come from the caps:<zoneid>:<cap>_zone_<zoneid> kstats
+// (class zone_caps) and the memory_cap kstats (class
+// zone_memory_cap), and the CPU time from the zones:<zoneid>:<zone>
+// kstats (class zone_misc). Each zone only has the kstats for the
+// resources that it's using or that are capped, so a zone may only
+// have some of them. From inside a non-global zone, only that zone
+// is seen.
+package zone
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Selectors select the kstats that this package reads.
+var Selectors = []kstat.Selector{
+	{Module: "caps", Instance: -1},
+	{Module: "memory_cap", Instance: -1},
+	{Module: "zones", Instance: -1},
+}
+
+// Unlimited is the Value of a Cap that isn't set.
+const Unlimited = math.MaxUint64
+
+// Cap is a resource cap and the zone's usage of the resource.
+type Cap struct {
+	Usage uint64 `kstat:"usage"`
+	Value uint64 `kstat:"value"`
+}
+
+// Capped reports whether the Cap is set.
+func (c *Cap) Capped() bool {
+	return c.Value != Unlimited
+}
+
+// CPUCap is the CPU cap of a zone, in percent of a CPU, and its
+// usage of it.
+type CPUCap struct {
+	Cap
+	MaxUsage uint64 `kstat:"maxusage"`
+	// NWait is the number of threads waiting for CPU because of
+	// the cap; BelowSec and AboveSec are the seconds that the
+	// zone has spent below and above its cap.
+	NWait    uint64 `kstat:"nwait"`
+	BelowSec uint64 `kstat:"below_sec"`
+	AboveSec uint64 `kstat:"above_sec"`
+}
+
+// Memory is the memory use of a zone and its memory caps, in bytes.
+// PhysCap and SwapCap are 0 if they aren't set.
+type Memory struct {
+	RSS      uint64 `kstat:"rss"`
+	PhysCap  uint64 `kstat:"physcap"`
+	Swap     uint64 `kstat:"swap"`
+	SwapCap  uint64 `kstat:"swapcap"`
+	NOver    uint64 `kstat:"nover"`
+	PagedOut uint64 `kstat:"pagedout"`
+}
+
+// Capped reports whether the zone has a physical memory cap.
+func (m *Memory) Capped() bool {
+	return m.PhysCap != 0
+}
+
+// Misc is the CPU time and activity of a zone from its zone_misc
+// kstat, counting up from when the zone booted.
+type Misc struct {
+	User   time.Duration `kstat:"nsec_user"`
+	System time.Duration `kstat:"nsec_sys"`
+	WaitRQ time.Duration `kstat:"nsec_waitrq"`
+
+	ForkFailCap    uint64 `kstat:"forkfail_cap"`
+	ForkFailNoMem  uint64 `kstat:"forkfail_nomem"`
+	ForkFailNoProc uint64 `kstat:"forkfail_noproc"`
+}
+
+// Zone is the resource usage and caps of a zone. Any of them are nil
+// if the zone has no kstat for them.
+type Zone struct {
+	Name string
+	ID   int
+
+	CPU       *CPUCap
+	LockedMem *Cap
+	Swap      *Cap
+	Procs     *Cap
+	LWPs      *Cap
+	Memory    *Memory
+	Misc      *Misc
+}
+
+// FromSnapshot gets the Zones in a Snapshot, keyed by zone name. The
+// name of a zone is its kstats' zonename statistic.
+func FromSnapshot(snap *kstat.Snapshot) (map[string]*Zone, error) {
+	type key struct {
+		module   string
+		instance int
+		name     string
+	}
+	vals := make(map[key][]kstat.Value)
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name}
+		vals[k] = append(vals[k], v)
+	}
+
+	zones := make(map[string]*Zone)
+	for _, ki := range snap.KStats {
+		kv := vals[key{ki.Module, ki.Instance, ki.Name}]
+		var name string
+		for _, v := range kv {
+			if v.Stat == "zonename" {
+				name = v.StringVal
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		var dst interface{}
+		z := zones[name]
+		if z == nil {
+			z = &Zone{Name: name, ID: ki.Instance}
+		}
+		switch {
+		case ki.Module == "caps" && ki.Class == "zone_caps":
+			res := strings.TrimSuffix(ki.Name, "_zone_"+strconv.Itoa(ki.Instance))
+			switch res {
+			case "cpucaps":
+				z.CPU = &CPUCap{}
+				dst = z.CPU
+			case "lockedmem":
+				z.LockedMem = &Cap{}
+				dst = z.LockedMem
+			case "swapresv":
+				z.Swap = &Cap{}
+				dst = z.Swap
+			case "nprocs":
+				z.Procs = &Cap{}
+				dst = z.Procs
+			case "lwps":
+				z.LWPs = &Cap{}
+				dst = z.LWPs
+			}
+		case ki.Module == "memory_cap" && ki.Class == "zone_memory_cap":
+			z.Memory = &Memory{}
+			dst = z.Memory
+		case ki.Module == "zones" && ki.Class == "zone_misc":
+			z.Misc = &Misc{}
+			dst = z.Misc
+		}
+		if dst == nil {
+			continue
+		}
+		if err := kstat.CopyValues(kv, dst); err != nil {
+			return nil, err
+		}
+		zones[name] = z
+	}
+	return zones, nil
+}
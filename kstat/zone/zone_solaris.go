@@ -0,0 +1,24 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reading zone statistics from a Token.
+
+package zone
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// Read updates tok's kstat chain, so that zones that have booted or
+// halted are noticed, and reads the statistics of every zone.
+func Read(tok *kstat.Token) (map[string]*Zone, error) {
+	if _, err := tok.Update(); err != nil {
+		return nil, err
+	}
+	snap, err := tok.Snapshot(Selectors...)
+	if err != nil {
+		return nil, err
+	}
+	return FromSnapshot(snap)
+}
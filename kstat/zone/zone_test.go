@@ -0,0 +1,55 @@
+//
+// Test reading zone statistics from Snapshots.
+
+package zone_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstat/zone"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func TestFromSnapshot(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	add := func(module string, instance int, name, class, zname string, stats map[string]uint64) {
+		ki := kstat.KStatInfo{Module: module, Instance: instance, Name: name, Class: class, Type: kstat.NamedStat}
+		vals := append([]kstat.Value{kstattest.String("zonename", zname)}, kstattest.Uints(kstat.Uint64, stats)...)
+		kstattest.AddValues(snap, ki, vals...)
+	}
+	add("caps", 3, "cpucaps_zone_3", "zone_caps", "web", map[string]uint64{"usage": 50, "value": 200, "nwait": 1})
+	add("caps", 3, "lwps_zone_3", "zone_caps", "web", map[string]uint64{"usage": 120, "value": zone.Unlimited})
+	add("memory_cap", 3, "web", "zone_memory_cap", "web", map[string]uint64{"rss": 1 << 30, "physcap": 2 << 30})
+	add("zones", 3, "web", "zone_misc", "web", map[string]uint64{"nsec_user": 5e9})
+	add("zones", 0, "global", "zone_misc", "global", map[string]uint64{"nsec_sys": 1e9})
+	add("caps", 0, "cpucaps_project_1", "project_caps", "global", map[string]uint64{"usage": 1})
+
+	zones, err := zone.FromSnapshot(snap)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %s", err)
+	}
+	if len(zones) != 2 {
+		t.Fatalf("expected 2 zones, got %+v", zones)
+	}
+	web := zones["web"]
+	if web == nil || web.ID != 3 {
+		t.Fatalf("wrong web zone: %+v", web)
+	}
+	if web.CPU == nil || web.CPU.Usage != 50 || web.CPU.Value != 200 || web.CPU.NWait != 1 || !web.CPU.Capped() {
+		t.Errorf("wrong web CPU cap: %+v", web.CPU)
+	}
+	if web.LWPs == nil || web.LWPs.Usage != 120 || web.LWPs.Capped() {
+		t.Errorf("wrong web LWPs cap: %+v", web.LWPs)
+	}
+	if web.Memory == nil || !web.Memory.Capped() || web.Memory.RSS != 1<<30 {
+		t.Errorf("wrong web memory: %+v", web.Memory)
+	}
+	if web.Misc == nil || web.Misc.User != 5*time.Second || web.Procs != nil {
+		t.Errorf("wrong web zone: %+v", web)
+	}
+	if g := zones["global"]; g == nil || g.CPU != nil || g.Misc == nil || g.Misc.System != time.Second {
+		t.Errorf("wrong global zone: %+v", g)
+	}
+}
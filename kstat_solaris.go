@@ -61,6 +61,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"sort"
 	"unsafe"
 )
 
@@ -73,8 +74,19 @@ type Token struct {
 	// we want to keep unique KStats. This holds some Go-level
 	// memory down, but I wave my hands.
 	ksm map[*C.struct_kstat]*KStat
+
+	// cstrs caches the C strings for module, name, and statistic
+	// names that we've looked up, so that polling the same things
+	// over and over doesn't malloc() and free() each time. They
+	// are freed in Close().
+	cstrs map[string]*C.char
 }
 
+// maxCStrings bounds the size of a Token's C string cache. Past this
+// we go back to allocating and freeing C strings on every lookup,
+// since someone is plainly not looking up the same few things.
+const maxCStrings = 4096
+
 // Open returns a kstat Token that is used to obtain kstats. It corresponds
 // to kstat_open(). You should call .Close() when you're done and then not
 // use any KStats or Nameds obtained through this token.
@@ -88,6 +100,7 @@ func Open() (*Token, error) {
 	t := Token{}
 	t.kc = r
 	t.ksm = make(map[*C.struct_kstat]*KStat)
+	t.cstrs = make(map[string]*C.char)
 	// A 'func (t *Token) Close()' is equivalent to
 	// 'func Close(t *Token)'. The latter is what SetFinalizer()
 	// needs.
@@ -123,6 +136,11 @@ func (t *Token) Close() error {
 	// clear the map to drop all references to KStats.
 	t.ksm = make(map[*C.struct_kstat]*KStat)
 
+	for _, cs := range t.cstrs {
+		C.free(unsafe.Pointer(cs))
+	}
+	t.cstrs = make(map[string]*C.char)
+
 	// cancel finalizer
 	runtime.SetFinalizer(&t, nil)
 
@@ -222,18 +240,59 @@ func (t *Token) All() []*KStat {
 	return n
 }
 
-//
-// allocate a C string for a non-blank string; otherwise return nil
-func maybeCString(src string) *C.char {
+// AllSorted returns an array of all available KStats, sorted by
+// module, then instance, then name. All() returns KStats in kstat
+// chain order, which is arbitrary and may change between kstat chain
+// updates; use AllSorted if you need stable output, for example to
+// compare two lists of kstats.
+func (t *Token) AllSorted() []*KStat {
+	n := t.All()
+	sort.Slice(n, func(i, j int) bool {
+		return ksLess(n[i], n[j])
+	})
+	return n
+}
+
+// ksLess orders KStats by module:instance:name.
+func ksLess(a, b *KStat) bool {
+	switch {
+	case a.Module != b.Module:
+		return a.Module < b.Module
+	case a.Instance != b.Instance:
+		return a.Instance < b.Instance
+	default:
+		return a.Name < b.Name
+	}
+}
+
+// cstring returns a C string for src, normally from the Token's
+// cache. If the cache is full, it returns a fresh C string and true;
+// the caller must free it with C.free() when done.
+func (t *Token) cstring(src string) (*C.char, bool) {
+	if cs, ok := t.cstrs[src]; ok {
+		return cs, false
+	}
+	cs := C.CString(src)
+	if len(t.cstrs) >= maxCStrings {
+		return cs, true
+	}
+	t.cstrs[src] = cs
+	return cs, false
+}
+
+// maybeCached is cstring except that it returns nil for a blank
+// string. The caller must call maybeRelease with the result once done
+// with it.
+func (t *Token) maybeCached(src string) (*C.char, bool) {
 	if src == "" {
-		return nil
+		return nil, false
 	}
-	return C.CString(src)
+	return t.cstring(src)
 }
 
-// free a non-nil C string
-func maybeFree(cs *C.char) {
-	if cs != nil {
+// maybeRelease frees a C string from maybeCached if it wasn't cached.
+func maybeRelease(cs *C.char, temp bool) {
+	if temp {
 		C.free(unsafe.Pointer(cs))
 	}
 }
@@ -265,11 +324,11 @@ func (t *Token) Lookup(module string, instance int, name string) (*KStat, error)
 		return nil, errors.New("Token not valid or closed")
 	}
 
-	ms := maybeCString(module)
-	ns := maybeCString(name)
+	ms, mtemp := t.maybeCached(module)
+	ns, ntemp := t.maybeCached(name)
 	r, err := C.kstat_lookup(t.kc, ms, C.int(instance), ns)
-	maybeFree(ms)
-	maybeFree(ns)
+	maybeRelease(ms, mtemp)
+	maybeRelease(ns, ntemp)
 
 	if r == nil {
 		return nil, err
@@ -296,6 +355,29 @@ func (t *Token) Lookup(module string, instance int, name string) (*KStat, error)
 	return k, nil
 }
 
+// LookupMatcher is Lookup for the first KStat (in sorted order) that
+// a compiled Selector matches. If the Matcher names a single kstat,
+// this is a kstat_lookup() (using the Token's cached C strings);
+// otherwise it checks every KStat against the Matcher. Like Lookup,
+// it refreshes the KStat.
+func (t *Token) LookupMatcher(m *Matcher) (*KStat, error) {
+	if module, instance, name, ok := m.Exact(); ok {
+		return t.Lookup(module, instance, name)
+	}
+	if t == nil || t.kc == nil {
+		return nil, errors.New("Token not valid or closed")
+	}
+	for _, k := range t.AllSorted() {
+		if m.MatchKStat(k.Module, k.Instance, k.Name) {
+			if err := k.Refresh(); err != nil {
+				return nil, err
+			}
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("no kstat matches %s", m.Selector())
+}
+
 // GetNamed obtains the Named representing a particular (named) kstat
 // module:instance:name:statistic statistic. It always returns current
 // data for the kstat statistic, even if it's called repeatedly for the
@@ -310,39 +392,125 @@ func (t *Token) GetNamed(module string, instance int, name, stat string) (*Named
 	return stats.GetNamed(stat)
 }
 
-// -----
+// GetNamedAll obtains the Named for module:*:name:statistic across
+// every instance of the kstat that currently exists, for example
+// every cpu:*:sys:cpu_nsec_idle. The Nameds are returned in order of
+// increasing instance number. As with GetNamed, each kstat is
+// refreshed so that you always get current data. module and name may
+// be "" to match any module or name.
+//
+// GetNamedAll fails if no kstats match or if the statistic cannot be
+// retrieved from any one of the matching kstats.
+func (t *Token) GetNamedAll(module, name, stat string) ([]*Named, error) {
+	if t == nil || t.kc == nil {
+		return nil, errors.New("Token not valid or closed")
+	}
 
-// KSType is the type of the data in a KStat.
-type KSType int
-
-// The different types of data that a KStat may contain, ie these
-// are the value of a KStat.Type. We currently only support getting
-// Named and IO statistics.
-const (
-	RawStat   KSType = C.KSTAT_TYPE_RAW
-	NamedStat KSType = C.KSTAT_TYPE_NAMED
-	IntrStat  KSType = C.KSTAT_TYPE_INTR
-	IoStat    KSType = C.KSTAT_TYPE_IO
-	TimerStat KSType = C.KSTAT_TYPE_TIMER
-)
+	var lst []*Named
+	for _, k := range t.AllSorted() {
+		if (module != "" && k.Module != module) || (name != "" && k.Name != name) {
+			continue
+		}
+		if err := k.Refresh(); err != nil {
+			return nil, err
+		}
+		n, err := k.GetNamed(stat)
+		if err != nil {
+			return nil, err
+		}
+		lst = append(lst, n)
+	}
+	if len(lst) == 0 {
+		return nil, fmt.Errorf("no kstats match %s:*:%s", module, name)
+	}
+	return lst, nil
+}
 
-func (tp KSType) String() string {
-	switch tp {
-	case RawStat:
-		return "raw"
-	case NamedStat:
-		return "named"
-	case IntrStat:
-		return "interrupt"
-	case IoStat:
-		return "io"
-	case TimerStat:
-		return "timer"
-	default:
-		return fmt.Sprintf("kstat_type:%d", tp)
+// Tree is a hierarchical view of kstats, indexed by module, then
+// instance, then name. It's a snapshot of the kstat chain at the time
+// it was created by Token.Tree(); it is not updated by Token.Update().
+type Tree map[string]map[int]map[string]*KStat
+
+// Tree returns all available KStats organized into a Tree. As with
+// All(), it cannot fail.
+func (t *Token) Tree() Tree {
+	tr := make(Tree)
+	for _, k := range t.All() {
+		insts, ok := tr[k.Module]
+		if !ok {
+			insts = make(map[int]map[string]*KStat)
+			tr[k.Module] = insts
+		}
+		names, ok := insts[k.Instance]
+		if !ok {
+			names = make(map[string]*KStat)
+			insts[k.Instance] = names
+		}
+		names[k.Name] = k
 	}
+	return tr
 }
 
+// Modules returns the modules in a Tree in sorted order.
+func (tr Tree) Modules() []string {
+	lst := make([]string, 0, len(tr))
+	for m := range tr {
+		lst = append(lst, m)
+	}
+	sort.Strings(lst)
+	return lst
+}
+
+// Instances returns the instances of a module in a Tree in sorted
+// order.
+func (tr Tree) Instances(module string) []int {
+	lst := make([]int, 0, len(tr[module]))
+	for i := range tr[module] {
+		lst = append(lst, i)
+	}
+	sort.Ints(lst)
+	return lst
+}
+
+// Names returns the names present for a module:instance in a Tree in
+// sorted order.
+func (tr Tree) Names(module string, instance int) []string {
+	lst := make([]string, 0, len(tr[module][instance]))
+	for n := range tr[module][instance] {
+		lst = append(lst, n)
+	}
+	sort.Strings(lst)
+	return lst
+}
+
+// Get returns the KStat for module:instance:name in a Tree, or nil if
+// there is no such KStat.
+func (tr Tree) Get(module string, instance int, name string) *KStat {
+	return tr[module][instance][name]
+}
+
+// -----
+
+// The KSType and NamedType constants are defined in types.go so that
+// they're available on all platforms, which means that they can't
+// be taken directly from sys/kstat.h. Make sure that they agree with
+// it; if they don't, one of these array indexes is out of range and
+// compilation fails.
+var (
+	_ = [1]struct{}{}[RawStat-C.KSTAT_TYPE_RAW]
+	_ = [1]struct{}{}[NamedStat-C.KSTAT_TYPE_NAMED]
+	_ = [1]struct{}{}[IntrStat-C.KSTAT_TYPE_INTR]
+	_ = [1]struct{}{}[IoStat-C.KSTAT_TYPE_IO]
+	_ = [1]struct{}{}[TimerStat-C.KSTAT_TYPE_TIMER]
+
+	_ = [1]struct{}{}[CharData-C.KSTAT_DATA_CHAR]
+	_ = [1]struct{}{}[Int32-C.KSTAT_DATA_INT32]
+	_ = [1]struct{}{}[Uint32-C.KSTAT_DATA_UINT32]
+	_ = [1]struct{}{}[Int64-C.KSTAT_DATA_INT64]
+	_ = [1]struct{}{}[Uint64-C.KSTAT_DATA_UINT64]
+	_ = [1]struct{}{}[String-C.KSTAT_DATA_STRING]
+)
+
 // KStat is the access handle for the collection of statistics for a
 // particular module:instance:name kstat.
 //
@@ -370,6 +538,11 @@ type KStat struct {
 	ksp *C.struct_kstat
 	// We need access to the token to refresh the data
 	tok *Token
+
+	// If track is set, last and prev are copies of the data from
+	// the two most recent refreshes, for Delta().
+	track      bool
+	prev, last saved
 }
 
 // newKStat is our internal KStat constructor.
@@ -387,9 +560,9 @@ func newKStat(tok *Token, ks *C.struct_kstat) *KStat {
 	kst.tok = tok
 
 	kst.Instance = int(ks.ks_instance)
-	kst.Module = strndup((*C.char)(unsafe.Pointer(&ks.ks_module)), C.KSTAT_STRLEN)
-	kst.Name = strndup((*C.char)(unsafe.Pointer(&ks.ks_name)), C.KSTAT_STRLEN)
-	kst.Class = strndup((*C.char)(unsafe.Pointer(&ks.ks_class)), C.KSTAT_STRLEN)
+	kst.Module = names.Bytes(cbytes((*C.char)(unsafe.Pointer(&ks.ks_module)), C.KSTAT_STRLEN))
+	kst.Name = names.Bytes(cbytes((*C.char)(unsafe.Pointer(&ks.ks_name)), C.KSTAT_STRLEN))
+	kst.Class = names.Bytes(cbytes((*C.char)(unsafe.Pointer(&ks.ks_class)), C.KSTAT_STRLEN))
 	kst.Type = KSType(ks.ks_type)
 	kst.Crtime = int64(ks.ks_crtime)
 
@@ -481,7 +654,7 @@ func (k *KStat) Refresh() error {
 	if res == -1 {
 		return err
 	}
-	k.Snaptime = int64(k.ksp.ks_snaptime)
+	k.readDone()
 	return nil
 }
 
@@ -508,6 +681,21 @@ func (k *KStat) GetIO() (*IO, error) {
 	return &io, nil
 }
 
+// GetIOInto is GetIO except that it copies the IO statistics into io
+// instead of allocating a new IO, for callers that poll IO kstats
+// often and want to avoid the garbage. Like GetIO, it always
+// refreshes the KStat.
+func (k *KStat) GetIOInto(io *IO) error {
+	if err := k.Refresh(); err != nil {
+		return err
+	}
+	if k.ksp.ks_type != C.KSTAT_TYPE_IO {
+		return fmt.Errorf("kstat %s (type %d) is not an IO kstat", k, k.ksp.ks_type)
+	}
+	*io = *((*IO)(k.ksp.ks_data))
+	return nil
+}
+
 // GetNamed obtains a particular named statistic from a KStat. It does
 // not refresh the KStat's statistics data, so multiple calls to
 // GetNamed on a single KStat will get a coherent set of statistic
@@ -518,17 +706,66 @@ func (k *KStat) GetNamed(name string) (*Named, error) {
 	if err := k.setup(); err != nil {
 		return nil, err
 	}
-	ns := C.CString(name)
+	ns, temp := k.tok.cstring(name)
 	r, err := C.kstat_data_lookup(k.ksp, ns)
-	C.free(unsafe.Pointer(ns))
+	maybeRelease(ns, temp)
 	if r == nil || err != nil {
 		return nil, err
 	}
 	return newNamed(k, (*C.struct_kstat_named)(r)), err
 }
 
+// lookupNamed is kstat_data_lookup() on a named KStat, for the
+// scalar Read* functions.
+func (k *KStat) lookupNamed(name string) (*C.struct_kstat_named, error) {
+	if err := k.setup(); err != nil {
+		return nil, err
+	}
+	ns, temp := k.tok.cstring(name)
+	r, err := C.kstat_data_lookup(k.ksp, ns)
+	maybeRelease(ns, temp)
+	if r == nil {
+		if err == nil {
+			err = fmt.Errorf("kstat %s has no statistic %s", k, name)
+		}
+		return nil, err
+	}
+	return (*C.struct_kstat_named)(r), nil
+}
+
+// ReadUint64 returns the value of a Uint32 or Uint64 named statistic
+// of the KStat without creating a Named for it. Like GetNamed, it
+// does not refresh the KStat's data. It is the cheapest way to get a
+// single number out of a kstat in a polling loop.
+func (k *KStat) ReadUint64(name string) (uint64, error) {
+	knp, err := k.lookupNamed(name)
+	if err != nil {
+		return 0, err
+	}
+	switch NamedType(knp.data_type) {
+	case Uint32, Uint64:
+		return uint64(C.get_named_uint(knp)), nil
+	}
+	return 0, fmt.Errorf("statistic %s of kstat %s is %s, not unsigned", name, k, NamedType(knp.data_type))
+}
+
+// ReadInt64 is ReadUint64 for Int32 and Int64 named statistics.
+func (k *KStat) ReadInt64(name string) (int64, error) {
+	knp, err := k.lookupNamed(name)
+	if err != nil {
+		return 0, err
+	}
+	switch NamedType(knp.data_type) {
+	case Int32, Int64:
+		return int64(C.get_named_int(knp)), nil
+	}
+	return 0, fmt.Errorf("statistic %s of kstat %s is %s, not signed", name, k, NamedType(knp.data_type))
+}
+
 // AllNamed returns an array of all named statistics for a particular
 // named-type KStat. Entries are returned in no particular order.
+// If you call AllNamed often, you can pass the result to ReleaseAll
+// when you're done with it so that the Nameds are reused.
 func (k *KStat) AllNamed() ([]*Named, error) {
 	if err := k.setup(); err != nil {
 		return nil, err
@@ -544,6 +781,37 @@ func (k *KStat) AllNamed() ([]*Named, error) {
 	return lst, nil
 }
 
+// AllNamedInto is AllNamed except that it fills in Named values in
+// dst, reusing its storage, instead of allocating new Nameds. It
+// returns dst resliced (or grown, if it's too small) to hold all of
+// the KStat's statistics. Names and string values are only
+// reallocated if they differ from what is already in the
+// corresponding entry, so calling AllNamedInto on the same KStat
+// over and over with the same dst normally allocates nothing.
+//
+// The returned Nameds are overwritten by the next call that's given
+// the same dst; copy any you want to keep.
+func (k *KStat) AllNamedInto(dst []Named) ([]Named, error) {
+	if err := k.setup(); err != nil {
+		return dst[:0], err
+	}
+	n := int(k.ksp.ks_ndata)
+	if cap(dst) < n {
+		nd := make([]Named, n)
+		copy(nd, dst[:cap(dst)])
+		dst = nd
+	}
+	dst = dst[:n]
+	for i := 0; i < n; i++ {
+		ks := C.get_nth_named(k.ksp, C.uint_t(i))
+		if ks == nil {
+			panic("get_nth_named returned surprise nil")
+		}
+		fillNamed(&dst[i], k, ks)
+	}
+	return dst, nil
+}
+
 // Named represents a particular kstat named statistic, ie the full
 //	module:instance:name:statistic
 // and its current value.
@@ -580,62 +848,52 @@ func (ks *Named) String() string {
 	return fmt.Sprintf("%s:%d:%s:%s", ks.KStat.Module, ks.KStat.Instance, ks.KStat.Name, ks.Name)
 }
 
-// NamedType represents the various types of named kstat statistics.
-type NamedType int
-
-// The different types of data that a named kstat statistic can be
-// (ie, these are the potential values of Named.Type).
-const (
-	CharData NamedType = C.KSTAT_DATA_CHAR
-	Int32    NamedType = C.KSTAT_DATA_INT32
-	Uint32   NamedType = C.KSTAT_DATA_UINT32
-	Int64    NamedType = C.KSTAT_DATA_INT64
-	Uint64   NamedType = C.KSTAT_DATA_UINT64
-	String   NamedType = C.KSTAT_DATA_STRING
-
-	// CharData is found in StringVal. At the moment we assume that
-	// it is a real string, because this matches how it seems to be
-	// used for short strings in the Solaris kernel. Someday we may
-	// find something that uses it as just a data dump for 16 bytes.
-
-	// Solaris sys/kstat.h also has _FLOAT (5) and _DOUBLE (6) types,
-	// but labels them as obsolete.
-)
-
-func (tp NamedType) String() string {
-	switch tp {
-	case CharData:
-		return "char"
-	case Int32:
-		return "int32"
-	case Uint32:
-		return "uint32"
-	case Int64:
-		return "int64"
-	case Uint64:
-		return "uint64"
-	case String:
-		return "string"
-	default:
-		return fmt.Sprintf("named_type-%d", tp)
+// Value returns a copy of a Named as a Value, for example so that it
+// can be given to a CounterTracker.
+func (ks *Named) Value() Value {
+	return Value{
+		Module: ks.KStat.Module, Instance: ks.KStat.Instance, Name: ks.KStat.Name, Class: ks.KStat.Class,
+		Stat: ks.Name, Type: ks.Type,
+		StringVal: ks.StringVal, IntVal: ks.IntVal, UintVal: ks.UintVal,
+		Crtime: ks.KStat.Crtime, Snaptime: ks.Snaptime,
 	}
 }
 
+// knamed is kstat_named_t under a name that the package's tests can
+// use, since they can't use cgo themselves.
+type knamed = C.struct_kstat_named
+
 // Create a new Stat from the kstat_named_t
-// We set the appropriate *Value field.
 func newNamed(k *KStat, knp *C.struct_kstat_named) *Named {
-	st := Named{}
+	st := getNamed()
+	fillNamed(st, k, knp)
+	return st
+}
+
+// fillNamed sets st from the kstat_named_t, including the appropriate
+// *Value field. Name and StringVal are only replaced if they've
+// changed, so that refilling the same Named doesn't allocate.
+func fillNamed(st *Named, k *KStat, knp *C.struct_kstat_named) {
 	st.KStat = k
-	st.Name = strndup((*C.char)(unsafe.Pointer(&knp.name)), C.KSTAT_STRLEN)
+	if b := cbytes((*C.char)(unsafe.Pointer(&knp.name)), C.KSTAT_STRLEN); string(b) != st.Name {
+		st.Name = names.Bytes(b)
+	}
 	st.Type = NamedType(knp.data_type)
 	st.Snaptime = k.Snaptime
+	oldVal := st.StringVal
+	st.StringVal, st.IntVal, st.UintVal = "", 0, 0
 
 	switch st.Type {
 	case String:
 		// The comments in sys/kstat.h explicitly guarantee
 		// that these strings are null-terminated, although
 		// knp.value.str.len also holds the length.
-		st.StringVal = C.GoString(C.get_named_char(knp))
+		// However the pointer can be NULL, for a string that
+		// has never been set or was set with
+		// kstat_named_setstr(knp, NULL).
+		if cs := C.get_named_char(knp); cs != nil {
+			st.StringVal = reuseString(oldVal, cs, C.strlen(cs))
+		}
 	case CharData:
 		// Solaris/etc appears to use CharData for short strings
 		// so that they can be embedded directly into
@@ -645,7 +903,7 @@ func newNamed(k *KStat, knp *C.struct_kstat_named) *Named {
 		// However I scanned the Illumos kernel source and
 		// everyone using it appears to really be using it for
 		// strings.
-		st.StringVal = strndup((*C.char)(unsafe.Pointer(&knp.value)), 16)
+		st.StringVal = reuseString(oldVal, (*C.char)(unsafe.Pointer(&knp.value)), 16)
 	case Int32, Int64:
 		st.IntVal = int64(C.get_named_int(knp))
 	case Uint32, Uint64:
@@ -654,5 +912,20 @@ func newNamed(k *KStat, knp *C.struct_kstat_named) *Named {
 		// TODO: should do better.
 		panic(fmt.Sprintf("unknown stat type: %d", st.Type))
 	}
-	return &st
+}
+
+// reuseString returns old if it is the same as the C string cs (of
+// at most size bytes, as for strndup()), and otherwise a new copy of
+// cs.
+func reuseString(old string, cs *C.char, size C.size_t) string {
+	if b := cbytes(cs, size); string(b) != old {
+		return string(b)
+	}
+	return old
+}
+
+// cbytes returns the bytes of the C string cs (of at most size
+// bytes, as for strndup()) without copying them.
+func cbytes(cs *C.char, size C.size_t) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(cs)), int(C.strnlen(cs, size)))
 }
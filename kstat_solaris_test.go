@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 //
 // All of these tests depend on being able to know what kstats exist
 // on any Illumos / Solaris machine. I believe I've selected kstats
@@ -9,6 +12,8 @@
 package kstat_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"runtime"
 	"testing"
 	"time"
@@ -231,6 +236,50 @@ func TestAlls(t *testing.T) {
 	stop(t, tok)
 }
 
+// Test that Token.AllSorted() returns everything that Token.All()
+// does, in module:instance:name order.
+func TestAllSorted(t *testing.T) {
+	tok := start(t)
+	lst := tok.All()
+	srt := tok.AllSorted()
+	if len(lst) != len(srt) {
+		t.Fatalf("tok.AllSorted gave %d KStats, tok.All gave %d", len(srt), len(lst))
+	}
+	for i := 1; i < len(srt); i++ {
+		a, b := srt[i-1], srt[i]
+		if a.Module > b.Module || (a.Module == b.Module && (a.Instance > b.Instance || (a.Instance == b.Instance && a.Name > b.Name))) {
+			t.Fatalf("tok.AllSorted out of order: %s before %s", a, b)
+		}
+	}
+	stop(t, tok)
+}
+
+// Test that Token.Tree() holds every KStat that Token.All() returns,
+// in the right place.
+func TestTree(t *testing.T) {
+	tok := start(t)
+	tr := tok.Tree()
+	n := 0
+	for _, m := range tr.Modules() {
+		for _, i := range tr.Instances(m) {
+			n += len(tr.Names(m, i))
+		}
+	}
+	lst := tok.All()
+	if n != len(lst) {
+		t.Fatalf("Tree has %d KStats, tok.All has %d", n, len(lst))
+	}
+	for _, ks := range lst {
+		if tr.Get(ks.Module, ks.Instance, ks.Name) != ks {
+			t.Fatalf("Tree does not have %s in the right place", ks)
+		}
+	}
+	if tr.Get("nosuch", 0, "nosuch") != nil {
+		t.Fatalf("Tree has nosuch:0:nosuch")
+	}
+	stop(t, tok)
+}
+
 // Test that we cannot do GetNamed() or AllNamed() on things that are
 // not named stats.
 // We use unix:0:vminfo as our test kstat for this, and also try to
@@ -342,6 +391,179 @@ func getnamed(t *testing.T, tok *kstat.Token, module, name, stat string) *kstat.
 	return n
 }
 
+// Test that GetNamedAll finds cpu:*:sys:syscall for every CPU that
+// Token.All() knows about, in instance order.
+func TestGetNamedAll(t *testing.T) {
+	tok := start(t)
+	ncpu := 0
+	for _, ks := range tok.All() {
+		if ks.Module == "cpu" && ks.Name == "sys" {
+			ncpu++
+		}
+	}
+	lst, err := tok.GetNamedAll("cpu", "sys", "syscall")
+	if err != nil {
+		t.Fatalf("GetNamedAll cpu:*:sys:syscall failed: %s", err)
+	}
+	if len(lst) != ncpu {
+		t.Fatalf("GetNamedAll gave %d Nameds for %d CPUs", len(lst), ncpu)
+	}
+	for i, n := range lst {
+		if n.Name != "syscall" || n.KStat.Module != "cpu" || n.KStat.Name != "sys" {
+			t.Fatalf("GetNamedAll returned the wrong thing: %s", n)
+		}
+		if i > 0 && lst[i-1].KStat.Instance >= n.KStat.Instance {
+			t.Fatalf("GetNamedAll out of order: %s before %s", lst[i-1], n)
+		}
+	}
+
+	_, err = tok.GetNamedAll("cpu", "sys", "nosuch")
+	if err == nil {
+		t.Fatalf("GetNamedAll of cpu:*:sys:nosuch succeeded")
+	}
+	_, err = tok.GetNamedAll("nosuch", "nosuch", "syscall")
+	if err == nil {
+		t.Fatalf("GetNamedAll of nosuch:*:nosuch:syscall succeeded")
+	}
+	stop(t, tok)
+}
+
+// AllNamedInto should give the same statistics as AllNamed, and
+// reuse its slice when it's big enough.
+func TestAllNamedInto(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	ks := lookup(t, tok, "unix", "system_misc")
+	lst, err := ks.AllNamed()
+	if err != nil {
+		t.Fatalf("AllNamed failed: %s", err)
+	}
+	var dst []kstat.Named
+	for i := 0; i < 2; i++ {
+		prev := dst
+		dst, err = ks.AllNamedInto(dst)
+		if err != nil {
+			t.Fatalf("AllNamedInto failed: %s", err)
+		}
+		if len(dst) != len(lst) {
+			t.Fatalf("AllNamedInto gave %d Nameds, AllNamed %d", len(dst), len(lst))
+		}
+		if i > 0 && &prev[0] != &dst[0] {
+			t.Fatalf("AllNamedInto didn't reuse its slice")
+		}
+		for j := range dst {
+			if dst[j].Name != lst[j].Name || dst[j].Type != lst[j].Type || dst[j].KStat != ks {
+				t.Fatalf("AllNamedInto entry %d is %s, AllNamed %s", j, &dst[j], lst[j])
+			}
+		}
+	}
+}
+
+// Released Nameds come back filled in correctly.
+func TestRelease(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	ks := lookup(t, tok, "unix", "system_misc")
+	lst, err := ks.AllNamed()
+	if err != nil {
+		t.Fatalf("AllNamed failed: %s", err)
+	}
+	names := make([]string, len(lst))
+	for i, n := range lst {
+		names[i] = n.Name
+	}
+	kstat.ReleaseAll(lst)
+	lst, err = ks.AllNamed()
+	if err != nil {
+		t.Fatalf("AllNamed after ReleaseAll failed: %s", err)
+	}
+	if len(lst) != len(names) {
+		t.Fatalf("AllNamed gave %d Nameds, then %d", len(names), len(lst))
+	}
+	for i, n := range lst {
+		if n.Name != names[i] || n.KStat != ks {
+			t.Fatalf("reused Named %d is %s, expected %s", i, n, names[i])
+		}
+	}
+}
+
+// LazyNameds decode to the same things as Nameds.
+func TestAllNamedLazy(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "cpu_info", "")
+	lst, err := ks.AllNamed()
+	if err != nil {
+		t.Fatalf("AllNamed failed: %s", err)
+	}
+	lazy, err := ks.AllNamedLazy()
+	if err != nil {
+		t.Fatalf("AllNamedLazy failed: %s", err)
+	}
+	if len(lazy) != len(lst) {
+		t.Fatalf("AllNamedLazy gave %d, AllNamed %d", len(lazy), len(lst))
+	}
+	for i, n := range lst {
+		ln := lazy[i]
+		if ln.Name() != n.Name || ln.Type() != n.Type || ln.StringVal() != n.StringVal {
+			t.Fatalf("LazyNamed %d is %s %d %q, Named is %s", i, ln.Name(), ln.Type(), ln.StringVal(), n)
+		}
+		if !ln.NameIs(n.Name) || ln.NameIs(n.Name+"x") {
+			t.Fatalf("LazyNamed %d NameIs disagrees with Named %s", i, n)
+		}
+	}
+
+	// Once the Token is closed, LazyNameds are invalid.
+	stop(t, tok)
+	if tp := lazy[0].Type(); tp != kstat.InvalidType {
+		t.Fatalf("LazyNamed Type after Close is %s", tp)
+	}
+	if lazy[0].NameIs(lst[0].Name) {
+		t.Fatalf("LazyNamed NameIs %q after Close", lst[0].Name)
+	}
+}
+
+// ReadUint64 and ReadInt64 agree with GetNamed and check types.
+func TestReadScalars(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	ks := lookup(t, tok, "unix", "system_misc")
+	v, err := ks.ReadUint64("ncpus")
+	if err != nil {
+		t.Fatalf("ReadUint64 ncpus failed: %s", err)
+	}
+	if n := kgetnamed(t, ks, "ncpus"); n.UintVal != v {
+		t.Fatalf("ReadUint64 ncpus is %d, GetNamed %d", v, n.UintVal)
+	}
+	if _, err = ks.ReadInt64("ncpus"); err == nil {
+		t.Fatalf("ReadInt64 of unsigned ncpus succeeded")
+	}
+	if _, err = ks.ReadUint64("nosuch"); err == nil {
+		t.Fatalf("ReadUint64 of nosuch succeeded")
+	}
+}
+
+// LookupMatcher finds the same KStat as Lookup, by either route.
+func TestLookupMatcher(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	ks := lookup(t, tok, "unix", "system_misc")
+	for _, sel := range []kstat.Selector{
+		{Module: "unix", Instance: 0, Name: "system_misc"},
+		{Module: "unix", Instance: -1, Name: "system_m*"},
+	} {
+		k, err := tok.LookupMatcher(sel.Compile())
+		if err != nil {
+			t.Fatalf("LookupMatcher %s failed: %s", sel, err)
+		}
+		if k != ks {
+			t.Fatalf("LookupMatcher %s found %s, not %s", sel, k, ks)
+		}
+	}
+	if _, err := tok.LookupMatcher(kstat.Selector{Module: "nosuch*", Instance: -1}.Compile()); err == nil {
+		t.Fatalf("LookupMatcher of nosuch* succeeded")
+	}
+}
+
 // Test named kstat stats other than Uint*
 //
 // We assume there will always be a cpu_info:*:cpu_info0 kstat, although
@@ -462,6 +684,29 @@ func TestDiskSnaptime(t *testing.T) {
 	stop(t, tok)
 }
 
+// GetIOInto should refresh on every call just as GetIO does, so a
+// second call sees a later Snaptime and counters that haven't gone
+// backwards.
+func TestDiskIOInto(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "sd", "sd0")
+	var io1, io2 kstat.IO
+	if err := ks.GetIOInto(&io1); err != nil {
+		t.Fatalf("%s GetIOInto failed: %s", ks, err)
+	}
+	osnap := ks.Snaptime
+	if err := ks.GetIOInto(&io2); err != nil {
+		t.Fatalf("%s second GetIOInto failed: %s", ks, err)
+	}
+	if ks.Snaptime <= osnap {
+		t.Fatalf("%s Snaptime did not increase after GetIOInto: %d then %d", ks, osnap, ks.Snaptime)
+	}
+	if io2.Nread < io1.Nread || io2.Nwritten < io1.Nwritten || io2.Reads < io1.Reads || io2.Writes < io1.Writes {
+		t.Fatalf("%s IO counters went backwards: %+v then %+v", ks, io1, io2)
+	}
+	stop(t, tok)
+}
+
 // This tries to test that that our usage of runtime.SetFinalizer()
 // at least doesn't crash when we try to call the finalizer.
 func TestTokenFinalizer(t *testing.T) {
@@ -495,3 +740,128 @@ func TestUpdate(t *testing.T) {
 		t.Fatalf("%s valid after Close()", ks)
 	}
 }
+
+// Test that CounterTracker works on Nameds from successive lookups.
+func TestNamedRate(t *testing.T) {
+	tok := start(t)
+	ct := kstat.NewCounterTracker()
+	n := getnamed(t, tok, "unix", "system_misc", "clk_intr")
+	if _, ok := ct.Update(n.Value()); ok {
+		t.Fatalf("first Update gave a rate")
+	}
+	time.Sleep(time.Second / 2)
+	n = getnamed(t, tok, "unix", "system_misc", "clk_intr")
+	r, ok := ct.Update(n.Value())
+	if !ok || r.Rate <= 0 || r.Elapsed <= 0 {
+		t.Fatalf("bad clk_intr rate: %v %+v", ok, r)
+	}
+	stop(t, tok)
+}
+
+// Test KStat.Delta() on a named kstat that's sure to change.
+func TestDelta(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "unix", "system_misc")
+	if _, err := ks.Delta(); err == nil {
+		t.Fatalf("%s Delta succeeded without TrackDelta", ks)
+	}
+	if err := ks.TrackDelta(); err != nil {
+		t.Fatalf("%s TrackDelta failed: %s", ks, err)
+	}
+	n1 := kgetnamed(t, ks, "clk_intr")
+	time.Sleep(time.Second / 2)
+	if err := ks.Refresh(); err != nil {
+		t.Fatalf("%s Refresh failed: %s", ks, err)
+	}
+	n2 := kgetnamed(t, ks, "clk_intr")
+	d, err := ks.Delta()
+	if err != nil {
+		t.Fatalf("%s Delta failed: %s", ks, err)
+	}
+	if d.Deltas["clk_intr"] != int64(n2.UintVal-n1.UintVal) || d.Deltas["clk_intr"] <= 0 {
+		t.Fatalf("%s bad clk_intr delta: %d vs %d - %d", ks, d.Deltas["clk_intr"], n2.UintVal, n1.UintVal)
+	}
+	if d.Elapsed != time.Duration(n2.Snaptime-n1.Snaptime) || d.Rate("clk_intr") <= 0 {
+		t.Fatalf("%s bad Delta elapsed or rate: %+v", ks, d)
+	}
+
+	// A freshly looked up IO KStat has only been read once.
+	ks = lookup(t, tok, "sd", "sd0")
+	if err = ks.TrackDelta(); err != nil {
+		t.Fatalf("%s TrackDelta failed: %s", ks, err)
+	}
+	if _, err = ks.Delta(); err == nil {
+		t.Fatalf("%s Delta succeeded after only one read", ks)
+	}
+	if err = ks.Refresh(); err != nil {
+		t.Fatalf("%s Refresh failed: %s", ks, err)
+	}
+	d, err = ks.Delta()
+	if err != nil {
+		t.Fatalf("%s Delta failed: %s", ks, err)
+	}
+	if _, ok := d.Deltas["nread"]; !ok {
+		t.Fatalf("%s IO Delta has no nread: %+v", ks, d)
+	}
+	stop(t, tok)
+}
+
+// CopyTo on a named kstat binds statistics to fields by name.
+func TestCopyToNamed(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "unix", "system_misc")
+	var r struct {
+		ClkIntr uint64 `kstat:"clk_intr"`
+		Ncpus   int
+		Nproc   uint32
+	}
+	if err := ks.CopyTo(&r); err != nil {
+		t.Fatalf("%s CopyTo failed: %s", ks, err)
+	}
+	n := kgetnamed(t, ks, "clk_intr")
+	if r.ClkIntr != n.UintVal || r.Ncpus == 0 || r.Nproc == 0 {
+		t.Fatalf("bad CopyTo result: %+v (clk_intr %d)", r, n.UintVal)
+	}
+	stop(t, tok)
+}
+
+func TestKStatJSON(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "unix", "system_misc")
+	n := kgetnamed(t, ks, "clk_intr")
+
+	var jk struct {
+		Module string
+		Type   string
+		Stats  []struct {
+			Name  string
+			Type  string
+			Value json.Number
+		}
+	}
+	b, err := json.Marshal(ks)
+	if err != nil {
+		t.Fatalf("%s MarshalJSON failed: %s", ks, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&jk); err != nil {
+		t.Fatalf("bad KStat JSON %s: %s", b, err)
+	}
+	if jk.Module != "unix" || jk.Type != "named" || len(jk.Stats) == 0 {
+		t.Fatalf("bad KStat JSON %s", b)
+	}
+
+	var jn struct {
+		Statistic string
+		Value     uint64
+	}
+	b, err = json.Marshal(n)
+	if err != nil {
+		t.Fatalf("%s MarshalJSON failed: %s", n, err)
+	}
+	if err = json.Unmarshal(b, &jn); err != nil || jn.Statistic != "clk_intr" || jn.Value != n.UintVal {
+		t.Fatalf("bad Named JSON %s: %v", b, err)
+	}
+	stop(t, tok)
+}
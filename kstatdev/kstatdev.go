@@ -0,0 +1,179 @@
+// Package kstatdev reads kstats by talking to the kernel's /dev/kstat
+// driver directly with ioctl(2), the way that libkstat itself does,
+// instead of going through libkstat with cgo. This lets kstat
+// collectors be built with CGO_ENABLED=0, for example to
+// cross-compile static binaries for illumos from another platform.
+//
+// kstatdev doesn't have the kstat package's Token and KStat API.
+// Instead a Dev produces kstat.Snapshots, which are what the kstat/*
+// packages (and most of the kstat package) work from. Both a Dev and
+// a kstat.Token are kstat.SnapshotSources, and OpenSource opens
+// whichever Backend you ask for, so code that works from Snapshots
+// can pick its backend when it opens kstats:
+//
+//	src, err := kstatdev.OpenSource(kstatdev.DevKstat)
+//	...
+//	snap, err := src.Snapshot(sels...)
+//	...
+//	rd, err := cpu.FromSnapshot(snap)
+//
+// When built without cgo, the kstat package still builds on Solaris,
+// but without Token, KStat, Sampler, and the other parts that need
+// libkstat, and OpenSource only supports DevKstat.
+//
+// Only amd64 is supported, since it's the only architecture that Go
+// supports on illumos and Solaris; the kernel structures here have
+// their 64-bit layouts.
+package kstatdev
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// kstatStrlen is KSTAT_STRLEN, the size of the name fields in a
+// kstat_t and a kstat_named_t.
+const kstatStrlen = 31
+
+// header is a kstat_t. It is both what the kernel gives us for each
+// kstat in the chain and what we hand to KSTAT_IOC_READ to read a
+// kstat's data. Pointers are uint64s and the padding that amd64
+// puts after Ndata is spelled out, so that this has the kernel's
+// 64-bit layout everywhere, including on 32-bit platforms.
+type header struct {
+	Crtime   int64
+	Next     uint64
+	Kid      int32
+	Module   [kstatStrlen]byte
+	Resv     uint8
+	Instance int32
+	Name     [kstatStrlen]byte
+	Type     uint8
+	Class    [kstatStrlen]byte
+	Flags    uint8
+	Data     uint64
+	Ndata    uint32
+	_        [4]byte
+	DataSize uint64
+	Snaptime int64
+	Update   uint64
+	Private  uint64
+	Snapshot uint64
+	Lock     uint64
+}
+
+// named is a kstat_named_t. Value is the union of the possible
+// values, which we pick apart by hand.
+type named struct {
+	Name  [kstatStrlen]byte
+	Type  uint8
+	Value [16]byte
+}
+
+// cstring returns the null-terminated string at the start of b, or
+// all of b if there is no null.
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// names is the Interner for kstat and statistic names.
+var names kstat.Interner
+
+// name is cstring for the name fields of kstats and statistics,
+// which are repeated endlessly and so are interned.
+func name(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			b = b[:i]
+			break
+		}
+	}
+	return names.Bytes(b)
+}
+
+func (h *header) info() kstat.KStatInfo {
+	return kstat.KStatInfo{
+		Module: name(h.Module[:]), Instance: int(h.Instance),
+		Name: name(h.Name[:]), Class: name(h.Class[:]),
+		Type: kstat.KSType(h.Type), Crtime: h.Crtime, Snaptime: h.Snaptime,
+	}
+}
+
+// headers copies n kstat_t's out of buf, which is the data of the
+// kernel's kstat_headers kstat.
+func headers(buf []byte, n int) ([]header, error) {
+	size := int(unsafe.Sizeof(header{}))
+	if n*size > len(buf) {
+		return nil, fmt.Errorf("kstat headers are %d bytes, not enough for %d kstats", len(buf), n)
+	}
+	hs := make([]header, n)
+	for i := range hs {
+		hs[i] = *(*header)(unsafe.Pointer(&buf[i*size]))
+	}
+	return hs, nil
+}
+
+// namedValues decodes the data of a named kstat, which is ndata
+// kstat_named_t's. String statistics point to where the kernel put
+// their strings in the data, which was at address base; we only
+// follow pointers that stay inside the data.
+func namedValues(ki kstat.KStatInfo, data []byte, ndata int, base uint64) ([]kstat.Value, error) {
+	size := int(unsafe.Sizeof(named{}))
+	if ndata*size > len(data) {
+		return nil, fmt.Errorf("%s data is %d bytes, not enough for %d statistics", ki, len(data), ndata)
+	}
+	vals := make([]kstat.Value, ndata)
+	for i := range vals {
+		n := (*named)(unsafe.Pointer(&data[i*size]))
+		v := kstat.Value{
+			Module: ki.Module, Instance: ki.Instance, Name: ki.Name, Class: ki.Class,
+			Stat: name(n.Name[:]), Type: kstat.NamedType(n.Type),
+			Crtime: ki.Crtime, Snaptime: ki.Snaptime,
+		}
+		le := binary.LittleEndian
+		switch v.Type {
+		case kstat.CharData:
+			v.StringVal = cstring(n.Value[:])
+		case kstat.Int32:
+			v.IntVal = int64(int32(le.Uint32(n.Value[:])))
+		case kstat.Int64:
+			v.IntVal = int64(le.Uint64(n.Value[:]))
+		case kstat.Uint32:
+			v.UintVal = uint64(le.Uint32(n.Value[:]))
+		case kstat.Uint64:
+			v.UintVal = le.Uint64(n.Value[:])
+		case kstat.String:
+			s, err := namedString(data, base, le.Uint64(n.Value[:]), le.Uint32(n.Value[8:]))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%s: %s", ki, v.Stat, err)
+			}
+			v.StringVal = s
+		default:
+			return nil, fmt.Errorf("%s:%s has unknown type %d", ki, v.Stat, v.Type)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// namedString returns the string of a String statistic, which is at
+// address ptr and is slen bytes long including its trailing null.
+func namedString(data []byte, base, ptr uint64, slen uint32) (string, error) {
+	if ptr == 0 || slen == 0 {
+		return "", nil
+	}
+	off := ptr - base
+	if ptr < base || off > uint64(len(data)) || uint64(slen) > uint64(len(data))-off {
+		return "", errors.New("string is outside of the kstat data")
+	}
+	return cstring(data[off : off+uint64(slen)]), nil
+}
@@ -0,0 +1,288 @@
+//
+// Reading kstats from /dev/kstat.
+
+package kstatdev
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/siebenmann/go-kstat"
+	"golang.org/x/sys/unix"
+)
+
+// The ioctls, from sys/kstat.h.
+const (
+	kstatIOCChainID = 'K'<<8 | 0x01
+	kstatIOCRead    = 'K'<<8 | 0x02
+)
+
+// sysIoctl is SYS_ioctl from sys/syscall.h, which is the same on
+// illumos and Solaris.
+const sysIoctl = 54
+
+// ErrChainChanged is returned when the kernel's list of kstats has
+// changed since the Dev last read it. Call Update and try again.
+var ErrChainChanged = errors.New("kstat chain has changed")
+
+// Dev is an open /dev/kstat and the kstats that existed as of when
+// it was opened or last updated. Like a kstat.Token, a Dev must only
+// be used by one goroutine at a time.
+type Dev struct {
+	fd    int
+	kid   int
+	chain []header
+
+	// hdr is what we hand to the kernel in KSTAT_IOC_READ, kept
+	// so that each read doesn't allocate a new one.
+	hdr *header
+}
+
+// Open opens /dev/kstat and reads the list of kstats. You should
+// call Close when you're done with the Dev.
+func Open() (*Dev, error) {
+	fd, err := unix.Open("/dev/kstat", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dev{fd: fd, kid: -1, hdr: new(header)}
+	if _, err := d.Update(); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the Dev.
+func (d *Dev) Close() error {
+	if d == nil || d.fd < 0 {
+		return nil
+	}
+	err := unix.Close(d.fd)
+	d.fd = -1
+	d.chain = nil
+	return err
+}
+
+// ioctl is ioctl(2) with a pointer argument, returning the ioctl's
+// result. The pointer only becomes a uintptr in the Syscall call
+// expression, which keeps what it points to alive and in place until
+// the call returns.
+func ioctl(fd int, req int, arg unsafe.Pointer) (int, error) {
+	r, _, errno := syscall.Syscall(sysIoctl, uintptr(fd), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+// read does KSTAT_IOC_READ for the kstat described by h, growing our
+// buffer if the kernel says that it's too small. It returns the
+// kernel's updated copy of the header, the kstat's data, and the
+// kstat chain ID, as libkstat's kstat_read() does.
+func (d *Dev) read(h *header) (header, []byte, int, error) {
+	if d.fd < 0 {
+		return header{}, nil, 0, errors.New("Dev is closed")
+	}
+	size := h.DataSize
+	if size == 0 {
+		size = 4096
+	}
+	for {
+		buf := make([]byte, size)
+		*d.hdr = *h
+		d.hdr.Data = uint64(uintptr(unsafe.Pointer(&buf[0])))
+		d.hdr.DataSize = size
+		kid, err := ioctl(d.fd, kstatIOCRead, unsafe.Pointer(d.hdr))
+		runtime.KeepAlive(buf)
+		switch err {
+		case nil:
+			nh := *d.hdr
+			if nh.DataSize > size {
+				nh.DataSize = size
+			}
+			return nh, buf[:nh.DataSize], kid, nil
+		case unix.EAGAIN:
+			continue
+		case unix.ENOMEM:
+			// The kernel tells us how much it needs, but
+			// make sure we make progress regardless.
+			if d.hdr.DataSize > size {
+				size = d.hdr.DataSize
+			} else {
+				size *= 2
+			}
+			continue
+		}
+		return header{}, nil, 0, err
+	}
+}
+
+// Update rereads the list of kstats if it has changed in the kernel,
+// returning true if it did. Like kstat.Token.Update, this is how you
+// see kstats that have come and gone.
+func (d *Dev) Update() (bool, error) {
+	if d.fd < 0 {
+		return false, errors.New("Dev is closed")
+	}
+	kid, err := unix.IoctlSetIntRetInt(d.fd, kstatIOCChainID, 0)
+	if err != nil {
+		return false, err
+	}
+	if kid == d.kid {
+		return false, nil
+	}
+	// kstat 0 is the kernel's kstat_headers kstat, whose data is
+	// the kstat_t of every kstat.
+	h, buf, kid, err := d.read(&header{})
+	if err != nil {
+		return false, err
+	}
+	chain, err := headers(buf, int(h.Ndata))
+	if err != nil {
+		return false, err
+	}
+	sort.Slice(chain, func(i, j int) bool {
+		a, b := &chain[i], &chain[j]
+		if a.Module != b.Module {
+			return cstring(a.Module[:]) < cstring(b.Module[:])
+		}
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return cstring(a.Name[:]) < cstring(b.Name[:])
+	})
+	d.chain = chain
+	d.kid = kid
+	return true, nil
+}
+
+// Backend is a way of reading kstats, for OpenSource.
+type Backend int
+
+const (
+	// Libkstat reads kstats through libkstat, as a kstat.Token.
+	// It needs the kstat package to be built with cgo.
+	Libkstat Backend = iota
+	// DevKstat reads kstats from /dev/kstat, as a Dev.
+	DevKstat
+)
+
+// OpenSource opens b as a kstat.SnapshotSource, so that the choice
+// of backend can be made when kstats are opened (for example from a
+// command line flag) and the rest of the code doesn't care.
+func OpenSource(b Backend) (kstat.SnapshotSource, error) {
+	switch b {
+	case Libkstat:
+		return openToken()
+	case DevKstat:
+		d, err := Open()
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("unknown kstatdev Backend %d", b)
+}
+
+// All returns the identifying information of all kstats, in the
+// same sorted order as kstat.Token.AllSorted.
+func (d *Dev) All() []kstat.KStatInfo {
+	ks := make([]kstat.KStatInfo, len(d.chain))
+	for i := range d.chain {
+		ks[i] = d.chain[i].info()
+	}
+	return ks
+}
+
+// Snapshot reads all kstats that match at least one of the selectors
+// and copies them and their selected statistics into a new Snapshot,
+// just as kstat.Token.Snapshot does. With no selectors, it takes a
+// Snapshot of everything. As with kstat.Token.Snapshot, kstats that
+// can't be read are left out of the Snapshot and returned as a
+// kstat.KStatErrors along with it. It fails with ErrChainChanged if
+// kstats have come or gone since the last Update.
+func (d *Dev) Snapshot(sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	if len(sels) == 0 {
+		sels = []kstat.Selector{{Instance: -1}}
+	}
+	ms := make([]*kstat.Matcher, len(sels))
+	for i, sel := range sels {
+		ms[i] = sel.Compile()
+	}
+	snap := &kstat.Snapshot{Time: time.Now()}
+	var errs kstat.KStatErrors
+	for i := range d.chain {
+		h := &d.chain[i]
+		var ksels []*kstat.Matcher
+		for _, sel := range ms {
+			if sel.MatchKStat(cstring(h.Module[:]), int(h.Instance), cstring(h.Name[:])) {
+				ksels = append(ksels, sel)
+			}
+		}
+		if len(ksels) == 0 {
+			continue
+		}
+		nh, data, kid, err := d.read(h)
+		switch {
+		case err == unix.ENXIO:
+			// The kstat is gone.
+			return nil, ErrChainChanged
+		case d.fd < 0:
+			// The Dev is closed, so nothing else will read.
+			return nil, err
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", h.info(), err))
+			continue
+		case kid != d.kid:
+			return nil, ErrChainChanged
+		}
+		// Remember the size so that next time we get it right.
+		h.DataSize = nh.DataSize
+		ki := nh.info()
+		vals, err := values(ki, &nh, data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		snap.KStats = append(snap.KStats, ki)
+		for _, v := range vals {
+			for _, sel := range ksels {
+				if sel.MatchStat(v.Stat) {
+					snap.Values = append(snap.Values, v)
+					break
+				}
+			}
+		}
+	}
+	if errs != nil {
+		return snap, errs
+	}
+	return snap, nil
+}
+
+// values decodes the data of a kstat into Values, the same way that
+// kstat.KStat.Values does.
+func values(ki kstat.KStatInfo, h *header, data []byte) ([]kstat.Value, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	switch ki.Type {
+	case kstat.NamedStat:
+		return namedValues(ki, data, int(h.Ndata), uint64(uintptr(unsafe.Pointer(&data[0]))))
+	case kstat.IoStat:
+		if len(data) < int(unsafe.Sizeof(kstat.IO{})) {
+			return nil, fmt.Errorf("%s is too small to be an IO kstat", ki)
+		}
+		io := *(*kstat.IO)(unsafe.Pointer(&data[0]))
+		return ki.IOValues(&io), nil
+	case kstat.RawStat:
+		return ki.RawValues(data)
+	}
+	return nil, nil
+}
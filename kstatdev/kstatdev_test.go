@@ -0,0 +1,108 @@
+//
+// Test decoding the kernel's kstat structures. These tests are inside
+// the package because the decoding isn't exported.
+
+package kstatdev
+
+import (
+	"encoding/binary"
+	"testing"
+	"unsafe"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// These are the amd64 sizes of kstat_t and kstat_named_t, which the
+// structures must have on every GOARCH.
+func TestStructSizes(t *testing.T) {
+	if sz := unsafe.Sizeof(header{}); sz != 184 {
+		t.Fatalf("header is %d bytes, not 184", sz)
+	}
+	if sz := unsafe.Offsetof(header{}.Data); sz != 120 {
+		t.Fatalf("header.Data is at %d, not 120", sz)
+	}
+	if sz := unsafe.Sizeof(named{}); sz != 48 {
+		t.Fatalf("named is %d bytes, not 48", sz)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	var hs [2]header
+	copy(hs[0].Module[:], "cpu")
+	copy(hs[0].Name[:], "sys")
+	copy(hs[0].Class[:], "misc")
+	hs[0].Instance = 3
+	hs[0].Type = uint8(kstat.NamedStat)
+	copy(hs[1].Module[:], "sd")
+	copy(hs[1].Name[:], "sd0")
+	hs[1].Type = uint8(kstat.IoStat)
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&hs[0])), unsafe.Sizeof(hs))
+
+	got, err := headers(buf, 2)
+	if err != nil {
+		t.Fatalf("headers failed: %s", err)
+	}
+	ki := got[0].info()
+	if ki.Module != "cpu" || ki.Instance != 3 || ki.Name != "sys" || ki.Class != "misc" || ki.Type != kstat.NamedStat {
+		t.Errorf("wrong first header: %+v", ki)
+	}
+	if ki := got[1].info(); ki.Module != "sd" || ki.Name != "sd0" || ki.Type != kstat.IoStat {
+		t.Errorf("wrong second header: %+v", ki)
+	}
+	if _, err := headers(buf, 3); err == nil {
+		t.Errorf("headers with too little data succeeded")
+	}
+}
+
+func TestNamedValues(t *testing.T) {
+	const n = 4
+	size := int(unsafe.Sizeof(named{}))
+	data := make([]byte, n*size+8)
+	le := binary.LittleEndian
+	set := func(i int, name string, tp kstat.NamedType) []byte {
+		nm := (*named)(unsafe.Pointer(&data[i*size]))
+		copy(nm.Name[:], name)
+		nm.Type = uint8(tp)
+		return nm.Value[:]
+	}
+	le.PutUint32(set(0, "ncpus", kstat.Uint32), 8)
+	le.PutUint64(set(1, "delta", kstat.Int64), uint64(1<<64-5))
+	copy(set(2, "brand", kstat.CharData), "i86pc")
+	// The string is put after the kstat_named_t's, as the kernel does.
+	const base = 0x10000
+	copy(data[n*size:], "zone1\x00")
+	v := set(3, "zonename", kstat.String)
+	le.PutUint64(v, base+uint64(n*size))
+	le.PutUint32(v[8:], 6)
+
+	ki := kstat.KStatInfo{Module: "unix", Name: "system_misc", Type: kstat.NamedStat, Snaptime: 7}
+	vals, err := namedValues(ki, data, n, base)
+	if err != nil {
+		t.Fatalf("namedValues failed: %s", err)
+	}
+	if len(vals) != n {
+		t.Fatalf("namedValues gave %d Values, not %d", len(vals), n)
+	}
+	if v := vals[0]; v.Stat != "ncpus" || v.Type != kstat.Uint32 || v.UintVal != 8 || v.Snaptime != 7 {
+		t.Errorf("wrong ncpus: %+v", v)
+	}
+	if v := vals[1]; v.Stat != "delta" || v.IntVal != -5 {
+		t.Errorf("wrong delta: %+v", v)
+	}
+	if v := vals[2]; v.Stat != "brand" || v.StringVal != "i86pc" {
+		t.Errorf("wrong brand: %+v", v)
+	}
+	if v := vals[3]; v.Stat != "zonename" || v.StringVal != "zone1" {
+		t.Errorf("wrong zonename: %+v", v)
+	}
+
+	// A string pointing outside of the data is an error, not a
+	// wild read.
+	le.PutUint64(v, base+uint64(len(data)))
+	if _, err := namedValues(ki, data, n, base); err == nil {
+		t.Errorf("namedValues with a bad string pointer succeeded")
+	}
+	if _, err := namedValues(ki, data[:size], n, base); err == nil {
+		t.Errorf("namedValues with too little data succeeded")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build cgo
+// +build cgo
+
+//
+// The libkstat backend for OpenSource, when there is one.
+
+package kstatdev
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+func openToken() (kstat.SnapshotSource, error) {
+	tok, err := kstat.Open()
+	if err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
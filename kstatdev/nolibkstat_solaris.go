@@ -0,0 +1,18 @@
+//go:build !cgo
+// +build !cgo
+
+//
+// Without cgo, the kstat package has no Token, so OpenSource can
+// only use /dev/kstat.
+
+package kstatdev
+
+import (
+	"errors"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func openToken() (kstat.SnapshotSource, error) {
+	return nil, errors.New("kstat package built without cgo, so only DevKstat is available")
+}
@@ -0,0 +1,363 @@
+// Package kstatpb encodes kstat Snapshots and Samples as protocol
+// buffers, in the schema in kstat.proto, so that non-Go consumers
+// and long-term archives have a stable, compact, versioned format.
+//
+// The encoding is done directly on the kstat package's types with
+// the low-level protowire package, so there is no generated code.
+// Decoding skips fields it doesn't know about, as protocol buffer
+// decoders should, which lets the schema grow compatibly.
+package kstatpb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Version is the schema version written in Snapshots.
+const Version = 1
+
+// Field numbers, from kstat.proto.
+const (
+	statName        = 1
+	statType        = 2
+	statStringValue = 3
+	statIntValue    = 4
+	statUintValue   = 5
+
+	ksModule   = 1
+	ksInstance = 2
+	ksName     = 3
+	ksClass    = 4
+	ksType     = 5
+	ksCrtime   = 6
+	ksSnaptime = 7
+	ksStats    = 8
+
+	snapVersion = 1
+	snapTime    = 2
+	snapKStats  = 3
+
+	derivedName  = 1
+	derivedValue = 2
+
+	sampleSnapshot = 1
+	sampleErrors   = 2
+	sampleDerived  = 3
+)
+
+// MarshalSnapshot encodes a Snapshot as a Snapshot message.
+func MarshalSnapshot(snap *kstat.Snapshot) ([]byte, error) {
+	return appendSnapshot(nil, snap)
+}
+
+// MarshalSample encodes a Sample as a Sample message.
+func MarshalSample(sm *kstat.Sample) ([]byte, error) {
+	snap, err := appendSnapshot(nil, &sm.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	b := appendBytes(nil, sampleSnapshot, snap)
+	for _, e := range sm.Errors {
+		b = appendString(b, sampleErrors, e.Error())
+	}
+	for _, d := range sm.Derived {
+		var db []byte
+		db = appendString(db, derivedName, d.Name)
+		if d.Value != 0 {
+			db = protowire.AppendTag(db, derivedValue, protowire.Fixed64Type)
+			db = protowire.AppendFixed64(db, math.Float64bits(d.Value))
+		}
+		b = appendBytes(b, sampleDerived, db)
+	}
+	return b, nil
+}
+
+// group is a kstat and its Values.
+type group struct {
+	info kstat.KStatInfo
+	vals []kstat.Value
+}
+
+// groups groups a Snapshot's Values under their kstats, the same
+// way as the JSON form does. Values without a KStatInfo get one made
+// up for them.
+func groups(snap *kstat.Snapshot) []*group {
+	type key struct {
+		module           string
+		instance         int
+		name             string
+		crtime, snaptime int64
+	}
+	var grps []*group
+	idx := make(map[key]*group)
+	for _, ki := range snap.KStats {
+		g := &group{info: ki}
+		idx[key{ki.Module, ki.Instance, ki.Name, ki.Crtime, ki.Snaptime}] = g
+		grps = append(grps, g)
+	}
+	for _, v := range snap.Values {
+		k := key{v.Module, v.Instance, v.Name, v.Crtime, v.Snaptime}
+		g := idx[k]
+		if g == nil {
+			g = &group{info: kstat.KStatInfo{
+				Module: v.Module, Instance: v.Instance, Name: v.Name,
+				Class: v.Class, Type: kstat.NamedStat,
+				Crtime: v.Crtime, Snaptime: v.Snaptime,
+			}}
+			idx[k] = g
+			grps = append(grps, g)
+		}
+		g.vals = append(g.vals, v)
+	}
+	return grps
+}
+
+func appendSnapshot(b []byte, snap *kstat.Snapshot) ([]byte, error) {
+	b = appendVarint(b, snapVersion, Version)
+	if !snap.Time.IsZero() {
+		b = appendVarint(b, snapTime, uint64(snap.Time.UnixNano()))
+	}
+	for _, g := range groups(snap) {
+		var kb []byte
+		kb = appendString(kb, ksModule, g.info.Module)
+		kb = appendVarint(kb, ksInstance, uint64(int64(g.info.Instance)))
+		kb = appendString(kb, ksName, g.info.Name)
+		kb = appendString(kb, ksClass, g.info.Class)
+		kb = appendVarint(kb, ksType, uint64(g.info.Type))
+		kb = appendVarint(kb, ksCrtime, uint64(g.info.Crtime))
+		kb = appendVarint(kb, ksSnaptime, uint64(g.info.Snaptime))
+		for _, v := range g.vals {
+			var sb []byte
+			sb = appendString(sb, statName, v.Stat)
+			sb = appendVarint(sb, statType, uint64(v.Type))
+			// Oneof fields are always written, even if they're
+			// zero, because their presence is what says which
+			// one is set.
+			switch v.Type {
+			case kstat.CharData, kstat.String:
+				sb = protowire.AppendTag(sb, statStringValue, protowire.BytesType)
+				sb = protowire.AppendString(sb, v.StringVal)
+			case kstat.Int32, kstat.Int64:
+				sb = protowire.AppendTag(sb, statIntValue, protowire.VarintType)
+				sb = protowire.AppendVarint(sb, uint64(v.IntVal))
+			case kstat.Uint32, kstat.Uint64:
+				sb = protowire.AppendTag(sb, statUintValue, protowire.VarintType)
+				sb = protowire.AppendVarint(sb, v.UintVal)
+			default:
+				return nil, fmt.Errorf("%s has unknown type %s", v, v.Type)
+			}
+			kb = appendBytes(kb, ksStats, sb)
+		}
+		b = appendBytes(b, snapKStats, kb)
+	}
+	return b, nil
+}
+
+// The append functions leave out zero values, as proto3 does.
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// field is a decoded field. Only the value for its type is set.
+type field struct {
+	num protowire.Number
+	typ protowire.Type
+	v   uint64
+	b   []byte
+}
+
+var errBadMessage = errors.New("kstatpb: bad protocol buffer message")
+
+// fields decodes all of the fields in a message, calling fn for each
+// varint, fixed64, and length-delimited one. Other fields are
+// skipped.
+func fields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errBadMessage
+		}
+		b = b[n:]
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.b, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errBadMessage
+		}
+		b = b[n:]
+		if typ != protowire.VarintType && typ != protowire.Fixed64Type && typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalSnapshot decodes a Snapshot message. The Snapshot's Time
+// is in the local time zone.
+func UnmarshalSnapshot(b []byte) (*kstat.Snapshot, error) {
+	snap := &kstat.Snapshot{}
+	var version uint64
+	err := fields(b, func(f field) error {
+		switch {
+		case f.num == snapVersion && f.typ == protowire.VarintType:
+			version = f.v
+		case f.num == snapTime && f.typ == protowire.VarintType:
+			snap.Time = time.Unix(0, int64(f.v))
+		case f.num == snapKStats && f.typ == protowire.BytesType:
+			return unmarshalKStat(f.b, snap)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if version != Version {
+		return nil, fmt.Errorf("kstatpb: unsupported Snapshot version %d", version)
+	}
+	return snap, nil
+}
+
+func unmarshalKStat(b []byte, snap *kstat.Snapshot) error {
+	var ki kstat.KStatInfo
+	var stats [][]byte
+	err := fields(b, func(f field) error {
+		switch {
+		case f.typ == protowire.BytesType && f.num == ksModule:
+			ki.Module = string(f.b)
+		case f.typ == protowire.BytesType && f.num == ksName:
+			ki.Name = string(f.b)
+		case f.typ == protowire.BytesType && f.num == ksClass:
+			ki.Class = string(f.b)
+		case f.typ == protowire.BytesType && f.num == ksStats:
+			stats = append(stats, f.b)
+		case f.typ == protowire.VarintType && f.num == ksInstance:
+			ki.Instance = int(int32(f.v))
+		case f.typ == protowire.VarintType && f.num == ksType:
+			ki.Type = kstat.KSType(f.v)
+		case f.typ == protowire.VarintType && f.num == ksCrtime:
+			ki.Crtime = int64(f.v)
+		case f.typ == protowire.VarintType && f.num == ksSnaptime:
+			ki.Snaptime = int64(f.v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	snap.KStats = append(snap.KStats, ki)
+
+	// The stats are decoded after the kstat's fields, since they
+	// need all of them and fields can come in any order.
+	for _, sb := range stats {
+		v := kstat.Value{
+			Module: ki.Module, Instance: ki.Instance, Name: ki.Name, Class: ki.Class,
+			Crtime: ki.Crtime, Snaptime: ki.Snaptime,
+		}
+		set := false
+		err = fields(sb, func(f field) error {
+			switch {
+			case f.typ == protowire.BytesType && f.num == statName:
+				v.Stat = string(f.b)
+			case f.typ == protowire.VarintType && f.num == statType:
+				v.Type = kstat.NamedType(f.v)
+			case f.typ == protowire.BytesType && f.num == statStringValue:
+				v.StringVal, set = string(f.b), true
+			case f.typ == protowire.VarintType && f.num == statIntValue:
+				v.IntVal, set = int64(f.v), true
+			case f.typ == protowire.VarintType && f.num == statUintValue:
+				v.UintVal, set = f.v, true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		switch v.Type {
+		case kstat.CharData, kstat.String, kstat.Int32, kstat.Int64, kstat.Uint32, kstat.Uint64:
+		default:
+			return fmt.Errorf("kstatpb: %s has unknown type %s", v, v.Type)
+		}
+		if !set {
+			return fmt.Errorf("kstatpb: %s has no value", v)
+		}
+		snap.Values = append(snap.Values, v)
+	}
+	return nil
+}
+
+// UnmarshalSample decodes a Sample message. The Sample's Errors are
+// plain errors with the original error text.
+func UnmarshalSample(b []byte) (*kstat.Sample, error) {
+	sm := &kstat.Sample{}
+	var snapb []byte
+	err := fields(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case sampleSnapshot:
+			snapb = f.b
+		case sampleErrors:
+			sm.Errors = append(sm.Errors, errors.New(string(f.b)))
+		case sampleDerived:
+			var d kstat.Derived
+			err := fields(f.b, func(f field) error {
+				switch {
+				case f.typ == protowire.BytesType && f.num == derivedName:
+					d.Name = string(f.b)
+				case f.typ == protowire.Fixed64Type && f.num == derivedValue:
+					d.Value = math.Float64frombits(f.v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			sm.Derived = append(sm.Derived, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	snap, err := UnmarshalSnapshot(snapb)
+	if err != nil {
+		return nil, err
+	}
+	sm.Snapshot = *snap
+	return sm, nil
+}
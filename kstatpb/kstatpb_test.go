@@ -0,0 +1,115 @@
+//
+// Test the protobuf codec for Snapshots and Samples.
+
+package kstatpb_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstatpb"
+	"github.com/siebenmann/go-kstat/kstattest"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testSnapshot() *kstat.Snapshot {
+	sys := kstat.KStatInfo{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: 100, Snaptime: 2000}
+	info := kstat.KStatInfo{Module: "cpu_info", Instance: 3, Name: "cpu_info3", Class: "misc", Type: kstat.NamedStat, Crtime: 150, Snaptime: 2100}
+	snap := &kstat.Snapshot{Time: time.Date(2015, 8, 28, 10, 0, 0, 123456789, time.Local)}
+	kstattest.AddValues(snap, sys,
+		kstat.Value{Stat: "syscall", Type: kstat.Uint64, UintVal: 1<<64 - 1},
+		kstat.Value{Stat: "delta", Type: kstat.Int64, IntVal: -5},
+		kstat.Value{Stat: "zero", Type: kstat.Uint32})
+	kstattest.AddValues(snap, info,
+		kstat.Value{Stat: "state", Type: kstat.CharData, StringVal: "on-line"},
+		kstattest.String("brand", "Intel(r) Xeon(r)"))
+	return snap
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	snap := testSnapshot()
+	b, err := kstatpb.MarshalSnapshot(snap)
+	if err != nil {
+		t.Fatalf("MarshalSnapshot failed: %s", err)
+	}
+	got, err := kstatpb.UnmarshalSnapshot(b)
+	if err != nil {
+		t.Fatalf("UnmarshalSnapshot failed: %s", err)
+	}
+	if !got.Time.Equal(snap.Time) {
+		t.Errorf("wrong Time: %s", got.Time)
+	}
+	got.Time = snap.Time
+	if !reflect.DeepEqual(got, snap) {
+		t.Fatalf("round trip changed the Snapshot:\n%+v\n%+v", got, snap)
+	}
+}
+
+func TestSampleRoundTrip(t *testing.T) {
+	sm := &kstat.Sample{
+		Snapshot: *testSnapshot(),
+		Errors:   []error{errors.New("cpu:1:sys: no such kstat")},
+		Derived:  []kstat.Derived{{Name: "util", Value: 12.5}, {Name: "idle"}},
+	}
+	b, err := kstatpb.MarshalSample(sm)
+	if err != nil {
+		t.Fatalf("MarshalSample failed: %s", err)
+	}
+	got, err := kstatpb.UnmarshalSample(b)
+	if err != nil {
+		t.Fatalf("UnmarshalSample failed: %s", err)
+	}
+	if len(got.Errors) != 1 || got.Errors[0].Error() != sm.Errors[0].Error() {
+		t.Errorf("wrong Errors: %v", got.Errors)
+	}
+	if !reflect.DeepEqual(got.Derived, sm.Derived) {
+		t.Errorf("wrong Derived: %+v", got.Derived)
+	}
+	if !reflect.DeepEqual(got.Values, sm.Values) {
+		t.Errorf("wrong Values: %+v", got.Values)
+	}
+}
+
+// Values without a matching KStatInfo still survive, and a zero Time
+// stays zero.
+func TestValuesOnly(t *testing.T) {
+	snap := testSnapshot()
+	snap.KStats = nil
+	snap.Time = time.Time{}
+	b, err := kstatpb.MarshalSnapshot(snap)
+	if err != nil {
+		t.Fatalf("MarshalSnapshot failed: %s", err)
+	}
+	got, err := kstatpb.UnmarshalSnapshot(b)
+	if err != nil {
+		t.Fatalf("UnmarshalSnapshot failed: %s", err)
+	}
+	if !got.Time.IsZero() || !reflect.DeepEqual(got.Values, snap.Values) || len(got.KStats) != 2 {
+		t.Fatalf("wrong Snapshot: %+v", got)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	b, _ := kstatpb.MarshalSnapshot(testSnapshot())
+	// Unknown fields are skipped.
+	ok := protowire.AppendTag(append([]byte(nil), b...), 100, protowire.BytesType)
+	ok = protowire.AppendString(ok, "from the future")
+	if _, err := kstatpb.UnmarshalSnapshot(ok); err != nil {
+		t.Errorf("unknown field not skipped: %s", err)
+	}
+
+	bad := protowire.AppendTag(append([]byte(nil), b...), 1, protowire.VarintType)
+	bad = protowire.AppendVarint(bad, 2)
+	if _, err := kstatpb.UnmarshalSnapshot(bad); err == nil {
+		t.Errorf("version 2 accepted")
+	}
+	if _, err := kstatpb.UnmarshalSnapshot(nil); err == nil {
+		t.Errorf("missing version accepted")
+	}
+	if _, err := kstatpb.UnmarshalSnapshot(b[:len(b)-1]); err == nil {
+		t.Errorf("truncated message accepted")
+	}
+}
@@ -0,0 +1,72 @@
+//
+// The client side of the kstat.KStat service.
+
+package kstatrpc
+
+import (
+	"context"
+
+	"github.com/siebenmann/go-kstat"
+	"google.golang.org/grpc"
+)
+
+// Client is a Source that gets kstats from a remote kstat.KStat
+// service.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient creates a Client that uses cc, which is normally a
+// *grpc.ClientConn.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) call(ctx context.Context, method string, req, resp interface{}) error {
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, grpc.CallContentSubtype(codecName))
+}
+
+// All returns the identifying information of all of the remote
+// kstats.
+func (c *Client) All(ctx context.Context) ([]kstat.KStatInfo, error) {
+	var resp AllResponse
+	if err := c.call(ctx, "All", &AllRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.KStats, nil
+}
+
+// Lookup returns a remote kstat and its Values.
+func (c *Client) Lookup(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	return c.lookup(ctx, "Lookup", module, instance, name)
+}
+
+// Refresh returns a remote kstat and its Values, freshly read.
+func (c *Client) Refresh(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	return c.lookup(ctx, "Refresh", module, instance, name)
+}
+
+func (c *Client) lookup(ctx context.Context, method, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	var resp LookupResponse
+	err := c.call(ctx, method, &LookupRequest{Module: module, Instance: instance, Name: name}, &resp)
+	if err != nil {
+		return kstat.KStatInfo{}, nil, err
+	}
+	return resp.KStat, resp.Values, nil
+}
+
+// Sample takes a Snapshot of the remote kstats matching the selectors.
+func (c *Client) Sample(ctx context.Context, sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	req := &SampleRequest{}
+	for _, sel := range sels {
+		req.Selectors = append(req.Selectors, sel.String())
+	}
+	var resp SampleResponse
+	if err := c.call(ctx, "Sample", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Snapshot == nil {
+		return &kstat.Snapshot{}, nil
+	}
+	return resp.Snapshot, nil
+}
@@ -0,0 +1,157 @@
+// Package kstatrpc serves kstats over gRPC and provides a client for
+// them, so that a central collector can pull kstats from many hosts
+// without running libkstat itself (or even running on Solaris).
+//
+// The service is kstat.KStat, with the unary methods All, Lookup,
+// Refresh, and Sample. Its messages are the Go types in this package
+// encoded as JSON (with the gRPC content subtype "kstat-json"), so it
+// doesn't need generated protobuf code; Snapshots and Values use the
+// kstat package's JSON forms. Both the server and the Client work in
+// terms of the Source interface, which a Client also implements.
+//
+// On a Solaris host, serving kstats looks like:
+//
+//	tok, err := kstat.Open()
+//	...
+//	gs := grpc.NewServer()
+//	kstatrpc.Register(gs, kstatrpc.TokenSource(tok))
+//	lis, err := net.Listen("tcp", ":7420")
+//	...
+//	gs.Serve(lis)
+//
+// and the collector does:
+//
+//	conn, err := grpc.NewClient("host:7420", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	...
+//	snap, err := kstatrpc.NewClient(conn).Sample(ctx, sels...)
+package kstatrpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/siebenmann/go-kstat"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Source is something that kstats can be gotten from, either a local
+// Token (through TokenSource) or a remote one (through a Client).
+type Source interface {
+	// All returns the identifying information of all kstats.
+	All(ctx context.Context) ([]kstat.KStatInfo, error)
+	// Lookup returns a kstat and its Values without refreshing
+	// its data (except to load it for the first time).
+	Lookup(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error)
+	// Refresh is Lookup with freshly read data.
+	Refresh(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error)
+	// Sample takes a Snapshot of the kstats matching the
+	// selectors, or all kstats if there are none. Kstats that
+	// can't be read are left out of it.
+	Sample(ctx context.Context, sels ...kstat.Selector) (*kstat.Snapshot, error)
+}
+
+// AllRequest is the request message for All.
+type AllRequest struct{}
+
+// AllResponse is the response message for All.
+type AllResponse struct {
+	KStats []kstat.KStatInfo
+}
+
+// LookupRequest is the request message for Lookup and Refresh.
+type LookupRequest struct {
+	Module   string
+	Instance int
+	Name     string
+}
+
+// LookupResponse is the response message for Lookup and Refresh.
+type LookupResponse struct {
+	KStat  kstat.KStatInfo
+	Values []kstat.Value
+}
+
+// SampleRequest is the request message for Sample. Selectors are in
+// the form that kstat.ParseSelector accepts.
+type SampleRequest struct {
+	Selectors []string
+}
+
+// SampleResponse is the response message for Sample.
+type SampleResponse struct {
+	Snapshot *kstat.Snapshot
+}
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "kstat.KStat"
+
+// codecName is the gRPC content subtype of our JSON codec.
+const codecName = "kstat-json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return codecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// Register registers a kstat.KStat service that serves src on a
+// gRPC server. The server needs no special options, so the service
+// can share a server with others.
+func Register(gs *grpc.Server, src Source) {
+	gs.RegisterService(&serviceDesc, src)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Source)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "All", Handler: unary("All", func(ctx context.Context, src Source, req *AllRequest) (interface{}, error) {
+			ks, err := src.All(ctx)
+			return &AllResponse{KStats: ks}, err
+		})},
+		{MethodName: "Lookup", Handler: unary("Lookup", func(ctx context.Context, src Source, req *LookupRequest) (interface{}, error) {
+			ki, vals, err := src.Lookup(ctx, req.Module, req.Instance, req.Name)
+			return &LookupResponse{KStat: ki, Values: vals}, err
+		})},
+		{MethodName: "Refresh", Handler: unary("Refresh", func(ctx context.Context, src Source, req *LookupRequest) (interface{}, error) {
+			ki, vals, err := src.Refresh(ctx, req.Module, req.Instance, req.Name)
+			return &LookupResponse{KStat: ki, Values: vals}, err
+		})},
+		{MethodName: "Sample", Handler: unary("Sample", func(ctx context.Context, src Source, req *SampleRequest) (interface{}, error) {
+			sels, err := kstat.ParseSelectors(req.Selectors)
+			if err != nil {
+				return nil, err
+			}
+			snap, err := src.Sample(ctx, sels...)
+			return &SampleResponse{Snapshot: snap}, err
+		})},
+	},
+}
+
+// unary turns a function into a gRPC method handler, which is what
+// protoc would generate for each method.
+func unary[Req any](method string, fn func(context.Context, Source, *Req) (interface{}, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		h := func(ctx context.Context, req interface{}) (interface{}, error) {
+			resp, err := fn(ctx, srv.(Source), req.(*Req))
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		if interceptor == nil {
+			return h(ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, req, info, h)
+	}
+}
@@ -0,0 +1,88 @@
+//
+// Test the gRPC service, using a fake Source.
+
+package kstatrpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstatrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var cpu = kstat.KStatInfo{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: 100, Snaptime: 2000}
+
+var syscall = kstat.Value{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Stat: "syscall", Type: kstat.Uint64, UintVal: 1234, Crtime: 100, Snaptime: 2000}
+
+type fakeSource struct {
+	refreshes int
+}
+
+func (f *fakeSource) All(ctx context.Context) ([]kstat.KStatInfo, error) {
+	return []kstat.KStatInfo{cpu}, nil
+}
+
+func (f *fakeSource) Lookup(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	if module != "cpu" || instance != 0 || name != "sys" {
+		return kstat.KStatInfo{}, nil, errors.New("no such kstat")
+	}
+	return cpu, []kstat.Value{syscall}, nil
+}
+
+func (f *fakeSource) Refresh(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	f.refreshes++
+	return f.Lookup(ctx, module, instance, name)
+}
+
+func (f *fakeSource) Sample(ctx context.Context, sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	snap := &kstat.Snapshot{KStats: []kstat.KStatInfo{cpu}, Values: []kstat.Value{syscall}}
+	return snap.Select(sels...), nil
+}
+
+func TestService(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	src := &fakeSource{}
+	kstatrpc.Register(gs, src)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %s", err)
+	}
+	defer conn.Close()
+	var c kstatrpc.Source = kstatrpc.NewClient(conn)
+	ctx := context.Background()
+
+	ks, err := c.All(ctx)
+	if err != nil || !reflect.DeepEqual(ks, []kstat.KStatInfo{cpu}) {
+		t.Fatalf("All gave %+v %v", ks, err)
+	}
+	ki, vals, err := c.Refresh(ctx, "cpu", 0, "sys")
+	if err != nil || ki != cpu || !reflect.DeepEqual(vals, []kstat.Value{syscall}) || src.refreshes != 1 {
+		t.Fatalf("Refresh gave %+v %+v %v", ki, vals, err)
+	}
+	if _, _, err = c.Lookup(ctx, "cpu", 1, "sys"); err == nil {
+		t.Fatalf("Lookup of a missing kstat did not fail")
+	}
+
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	snap, err := c.Sample(ctx, sel)
+	if err != nil || len(snap.Values) != 1 || snap.Values[0] != syscall {
+		t.Fatalf("Sample gave %+v %v", snap, err)
+	}
+	sel.Stat = "intr"
+	if snap, err = c.Sample(ctx, sel); err != nil || len(snap.Values) != 0 {
+		t.Fatalf("Sample did not pass on selectors: %+v %v", snap, err)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build cgo
+// +build cgo
+
+//
+// Serving kstats from a local Token.
+
+package kstatrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+type tokenSource struct {
+	mu  sync.Mutex
+	tok *kstat.Token
+}
+
+// TokenSource returns a Source that gets kstats from tok. The Source
+// serializes its use of tok (since a gRPC server handles requests
+// concurrently), so nothing else may use tok.
+func TokenSource(tok *kstat.Token) Source {
+	return &tokenSource{tok: tok}
+}
+
+func info(k *kstat.KStat) kstat.KStatInfo {
+	return kstat.KStatInfo{
+		Module: k.Module, Instance: k.Instance, Name: k.Name, Class: k.Class,
+		Type: k.Type, Crtime: k.Crtime, Snaptime: k.Snaptime,
+	}
+}
+
+func (ts *tokenSource) All(ctx context.Context) ([]kstat.KStatInfo, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if err := ts.update(); err != nil {
+		return nil, err
+	}
+	var ks []kstat.KStatInfo
+	for _, k := range ts.tok.AllSorted() {
+		ks = append(ks, info(k))
+	}
+	return ks, nil
+}
+
+func (ts *tokenSource) Lookup(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	return ts.lookup(module, instance, name, false)
+}
+
+func (ts *tokenSource) Refresh(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	return ts.lookup(module, instance, name, true)
+}
+
+func (ts *tokenSource) lookup(module string, instance int, name string, refresh bool) (kstat.KStatInfo, []kstat.Value, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if err := ts.update(); err != nil {
+		return kstat.KStatInfo{}, nil, err
+	}
+	k, vals, err := ts.find(module, instance, name, refresh)
+	if chainChanged(err) {
+		if err = ts.update(); err != nil {
+			return kstat.KStatInfo{}, nil, err
+		}
+		k, vals, err = ts.find(module, instance, name, refresh)
+	}
+	if err != nil {
+		return kstat.KStatInfo{}, nil, err
+	}
+	return info(k), vals, nil
+}
+
+// find is kstat_lookup() without Token.Lookup's kstat_read(), so that
+// Lookup reads a kstat's data only if it has never been loaded and
+// Refresh reads it exactly once. ts.mu must be held.
+func (ts *tokenSource) find(module string, instance int, name string, refresh bool) (*kstat.KStat, []kstat.Value, error) {
+	for _, k := range ts.tok.All() {
+		if (module != "" && k.Module != module) || (instance != -1 && k.Instance != instance) || (name != "" && k.Name != name) {
+			continue
+		}
+		if refresh {
+			if err := k.Refresh(); err != nil {
+				return nil, nil, err
+			}
+		}
+		vals, err := k.Values()
+		if err != nil {
+			return nil, nil, err
+		}
+		return k, vals, nil
+	}
+	return nil, nil, syscall.ENOENT
+}
+
+// Sample leaves out kstats that can't be read, since a gRPC response
+// can't carry both a Snapshot and an error.
+func (ts *tokenSource) Sample(ctx context.Context, sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if err := ts.update(); err != nil {
+		return nil, err
+	}
+	snap, err := ts.tok.SnapshotContext(ctx, sels...)
+	if chainChanged(err) {
+		if err = ts.update(); err != nil {
+			return nil, err
+		}
+		snap, err = ts.tok.SnapshotContext(ctx, sels...)
+	}
+	if _, ok := err.(kstat.KStatErrors); ok {
+		err = nil
+	}
+	return snap, err
+}
+
+// update brings the Token up to date with the kernel's kstat chain at
+// the start of each request, since the Source may be long lived. ts.mu
+// must be held.
+func (ts *tokenSource) update() error {
+	_, err := ts.tok.Update()
+	return err
+}
+
+// chainChanged reports whether err (or any of the per-kstat errors
+// in it) is the ENXIO that means kstats went away under us, in which
+// case the request is worth retrying after an update.
+func chainChanged(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
@@ -0,0 +1,66 @@
+// Package kstattest builds kstat Snapshots by hand, for testing code
+// that works from Snapshots (such as the kstat/* packages) without a
+// kstat system.
+//
+//	snap := &kstat.Snapshot{}
+//	kstattest.Add(snap, kstat.KStatInfo{Module: "unix", Name: "dnlcstats", Class: "misc", Type: kstat.NamedStat},
+//		map[string]uint64{"hits": 100, "misses": 10})
+package kstattest
+
+import (
+	"sort"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// AddValues adds the kstat ki to snap along with vals, which only
+// need their Stat, Type, and value set; AddValues fills in the rest
+// from ki, the way that a real Snapshot would have them.
+func AddValues(snap *kstat.Snapshot, ki kstat.KStatInfo, vals ...kstat.Value) {
+	snap.KStats = append(snap.KStats, ki)
+	for _, v := range vals {
+		v.Module, v.Instance, v.Name, v.Class = ki.Module, ki.Instance, ki.Name, ki.Class
+		v.Crtime, v.Snaptime = ki.Crtime, ki.Snaptime
+		snap.Values = append(snap.Values, v)
+	}
+}
+
+// Add adds the kstat ki to snap along with a Uint64 statistic for
+// each of stats.
+func Add(snap *kstat.Snapshot, ki kstat.KStatInfo, stats map[string]uint64) {
+	AddValues(snap, ki, Uints(kstat.Uint64, stats)...)
+}
+
+// Uints returns a Value of type tp (Uint32 or Uint64) for each of
+// stats, in order of statistic name.
+func Uints(tp kstat.NamedType, stats map[string]uint64) []kstat.Value {
+	vals := make([]kstat.Value, 0, len(stats))
+	for _, s := range names(stats) {
+		vals = append(vals, kstat.Value{Stat: s, Type: tp, UintVal: stats[s]})
+	}
+	return vals
+}
+
+// Ints returns a Value of type tp (Int32 or Int64) for each of stats,
+// in order of statistic name.
+func Ints(tp kstat.NamedType, stats map[string]int64) []kstat.Value {
+	vals := make([]kstat.Value, 0, len(stats))
+	for _, s := range names(stats) {
+		vals = append(vals, kstat.Value{Stat: s, Type: tp, IntVal: stats[s]})
+	}
+	return vals
+}
+
+// String returns a String Value.
+func String(stat, val string) kstat.Value {
+	return kstat.Value{Stat: stat, Type: kstat.String, StringVal: val}
+}
+
+func names[T any](stats map[string]T) []string {
+	lst := make([]string, 0, len(stats))
+	for s := range stats {
+		lst = append(lst, s)
+	}
+	sort.Strings(lst)
+	return lst
+}
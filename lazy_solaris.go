@@ -0,0 +1,152 @@
+//
+// Named statistics that are only decoded when asked for.
+
+package kstat
+
+// #include <sys/types.h>
+// #include <kstat.h>
+//
+// /* These are in kstat_solaris.go. */
+// char *get_named_char(kstat_named_t *knp);
+// uint64_t get_named_uint(kstat_named_t *knp);
+// int64_t get_named_int(kstat_named_t *knp);
+// kstat_named_t *get_nth_named(kstat_t *ks, uint_t n);
+//
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// LazyNamed is a reference to a named statistic in a KStat's current
+// data. Unlike a Named, nothing about the statistic is copied out of
+// the kstat data until you ask for it, so scanning through a
+// KStat's LazyNameds for one or two statistics doesn't pay to decode
+// all of the others (and especially doesn't copy all of their
+// string values).
+//
+// Because a LazyNamed refers to the KStat's data instead of holding a
+// copy, its values change when the KStat is refreshed. Once the KStat
+// becomes invalid (or the Token is closed), its LazyNameds have
+// InvalidType as their Type and return zero values for everything
+// else.
+type LazyNamed struct {
+	// The parent KStat.
+	KStat *KStat
+
+	n C.uint_t
+}
+
+// AllNamedLazy returns LazyNameds for all named statistics of a
+// named-type KStat, in the same order as AllNamed. Like AllNamed,
+// it doesn't refresh the KStat's data.
+func (k *KStat) AllNamedLazy() ([]LazyNamed, error) {
+	if err := k.setup(); err != nil {
+		return nil, err
+	}
+	lst := make([]LazyNamed, k.ksp.ks_ndata)
+	for i := range lst {
+		lst[i] = LazyNamed{KStat: k, n: C.uint_t(i)}
+	}
+	return lst, nil
+}
+
+// knp returns the kstat_named_t for the LazyNamed, or nil if it is
+// no longer valid.
+func (ln LazyNamed) knp() *C.struct_kstat_named {
+	if ln.KStat.invalid() {
+		return nil
+	}
+	return C.get_nth_named(ln.KStat.ksp, ln.n)
+}
+
+// Name returns the statistic's name. Names are interned, which
+// takes a lock; use NameIs to look for a particular statistic.
+func (ln LazyNamed) Name() string {
+	knp := ln.knp()
+	if knp == nil {
+		return ""
+	}
+	return names.Bytes(ln.name(knp))
+}
+
+// NameIs reports whether the statistic's name is name. It compares
+// the name in the kstat data directly, so it neither allocates nor
+// locks.
+func (ln LazyNamed) NameIs(name string) bool {
+	knp := ln.knp()
+	if knp == nil {
+		return false
+	}
+	return string(ln.name(knp)) == name
+}
+
+// name returns the bytes of knp's name, which point into the kstat
+// data.
+func (ln LazyNamed) name(knp *C.struct_kstat_named) []byte {
+	return cbytes((*C.char)(unsafe.Pointer(&knp.name)), C.KSTAT_STRLEN)
+}
+
+// Type returns the statistic's type, or InvalidType if the KStat is
+// no longer valid.
+func (ln LazyNamed) Type() NamedType {
+	knp := ln.knp()
+	if knp == nil {
+		return InvalidType
+	}
+	return NamedType(knp.data_type)
+}
+
+// IntVal returns the value of an Int32 or Int64 statistic, and 0 for
+// other types.
+func (ln LazyNamed) IntVal() int64 {
+	knp := ln.knp()
+	if knp == nil {
+		return 0
+	}
+	switch NamedType(knp.data_type) {
+	case Int32, Int64:
+		return int64(C.get_named_int(knp))
+	}
+	return 0
+}
+
+// UintVal returns the value of a Uint32 or Uint64 statistic, and 0
+// for other types.
+func (ln LazyNamed) UintVal() uint64 {
+	knp := ln.knp()
+	if knp == nil {
+		return 0
+	}
+	switch NamedType(knp.data_type) {
+	case Uint32, Uint64:
+		return uint64(C.get_named_uint(knp))
+	}
+	return 0
+}
+
+// StringVal returns the value of a String or CharData statistic, and
+// "" for other types. This is the only thing that copies the string.
+func (ln LazyNamed) StringVal() string {
+	knp := ln.knp()
+	if knp == nil {
+		return ""
+	}
+	switch NamedType(knp.data_type) {
+	case String:
+		return C.GoString(C.get_named_char(knp))
+	case CharData:
+		return strndup((*C.char)(unsafe.Pointer(&knp.value)), 16)
+	}
+	return ""
+}
+
+// Named decodes the statistic in full, returning a Named for it.
+func (ln LazyNamed) Named() (*Named, error) {
+	knp := ln.knp()
+	if knp == nil {
+		return nil, errors.New("invalid KStat or closed token")
+	}
+	return newNamed(ln.KStat, knp), nil
+}
@@ -0,0 +1,105 @@
+//
+// mpstat-style metrics computed from per-CPU kstats.
+
+package kstat
+
+import (
+	"time"
+)
+
+// CPUMetrics are the mpstat(1M) metrics for one CPU over the interval
+// between two readings of its cpu:N:sys kstat (and cpu:N:vm, if it's
+// available). Rates are per second and the usr, sys, and idle times
+// are percentages.
+type CPUMetrics struct {
+	CPU     int
+	Elapsed time.Duration
+
+	MinorFaults float64 // minf, from cpu:N:vm
+	MajorFaults float64 // mjf, from cpu:N:vm
+	Xcalls      float64 // xcal
+	Interrupts  float64 // intr
+	IntrThreads float64 // ithr
+	CtxSwitches float64 // csw
+	InvSwitches float64 // icsw
+	Migrations  float64 // migr
+	MutexSpins  float64 // smtx
+	RWFails     float64 // srw
+	Syscalls    float64 // syscl
+	PctUser     float64 // usr
+	PctSystem   float64 // sys
+	PctIdle     float64 // idl
+}
+
+// ComputeCPUMetrics computes CPUMetrics for every CPU whose cpu:N:sys
+// kstat is in both Snapshots, in the order they are in cur (which is
+// CPU order for Snapshots from a Token). As in mpstat, the usr,
+// sys, and idle percentages come from the cpu_nsec_* statistics and
+// are relative to their total, not to the elapsed time, so they
+// always add up to 100%.
+func ComputeCPUMetrics(prev, cur *Snapshot) []CPUMetrics {
+	old := make(map[kstatKey]kstatGroup)
+	for _, g := range prev.groups() {
+		if g.info.Module == "cpu" {
+			old[g.info.key()] = g
+		}
+	}
+	vms := make(map[int]map[string]float64)
+	for _, g := range cur.groups() {
+		if g.info.Module != "cpu" || g.info.Name != "vm" {
+			continue
+		}
+		if pg, ok := old[g.info.key()]; ok && g.info.Snaptime > pg.info.Snaptime {
+			vms[g.info.Instance] = statRates(pg, g)
+		}
+	}
+
+	var lst []CPUMetrics
+	for _, g := range cur.groups() {
+		if g.info.Module != "cpu" || g.info.Name != "sys" {
+			continue
+		}
+		pg, ok := old[g.info.key()]
+		if !ok || g.info.Snaptime <= pg.info.Snaptime {
+			continue
+		}
+		r := statRates(pg, g)
+		cm := CPUMetrics{
+			CPU:         g.info.Instance,
+			Elapsed:     time.Duration(g.info.Snaptime - pg.info.Snaptime),
+			Xcalls:      r["xcalls"],
+			Interrupts:  r["intr"],
+			IntrThreads: r["intrthread"],
+			CtxSwitches: r["pswitch"],
+			InvSwitches: r["inv_swtch"],
+			Migrations:  r["cpumigrate"],
+			MutexSpins:  r["mutex_adenters"],
+			RWFails:     r["rw_rdfails"] + r["rw_wrfails"],
+			Syscalls:    r["syscall"],
+		}
+		if vm, ok := vms[g.info.Instance]; ok {
+			cm.MinorFaults = vm["hat_fault"] + vm["as_fault"]
+			cm.MajorFaults = vm["maj_fault"]
+		}
+		usr, sys, idl := r["cpu_nsec_user"], r["cpu_nsec_kernel"], r["cpu_nsec_idle"]
+		if total := usr + sys + idl; total > 0 {
+			cm.PctUser = usr * 100 / total
+			cm.PctSystem = sys * 100 / total
+			cm.PctIdle = idl * 100 / total
+		}
+		lst = append(lst, cm)
+	}
+	return lst
+}
+
+// statRates returns the per-second rates of change of the numeric
+// statistics between two readings of a kstat, which must have
+// different Snaptimes.
+func statRates(prev, cur kstatGroup) map[string]float64 {
+	d := statDeltas(prev, cur)
+	secs := time.Duration(cur.info.Snaptime - prev.info.Snaptime).Seconds()
+	for k := range d {
+		d[k] /= secs
+	}
+	return d
+}
@@ -0,0 +1,71 @@
+//
+// Test CPU metrics.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// cpuSysSnapshot returns a Snapshot of cpu:N:sys and cpu:N:vm for
+// one CPU with the given statistics, all in cpu:N:sys except the
+// faults.
+func cpuSysSnapshot(cpu int, snaptime int64, stats map[string]uint64) *kstat.Snapshot {
+	sys, vm := make(map[string]uint64), make(map[string]uint64)
+	for s, x := range stats {
+		if s == "maj_fault" || s == "as_fault" || s == "hat_fault" {
+			vm[s] = x
+		} else {
+			sys[s] = x
+		}
+	}
+	snap := &kstat.Snapshot{}
+	kstattest.Add(snap, kstat.KStatInfo{Module: "cpu", Instance: cpu, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: 1, Snaptime: snaptime}, sys)
+	kstattest.Add(snap, kstat.KStatInfo{Module: "cpu", Instance: cpu, Name: "vm", Class: "misc", Type: kstat.NamedStat, Crtime: 1, Snaptime: snaptime}, vm)
+	return snap
+}
+
+func TestComputeCPUMetrics(t *testing.T) {
+	sec := int64(time.Second)
+	prev := cpuSysSnapshot(3, sec, map[string]uint64{
+		"cpu_nsec_user": 0, "cpu_nsec_kernel": 0, "cpu_nsec_idle": 0,
+		"xcalls": 0, "pswitch": 0, "rw_rdfails": 0, "rw_wrfails": 0,
+		"maj_fault": 0, "as_fault": 0, "hat_fault": 0,
+	})
+	cur := cpuSysSnapshot(3, 3*sec, map[string]uint64{
+		"cpu_nsec_user": 500, "cpu_nsec_kernel": 250, "cpu_nsec_idle": 1250,
+		"xcalls": 20, "pswitch": 200, "rw_rdfails": 2, "rw_wrfails": 4,
+		"maj_fault": 6, "as_fault": 8, "hat_fault": 2,
+	})
+	lst := kstat.ComputeCPUMetrics(prev, cur)
+	if len(lst) != 1 {
+		t.Fatalf("wrong number of CPUMetrics: %+v", lst)
+	}
+	cm := lst[0]
+	want := []struct {
+		name     string
+		got, exp float64
+	}{
+		{"usr", cm.PctUser, 25},
+		{"sys", cm.PctSystem, 12.5},
+		{"idl", cm.PctIdle, 62.5},
+		{"xcal", cm.Xcalls, 10},
+		{"csw", cm.CtxSwitches, 100},
+		{"srw", cm.RWFails, 3},
+		{"minf", cm.MinorFaults, 5},
+		{"mjf", cm.MajorFaults, 3},
+	}
+	for _, w := range want {
+		if math.Abs(w.got-w.exp) > 1e-9 {
+			t.Fatalf("bad %s: %f (should be %f)", w.name, w.got, w.exp)
+		}
+	}
+	if cm.CPU != 3 || cm.Elapsed != 2*time.Second {
+		t.Fatalf("bad CPUMetrics: %+v", cm)
+	}
+}
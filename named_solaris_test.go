@@ -0,0 +1,24 @@
+//go:build cgo
+// +build cgo
+
+//
+// Tests of decoding kstat_named_t's that we can't get real kstats
+// for.
+
+package kstat
+
+import (
+	"testing"
+)
+
+// A String statistic whose pointer is NULL decodes as "", not as a
+// crash.
+func TestNullString(t *testing.T) {
+	var knp knamed
+	knp.data_type = 9 // KSTAT_DATA_STRING
+	st := &Named{StringVal: "old"}
+	fillNamed(st, &KStat{}, &knp)
+	if st.Type != String || st.StringVal != "" {
+		t.Fatalf("NULL string statistic decoded as %s %q", st.Type, st.StringVal)
+	}
+}
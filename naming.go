@@ -0,0 +1,163 @@
+//
+// Mapping statistics to exporter metric names and labels.
+
+package kstat
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NamingRule maps the statistics that it matches to a metric name and
+// labels.
+//
+// Match is a regular expression that must match all of a statistic's
+// module:instance:name:statistic name (ie, Value.String()). Name and
+// the values of Labels are templates that are expanded for each
+// statistic. In them, $module, $instance, $name, $stat, and $class
+// are the parts of the statistic, $1 and so on are the submatches of
+// Match, and $group is the submatch of a named group (?P<group>...).
+// ${...} can be used to separate a variable from text after it. If
+// Name is blank, it's "${module}_${stat}".
+//
+// For example, this rule turns link:0:e1000g0:rbytes64 into the
+// metric link_rbytes64 with an interface label of e1000g0:
+//
+//	NamingRule{Match: `link:\d+:(?P<nic>[^:]+):(.*)`, Name: "link_$2", Labels: map[string]string{"interface": "$nic"}}
+type NamingRule struct {
+	Match  string            `json:"match" yaml:"match"`
+	Name   string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Label is a metric label.
+type Label struct {
+	Name, Value string
+}
+
+// MetricName is the metric name and labels for a statistic, as
+// determined by a Naming.
+type MetricName struct {
+	Name string
+	// Labels are sorted by name.
+	Labels []Label
+}
+
+// Naming maps statistics to metric names and labels with a list of
+// NamingRules, so that all exporters can name things the same way.
+// The first rule that matches a statistic is used. Statistics that no
+// rule matches get each exporter's default name and labels.
+//
+// The names and labels are used as they are, without any namespace
+// or prefix, which the exporter adds. Each exporter turns characters
+// that aren't valid in its names into underscores, and exporters that
+// have no labels (such as statsd and Graphite) add the label values
+// to the end of the name as extra components.
+//
+// A Naming's rules can be replaced with SetRules while it's in use,
+// which changes the names that all of the exporters using it produce.
+type Naming struct {
+	mu    sync.RWMutex
+	rules []namingRule
+}
+
+type namingRule struct {
+	NamingRule
+	re     *regexp.Regexp
+	labels []string
+}
+
+// NewNaming creates a Naming from a list of rules, checking that
+// their Match expressions are valid.
+func NewNaming(rules ...NamingRule) (*Naming, error) {
+	n := &Naming{}
+	if err := n.SetRules(rules...); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// SetRules replaces the Naming's rules. If any of the new rules are
+// bad, the current ones are left alone.
+func (n *Naming) SetRules(rules ...NamingRule) error {
+	var nrules []namingRule
+	for _, r := range rules {
+		re, err := regexp.Compile("^(?:" + r.Match + ")$")
+		if err != nil {
+			return fmt.Errorf("bad naming rule %q: %w", r.Match, err)
+		}
+		if r.Name == "" {
+			r.Name = "${module}_${stat}"
+		}
+		nr := namingRule{NamingRule: r, re: re}
+		for l := range r.Labels {
+			nr.labels = append(nr.labels, l)
+		}
+		sort.Strings(nr.labels)
+		nrules = append(nrules, nr)
+	}
+	n.mu.Lock()
+	n.rules = nrules
+	n.mu.Unlock()
+	return nil
+}
+
+// Map returns the metric name and labels for a Value, or false if no
+// rule matches it. A nil Naming matches nothing.
+func (n *Naming) Map(v Value) (MetricName, bool) {
+	if n == nil {
+		return MetricName{}, false
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	key := v.String()
+	for _, r := range n.rules {
+		m := r.re.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		vars := func(name string) string {
+			switch name {
+			case "module":
+				return v.Module
+			case "instance":
+				return strconv.Itoa(v.Instance)
+			case "name":
+				return v.Name
+			case "stat":
+				return v.Stat
+			case "class":
+				return v.Class
+			}
+			if i, err := strconv.Atoi(name); err == nil && i < len(m) {
+				return m[i]
+			}
+			if i := r.re.SubexpIndex(name); i > 0 {
+				return m[i]
+			}
+			return ""
+		}
+		mn := MetricName{Name: os.Expand(r.Name, vars)}
+		for _, l := range r.labels {
+			mn.Labels = append(mn.Labels, Label{l, os.Expand(r.Labels[l], vars)})
+		}
+		return mn, true
+	}
+	return MetricName{}, false
+}
+
+// dotted returns the components of a dotted name (for statsd or
+// Graphite) for a MetricName: the dot-separated parts of its name,
+// then its label values.
+func (mn MetricName) dotted() []string {
+	parts := strings.Split(mn.Name, ".")
+	for _, l := range mn.Labels {
+		parts = append(parts, l.Value)
+	}
+	return parts
+}
@@ -0,0 +1,94 @@
+//
+// Test metric naming.
+
+package kstat_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func linkNaming(t *testing.T) *kstat.Naming {
+	n, err := kstat.NewNaming(
+		kstat.NamingRule{Match: `link:\d+:(?P<nic>[^:]+):(.*)`, Name: "link_$2", Labels: map[string]string{"interface": "$nic", "zone": "global"}},
+		kstat.NamingRule{Match: `cpu:.*`},
+	)
+	if err != nil {
+		t.Fatalf("NewNaming failed: %s", err)
+	}
+	return n
+}
+
+func linkValue(nic string, v uint64) kstat.Value {
+	return kstat.Value{Module: "link", Name: nic, Class: "net", Stat: "rbytes64", Type: kstat.Uint64, UintVal: v}
+}
+
+func TestNaming(t *testing.T) {
+	n := linkNaming(t)
+	mn, ok := n.Map(linkValue("e1000g0", 1))
+	exp := kstat.MetricName{Name: "link_rbytes64", Labels: []kstat.Label{{"interface", "e1000g0"}, {"zone", "global"}}}
+	if !ok || !reflect.DeepEqual(mn, exp) {
+		t.Errorf("wrong link mapping: %v %+v", ok, mn)
+	}
+	// The default name, and Match has to match all of the name.
+	if mn, ok := n.Map(testSnapshot().Values[0]); !ok || mn.Name != "cpu_syscall" || mn.Labels != nil {
+		t.Errorf("wrong cpu mapping: %v %+v", ok, mn)
+	}
+	if _, ok := n.Map(kstat.Value{Module: "xcpu", Name: "sys", Stat: "x"}); ok {
+		t.Errorf("partial match mapped")
+	}
+	if _, ok := (*kstat.Naming)(nil).Map(linkValue("e1000g0", 1)); ok {
+		t.Errorf("nil Naming mapped")
+	}
+	if _, err := kstat.NewNaming(kstat.NamingRule{Match: "link:("}); err == nil {
+		t.Errorf("bad Match accepted")
+	}
+}
+
+// Exporters use the Naming's names and labels in their own ways.
+func TestNamingExporters(t *testing.T) {
+	n := linkNaming(t)
+	snap := &kstat.Snapshot{Values: []kstat.Value{linkValue("e1000g0", 10), linkValue("e1000g1", 20)}}
+
+	var b bytes.Buffer
+	if err := snap.WritePrometheusText(&b, kstat.OpenMetricsOptions{Naming: n}); err != nil {
+		t.Fatalf("WritePrometheusText failed: %s", err)
+	}
+	exp := `# TYPE kstat_link_rbytes64 untyped
+# HELP kstat_link_rbytes64 kstat link:*:*:rbytes64
+kstat_link_rbytes64{interface="e1000g0",zone="global"} 10
+kstat_link_rbytes64{interface="e1000g1",zone="global"} 20
+`
+	if b.String() != exp {
+		t.Errorf("wrong Prometheus text output:\n%s", b.String())
+	}
+
+	var w writes
+	if err := kstat.NewStatsdSink(&w, kstat.StatsdOptions{Prefix: "h1", Naming: n}).Write(&kstat.Sample{Snapshot: *snap}); err != nil {
+		t.Fatalf("statsd Write failed: %s", err)
+	}
+	if len(w) != 1 || w[0] != "h1.link_rbytes64.e1000g0.global:10|g\nh1.link_rbytes64.e1000g1.global:20|g\n" {
+		t.Errorf("wrong statsd output: %q", w)
+	}
+
+	w = nil
+	if err := kstat.NewInfluxWriter(&w, kstat.InfluxOptions{Host: "h1", Naming: n}).WriteSnapshot(snap); err != nil {
+		t.Fatalf("influx WriteSnapshot failed: %s", err)
+	}
+	if len(w) != 1 || !strings.HasPrefix(w[0], "link_rbytes64,host=h1,interface=e1000g0,zone=global value=10i ") {
+		t.Errorf("wrong influx output: %q", w)
+	}
+
+	b.Reset()
+	cw := kstat.NewCollectdWriter(&b, kstat.CollectdOptions{Host: "h1", Naming: n})
+	if err := cw.WriteSnapshot(snap); err != nil {
+		t.Fatalf("collectd WriteSnapshot failed: %s", err)
+	}
+	if !strings.HasPrefix(b.String(), `PUTVAL "h1/link-e1000g0_global/gauge-link_rbytes64" `) {
+		t.Errorf("wrong collectd output: %q", b.String())
+	}
+}
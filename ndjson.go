@@ -0,0 +1,98 @@
+//
+// Streaming Samples as newline delimited JSON.
+
+package kstat
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// NDJSONEncoder writes Samples as newline delimited JSON, with one
+// object per statistic:
+//
+//	{"time":"2015-08-28T10:00:00.123456789Z","stat":"cpu:0:sys:syscall","value":1234,"rate":12.5}
+//
+// "time" is the Sample's Time and "stat" is the statistic's
+// module:instance:name:stat. "value" is a number or a string,
+// depending on the statistic. "rate" is the per-second rate of change
+// since the previous Sample, computed as ComputeRate does; it's left
+// out when there's no rate. Derived values are written with their
+// names as "stat" and no rate.
+//
+// This is a convenient form for jq, log shippers, and the like,
+// although it's much bigger than a Recording.
+type NDJSONEncoder struct {
+	w     io.Writer
+	rates []Selector
+	ct    *CounterTracker
+	buf   bytes.Buffer
+}
+
+type ndjsonRecord struct {
+	Time  time.Time   `json:"time"`
+	Stat  string      `json:"stat"`
+	Value interface{} `json:"value"`
+	Rate  *float64    `json:"rate,omitempty"`
+}
+
+// NewNDJSONEncoder creates an NDJSONEncoder that writes to w. Rates
+// are only computed for the statistics picked out by rates, or for
+// all numeric statistics if there are no selectors.
+func NewNDJSONEncoder(w io.Writer, rates ...Selector) *NDJSONEncoder {
+	return &NDJSONEncoder{w: w, rates: rates, ct: NewCounterTracker()}
+}
+
+// Write writes the statistics and Derived values of a Sample, with
+// a single Write to the underlying writer.
+func (e *NDJSONEncoder) Write(sm *Sample) error {
+	rates := make(map[string]float64)
+	for _, r := range e.ct.UpdateSample(sm) {
+		if e.wantRate(r.Value) {
+			rates[r.Value.String()] = r.Rate
+		}
+	}
+
+	e.buf.Reset()
+	enc := json.NewEncoder(&e.buf)
+	for _, v := range sm.Values {
+		rec := ndjsonRecord{Time: sm.Time, Stat: v.String(), Value: v.native()}
+		if r, ok := rates[rec.Stat]; ok {
+			rec.Rate = &r
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	for _, d := range sm.Derived {
+		if err := enc.Encode(ndjsonRecord{Time: sm.Time, Stat: d.Name, Value: d.Value}); err != nil {
+			return err
+		}
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *NDJSONEncoder) wantRate(v Value) bool {
+	if len(e.rates) == 0 {
+		return true
+	}
+	for _, sel := range e.rates {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush does nothing, since Write writes everything immediately.
+func (e *NDJSONEncoder) Flush() error {
+	return nil
+}
+
+// Close closes the NDJSONEncoder's writer, if it's an io.Closer.
+func (e *NDJSONEncoder) Close() error {
+	return closeWriter(e.w)
+}
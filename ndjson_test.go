@@ -0,0 +1,51 @@
+//
+// Test NDJSON output.
+
+package kstat_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestNDJSONEncoder(t *testing.T) {
+	var b bytes.Buffer
+	e := kstat.NewNDJSONEncoder(&b)
+	sm := &kstat.Sample{}
+	sm.Time = time.Date(2015, 8, 28, 10, 0, 0, 0, time.UTC)
+	state := kstat.Value{Module: "cpu_info", Name: "cpu_info0", Stat: "state", Type: kstat.CharData, StringVal: "on-line"}
+	sm.Values = []kstat.Value{counter(1e9, 100), state}
+	if err := e.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	sm.Time = sm.Time.Add(2 * time.Second)
+	sm.Values[0] = counter(3e9, 300)
+	sm.Derived = []kstat.Derived{{Name: "mean", Value: math.Pi}}
+	if err := e.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	exp := `{"time":"2015-08-28T10:00:00Z","stat":"cpu:0:sys:syscall","value":100}
+{"time":"2015-08-28T10:00:00Z","stat":"cpu_info:0:cpu_info0:state","value":"on-line"}
+{"time":"2015-08-28T10:00:02Z","stat":"cpu:0:sys:syscall","value":300,"rate":100}
+{"time":"2015-08-28T10:00:02Z","stat":"cpu_info:0:cpu_info0:state","value":"on-line"}
+{"time":"2015-08-28T10:00:02Z","stat":"mean","value":3.141592653589793}
+`
+	if b.String() != exp {
+		t.Fatalf("wrong output:\n%s", b.String())
+	}
+
+	// Rates can be limited to some statistics.
+	b.Reset()
+	sel, _ := kstat.ParseSelector("cpu::sys:intr")
+	e = kstat.NewNDJSONEncoder(&b, sel)
+	e.Write(sm)
+	sm.Values[0] = counter(5e9, 500)
+	e.Write(sm)
+	if bytes.Contains(b.Bytes(), []byte(`"rate"`)) {
+		t.Fatalf("unwanted rate:\n%s", b.String())
+	}
+}
@@ -0,0 +1,185 @@
+//
+// Writing Snapshots in the OpenMetrics and Prometheus text formats.
+
+package kstat
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// OpenMetricsOptions control how Snapshots are written in the
+// OpenMetrics and Prometheus text formats.
+type OpenMetricsOptions struct {
+	// Namespace is the prefix of metric names. If it's blank,
+	// "kstat" is used.
+	Namespace string
+
+	// Counters and Gauges pick out the statistics that are
+	// written as counters and gauges respectively. Everything else
+	// has an unknown (untyped) type, since kstats don't say what
+	// sort of value a statistic is.
+	Counters []Selector
+	Gauges   []Selector
+
+	// Naming maps statistics to metric names (which get the
+	// Namespace in front of them) and labels. Statistics that it
+	// doesn't map get the default name and labels.
+	Naming *Naming
+}
+
+// WriteOpenMetrics writes the numeric statistics in a Snapshot to w
+// in the OpenMetrics text format, ending with "# EOF". Each
+// module:*:*:stat statistic is a metric family named
+// namespace_module_stat (with invalid characters turned into
+// underscores), and each kstat is a sample in it with kstat_instance
+// and kstat_name labels:
+//
+//	# TYPE kstat_cpu_syscall counter
+//	# HELP kstat_cpu_syscall kstat cpu:*:*:syscall
+//	kstat_cpu_syscall_total{kstat_instance="0",kstat_name="sys"} 1234
+//
+// These are the same names and labels that promexporter uses by
+// default. Samples have no timestamps.
+func (snap *Snapshot) WriteOpenMetrics(w io.Writer, opts OpenMetricsOptions) error {
+	return snap.writeMetrics(w, opts, true)
+}
+
+// WritePrometheusText is WriteOpenMetrics for the older Prometheus
+// text exposition format (version 0.0.4), which is what Prometheus
+// asks for if it's not told otherwise.
+func (snap *Snapshot) WritePrometheusText(w io.Writer, opts OpenMetricsOptions) error {
+	return snap.writeMetrics(w, opts, false)
+}
+
+// metricFamily is a metric family and its samples' lines, minus
+// their metric names.
+type metricFamily struct {
+	name, help, tp string
+	samples        []string
+}
+
+func (snap *Snapshot) writeMetrics(w io.Writer, opts OpenMetricsOptions, om bool) error {
+	ns := opts.Namespace
+	if ns == "" {
+		ns = "kstat"
+	}
+
+	// All of a family's samples have to be together, so we gather
+	// them up before writing anything.
+	var fams []*metricFamily
+	byName := make(map[string]*metricFamily)
+	seen := make(map[string]bool)
+	for _, v := range snap.Values {
+		var num string
+		switch v.Type {
+		case Int32, Int64:
+			num = strconv.FormatInt(v.IntVal, 10)
+		case Uint32, Uint64:
+			num = strconv.FormatUint(v.UintVal, 10)
+		default:
+			continue
+		}
+		name := metricName(ns + "_" + v.Module + "_" + v.Stat)
+		labels := `{kstat_instance="` + strconv.Itoa(v.Instance) + `",kstat_name="` + labelEscape(v.Name) + `"}`
+		if mn, ok := opts.Naming.Map(v); ok {
+			name, labels = metricName(ns+"_"+mn.Name), metricLabels(mn.Labels)
+		}
+		if seen[name+labels] {
+			continue
+		}
+		seen[name+labels] = true
+
+		f := byName[name]
+		if f == nil {
+			f = &metricFamily{name: name, help: "kstat " + v.Module + ":*:*:" + v.Stat, tp: metricType(v, opts, om)}
+			byName[name] = f
+			fams = append(fams, f)
+		}
+		f.samples = append(f.samples, labels+" "+num)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range fams {
+		name, sname := f.name, f.name
+		if om && f.tp == "counter" {
+			// OpenMetrics counter families don't have the
+			// _total suffix, but their samples must.
+			name = strings.TrimSuffix(name, "_total")
+			sname = name + "_total"
+		}
+		bw.WriteString("# TYPE " + name + " " + f.tp + "\n")
+		bw.WriteString("# HELP " + name + " " + helpEscape(f.help) + "\n")
+		for _, s := range f.samples {
+			bw.WriteString(sname + s + "\n")
+		}
+	}
+	if om {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func metricType(v Value, opts OpenMetricsOptions, om bool) string {
+	for _, sel := range opts.Counters {
+		if sel.Match(v) {
+			return "counter"
+		}
+	}
+	for _, sel := range opts.Gauges {
+		if sel.Match(v) {
+			return "gauge"
+		}
+	}
+	if om {
+		return "unknown"
+	}
+	return "untyped"
+}
+
+// metricName turns s into a valid metric name by replacing invalid
+// characters with underscores.
+func metricName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// metricLabels formats labels for a sample line, turning invalid
+// characters in their names into underscores.
+func metricLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, l := range labels {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(strings.ReplaceAll(metricName(l.Name), ":", "_"))
+		b.WriteString(`="`)
+		b.WriteString(labelEscape(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func labelEscape(s string) string { return labelEscaper.Replace(s) }
+func helpEscape(s string) string  { return helpEscaper.Replace(s) }
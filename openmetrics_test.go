@@ -0,0 +1,54 @@
+//
+// Test OpenMetrics output.
+
+package kstat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	snap := testSnapshot()
+	v := snap.Values[0]
+	v.Instance, v.Name = 1, `odd"name`
+	snap.Values = append(snap.Values, v)
+	sel, _ := kstat.ParseSelector("cpu::sys:syscall")
+	opts := kstat.OpenMetricsOptions{Counters: []kstat.Selector{sel}}
+
+	var b bytes.Buffer
+	if err := snap.WriteOpenMetrics(&b, opts); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %s", err)
+	}
+	exp := `# TYPE kstat_cpu_syscall counter
+# HELP kstat_cpu_syscall kstat cpu:*:*:syscall
+kstat_cpu_syscall_total{kstat_instance="0",kstat_name="sys"} 18446744073709551615
+kstat_cpu_syscall_total{kstat_instance="1",kstat_name="odd\"name"} 18446744073709551615
+# TYPE kstat_cpu_delta unknown
+# HELP kstat_cpu_delta kstat cpu:*:*:delta
+kstat_cpu_delta{kstat_instance="0",kstat_name="sys"} -5
+# EOF
+`
+	if b.String() != exp {
+		t.Fatalf("wrong OpenMetrics output:\n%s", b.String())
+	}
+
+	b.Reset()
+	opts.Namespace = "solaris"
+	if err := snap.WritePrometheusText(&b, opts); err != nil {
+		t.Fatalf("WritePrometheusText failed: %s", err)
+	}
+	exp = `# TYPE solaris_cpu_syscall counter
+# HELP solaris_cpu_syscall kstat cpu:*:*:syscall
+solaris_cpu_syscall{kstat_instance="0",kstat_name="sys"} 18446744073709551615
+solaris_cpu_syscall{kstat_instance="1",kstat_name="odd\"name"} 18446744073709551615
+# TYPE solaris_cpu_delta untyped
+# HELP solaris_cpu_delta kstat cpu:*:*:delta
+solaris_cpu_delta{kstat_instance="0",kstat_name="sys"} -5
+`
+	if b.String() != exp {
+		t.Fatalf("wrong Prometheus text output:\n%s", b.String())
+	}
+}
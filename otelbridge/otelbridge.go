@@ -0,0 +1,193 @@
+// Package otelbridge exports kstat statistics through OpenTelemetry
+// metrics, as asynchronous instruments whose callback takes a
+// Snapshot of the selected kstats. This lets kstat data flow into
+// any OTel pipeline (such as an OTLP exporter) that the program has
+// set up for its own metrics.
+//
+// Usage is:
+//
+//	tok, err := kstat.Open()
+//	...
+//	sels, err := kstat.ParseSelectors([]string{"cpu::sys", "zfs:0:arcstats"})
+//	...
+//	reg, err := otelbridge.Register(otel.Meter("kstat"), tok.Snapshot, otelbridge.Options{Selectors: sels})
+//
+// OTel instruments have to be created before they're observed, so
+// Register takes an initial Snapshot and creates an instrument for
+// every metric name in it. Statistics that only show up later with
+// new names aren't exported, although new instances of existing
+// statistics (such as a new disk) are.
+package otelbridge
+
+import (
+	"context"
+	"sync"
+
+	"github.com/siebenmann/go-kstat"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// SnapshotFunc takes a Snapshot of the kstats matching the selectors.
+// Token.Snapshot and Token.CoherentSnapshot are SnapshotFuncs.
+type SnapshotFunc func(sels ...kstat.Selector) (*kstat.Snapshot, error)
+
+// Options control what is exported and how.
+type Options struct {
+	// Selectors pick the statistics to export. If there are none,
+	// everything is exported.
+	Selectors []kstat.Selector
+
+	// Name returns the instrument name for a Value. If it's nil,
+	// instruments are named kstat.module.stat. Names are sanitized
+	// to be valid instrument names, and Values whose name is "" are
+	// skipped.
+	Name func(v kstat.Value) string
+
+	// Counters and Gauges override the type heuristic for the
+	// statistics they match. By default unsigned statistics are
+	// exported as monotonic counters, since most of them count
+	// things, and signed ones are exported as gauges.
+	Counters []kstat.Selector
+	Gauges   []kstat.Selector
+
+	// Naming maps statistics to instrument names (which get
+	// "kstat." in front of them) and attributes, taking priority
+	// over Name for the statistics that it maps. Their attributes
+	// are the labels, instead of the kstat module, instance, and
+	// name.
+	Naming *kstat.Naming
+}
+
+// Attribute keys for the kstat module, instance, and name of each
+// observation.
+const (
+	ModuleKey   = attribute.Key("kstat.module")
+	InstanceKey = attribute.Key("kstat.instance")
+	NameKey     = attribute.Key("kstat.name")
+)
+
+type bridge struct {
+	mu    sync.Mutex
+	snap  SnapshotFunc
+	opts  Options
+	insts map[string]metric.Float64Observable
+}
+
+// Register creates instruments on meter for the statistics in an
+// initial Snapshot from snap, and registers a callback that observes
+// them from a new Snapshot every time metrics are collected. The
+// callback serializes its use of snap. Unregister the returned
+// Registration to stop exporting.
+func Register(meter metric.Meter, snap SnapshotFunc, opts Options) (metric.Registration, error) {
+	b := &bridge{snap: snap, opts: opts, insts: make(map[string]metric.Float64Observable)}
+	s, err := snap(opts.Selectors...)
+	if err != nil {
+		return nil, err
+	}
+	var obs []metric.Observable
+	for _, v := range s.Values {
+		if _, ok := v.Float(); !ok {
+			continue
+		}
+		name := b.name(v)
+		if name == "" || b.insts[name] != nil {
+			continue
+		}
+		desc := metric.WithDescription("kstat " + v.Module + ":*:*:" + v.Stat)
+		var inst metric.Float64Observable
+		if b.counter(v) {
+			inst, err = meter.Float64ObservableCounter(name, desc)
+		} else {
+			inst, err = meter.Float64ObservableGauge(name, desc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.insts[name] = inst
+		obs = append(obs, inst)
+	}
+	return meter.RegisterCallback(b.observe, obs...)
+}
+
+// observe is the callback that observes all of the instruments.
+func (b *bridge) observe(ctx context.Context, o metric.Observer) error {
+	b.mu.Lock()
+	s, err := b.snap(b.opts.Selectors...)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, v := range s.Values {
+		f, ok := v.Float()
+		if !ok {
+			continue
+		}
+		inst := b.insts[b.name(v)]
+		if inst == nil {
+			continue
+		}
+		if mn, ok := b.opts.Naming.Map(v); ok {
+			attrs := make([]attribute.KeyValue, len(mn.Labels))
+			for i, l := range mn.Labels {
+				attrs[i] = attribute.String(l.Name, l.Value)
+			}
+			o.ObserveFloat64(inst, f, metric.WithAttributes(attrs...))
+			continue
+		}
+		o.ObserveFloat64(inst, f, metric.WithAttributes(
+			ModuleKey.String(v.Module),
+			InstanceKey.Int(v.Instance),
+			NameKey.String(v.Name),
+		))
+	}
+	return nil
+}
+
+func (b *bridge) name(v kstat.Value) string {
+	if mn, ok := b.opts.Naming.Map(v); ok {
+		return sanitize("kstat." + mn.Name)
+	}
+	if b.opts.Name != nil {
+		return sanitize(b.opts.Name(v))
+	}
+	return sanitize("kstat." + v.Module + "." + v.Stat)
+}
+
+// counter decides whether a Value is exported as a counter.
+func (b *bridge) counter(v kstat.Value) bool {
+	for _, sel := range b.opts.Counters {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	for _, sel := range b.opts.Gauges {
+		if sel.Match(v) {
+			return false
+		}
+	}
+	return v.Type == kstat.Uint32 || v.Type == kstat.Uint64
+}
+
+// sanitize turns s into a valid instrument name, which starts with a
+// letter and has only letters, digits, and _ . - /, by replacing
+// other characters with underscores and putting a "k" in front of a
+// leading non-letter.
+func sanitize(s string) string {
+	if s == "" {
+		return s
+	}
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9', c == '_', c == '.', c == '-', c == '/':
+		default:
+			b[i] = '_'
+		}
+	}
+	if c := b[0]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		return "k" + string(b)
+	}
+	return string(b)
+}
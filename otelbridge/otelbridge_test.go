@@ -0,0 +1,58 @@
+//
+// Test the OpenTelemetry bridge.
+
+package otelbridge_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/otelbridge"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegister(t *testing.T) {
+	var syscalls uint64
+	snap := func(sels ...kstat.Selector) (*kstat.Snapshot, error) {
+		syscalls += 100
+		return &kstat.Snapshot{Values: []kstat.Value{
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "syscall", Type: kstat.Uint64, UintVal: syscalls},
+			{Module: "unix", Instance: 0, Name: "system_misc", Stat: "nproc", Type: kstat.Int32, IntVal: 42},
+			{Module: "unix", Instance: 0, Name: "system_misc", Stat: "state", Type: kstat.String, StringVal: "up"},
+		}}, nil
+	}
+	rd := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(rd))
+	reg, err := otelbridge.Register(mp.Meter("test"), snap, otelbridge.Options{})
+	if err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	defer reg.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	if err = rd.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %s", err)
+	}
+	got := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("wrong metrics: %+v", got)
+	}
+	sum, ok := got["kstat.cpu.syscall"].(metricdata.Sum[float64])
+	if !ok || !sum.IsMonotonic || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 200 {
+		t.Fatalf("wrong syscall counter: %+v", got["kstat.cpu.syscall"])
+	}
+	if inst, _ := sum.DataPoints[0].Attributes.Value(otelbridge.InstanceKey); inst.AsInt64() != 0 {
+		t.Fatalf("wrong instance attribute: %v", sum.DataPoints[0].Attributes)
+	}
+	gauge, ok := got["kstat.unix.nproc"].(metricdata.Gauge[float64])
+	if !ok || len(gauge.DataPoints) != 1 || gauge.DataPoints[0].Value != 42 {
+		t.Fatalf("wrong nproc gauge: %+v", got["kstat.unix.nproc"])
+	}
+}
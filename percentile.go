@@ -0,0 +1,159 @@
+//
+// Percentiles and histograms of statistics over a sliding window.
+
+package kstat
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Percentile returns the p'th percentile (0 to 100) of the values in
+// the History, or NaN if it's empty. Percentiles that fall between two
+// values are linearly interpolated between them, so the 50th
+// percentile of 1 and 2 is 1.5.
+func (h *History) Percentile(p float64) float64 {
+	if h.n == 0 {
+		return math.NaN()
+	}
+	vals := h.sorted()
+	return percentile(vals, p)
+}
+
+// Percentiles is like Percentile for several percentiles at once,
+// which is cheaper than calling Percentile repeatedly.
+func (h *History) Percentiles(ps ...float64) []float64 {
+	res := make([]float64, len(ps))
+	if h.n == 0 {
+		for i := range res {
+			res[i] = math.NaN()
+		}
+		return res
+	}
+	vals := h.sorted()
+	for i, p := range ps {
+		res[i] = percentile(vals, p)
+	}
+	return res
+}
+
+// Histogram counts the values in the History into buckets. bounds
+// are the inclusive upper bounds of the buckets, in increasing order;
+// a value goes in the first bucket whose bound it is <= to. The
+// result has one more count than there are bounds, for the values
+// larger than the last bound.
+func (h *History) Histogram(bounds []float64) []int {
+	counts := make([]int, len(bounds)+1)
+	for _, p := range h.Points() {
+		counts[sort.SearchFloat64s(bounds, p.Value)]++
+	}
+	return counts
+}
+
+func (h *History) sorted() []float64 {
+	vals := make([]float64, h.n)
+	for i := range vals {
+		vals[i] = h.pts[(h.start+i)%len(h.pts)].Value
+	}
+	sort.Float64s(vals)
+	return vals
+}
+
+// percentile returns the p'th percentile of a sorted, non-empty list.
+func percentile(vals []float64, p float64) float64 {
+	switch {
+	case p <= 0:
+		return vals[0]
+	case p >= 100:
+		return vals[len(vals)-1]
+	}
+	r := p / 100 * float64(len(vals)-1)
+	i := int(r)
+	if i+1 >= len(vals) {
+		return vals[i]
+	}
+	return vals[i] + (r-float64(i))*(vals[i+1]-vals[i])
+}
+
+// PercentileTracker is a Processor that keeps a sliding window of
+// selected statistics and adds percentiles over the window to each
+// Sample as Derived values. Like a Smoother, it works on either the
+// values of statistics or their per-second rates; the 95th percentile
+// of a value is named "p95(<stat>)" and of a rate "p95_rate(<stat>)".
+type PercentileTracker struct {
+	size  int
+	pcts  []float64
+	sels  []Selector
+	ct    *CounterTracker
+	hists map[string]*History
+}
+
+// NewValuePercentiles creates a PercentileTracker for the percentiles
+// pcts of the last size values of the statistics selected by sels (or
+// of all numeric statistics, if there are no selectors).
+func NewValuePercentiles(size int, pcts []float64, sels ...Selector) *PercentileTracker {
+	return &PercentileTracker{size: size, pcts: pcts, sels: sels, hists: make(map[string]*History)}
+}
+
+// NewRatePercentiles creates a PercentileTracker for the percentiles
+// pcts of the last size per-second rates of the counters selected by
+// sels (or of all numeric statistics, if there are no selectors).
+func NewRatePercentiles(size int, pcts []float64, sels ...Selector) *PercentileTracker {
+	pt := NewValuePercentiles(size, pcts, sels...)
+	pt.ct = NewCounterTracker()
+	return pt
+}
+
+func (pt *PercentileTracker) wanted(v Value) bool {
+	if len(pt.sels) == 0 {
+		return true
+	}
+	for _, sel := range pt.sels {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Process adds a Sample's statistics to their windows and adds the
+// current percentiles to it.
+func (pt *PercentileTracker) Process(sm *Sample) {
+	for _, v := range sm.Values {
+		if !pt.wanted(v) {
+			continue
+		}
+		x, ok := v.Float()
+		if !ok {
+			continue
+		}
+		suffix := ""
+		if pt.ct != nil {
+			r, ok := pt.ct.Update(v)
+			if !ok {
+				continue
+			}
+			x = r.Rate
+			suffix = "_rate"
+		}
+		key := v.String()
+		h, ok := pt.hists[key]
+		if !ok {
+			h = NewHistory(pt.size)
+			pt.hists[key] = h
+		}
+		h.Add(v.Snaptime, x)
+		for i, p := range h.Percentiles(pt.pcts...) {
+			name := fmt.Sprintf("p%g%s(%s)", pt.pcts[i], suffix, key)
+			sm.Derived = append(sm.Derived, Derived{Name: name, Value: p})
+		}
+	}
+}
+
+// History returns the window for a statistic, identified by its
+// module:instance:name:statistic name, or nil if there is none. For
+// rate PercentileTrackers the History holds rates.
+func (pt *PercentileTracker) History(stat string) *History {
+	return pt.hists[stat]
+}
@@ -0,0 +1,66 @@
+//
+// Test percentiles.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestHistoryPercentile(t *testing.T) {
+	h := kstat.NewHistory(10)
+	if !math.IsNaN(h.Percentile(50)) {
+		t.Fatalf("empty History has a percentile")
+	}
+	// The window only holds the last ten values, 11 through 20.
+	for i := 1; i <= 20; i++ {
+		h.Add(int64(i), float64(21-i))
+	}
+	if p := h.Percentile(0); p != 1 {
+		t.Fatalf("bad 0th percentile: %f", p)
+	}
+	if p := h.Percentile(100); p != 10 {
+		t.Fatalf("bad 100th percentile: %f", p)
+	}
+	if p := h.Percentile(50); p != 5.5 {
+		t.Fatalf("bad 50th percentile: %f", p)
+	}
+	ps := h.Percentiles(50, 90)
+	if ps[0] != 5.5 || math.Abs(ps[1]-9.1) > 1e-9 {
+		t.Fatalf("bad Percentiles: %v", ps)
+	}
+
+	counts := h.Histogram([]float64{2, 5, 8})
+	want := []int{2, 3, 3, 2}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Fatalf("bad Histogram: %v (should be %v)", counts, want)
+		}
+	}
+}
+
+func TestPercentileTracker(t *testing.T) {
+	sec := int64(time.Second)
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	pt := kstat.NewRatePercentiles(3, []float64{50, 99.5}, sel)
+	var sm *kstat.Sample
+	total := uint64(0)
+	for i, inc := range []uint64{0, 10, 20, 30, 40} {
+		total += inc
+		sm = &kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{counter(int64(i+1)*sec, total)}}}
+		pt.Process(sm)
+	}
+	if v, ok := sm.Get("p50_rate(cpu:0:sys:syscall)"); !ok || v != 30 {
+		t.Fatalf("bad p50_rate: %v %f", ok, v)
+	}
+	if _, ok := sm.Get("p99.5_rate(cpu:0:sys:syscall)"); !ok {
+		t.Fatalf("no p99.5_rate: %+v", sm.Derived)
+	}
+	if h := pt.History("cpu:0:sys:syscall"); h == nil || h.Len() != 3 || h.Max() != 40 {
+		t.Fatalf("bad PercentileTracker History: %+v", h)
+	}
+}
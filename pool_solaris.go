@@ -0,0 +1,49 @@
+//go:build cgo
+// +build cgo
+
+//
+// Reusing Named allocations.
+
+package kstat
+
+import (
+	"sync"
+)
+
+// namedPool holds Nameds that have been Release()'d, for newNamed to
+// reuse. Reused Nameds keep their old Name and StringVal strings, so
+// that refilling them for the same statistic doesn't allocate.
+var namedPool = sync.Pool{
+	New: func() interface{} { return new(Named) },
+}
+
+// getNamed returns a Named from the pool.
+func getNamed() *Named {
+	return namedPool.Get().(*Named)
+}
+
+// Release returns a Named to an internal pool so that a later
+// GetNamed or AllNamed can reuse it instead of allocating a new
+// one. After calling Release you must not use the Named at all; if
+// you want to keep its contents, copy them out first (a plain '*n'
+// copy is fine, as is n.Value()).
+//
+// Calling Release is optional. Nameds that are never released are
+// simply garbage collected as usual, but programs that call AllNamed
+// on large kstats over and over can cut their garbage a lot by
+// releasing the results once they're done with them.
+func (ks *Named) Release() {
+	if ks == nil {
+		return
+	}
+	ks.KStat = nil
+	namedPool.Put(ks)
+}
+
+// ReleaseAll calls Release on all of the Nameds in lst, for example
+// the result of AllNamed.
+func ReleaseAll(lst []*Named) {
+	for _, n := range lst {
+		n.Release()
+	}
+}
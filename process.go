@@ -0,0 +1,26 @@
+//
+// Processing Samples as they're produced.
+
+package kstat
+
+// Processor processes each Sample that a SampleSource produces
+// before it's delivered, normally to add Derived values to it.
+// Processors may keep state from Sample to Sample.
+type Processor interface {
+	Process(sm *Sample)
+}
+
+// ProcessorFunc lets an ordinary function be a Processor.
+type ProcessorFunc func(sm *Sample)
+
+// Process calls f(sm).
+func (f ProcessorFunc) Process(sm *Sample) {
+	f(sm)
+}
+
+// process runs a list of Processors on a Sample.
+func process(procs []Processor, sm *Sample) {
+	for _, p := range procs {
+		p.Process(sm)
+	}
+}
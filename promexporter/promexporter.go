@@ -0,0 +1,236 @@
+// Package promexporter exposes kstat statistics as Prometheus metrics.
+// A Collector takes a Snapshot of the selected kstats every time it's
+// scraped and turns each numeric Value into a metric, with the kstat
+// module, instance, and name as labels or as part of the metric name.
+//
+// A minimal Solaris node exporter looks like:
+//
+//	tok, err := kstat.Open()
+//	...
+//	sels, err := kstat.ParseSelectors([]string{"cpu::sys", "unix:0:system_misc"})
+//	...
+//	prometheus.MustRegister(promexporter.New(tok.Snapshot, promexporter.Options{Selectors: sels}))
+//	http.Handle("/metrics", promhttp.Handler())
+//	log.Fatal(http.ListenAndServe(":9100", nil))
+//
+// The Collector serializes its own use of the snapshot function, so
+// it's safe to register a Collector that uses a Token even though
+// Prometheus may scrape it concurrently, provided that nothing else
+// uses the Token.
+package promexporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/siebenmann/go-kstat"
+)
+
+// SnapshotFunc takes a Snapshot of the kstats matching the selectors.
+// Token.Snapshot and Token.CoherentSnapshot are SnapshotFuncs.
+type SnapshotFunc func(sels ...kstat.Selector) (*kstat.Snapshot, error)
+
+// Labels gives the names of the labels that the kstat module,
+// instance, and name of a Value are exported as. A blank label name
+// means that part isn't exported as a label.
+type Labels struct {
+	Module   string
+	Instance string
+	Name     string
+}
+
+// DefaultLabels are the labels used if Options.Labels is nil. The
+// module is part of the default metric name, so it isn't a label.
+// The labels are prefixed with kstat_ so that they don't clash with
+// the instance label that Prometheus adds itself.
+var DefaultLabels = Labels{Instance: "kstat_instance", Name: "kstat_name"}
+
+// Options control what a Collector exports and how.
+type Options struct {
+	// Selectors pick the statistics to export. If there are none,
+	// everything is exported.
+	Selectors []kstat.Selector
+
+	// Namespace is the prefix of the default metric names. If it's
+	// blank, "kstat" is used.
+	Namespace string
+
+	// Name returns the metric name for a Value. If it's nil,
+	// metrics are named namespace_module_stat. Names are
+	// sanitized to be valid Prometheus metric names, and Values
+	// whose name is "" are skipped.
+	Name func(v kstat.Value) string
+
+	// Labels maps the module, instance, and name of each Value to
+	// labels. If it's nil, DefaultLabels is used.
+	Labels *Labels
+
+	// ConstLabels are added to every metric.
+	ConstLabels prometheus.Labels
+
+	// Counters and Gauges pick out the statistics that are
+	// exported as counters and gauges respectively. Everything
+	// else is exported as untyped, since kstats don't say what
+	// sort of value a statistic is.
+	Counters []kstat.Selector
+	Gauges   []kstat.Selector
+
+	// Naming maps statistics to metric names (which get the
+	// Namespace in front of them) and labels, taking priority
+	// over Name and Labels for the statistics that it maps. All
+	// statistics mapped to the same name must have the same label
+	// names, or the scrape fails.
+	Naming *kstat.Naming
+}
+
+// Collector is a prometheus.Collector for kstats. It's an unchecked
+// Collector, because what metrics it has depends on the kstats that
+// exist at the time it's scraped.
+type Collector struct {
+	mu   sync.Mutex
+	snap SnapshotFunc
+	opts Options
+
+	labels Labels
+	lnames []string
+	errd   *prometheus.Desc
+}
+
+// New creates a Collector that gets kstats from snap.
+func New(snap SnapshotFunc, opts Options) *Collector {
+	c := &Collector{snap: snap, opts: opts, labels: DefaultLabels}
+	if c.opts.Namespace == "" {
+		c.opts.Namespace = "kstat"
+	}
+	if opts.Labels != nil {
+		c.labels = *opts.Labels
+	}
+	for _, l := range []string{c.labels.Module, c.labels.Instance, c.labels.Name} {
+		if l != "" {
+			c.lnames = append(c.lnames, l)
+		}
+	}
+	c.errd = prometheus.NewDesc(c.opts.Namespace+"_scrape_error",
+		"kstat snapshot failed", nil, c.opts.ConstLabels)
+	return c
+}
+
+// Describe sends nothing, which makes the Collector an unchecked
+// Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect takes a Snapshot and sends a metric for every numeric Value
+// in it. If the Snapshot fails, Collect sends an invalid metric with
+// the error, which fails the scrape.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	snap, err := c.snap(c.opts.Selectors...)
+	c.mu.Unlock()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.errd, err)
+		return
+	}
+
+	// All metrics with the same name must have the same Desc, so
+	// the first Value with a given name decides its help and type.
+	type metric struct {
+		desc *prometheus.Desc
+		tp   prometheus.ValueType
+	}
+	metrics := make(map[string]metric)
+	seen := make(map[string]bool)
+	for _, v := range snap.Values {
+		f, ok := v.Float()
+		if !ok {
+			continue
+		}
+		name, lnames, lvals := c.name(v), c.lnames, c.labelValues(v)
+		if mn, ok := c.opts.Naming.Map(v); ok {
+			name, lnames, lvals = SanitizeName(c.opts.Namespace+"_"+mn.Name), nil, nil
+			for _, l := range mn.Labels {
+				lnames = append(lnames, SanitizeName(strings.ReplaceAll(l.Name, ":", "_")))
+				lvals = append(lvals, l.Value)
+			}
+		}
+		if name == "" {
+			continue
+		}
+		key := name + "\xff" + strings.Join(lvals, "\xff")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		m, ok := metrics[name]
+		if !ok {
+			help := fmt.Sprintf("kstat %s:*:*:%s", v.Module, v.Stat)
+			m = metric{prometheus.NewDesc(name, help, lnames, c.opts.ConstLabels), c.valueType(v)}
+			metrics[name] = m
+		}
+		pm, err := prometheus.NewConstMetric(m.desc, m.tp, f, lvals...)
+		if err != nil {
+			pm = prometheus.NewInvalidMetric(m.desc, err)
+		}
+		ch <- pm
+	}
+}
+
+// name returns the sanitized metric name for a Value.
+func (c *Collector) name(v kstat.Value) string {
+	var name string
+	if c.opts.Name != nil {
+		name = c.opts.Name(v)
+	} else {
+		name = c.opts.Namespace + "_" + v.Module + "_" + v.Stat
+	}
+	return SanitizeName(name)
+}
+
+func (c *Collector) labelValues(v kstat.Value) []string {
+	var lvals []string
+	if c.labels.Module != "" {
+		lvals = append(lvals, v.Module)
+	}
+	if c.labels.Instance != "" {
+		lvals = append(lvals, fmt.Sprint(v.Instance))
+	}
+	if c.labels.Name != "" {
+		lvals = append(lvals, v.Name)
+	}
+	return lvals
+}
+
+func (c *Collector) valueType(v kstat.Value) prometheus.ValueType {
+	for _, sel := range c.opts.Counters {
+		if sel.Match(v) {
+			return prometheus.CounterValue
+		}
+	}
+	for _, sel := range c.opts.Gauges {
+		if sel.Match(v) {
+			return prometheus.GaugeValue
+		}
+	}
+	return prometheus.UntypedValue
+}
+
+// SanitizeName turns s into a valid Prometheus metric name by
+// replacing invalid characters with underscores, so that for example
+// "kstat_zfs_l2_hits.total" becomes "kstat_zfs_l2_hits_total".
+func SanitizeName(s string) string {
+	if s == "" {
+		return s
+	}
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
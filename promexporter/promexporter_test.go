@@ -0,0 +1,111 @@
+//
+// Test the Prometheus Collector.
+
+package promexporter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/promexporter"
+)
+
+func testSnapshot(sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	snap := &kstat.Snapshot{
+		Values: []kstat.Value{
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "syscall", Type: kstat.Uint64, UintVal: 100},
+			{Module: "cpu", Instance: 1, Name: "sys", Stat: "syscall", Type: kstat.Uint64, UintVal: 200},
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "cpu_nsec_idle", Type: kstat.Uint64, UintVal: 5},
+			{Module: "unix", Instance: 0, Name: "system_misc", Stat: "nproc", Type: kstat.Int32, IntVal: 42},
+			{Module: "unix", Instance: 0, Name: "system_misc", Stat: "boot.state", Type: kstat.String, StringVal: "up"},
+		},
+	}
+	if len(sels) > 0 {
+		snap = snap.Select(sels...)
+	}
+	return snap, nil
+}
+
+func TestCollector(t *testing.T) {
+	sel, _ := kstat.ParseSelector("cpu::sys:syscall")
+	c := promexporter.New(testSnapshot, promexporter.Options{
+		Selectors: []kstat.Selector{sel},
+		Counters:  []kstat.Selector{sel},
+	})
+	exp := `
+# HELP kstat_cpu_syscall kstat cpu:*:*:syscall
+# TYPE kstat_cpu_syscall counter
+kstat_cpu_syscall{kstat_instance="0",kstat_name="sys"} 100
+kstat_cpu_syscall{kstat_instance="1",kstat_name="sys"} 200
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(exp)); err != nil {
+		t.Fatalf("wrong metrics: %s", err)
+	}
+}
+
+func TestCollectorNaming(t *testing.T) {
+	c := promexporter.New(testSnapshot, promexporter.Options{
+		Name: func(v kstat.Value) string {
+			if v.Module != "unix" {
+				return ""
+			}
+			return "solaris_" + v.Stat
+		},
+		Labels:      &promexporter.Labels{Module: "module"},
+		ConstLabels: prometheus.Labels{"zone": "global"},
+	})
+	exp := `
+# HELP solaris_nproc kstat unix:*:*:nproc
+# TYPE solaris_nproc untyped
+solaris_nproc{module="unix",zone="global"} 42
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(exp)); err != nil {
+		t.Fatalf("wrong metrics: %s", err)
+	}
+}
+
+func TestCollectorKStatNaming(t *testing.T) {
+	n, err := kstat.NewNaming(kstat.NamingRule{Match: `cpu:(\d+):sys:syscall`, Name: "syscalls", Labels: map[string]string{"cpu": "$1"}})
+	if err != nil {
+		t.Fatalf("NewNaming failed: %s", err)
+	}
+	sel, _ := kstat.ParseSelector("cpu::sys:syscall")
+	c := promexporter.New(testSnapshot, promexporter.Options{Selectors: []kstat.Selector{sel}, Naming: n})
+	exp := `
+# HELP kstat_syscalls kstat cpu:*:*:syscall
+# TYPE kstat_syscalls untyped
+kstat_syscalls{cpu="0"} 100
+kstat_syscalls{cpu="1"} 200
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(exp)); err != nil {
+		t.Fatalf("wrong metrics: %s", err)
+	}
+}
+
+func TestCollectorError(t *testing.T) {
+	c := promexporter.New(func(...kstat.Selector) (*kstat.Snapshot, error) {
+		return nil, errors.New("no kstats")
+	}, promexporter.Options{})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	if _, err := reg.Gather(); err == nil || !strings.Contains(err.Error(), "no kstats") {
+		t.Fatalf("Gather did not fail properly: %v", err)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	for in, out := range map[string]string{
+		"kstat_zfs_l2_hits.total": "kstat_zfs_l2_hits_total",
+		"9lives":                  "_lives",
+		"a:b-c":                   "a:b_c",
+		"":                        "",
+	} {
+		if s := promexporter.SanitizeName(in); s != out {
+			t.Fatalf("SanitizeName(%q) is %q, not %q", in, s, out)
+		}
+	}
+}
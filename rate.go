@@ -0,0 +1,141 @@
+//
+// Rates of change of counter statistics.
+
+package kstat
+
+import (
+	"time"
+)
+
+// Rate is the per-second rate of change of a counter statistic
+// between two readings of it.
+type Rate struct {
+	// Value is the more recent of the two readings.
+	Value Value
+	// Rate is the change per second and Delta the total change.
+	Rate  float64
+	Delta float64
+	// Elapsed is the time between the two readings, according to
+	// their Snaptimes.
+	Elapsed time.Duration
+	// Wrapped is true if the counter wrapped around between the
+	// readings. Delta and Rate have been corrected for this.
+	Wrapped bool
+}
+
+// delta returns cur - prev for numeric Values of the same type.
+func delta(prev, cur Value) (float64, bool) {
+	switch cur.Type {
+	case Int32, Int64:
+		return float64(cur.IntVal - prev.IntVal), true
+	case Uint32, Uint64:
+		if cur.UintVal >= prev.UintVal {
+			return float64(cur.UintVal - prev.UintVal), true
+		}
+		return -float64(prev.UintVal - cur.UintVal), true
+	}
+	return 0, false
+}
+
+// unwrap32 corrects the difference between two readings of a 32-bit
+// statistic for the statistic wrapping around in between them. We
+// assume that a 32-bit statistic that went down by more than half of
+// its range actually wrapped around, since a real drop that large is
+// very unlikely. It returns true if it made a correction.
+func unwrap32(tp NamedType, d float64) (float64, bool) {
+	if (tp == Int32 || tp == Uint32) && d < -(1<<31) {
+		return d + (1 << 32), true
+	}
+	return d, false
+}
+
+// counterDelta returns cur - prev for two readings of a counter,
+// corrected for 32-bit wraparound, and whether it wrapped. It fails
+// if the counter went backwards, which means that it was reset.
+func counterDelta(prev, cur Value) (float64, bool, bool) {
+	d, ok := delta(prev, cur)
+	if !ok {
+		return 0, false, false
+	}
+	d, wrapped := unwrap32(cur.Type, d)
+	if d < 0 {
+		return 0, false, false
+	}
+	return d, wrapped, true
+}
+
+// ComputeRate computes the rate of change between two readings of
+// the same counter. It uses the difference between the readings'
+// Snaptimes, not the wall clock time they were taken at, so that the
+// rate is accurate even if the readings were delayed. It fails
+// (returning false) if the readings are not numeric, are not of the
+// same statistic and type, are from different incarnations of the
+// kstat (ie, they have different Crtimes), or if cur is not more
+// recent than prev.
+//
+// 32-bit counters that wrap around are corrected for (and the Rate
+// is marked as Wrapped). Any other counter that goes backwards is
+// taken to have been reset, and ComputeRate fails instead of
+// returning a bogus negative rate.
+func ComputeRate(prev, cur Value) (Rate, bool) {
+	if prev.String() != cur.String() || prev.Type != cur.Type || prev.Crtime != cur.Crtime || cur.Snaptime <= prev.Snaptime {
+		return Rate{}, false
+	}
+	d, wrapped, ok := counterDelta(prev, cur)
+	if !ok {
+		return Rate{}, false
+	}
+	el := time.Duration(cur.Snaptime - prev.Snaptime)
+	return Rate{Value: cur, Rate: d / el.Seconds(), Delta: d, Elapsed: el, Wrapped: wrapped}, true
+}
+
+// CounterTracker computes rates for counter statistics from
+// successive readings of them, remembering the previous reading of
+// each statistic.
+type CounterTracker struct {
+	last map[string]Value
+}
+
+// NewCounterTracker creates a new, empty CounterTracker.
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{last: make(map[string]Value)}
+}
+
+// Update records a new reading of a statistic and returns its rate
+// since the previous reading, if there is one and ComputeRate can
+// compute a rate from the two. After a counter is reset there's no
+// rate for that reading, but the next one will have one.
+func (ct *CounterTracker) Update(v Value) (Rate, bool) {
+	key := v.String()
+	prev, ok := ct.last[key]
+	ct.last[key] = v
+	if !ok {
+		return Rate{}, false
+	}
+	return ComputeRate(prev, v)
+}
+
+// UpdateSample records all of the readings in a Sample and returns
+// rates for the ones that it can. Statistics that are not in the
+// Sample are forgotten.
+func (ct *CounterTracker) UpdateSample(sm *Sample) []Rate {
+	var rates []Rate
+	last := make(map[string]Value, len(sm.Values))
+	for _, v := range sm.Values {
+		key := v.String()
+		if prev, ok := ct.last[key]; ok {
+			if r, ok := ComputeRate(prev, v); ok {
+				rates = append(rates, r)
+			}
+		}
+		last[key] = v
+	}
+	ct.last = last
+	return rates
+}
+
+// Forget discards the previous reading of a statistic, so that the
+// next Update of it starts over.
+func (ct *CounterTracker) Forget(v Value) {
+	delete(ct.last, v.String())
+}
@@ -0,0 +1,96 @@
+//
+// Test rate computations.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func counter(snaptime int64, v uint64) kstat.Value {
+	return kstat.Value{Module: "cpu", Instance: 0, Name: "sys", Stat: "syscall", Type: kstat.Uint64, UintVal: v, Crtime: 100, Snaptime: snaptime}
+}
+
+func TestComputeRate(t *testing.T) {
+	sec := int64(time.Second)
+	r, ok := kstat.ComputeRate(counter(sec, 100), counter(3*sec, 300))
+	if !ok || r.Rate != 100 || r.Elapsed != 2*time.Second {
+		t.Fatalf("bad rate: %v %+v", ok, r)
+	}
+	if r.Delta != 200 || r.Wrapped {
+		t.Fatalf("bad rate delta: %+v", r)
+	}
+
+	// Going backwards is a counter reset.
+	if r, ok = kstat.ComputeRate(counter(sec, 300), counter(2*sec, 100)); ok {
+		t.Fatalf("rate across a reset succeeded: %+v", r)
+	}
+
+	// 32-bit counters can wrap around, but only a long way.
+	pw, cw := counter(sec, math.MaxUint32-9), counter(2*sec, 10)
+	pw.Type, cw.Type = kstat.Uint32, kstat.Uint32
+	r, ok = kstat.ComputeRate(pw, cw)
+	if !ok || r.Rate != 20 || !r.Wrapped {
+		t.Fatalf("bad wrapped rate: %v %+v", ok, r)
+	}
+	pw.UintVal = 100
+	if r, ok = kstat.ComputeRate(pw, cw); ok {
+		t.Fatalf("rate across a 32-bit reset succeeded: %+v", r)
+	}
+	pw = kstat.Value{Module: "m", Stat: "s", Type: kstat.Int32, IntVal: math.MaxInt32, Snaptime: sec}
+	cw = kstat.Value{Module: "m", Stat: "s", Type: kstat.Int32, IntVal: math.MinInt32 + 1, Snaptime: 2 * sec}
+	if r, ok = kstat.ComputeRate(pw, cw); !ok || r.Delta != 2 || !r.Wrapped {
+		t.Fatalf("bad wrapped signed rate: %v %+v", ok, r)
+	}
+
+	// Things that should fail.
+	if _, ok = kstat.ComputeRate(counter(sec, 1), counter(sec, 2)); ok {
+		t.Fatalf("rate with no elapsed time succeeded")
+	}
+	c := counter(2*sec, 2)
+	c.Crtime = 200
+	if _, ok = kstat.ComputeRate(counter(sec, 1), c); ok {
+		t.Fatalf("rate with different crtimes succeeded")
+	}
+	c = counter(2*sec, 2)
+	c.Stat = "sysread"
+	if _, ok = kstat.ComputeRate(counter(sec, 1), c); ok {
+		t.Fatalf("rate between different stats succeeded")
+	}
+	s1 := kstat.Value{Stat: "s", Type: kstat.String, Snaptime: 1}
+	s2 := kstat.Value{Stat: "s", Type: kstat.String, Snaptime: 2}
+	if _, ok = kstat.ComputeRate(s1, s2); ok {
+		t.Fatalf("rate between strings succeeded")
+	}
+}
+
+func TestCounterTracker(t *testing.T) {
+	sec := int64(time.Second)
+	ct := kstat.NewCounterTracker()
+	if _, ok := ct.Update(counter(sec, 10)); ok {
+		t.Fatalf("first Update gave a rate")
+	}
+	r, ok := ct.Update(counter(2*sec, 20))
+	if !ok || r.Rate != 10 {
+		t.Fatalf("bad Update rate: %v %+v", ok, r)
+	}
+
+	other := counter(2*sec, 5)
+	other.Instance = 1
+	rates := ct.UpdateSample(&kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{counter(4*sec, 60), other}}})
+	if len(rates) != 1 || rates[0].Rate != 20 {
+		t.Fatalf("bad UpdateSample rates: %+v", rates)
+	}
+	rates = ct.UpdateSample(&kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{other}}})
+	if len(rates) != 0 {
+		t.Fatalf("UpdateSample gave rates with no time passing: %+v", rates)
+	}
+	// cpu:0:sys:syscall should now have been forgotten.
+	if _, ok := ct.Update(counter(5*sec, 70)); ok {
+		t.Fatalf("UpdateSample did not forget a missing statistic")
+	}
+}
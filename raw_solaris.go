@@ -167,51 +167,60 @@ func safeThing(t reflect.Type) bool {
 // TODO: add floats to the supported list? It's unlikely to be needed
 // but it should just work.
 
-// CopyTo copies a RawStat KStat into a struct that you supply a
-// pointer to. The size of the struct must exactly match the size of
-// the RawStat's data.
+// CopyTo copies a KStat into a struct that you supply a pointer to.
 //
-// CopyStat imposes conditions on the struct that you are copying to:
-// it must be composed entirely of primitive integer types with defined
-// sizes (intN and uintN), or arrays and structs that ultimately only
-// contain them. All fields should be exported.
+// For named and IO KStats, it copies statistics into the struct's
+// fields by name as CopyValues does, with the statistics that Values
+// returns. Like Values, it does not refresh the KStat.
 //
-// If you give CopyStat a bad argument, it generally panics.
+// For RawStat KStats, it copies the raw data. The size of the struct
+// must exactly match the size of the RawStat's data, and CopyTo
+// imposes conditions on the struct that you are copying to: it must
+// be composed entirely of primitive integer types with defined sizes
+// (intN and uintN), or arrays and structs that ultimately only contain
+// them. All fields should be exported.
+//
+// If you give CopyTo a bad argument, it generally panics.
 //
 // This API is provisional and may be changed or deleted.
 func (k *KStat) CopyTo(ptr interface{}) error {
+	return k.CopyToWith(ptr, CopyOptions{})
+}
+
+// CopyToWith is CopyTo with CopyOptions, which apply when copying a
+// named or IO KStat (and are ignored for RawStat KStats).
+func (k *KStat) CopyToWith(ptr interface{}, opts CopyOptions) error {
 	if err := k.prep(); err != nil {
 		return err
 	}
 
+	if k.Type == NamedStat || k.Type == IoStat {
+		dst := checkPtr("CopyTo", ptr)
+		vals, err := k.Values()
+		if err != nil {
+			return err
+		}
+		byName := make(map[string]Value, len(vals))
+		for _, v := range vals {
+			byName[v.Stat] = v
+		}
+		if err := bindStruct(byName, dst, opts); err != nil {
+			return fmt.Errorf("%s: %s", k, err)
+		}
+		return nil
+	}
 	if k.Type != RawStat {
-		return errors.New("KStat is not a RawStat")
+		return errors.New("KStat is not a RawStat, NamedStat, or IoStat")
 	}
 
 	// Validity checks: not nil value, not nil pointer value,
 	// is a pointer to struct.
-	if ptr == nil {
-		panic("CopyTo given nil pointer")
-	}
-	vp := reflect.ValueOf(ptr)
-	if vp.Kind() != reflect.Ptr {
-		panic("CopyTo not given a pointer")
-	}
-	if vp.IsNil() {
-		panic("CopyTo given nil pointer")
-	}
-	dst := vp.Elem()
-	if dst.Kind() != reflect.Struct {
-		panic("CopyTo: not pointer to struct")
-	}
+	dst := checkPtr("CopyTo", ptr)
 	// Is the struct safe to copy into, which means primitive types
 	// and structs/arrays of primitive types?
 	if !safeThing(dst.Type()) {
 		panic("CopyTo: not a safe structure, contains unsupported fields")
 	}
-	if !dst.CanSet() {
-		panic("CopyTo: struct cannot be set for some reason")
-	}
 
 	// Verify that the size of the target struct matches the size
 	// of the raw KStat.
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 //
 // Test raw access to KStats.
 
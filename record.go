@@ -0,0 +1,261 @@
+//
+// Recording streams of Snapshots and replaying them later.
+
+package kstat
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SampleSource is something that produces a series of Samples, such
+// as a Sampler (which takes them live) or a Replayer (which plays
+// back recorded ones). Its methods behave as documented for Sampler.
+type SampleSource interface {
+	Sample() (*Sample, error)
+	Run(fn func(*Sample)) error
+	RunContext(ctx context.Context, fn func(*Sample)) error
+	Start() <-chan *Sample
+	Stop()
+	Err() error
+	AddProcessor(p Processor)
+	AddSink(sk Sink)
+}
+
+// Recorder writes a stream of Snapshots to an io.Writer (normally a
+// file) in the binary form written by SnapshotWriter, so that they
+// can be played back later with a Replayer. Because the Snapshots
+// have their times in them, the playback can reproduce the original
+// timing.
+type Recorder struct {
+	sw *SnapshotWriter
+	bw *bufio.Writer
+	f  *os.File
+}
+
+// NewRecorder creates a Recorder that writes to w. Output is
+// buffered; call Flush or Close when you're done.
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	return &Recorder{sw: NewSnapshotWriter(bw), bw: bw}
+}
+
+// CreateRecording creates (or truncates) the file path and returns a
+// Recorder that writes to it.
+func CreateRecording(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.f = f
+	return r, nil
+}
+
+// Record adds a Snapshot to the recording.
+func (r *Recorder) Record(snap *Snapshot) error {
+	return r.sw.Write(snap)
+}
+
+// Write records a Sample's Snapshot, so that a Recorder can be a
+// Sink. Derived values and errors are not recorded.
+func (r *Recorder) Write(sm *Sample) error {
+	return r.Record(&sm.Snapshot)
+}
+
+// RecordSamples records every Sample from a SampleSource until the
+// SampleSource stops, then flushes the recording. It returns the
+// first error from recording or from the SampleSource.
+func (r *Recorder) RecordSamples(src SampleSource) error {
+	var rerr error
+	err := src.Run(func(sm *Sample) {
+		if rerr == nil {
+			rerr = r.Record(&sm.Snapshot)
+			if rerr != nil {
+				src.Stop()
+			}
+		}
+	})
+	if ferr := r.Flush(); rerr == nil {
+		rerr = ferr
+	}
+	if rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (r *Recorder) Flush() error {
+	return r.bw.Flush()
+}
+
+// Close flushes the recording and, if the Recorder was created by
+// CreateRecording, closes the file.
+func (r *Recorder) Close() error {
+	err := r.Flush()
+	if r.f != nil {
+		if cerr := r.f.Close(); err == nil {
+			err = cerr
+		}
+		r.f = nil
+	}
+	return err
+}
+
+// Replayer plays back a recording made by a Recorder as a series of
+// Samples, through the same API as a Sampler. Run and Start wait
+// between Samples for as long as passed between them in the
+// recording, divided by the Replayer's speed; Sample returns the
+// next Sample immediately. A Replayer stops at the end of the
+// recording.
+type Replayer struct {
+	sr    *SnapshotReader
+	f     *os.File
+	speed float64
+	last  time.Time
+	procs []Processor
+	sinks []Sink
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error
+}
+
+// NewReplayer creates a Replayer that reads a recording from r and
+// plays it back at the original speed.
+func NewReplayer(r io.Reader) *Replayer {
+	return &Replayer{sr: NewSnapshotReader(r), speed: 1, stop: make(chan struct{})}
+}
+
+// OpenRecording opens the recording in the file path for replay.
+func OpenRecording(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rp := NewReplayer(f)
+	rp.f = f
+	return rp, nil
+}
+
+// SetSpeed sets how fast Run and Start play back the recording
+// relative to the original speed; 2 is twice as fast. A speed of 0
+// or less plays it back as fast as possible.
+func (rp *Replayer) SetSpeed(speed float64) {
+	rp.speed = speed
+}
+
+// Sample returns the next Sample in the recording, or io.EOF at the
+// end of it.
+func (rp *Replayer) Sample() (*Sample, error) {
+	snap, err := rp.sr.Read()
+	if err != nil {
+		return nil, err
+	}
+	sm := &Sample{Snapshot: *snap}
+	process(rp.procs, sm)
+	writeSinks(rp.sinks, sm)
+	return sm, nil
+}
+
+// AddProcessor adds a Processor that is run on every replayed
+// Sample, as with Sampler.AddProcessor.
+func (rp *Replayer) AddProcessor(p Processor) {
+	rp.procs = append(rp.procs, p)
+}
+
+// AddSink adds a Sink that every replayed Sample is written to, as
+// with Sampler.AddSink.
+func (rp *Replayer) AddSink(sk Sink) {
+	rp.sinks = append(rp.sinks, sk)
+}
+
+// Run calls fn with each Sample in the recording, waiting between
+// them, until the end of the recording or the Replayer is stopped.
+// It returns nil in either case.
+func (rp *Replayer) Run(fn func(*Sample)) error {
+	return rp.RunContext(context.Background(), fn)
+}
+
+// RunContext is Run with a Context. It also stops if the Context is
+// canceled or times out, returning the Context's error.
+func (rp *Replayer) RunContext(ctx context.Context, fn func(*Sample)) error {
+	defer flushSinks(rp.sinks)
+	for {
+		sm, err := rp.Sample()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			rp.err = err
+			return err
+		}
+
+		if !rp.last.IsZero() && rp.speed > 0 {
+			wait := time.Duration(float64(sm.Time.Sub(rp.last)) / rp.speed)
+			if wait > 0 {
+				select {
+				case <-rp.stop:
+					return nil
+				case <-ctx.Done():
+					rp.err = ctx.Err()
+					return rp.err
+				case <-time.After(wait):
+				}
+			}
+		}
+		rp.last = sm.Time
+
+		select {
+		case <-rp.stop:
+			return nil
+		case <-ctx.Done():
+			rp.err = ctx.Err()
+			return rp.err
+		default:
+		}
+		fn(sm)
+	}
+}
+
+// Start runs the Replayer in a new goroutine, delivering Samples on
+// the returned channel, which is closed at the end of the recording.
+func (rp *Replayer) Start() <-chan *Sample {
+	c := make(chan *Sample)
+	go func() {
+		defer close(c)
+		rp.Run(func(sm *Sample) {
+			select {
+			case c <- sm:
+			case <-rp.stop:
+			}
+		})
+	}()
+	return c
+}
+
+// Stop stops a running Replayer.
+func (rp *Replayer) Stop() {
+	rp.stopOnce.Do(func() { close(rp.stop) })
+}
+
+// Err returns the error that stopped a Replayer, if any.
+func (rp *Replayer) Err() error {
+	return rp.err
+}
+
+// Close closes the recording file if the Replayer was created by
+// OpenRecording.
+func (rp *Replayer) Close() error {
+	if rp.f == nil {
+		return nil
+	}
+	err := rp.f.Close()
+	rp.f = nil
+	return err
+}
@@ -0,0 +1,133 @@
+//
+// Test recording and replay.
+
+package kstat_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// recordSnapshots records n variants of testSnapshot() to path, gap
+// apart.
+func recordSnapshots(t *testing.T, path string, n int, gap time.Duration) {
+	r, err := kstat.CreateRecording(path)
+	if err != nil {
+		t.Fatalf("CreateRecording failed: %s", err)
+	}
+	snap := testSnapshot()
+	for i := 0; i < n; i++ {
+		snap.Values[0].UintVal = uint64(i)
+		if err = r.Record(snap); err != nil {
+			t.Fatalf("Record failed: %s", err)
+		}
+		snap.Time = snap.Time.Add(gap)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec")
+	recordSnapshots(t, path, 3, 50*time.Millisecond)
+
+	rp, err := kstat.OpenRecording(path)
+	if err != nil {
+		t.Fatalf("OpenRecording failed: %s", err)
+	}
+	var src kstat.SampleSource = rp
+	start := time.Now()
+	n := 0
+	for sm := range src.Start() {
+		if sm.Values[0].UintVal != uint64(n) {
+			t.Fatalf("Sample %d has the wrong value: %+v", n, sm.Values[0])
+		}
+		n++
+	}
+	if n != 3 || src.Err() != nil {
+		t.Fatalf("replayed %d Samples, error %v", n, src.Err())
+	}
+	if el := time.Since(start); el < 100*time.Millisecond {
+		t.Fatalf("replay did not keep the original timing: %s", el)
+	}
+	rp.Close()
+
+	// Fast replay, stopping early.
+	rp, err = kstat.OpenRecording(path)
+	if err != nil {
+		t.Fatalf("OpenRecording failed: %s", err)
+	}
+	rp.SetSpeed(0)
+	n = 0
+	rp.Run(func(sm *kstat.Sample) {
+		n++
+		rp.Stop()
+	})
+	if n != 1 {
+		t.Fatalf("Stop did not stop replay: %d Samples", n)
+	}
+	rp.Close()
+}
+
+// A canceled Context should stop a slow replay promptly.
+func TestReplayContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec")
+	recordSnapshots(t, path, 3, time.Hour)
+	rp, err := kstat.OpenRecording(path)
+	if err != nil {
+		t.Fatalf("OpenRecording failed: %s", err)
+	}
+	defer rp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	n := 0
+	err = rp.RunContext(ctx, func(*kstat.Sample) { n++ })
+	if err != context.DeadlineExceeded || n != 1 || rp.Err() != err {
+		t.Fatalf("RunContext returned %v after %d Samples", err, n)
+	}
+}
+
+// Record a Replayer into a new recording, which should then have the
+// same Samples.
+func TestRecordSamples(t *testing.T) {
+	dir := t.TempDir()
+	p1, p2 := filepath.Join(dir, "one"), filepath.Join(dir, "two")
+	recordSnapshots(t, p1, 4, time.Second)
+
+	rp, err := kstat.OpenRecording(p1)
+	if err != nil {
+		t.Fatalf("OpenRecording failed: %s", err)
+	}
+	rp.SetSpeed(0)
+	r, err := kstat.CreateRecording(p2)
+	if err != nil {
+		t.Fatalf("CreateRecording failed: %s", err)
+	}
+	if err = r.RecordSamples(rp); err != nil {
+		t.Fatalf("RecordSamples failed: %s", err)
+	}
+	r.Close()
+	rp.Close()
+
+	rp, err = kstat.OpenRecording(p2)
+	if err != nil {
+		t.Fatalf("OpenRecording failed: %s", err)
+	}
+	for i := 0; i < 4; i++ {
+		sm, err := rp.Sample()
+		if err != nil || sm.Values[0].UintVal != uint64(i) {
+			t.Fatalf("bad Sample %d: %v %s", i, sm, err)
+		}
+	}
+	if _, err = rp.Sample(); err != io.EOF {
+		t.Fatalf("no EOF at end of recording: %v", err)
+	}
+	rp.Close()
+}
@@ -0,0 +1,144 @@
+// Package restapi serves kstats as a simple REST/JSON HTTP API, for
+// quick integrations, debugging with curl, and web dashboards. It
+// serves any kstatrpc.Source, so it can front either the local host's
+// kstats or a remote host's.
+//
+// The endpoints are:
+//
+//	GET /kstats[?selector=S...]
+//		the kstats (without statistics), optionally only the
+//		ones matching any of the selectors
+//	GET /kstats/{module}/{instance}/{name}[?refresh=1]
+//		one kstat and its statistics, freshly read if refresh
+//		is set
+//	GET /sample[?selector=S...]
+//		a Snapshot of the kstats matching the selectors (or of
+//		everything, which is large)
+//
+// Every successful response is a Snapshot in the JSON form that
+// kstat.Snapshot.MarshalJSON produces, so clients can decode any of
+// them into a kstat.Snapshot. Errors are {"error": "..."} with a
+// suitable HTTP status. Selectors are in the form that
+// kstat.ParseSelector accepts.
+//
+// To embed the API under a prefix in an existing server:
+//
+//	http.Handle("/api/", http.StripPrefix("/api", restapi.NewHandler(kstatrpc.TokenSource(tok))))
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstatrpc"
+)
+
+// Handler is the http.Handler for the API.
+type Handler struct {
+	src kstatrpc.Source
+}
+
+// NewHandler creates a Handler that serves kstats from src.
+func NewHandler(src kstatrpc.Source) *Handler {
+	return &Handler{src: src}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	sels, err := kstat.ParseSelectors(r.URL.Query()["selector"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "kstats":
+		h.kstats(w, r, sels)
+	case strings.HasPrefix(path, "kstats/"):
+		h.kstat(w, r, strings.Split(path, "/")[1:])
+	case path == "sample":
+		snap, err := h.src.Sample(r.Context(), sels...)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, snap)
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+func (h *Handler) kstats(w http.ResponseWriter, r *http.Request, sels []kstat.Selector) {
+	ks, err := h.src.All(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	snap := &kstat.Snapshot{Time: time.Now()}
+	for _, ki := range ks {
+		if matchKStat(sels, ki) {
+			snap.KStats = append(snap.KStats, ki)
+		}
+	}
+	writeJSON(w, snap)
+}
+
+func matchKStat(sels []kstat.Selector, ki kstat.KStatInfo) bool {
+	if len(sels) == 0 {
+		return true
+	}
+	for _, sel := range sels {
+		if sel.MatchKStat(ki.Module, ki.Instance, ki.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) kstat(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 3 {
+		writeError(w, http.StatusNotFound, "kstats must be /kstats/{module}/{instance}/{name}")
+		return
+	}
+	inst, err := strconv.Atoi(parts[1])
+	if err != nil || inst < 0 {
+		writeError(w, http.StatusBadRequest, "bad instance "+strconv.Quote(parts[1]))
+		return
+	}
+	lookup := h.src.Lookup
+	if v := r.URL.Query().Get("refresh"); v != "" && v != "0" && v != "false" {
+		lookup = h.src.Refresh
+	}
+	ki, vals, err := lookup(r.Context(), parts[0], inst, parts[2])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, &kstat.Snapshot{Time: time.Now(), KStats: []kstat.KStatInfo{ki}, Values: vals})
+}
+
+func writeJSON(w http.ResponseWriter, snap *kstat.Snapshot) {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,87 @@
+//
+// Test the REST API, using a fake Source.
+
+package restapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/restapi"
+)
+
+var (
+	cpu  = kstat.KStatInfo{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: 100, Snaptime: 2000}
+	zfs  = kstat.KStatInfo{Module: "zfs", Instance: 0, Name: "arcstats", Class: "misc", Type: kstat.NamedStat, Crtime: 100, Snaptime: 2000}
+	sysc = kstat.Value{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Stat: "syscall", Type: kstat.Uint64, UintVal: 1234, Crtime: 100, Snaptime: 2000}
+)
+
+type fakeSource struct {
+	refreshed bool
+}
+
+func (f *fakeSource) All(ctx context.Context) ([]kstat.KStatInfo, error) {
+	return []kstat.KStatInfo{cpu, zfs}, nil
+}
+
+func (f *fakeSource) Lookup(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	if module != "cpu" || instance != 0 || name != "sys" {
+		return kstat.KStatInfo{}, nil, errors.New("no such kstat")
+	}
+	return cpu, []kstat.Value{sysc}, nil
+}
+
+func (f *fakeSource) Refresh(ctx context.Context, module string, instance int, name string) (kstat.KStatInfo, []kstat.Value, error) {
+	f.refreshed = true
+	return f.Lookup(ctx, module, instance, name)
+}
+
+func (f *fakeSource) Sample(ctx context.Context, sels ...kstat.Selector) (*kstat.Snapshot, error) {
+	snap := &kstat.Snapshot{KStats: []kstat.KStatInfo{cpu}, Values: []kstat.Value{sysc}}
+	return snap.Select(sels...), nil
+}
+
+// get fetches a URL from h and decodes the Snapshot it returns.
+func get(t *testing.T, h http.Handler, url string, status int) *kstat.Snapshot {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	if rec.Code != status {
+		t.Fatalf("GET %s: status %d, not %d: %s", url, rec.Code, status, rec.Body)
+	}
+	var snap kstat.Snapshot
+	if status == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+			t.Fatalf("GET %s: bad JSON: %s", url, err)
+		}
+	}
+	return &snap
+}
+
+func TestHandler(t *testing.T) {
+	src := &fakeSource{}
+	h := restapi.NewHandler(src)
+
+	if snap := get(t, h, "/kstats", http.StatusOK); len(snap.KStats) != 2 || len(snap.Values) != 0 {
+		t.Fatalf("wrong /kstats: %+v", snap)
+	}
+	if snap := get(t, h, "/kstats?selector=zfs:0", http.StatusOK); len(snap.KStats) != 1 || snap.KStats[0] != zfs {
+		t.Fatalf("wrong selected /kstats: %+v", snap)
+	}
+	snap := get(t, h, "/kstats/cpu/0/sys?refresh=1", http.StatusOK)
+	if len(snap.Values) != 1 || snap.Values[0] != sysc || !src.refreshed {
+		t.Fatalf("wrong kstat: %+v", snap)
+	}
+	if snap = get(t, h, "/sample?selector=cpu::sys:syscall", http.StatusOK); len(snap.Values) != 1 {
+		t.Fatalf("wrong /sample: %+v", snap)
+	}
+
+	get(t, h, "/kstats/cpu/1/sys", http.StatusNotFound)
+	get(t, h, "/kstats/cpu/x/sys", http.StatusBadRequest)
+	get(t, h, "/sample?selector=a:b", http.StatusBadRequest)
+	get(t, h, "/nothing", http.StatusNotFound)
+}
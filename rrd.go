@@ -0,0 +1,544 @@
+//
+// Round-robin files of consolidated statistics, in the style of RRDtool.
+
+package kstat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Consolidation is how an RRD archive combines the readings in each
+// of its rows into one value.
+type Consolidation int
+
+// The Consolidations.
+const (
+	ConsolidateAverage Consolidation = iota
+	ConsolidateMin
+	ConsolidateMax
+	ConsolidateLast
+)
+
+func (c Consolidation) String() string {
+	switch c {
+	case ConsolidateAverage:
+		return "average"
+	case ConsolidateMin:
+		return "min"
+	case ConsolidateMax:
+		return "max"
+	case ConsolidateLast:
+		return "last"
+	}
+	return fmt.Sprintf("Consolidation(%d)", int(c))
+}
+
+// RRDSource is a statistic that an RRD keeps. Stat is its
+// module:instance:name:statistic name (ie, Value.String()) or the name
+// of a Derived value. If Counter is set, the RRD keeps the statistic's
+// per-second rate (as computed by ComputeRate) instead of its value.
+type RRDSource struct {
+	Stat    string
+	Counter bool
+}
+
+// RRDArchive is one archive of an RRD: Rows rows, each of which is
+// the Consolidation of the readings in a Resolution-long interval.
+// An archive covers Rows * Resolution of time.
+type RRDArchive struct {
+	Consolidation Consolidation
+	Resolution    time.Duration
+	Rows          int
+}
+
+// RRDRow is a row of an RRD archive. Time is the start of the row's
+// interval; Values has a value for each of the RRD's sources, in
+// order, which is NaN if there were no readings of it.
+type RRDRow struct {
+	Time   time.Time
+	Values []float64
+}
+
+// RRD is a fixed-size file that keeps a bounded history of a fixed
+// set of statistics, like an RRDtool database: it has one or more
+// archives, each of which holds a fixed number of rows at a fixed
+// resolution, and once an archive is full each new row overwrites the
+// oldest one. For example, archives of {ConsolidateAverage, time.Minute,
+// 1440} and {ConsolidateMax, time.Hour, 24 * 90} keep a day of
+// per-minute averages and 90 days of hourly maximums.
+//
+// Rows are aligned to multiples of their Resolution since the Unix
+// epoch, using the wall clock Time of Samples; a row is written out
+// when a Sample from a later row comes in. Rows that no Samples fall
+// in have NaN values.
+//
+// Rates of counter sources come from successive Samples written to
+// the same RRD, so the first Sample written after an RRD is opened
+// has no rates.
+type RRD struct {
+	f       *os.File
+	sources []RRDSource
+	index   map[string]int
+	arcs    []*rrdArchive
+	last    int64
+	ct      *CounterTracker
+	vals    []float64
+
+	stateOff int64
+	state    []byte
+}
+
+// rrdArchive is an RRDArchive and the state of its current row.
+type rrdArchive struct {
+	RRDArchive
+	off   int64 // file offset of the archive's rows
+	first int64 // first row, or noRow
+	cur   int64 // row being accumulated, or noRow
+	done  int64 // last row written out, or noRow
+	acc   []float64
+	n     []uint32
+}
+
+const noRow = math.MinInt64
+
+// An RRD file is a header, the state, and the archives' rows. The
+// header is:
+//
+//	[8]byte  rrdMagic
+//	uint8    RRDVersion
+//	uint16   number of sources
+//	uint16   number of archives
+//	for each source:
+//	    uint8    1 if a counter, else 0
+//	    uint16   length of Stat
+//	    []byte   Stat
+//	for each archive:
+//	    uint8    Consolidation
+//	    int64    Resolution
+//	    uint32   Rows
+//
+// The state is the Unix nanosecond time of the last Sample, then for
+// each archive its first, current, and last written rows (int64,
+// noRow if none) and, for each source, the float64 consolidated
+// value and uint32 count of readings so far in the current row. The rows of
+// each archive are Rows * number of sources float64s, with row r at
+// index r % Rows. Everything is big-endian.
+const (
+	rrdMagic   = "KSTATRRD"
+	RRDVersion = 1
+)
+
+var errBadRRD = errors.New("bad RRD file")
+
+// CreateRRD creates a new RRD file at path with the given sources
+// and archives, failing if the file already exists. The file has its
+// full size from the start.
+func CreateRRD(path string, sources []RRDSource, archives []RRDArchive) (*RRD, error) {
+	if len(sources) == 0 || len(sources) > math.MaxUint16 || len(archives) == 0 || len(archives) > math.MaxUint16 {
+		return nil, errors.New("an RRD must have between 1 and 65535 sources and archives")
+	}
+	var hdr bytes.Buffer
+	hdr.WriteString(rrdMagic)
+	hdr.WriteByte(RRDVersion)
+	binary.Write(&hdr, binary.BigEndian, uint16(len(sources)))
+	binary.Write(&hdr, binary.BigEndian, uint16(len(archives)))
+	for _, s := range sources {
+		if len(s.Stat) > math.MaxUint16 {
+			return nil, fmt.Errorf("RRD source name too long: %.40s...", s.Stat)
+		}
+		ctr := uint8(0)
+		if s.Counter {
+			ctr = 1
+		}
+		hdr.WriteByte(ctr)
+		binary.Write(&hdr, binary.BigEndian, uint16(len(s.Stat)))
+		hdr.WriteString(s.Stat)
+	}
+	for _, a := range archives {
+		if a.Resolution <= 0 || a.Rows < 1 || int64(a.Rows) > math.MaxUint32 || a.Consolidation < ConsolidateAverage || a.Consolidation > ConsolidateLast {
+			return nil, fmt.Errorf("bad RRD archive: %+v", a)
+		}
+		hdr.WriteByte(uint8(a.Consolidation))
+		binary.Write(&hdr, binary.BigEndian, int64(a.Resolution))
+		binary.Write(&hdr, binary.BigEndian, uint32(a.Rows))
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	rrd := newRRD(f, sources, archives, int64(hdr.Len()))
+	rrd.last = noRow
+	err = rrd.create(hdr.Bytes())
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return rrd, nil
+}
+
+// create writes out a new RRD's header, state, and empty rows.
+func (rrd *RRD) create(hdr []byte) error {
+	if _, err := rrd.f.WriteAt(hdr, 0); err != nil {
+		return err
+	}
+	if err := rrd.writeState(); err != nil {
+		return err
+	}
+	for _, a := range rrd.arcs {
+		row := nanRow(len(rrd.sources))
+		for r := 0; r < a.Rows; r++ {
+			if _, err := rrd.f.WriteAt(row, a.off+int64(r)*int64(len(row))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// OpenRRD opens an existing RRD file.
+func OpenRRD(path string) (*RRD, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	rrd, err := readRRD(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rrd, nil
+}
+
+func readRRD(f *os.File) (*RRD, error) {
+	r := &countReader{r: f}
+	var magic [len(rrdMagic)]byte
+	var version uint8
+	var nsrc, narc uint16
+	if _, err := io.ReadFull(r, magic[:]); err != nil || string(magic[:]) != rrdMagic {
+		return nil, errBadRRD
+	}
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, errBadRRD
+	}
+	if version != RRDVersion {
+		return nil, fmt.Errorf("unsupported RRD version %d", version)
+	}
+	binary.Read(r, binary.BigEndian, &nsrc)
+	if err := binary.Read(r, binary.BigEndian, &narc); err != nil || nsrc == 0 || narc == 0 {
+		return nil, errBadRRD
+	}
+	sources := make([]RRDSource, nsrc)
+	for i := range sources {
+		var ctr uint8
+		var n uint16
+		binary.Read(r, binary.BigEndian, &ctr)
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, errBadRRD
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, errBadRRD
+		}
+		sources[i] = RRDSource{Stat: string(b), Counter: ctr == 1}
+	}
+	archives := make([]RRDArchive, narc)
+	for i := range archives {
+		var cf uint8
+		var res int64
+		var rows uint32
+		binary.Read(r, binary.BigEndian, &cf)
+		binary.Read(r, binary.BigEndian, &res)
+		err := binary.Read(r, binary.BigEndian, &rows)
+		if err != nil || Consolidation(cf) > ConsolidateLast || res <= 0 || rows == 0 {
+			return nil, errBadRRD
+		}
+		archives[i] = RRDArchive{Consolidation(cf), time.Duration(res), int(rows)}
+	}
+
+	rrd := newRRD(f, sources, archives, r.n)
+	if _, err := f.ReadAt(rrd.state, rrd.stateOff); err != nil {
+		return nil, errBadRRD
+	}
+	rd := bytes.NewReader(rrd.state)
+	binary.Read(rd, binary.BigEndian, &rrd.last)
+	for _, a := range rrd.arcs {
+		binary.Read(rd, binary.BigEndian, &a.first)
+		binary.Read(rd, binary.BigEndian, &a.cur)
+		binary.Read(rd, binary.BigEndian, &a.done)
+		for i := range a.acc {
+			binary.Read(rd, binary.BigEndian, &a.acc[i])
+			binary.Read(rd, binary.BigEndian, &a.n[i])
+		}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if a := rrd.arcs[len(rrd.arcs)-1]; fi.Size() < a.off+int64(a.Rows)*int64(8*len(sources)) {
+		return nil, errBadRRD
+	}
+	return rrd, nil
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
+}
+
+// newRRD sets up an RRD whose header is hdrLen bytes long, with empty
+// state.
+func newRRD(f *os.File, sources []RRDSource, archives []RRDArchive, hdrLen int64) *RRD {
+	rrd := &RRD{
+		f:        f,
+		sources:  sources,
+		index:    make(map[string]int, len(sources)),
+		ct:       NewCounterTracker(),
+		vals:     make([]float64, len(sources)),
+		stateOff: hdrLen,
+	}
+	for i, s := range sources {
+		rrd.index[s.Stat] = i
+	}
+	stateLen := int64(8 + len(archives)*(24+12*len(sources)))
+	off := hdrLen + stateLen
+	for _, ra := range archives {
+		rrd.arcs = append(rrd.arcs, &rrdArchive{
+			RRDArchive: ra,
+			off:        off,
+			first:      noRow,
+			cur:        noRow,
+			done:       noRow,
+			acc:        make([]float64, len(sources)),
+			n:          make([]uint32, len(sources)),
+		})
+		off += int64(ra.Rows) * int64(8*len(sources))
+	}
+	rrd.state = make([]byte, stateLen)
+	return rrd
+}
+
+func nanRow(n int) []byte {
+	b := make([]byte, 0, 8*n)
+	for i := 0; i < n; i++ {
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(math.NaN()))
+	}
+	return b
+}
+
+func (rrd *RRD) writeState() error {
+	b := rrd.state[:0]
+	b = binary.BigEndian.AppendUint64(b, uint64(rrd.last))
+	for _, a := range rrd.arcs {
+		b = binary.BigEndian.AppendUint64(b, uint64(a.first))
+		b = binary.BigEndian.AppendUint64(b, uint64(a.cur))
+		b = binary.BigEndian.AppendUint64(b, uint64(a.done))
+		for i := range a.acc {
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(a.acc[i]))
+			b = binary.BigEndian.AppendUint32(b, a.n[i])
+		}
+	}
+	_, err := rrd.f.WriteAt(b, rrd.stateOff)
+	return err
+}
+
+// Sources returns the RRD's sources.
+func (rrd *RRD) Sources() []RRDSource {
+	return rrd.sources
+}
+
+// Archives returns the RRD's archives.
+func (rrd *RRD) Archives() []RRDArchive {
+	lst := make([]RRDArchive, len(rrd.arcs))
+	for i, a := range rrd.arcs {
+		lst[i] = a.RRDArchive
+	}
+	return lst
+}
+
+// Write adds the readings of the RRD's sources in a Sample to the
+// RRD, writing out any rows that it completes. Sources that aren't
+// in the Sample (or that are counters with no rate) have no reading
+// in it. A Sample that's older than the last one written is an error.
+func (rrd *RRD) Write(sm *Sample) error {
+	// Check the time first so that a bad Sample doesn't update
+	// counter rates.
+	if err := rrd.checkTime(sm.Time); err != nil {
+		return err
+	}
+	for i := range rrd.vals {
+		rrd.vals[i] = math.NaN()
+	}
+	for _, v := range sm.Values {
+		i, ok := rrd.index[v.String()]
+		if !ok || rrd.sources[i].Counter {
+			continue
+		}
+		if f, ok := v.Float(); ok {
+			rrd.vals[i] = f
+		}
+	}
+	for _, r := range rrd.ct.UpdateSample(sm) {
+		if i, ok := rrd.index[r.Value.String()]; ok && rrd.sources[i].Counter {
+			rrd.vals[i] = r.Rate
+		}
+	}
+	for _, d := range sm.Derived {
+		if i, ok := rrd.index[d.Name]; ok {
+			rrd.vals[i] = d.Value
+		}
+	}
+	return rrd.Update(sm.Time, rrd.vals)
+}
+
+// Update adds a reading of each of the RRD's sources at time t, in
+// the same order as its sources; NaN is no reading. It's the
+// underlying operation of Write, for readings that don't come from
+// Samples.
+func (rrd *RRD) Update(t time.Time, vals []float64) error {
+	if len(vals) != len(rrd.sources) {
+		return fmt.Errorf("RRD has %d sources, not %d", len(rrd.sources), len(vals))
+	}
+	if err := rrd.checkTime(t); err != nil {
+		return err
+	}
+	ts := t.UnixNano()
+	for _, a := range rrd.arcs {
+		row := ts / int64(a.Resolution)
+		if a.cur != noRow && row != a.cur {
+			if err := rrd.finish(a, row); err != nil {
+				return err
+			}
+		}
+		if a.cur == noRow {
+			a.first, a.cur = row, row
+		}
+		a.add(vals)
+	}
+	rrd.last = ts
+	return rrd.writeState()
+}
+
+// checkTime checks that t can be written to the RRD: it can't go
+// backward, and it can't be before the epoch, where rows would have
+// negative numbers.
+func (rrd *RRD) checkTime(t time.Time) error {
+	if t.UnixNano() < 0 {
+		return fmt.Errorf("RRD update at %s is before the epoch", t)
+	}
+	if rrd.last != noRow && t.UnixNano() < rrd.last {
+		return fmt.Errorf("RRD update at %s is before the last update", t)
+	}
+	return nil
+}
+
+// finish writes out an archive's current row, and empty rows for any
+// rows between it and next, and starts next as the current row.
+func (rrd *RRD) finish(a *rrdArchive, next int64) error {
+	rowLen := int64(8 * len(rrd.sources))
+	b := make([]byte, 0, rowLen)
+	for i := range a.acc {
+		v := math.NaN()
+		if a.n[i] > 0 {
+			v = a.acc[i]
+			if a.Consolidation == ConsolidateAverage {
+				v /= float64(a.n[i])
+			}
+		}
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	if _, err := rrd.f.WriteAt(b, a.off+(a.cur%int64(a.Rows))*rowLen); err != nil {
+		return err
+	}
+	empty := nanRow(len(rrd.sources))
+	first := a.cur + 1
+	if next-first > int64(a.Rows) {
+		first = next - int64(a.Rows)
+	}
+	for r := first; r < next; r++ {
+		if _, err := rrd.f.WriteAt(empty, a.off+(r%int64(a.Rows))*rowLen); err != nil {
+			return err
+		}
+	}
+	a.done, a.cur = next-1, next
+	for i := range a.acc {
+		a.acc[i], a.n[i] = 0, 0
+	}
+	return nil
+}
+
+// add consolidates a reading of each source into the current row.
+func (a *rrdArchive) add(vals []float64) {
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		switch {
+		case a.n[i] == 0, a.Consolidation == ConsolidateLast:
+			a.acc[i] = v
+		case a.Consolidation == ConsolidateAverage:
+			a.acc[i] += v
+		case a.Consolidation == ConsolidateMin:
+			a.acc[i] = math.Min(a.acc[i], v)
+		case a.Consolidation == ConsolidateMax:
+			a.acc[i] = math.Max(a.acc[i], v)
+		}
+		a.n[i]++
+	}
+}
+
+// Fetch returns the rows of the i'th archive that have been written
+// out, oldest first. There are at most the archive's Rows of them,
+// and none from before the RRD's first Update.
+func (rrd *RRD) Fetch(i int) ([]RRDRow, error) {
+	a := rrd.arcs[i]
+	if a.done == noRow {
+		return nil, nil
+	}
+	rowLen := int64(8 * len(rrd.sources))
+	buf := make([]byte, int64(a.Rows)*rowLen)
+	if _, err := rrd.f.ReadAt(buf, a.off); err != nil {
+		return nil, err
+	}
+	first := a.done - int64(a.Rows) + 1
+	if first < a.first {
+		first = a.first
+	}
+	rows := make([]RRDRow, 0, a.done-first+1)
+	for r := first; r <= a.done; r++ {
+		b := buf[(r%int64(a.Rows))*rowLen:]
+		row := RRDRow{Time: time.Unix(0, r*int64(a.Resolution)), Values: make([]float64, len(rrd.sources))}
+		for j := range row.Values {
+			row.Values[j] = math.Float64frombits(binary.BigEndian.Uint64(b[8*j:]))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Flush writes out nothing, because the RRD's file is always up to
+// date, but syncs it to disk.
+func (rrd *RRD) Flush() error {
+	return rrd.f.Sync()
+}
+
+// Close closes the RRD's file. The current rows of its archives are
+// kept in the file and carry on when it's reopened.
+func (rrd *RRD) Close() error {
+	return rrd.f.Close()
+}
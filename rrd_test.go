@@ -0,0 +1,123 @@
+//
+// Test RRDs.
+
+package kstat_test
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func rrdSample(sec int64, syscall uint64, util float64) *kstat.Sample {
+	sm := &kstat.Sample{}
+	sm.Time = time.Unix(sec, 0)
+	sm.Values = []kstat.Value{counter(sec*1e9, syscall)}
+	sm.Derived = []kstat.Derived{{Name: "util", Value: util}}
+	return sm
+}
+
+func fetch(t *testing.T, rrd *kstat.RRD, i int) [][]float64 {
+	t.Helper()
+	rows, err := rrd.Fetch(i)
+	if err != nil {
+		t.Fatalf("Fetch failed: %s", err)
+	}
+	var res [][]float64
+	for _, r := range rows {
+		if r.Time.Unix()%int64(rrd.Archives()[i].Resolution/time.Second) != 0 {
+			t.Fatalf("row not aligned: %s", r.Time)
+		}
+		res = append(res, r.Values)
+	}
+	return res
+}
+
+func TestRRD(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "k.rrd")
+	sources := []kstat.RRDSource{{Stat: "cpu:0:sys:syscall", Counter: true}, {Stat: "util"}}
+	archives := []kstat.RRDArchive{
+		{Consolidation: kstat.ConsolidateAverage, Resolution: 10 * time.Second, Rows: 3},
+		{Consolidation: kstat.ConsolidateMax, Resolution: 30 * time.Second, Rows: 2},
+	}
+	rrd, err := kstat.CreateRRD(path, sources, archives)
+	if err != nil {
+		t.Fatalf("CreateRRD failed: %s", err)
+	}
+	if _, err := kstat.CreateRRD(path, sources, archives); err == nil {
+		t.Fatalf("CreateRRD overwrote an existing RRD")
+	}
+	if err := rrd.Update(time.Unix(-5, 0), []float64{1, 2}); err == nil {
+		t.Fatalf("Update before the epoch did not fail")
+	}
+
+	// Every 5 seconds from 1000 to 1030, syscall goes up 50 a
+	// second and util counts up.
+	for i := int64(0); i < 7; i++ {
+		if err := rrd.Write(rrdSample(1000+5*i, uint64(250*i), float64(i))); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+	}
+	nan := math.NaN()
+	exp := [][]float64{{50, 0.5}, {50, 2.5}, {50, 4.5}}
+	if got := fetch(t, rrd, 0); !sameRows(got, exp) {
+		t.Fatalf("wrong average rows: %v", got)
+	}
+	// 990 to 1020 is done, with util from 0 to 3.
+	if got := fetch(t, rrd, 1); !sameRows(got, [][]float64{{50, 3}}) {
+		t.Fatalf("wrong max rows: %v", got)
+	}
+	if err := rrd.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+
+	// A reopened RRD carries on where it left off, except that
+	// counters need a new Sample before they have rates again. A
+	// gap leaves empty rows.
+	rrd, err = kstat.OpenRRD(path)
+	if err != nil {
+		t.Fatalf("OpenRRD failed: %s", err)
+	}
+	defer rrd.Close()
+	if !reflect.DeepEqual(rrd.Sources(), sources) || !reflect.DeepEqual(rrd.Archives(), archives) {
+		t.Fatalf("wrong layout: %+v %+v", rrd.Sources(), rrd.Archives())
+	}
+	if err := rrd.Write(rrdSample(1025, 0, 0)); err == nil {
+		t.Fatalf("Write of an older Sample did not fail")
+	}
+	if err := rrd.Write(rrdSample(1035, 2000, 7)); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if err := rrd.Write(rrdSample(1055, 3000, 9)); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	exp = [][]float64{{50, 4.5}, {50, 6.5}, {nan, nan}}
+	if got := fetch(t, rrd, 0); !sameRows(got, exp) {
+		t.Fatalf("wrong average rows after reopening: %v", got)
+	}
+	if got := fetch(t, rrd, 1); !sameRows(got, [][]float64{{50, 3}, {50, 7}}) {
+		t.Fatalf("wrong max rows after reopening: %v", got)
+	}
+}
+
+// sameRows compares rows, with NaNs equal to each other.
+func sameRows(a, b [][]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] && !(math.IsNaN(a[i][j]) && math.IsNaN(b[i][j])) {
+				return false
+			}
+		}
+	}
+	return true
+}
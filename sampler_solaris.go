@@ -0,0 +1,324 @@
+//go:build cgo
+// +build cgo
+
+//
+// Periodic sampling of selected kstats.
+
+package kstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Sampler periodically collects the statistics picked out by a set
+// of Selectors. It takes care of refreshing kstats, of noticing
+// changes in the kstat chain (and picking up new kstats that match
+// the selectors), and of skipping kstats that have errors.
+//
+// A running Sampler uses its Token from its own goroutine, so you
+// must not use the Token for anything else until the Sampler has been
+// stopped.
+type Sampler struct {
+	tok *Token
+
+	// mu protects interval, sels, and reselect, which can be
+	// changed while the Sampler is running, and err, which is set
+	// by the goroutine that Start runs the Sampler in.
+	mu       sync.Mutex
+	interval time.Duration
+	sels     []Selector
+	reselect bool
+	err      error
+
+	align    bool
+	jitter   time.Duration
+	coherent bool
+	batch    readBatch
+
+	// kstats is the current list of KStats that match sels, in
+	// sorted order. It is rebuilt when the kstat chain changes.
+	kstats []sampled
+
+	procs   []Processor
+	alerter *Alerter
+	sinks   []Sink
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSampler creates a Sampler that collects the statistics picked
+// out by sels from tok every interval. If there are no selectors, it
+// collects everything.
+func NewSampler(tok *Token, interval time.Duration, sels ...Selector) *Sampler {
+	return &Sampler{
+		tok:      tok,
+		interval: interval,
+		sels:     sels,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Sample does a single collection pass right now. Problems with
+// individual kstats are reported in the Sample's Errors; Sample
+// itself only fails if the Token is unusable.
+func (s *Sampler) Sample() (*Sample, error) {
+	return s.SampleContext(context.Background())
+}
+
+// SampleContext is Sample with a Context. It fails with the Context's
+// error if the Context is canceled or times out during the collection
+// pass.
+func (s *Sampler) SampleContext(ctx context.Context) (*Sample, error) {
+	sm := &Sample{}
+	sm.Time = time.Now()
+	upd, err := s.tok.Update()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	sels, reselect := s.sels, s.reselect
+	s.reselect = false
+	s.mu.Unlock()
+	if upd || reselect || s.kstats == nil {
+		s.kstats = s.tok.matching(sels)
+	}
+
+	if s.coherent {
+		for i, err := range s.batch.read(s.kstats) {
+			if err == nil {
+				err = sm.addRead(s.kstats[i])
+			}
+			if err != nil {
+				sm.Errors = append(sm.Errors, fmt.Errorf("%s: %s", s.kstats[i].k, err))
+			}
+		}
+	} else {
+		for _, sk := range s.kstats {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := sm.add(sk); err != nil {
+				sm.Errors = append(sm.Errors, fmt.Errorf("%s: %s", sk.k, err))
+			}
+		}
+	}
+	process(s.procs, sm)
+	writeSinks(s.sinks, sm)
+	return sm, nil
+}
+
+// AddProcessor adds a Processor that is run on every Sample before
+// it's returned or delivered. Processors are run in the order they
+// were added.
+func (s *Sampler) AddProcessor(p Processor) {
+	s.procs = append(s.procs, p)
+}
+
+// AddSink adds a Sink that every Sample is written to after the
+// Processors have run on it. Errors from writing to Sinks are added
+// to the Sample's Errors as SinkErrors. Run flushes the Sinks when it
+// returns, but doesn't close them.
+func (s *Sampler) AddSink(sk Sink) {
+	s.sinks = append(s.sinks, sk)
+}
+
+// AddRule adds a threshold alert Rule that is evaluated against
+// every Sample. The Sampler's Rules are evaluated by an Alerter that
+// is added as a Processor when the first Rule is added.
+func (s *Sampler) AddRule(r Rule) {
+	if s.alerter == nil {
+		s.alerter = NewAlerter()
+		s.AddProcessor(s.alerter)
+	}
+	s.alerter.AddRule(r)
+}
+
+// A Sampler can be reconfigured by a Collection.
+var _ Reconfigurable = (*Sampler)(nil)
+
+// SetSelectors changes the selectors of the Sampler. It can be
+// called while the Sampler is running (from any goroutine), and takes
+// effect with the next Sample.
+func (s *Sampler) SetSelectors(sels ...Selector) {
+	s.mu.Lock()
+	s.sels, s.reselect = sels, true
+	s.mu.Unlock()
+}
+
+// SetInterval changes the interval of the Sampler. It can be called
+// while the Sampler is running (from any goroutine), and takes effect
+// after the next Sample. Intervals that aren't positive are ignored.
+func (s *Sampler) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+}
+
+func (s *Sampler) currentInterval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+// SetAlign sets whether Run aligns Samples to wall clock multiples
+// of the Sampler's interval, so that with a 10 second interval they
+// are taken at :00, :10, :20, and so on. This lines up Samples taken
+// on different hosts (assuming their clocks are in sync). An aligned
+// Sampler takes its first Sample at the next boundary instead of
+// immediately.
+func (s *Sampler) SetAlign(align bool) {
+	s.align = align
+}
+
+// SetCoherent sets whether the Sampler reads all of its KStats in one
+// tight pass before copying out their statistics, as
+// Token.CoherentSnapshot does. This minimizes the time skew within
+// each Sample, but a coherent Sample can't be interrupted part way
+// through by its Context.
+//
+// Because the pass is a single cgo call, coherent sampling is also
+// much cheaper than regular sampling when a Sampler samples many
+// KStats at high frequency.
+func (s *Sampler) SetCoherent(coherent bool) {
+	s.coherent = coherent
+}
+
+// SetJitter sets a maximum random delay that Run adds to each Sample,
+// so that a fleet of collectors started at the same time (or aligned
+// with SetAlign) don't all read their kstats at the same instant. The
+// delay is chosen anew for each Sample and doesn't accumulate; it
+// should be well under the interval.
+func (s *Sampler) SetJitter(jitter time.Duration) {
+	s.jitter = jitter
+}
+
+// Run collects a Sample immediately and then every interval, calling
+// fn with each one, until the Sampler is stopped or a Sample fails.
+// It returns nil if the Sampler was stopped; any other error is also
+// recorded as the Sampler's Err. If fn or a Sample takes longer than
+// the interval, the missed Samples are skipped.
+func (s *Sampler) Run(fn func(*Sample)) error {
+	return s.RunContext(context.Background(), fn)
+}
+
+// RunContext is Run with a Context. It also stops if the Context is
+// canceled or times out, returning the Context's error.
+func (s *Sampler) RunContext(ctx context.Context, fn func(*Sample)) (err error) {
+	defer func() {
+		if err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
+	}()
+	interval := s.currentInterval()
+	if interval <= 0 {
+		return errors.New("Sampler interval must be positive")
+	}
+	defer flushSinks(s.sinks)
+	next := time.Now()
+	if s.align {
+		next = next.Truncate(interval).Add(interval)
+	}
+	for {
+		if err := s.wait(ctx, next); err == errStopped {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		sm, err := s.SampleContext(ctx)
+		if err != nil {
+			return err
+		}
+		fn(sm)
+
+		if iv := s.currentInterval(); iv != interval {
+			// The interval was changed, so we start over on
+			// the new one.
+			interval = iv
+			next = time.Now()
+			if s.align {
+				next = next.Truncate(interval)
+			}
+		}
+		next = next.Add(interval)
+		if now := time.Now(); !next.After(now) {
+			next = next.Add((now.Sub(next)/interval + 1) * interval)
+		}
+	}
+}
+
+var errStopped = errors.New("stopped")
+
+// wait waits until t plus any jitter. It returns errStopped if the
+// Sampler was stopped or the Context's error if it's done.
+func (s *Sampler) wait(ctx context.Context, t time.Time) error {
+	if s.jitter > 0 {
+		t = t.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		select {
+		case <-s.stop:
+			return errStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			return nil
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.stop:
+		return errStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Start runs the Sampler in a new goroutine, delivering Samples on
+// the returned channel. The channel is closed when the Sampler stops,
+// either because Stop was called or because of an error, which is
+// then available from Err.
+//
+// If you don't receive Samples fast enough, the Sampler waits for you
+// (and so will skip ticks).
+func (s *Sampler) Start() <-chan *Sample {
+	c := make(chan *Sample)
+	go func() {
+		defer close(c)
+		s.Run(func(sm *Sample) {
+			select {
+			case c <- sm:
+			case <-s.stop:
+			}
+		})
+	}()
+	return c
+}
+
+// Stop stops a running Sampler. A stopped Sampler cannot be
+// restarted, although you can still call Sample on it.
+func (s *Sampler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Err returns the error that stopped a Sampler started with Start,
+// if any. It's only meaningful once the Sample channel is closed.
+func (s *Sampler) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
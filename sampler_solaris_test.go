@@ -0,0 +1,293 @@
+//go:build cgo
+// +build cgo
+
+//
+// Test the Sampler.
+
+package kstat_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func selectors(t *testing.T, lst ...string) []kstat.Selector {
+	sels, err := kstat.ParseSelectors(lst)
+	if err != nil {
+		t.Fatalf("ParseSelectors failed: %s", err)
+	}
+	return sels
+}
+
+// A single Sample should have exactly what we select.
+func TestSamplerSample(t *testing.T) {
+	tok := start(t)
+	ncpu := len(tok.Tree()["cpu"])
+	s := kstat.NewSampler(tok, time.Second, selectors(t, "cpu:*:sys:syscall", "unix:0:sysinfo")...)
+	sm, err := s.Sample()
+	if err != nil {
+		t.Fatalf("Sample failed: %s", err)
+	}
+	if len(sm.Errors) > 0 {
+		t.Fatalf("Sample had errors: %v", sm.Errors)
+	}
+	nsys := 0
+	for _, v := range sm.Values {
+		switch {
+		case v.Module == "cpu" && v.Stat == "syscall":
+			nsys++
+		case v.Module == "unix" && v.Name == "sysinfo":
+		default:
+			t.Fatalf("Sample has unselected value %s", v)
+		}
+	}
+	if nsys != ncpu {
+		t.Fatalf("Sample has %d syscall values for %d CPUs", nsys, ncpu)
+	}
+	stop(t, tok)
+
+	_, err = s.Sample()
+	if err == nil {
+		t.Fatalf("Sample succeeded after Close")
+	}
+}
+
+// A started Sampler should deliver Samples until it's stopped.
+func TestSamplerStart(t *testing.T) {
+	tok := start(t)
+	s := kstat.NewSampler(tok, 100*time.Millisecond, selectors(t, "unix:0:system_misc:clk_intr")...)
+	c := s.Start()
+	sm1 := <-c
+	sm2 := <-c
+	s.Stop()
+	for range c {
+	}
+	if s.Err() != nil {
+		t.Fatalf("Sampler error: %s", s.Err())
+	}
+	if len(sm1.Values) != 1 || len(sm2.Values) != 1 {
+		t.Fatalf("bad Samples: %+v %+v", sm1, sm2)
+	}
+	if sm2.Values[0].Snaptime <= sm1.Values[0].Snaptime {
+		t.Fatalf("Snaptime did not advance: %+v %+v", sm1, sm2)
+	}
+	stop(t, tok)
+}
+
+// A Sampler that can't run at all should still close its channel and
+// say why.
+func TestSamplerStartFails(t *testing.T) {
+	tok := start(t)
+	s := kstat.NewSampler(tok, 0)
+	for range s.Start() {
+		t.Fatalf("Sampler with no interval delivered a Sample")
+	}
+	if s.Err() == nil {
+		t.Fatalf("Sampler with no interval has no error")
+	}
+	stop(t, tok)
+}
+
+// Aligned Samples should be taken just after interval boundaries.
+func TestSamplerAlign(t *testing.T) {
+	tok := start(t)
+	iv := 200 * time.Millisecond
+	s := kstat.NewSampler(tok, iv, selectors(t, "unix:0:system_misc:clk_intr")...)
+	s.SetAlign(true)
+	s.SetJitter(10 * time.Millisecond)
+	c := s.Start()
+	sm1 := <-c
+	sm2 := <-c
+	s.Stop()
+	for range c {
+	}
+	for _, sm := range []*kstat.Sample{sm1, sm2} {
+		if off := sm.Time.Sub(sm.Time.Truncate(iv)); off > 50*time.Millisecond {
+			t.Fatalf("Sample at %s is %s past an interval boundary", sm.Time, off)
+		}
+	}
+	stop(t, tok)
+}
+
+func TestSamplerContext(t *testing.T) {
+	tok := start(t)
+	s := kstat.NewSampler(tok, time.Hour, selectors(t, "unix:0:system_misc:clk_intr")...)
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	err := s.RunContext(ctx, func(*kstat.Sample) {
+		n++
+		cancel()
+	})
+	if err != context.Canceled || n != 1 {
+		t.Fatalf("RunContext returned %v after %d Samples", err, n)
+	}
+	if _, err = tok.SnapshotContext(ctx); err != context.Canceled {
+		t.Fatalf("SnapshotContext with a canceled Context returned %v", err)
+	}
+	stop(t, tok)
+}
+
+// A Snapshot should contain what we select and stay usable after the
+// Token is closed.
+func TestSnapshot(t *testing.T) {
+	tok := start(t)
+	snap, err := tok.Snapshot(selectors(t, "unix:0:system_misc", "unix:0:kstat_headers")...)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	stop(t, tok)
+
+	// unix:0:kstat_headers is a raw kstat with no Values but it
+	// should still be in KStats.
+	if len(snap.KStats) != 2 {
+		t.Fatalf("Snapshot has wrong KStats: %+v", snap.KStats)
+	}
+	if _, ok := snap.KStat("unix", 0, "kstat_headers"); !ok {
+		t.Fatalf("Snapshot lacks unix:0:kstat_headers: %+v", snap.KStats)
+	}
+	v, ok := snap.Get("unix", 0, "system_misc", "clk_intr")
+	if !ok || v.UintVal == 0 {
+		t.Fatalf("Snapshot has bad clk_intr: %v %+v", ok, v)
+	}
+	for _, v := range snap.Values {
+		if v.Name != "system_misc" {
+			t.Fatalf("Snapshot has unselected value %s", v)
+		}
+	}
+
+	if _, err = tok.Snapshot(); err == nil {
+		t.Fatalf("Snapshot succeeded after Close")
+	}
+}
+
+// A Sampler must be usable as a SampleSource.
+var _ kstat.SampleSource = (*kstat.Sampler)(nil)
+
+// A coherent Snapshot should have the same contents as a regular one
+// and (normally) less skew.
+func TestCoherentSnapshot(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	sels := selectors(t, "cpu::sys")
+	snap, err := tok.CoherentSnapshot(sels...)
+	if err != nil {
+		t.Fatalf("CoherentSnapshot failed: %s", err)
+	}
+	snap2, err := tok.Snapshot(sels...)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	if len(snap.KStats) == 0 || len(snap.KStats) != len(snap2.KStats) || len(snap.Values) != len(snap2.Values) {
+		t.Fatalf("CoherentSnapshot differs from Snapshot: %d/%d KStats, %d/%d Values",
+			len(snap.KStats), len(snap2.KStats), len(snap.Values), len(snap2.Values))
+	}
+	t.Logf("skew: coherent %s, regular %s", snap.Skew(), snap2.Skew())
+}
+
+// ReadAll with no selectors reads the whole chain; with selectors it
+// should find the same KStats that Snapshot does.
+func TestReadAll(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	all, err := tok.ReadAll()
+	if _, ok := err.(kstat.KStatErrors); err != nil && !ok {
+		t.Fatalf("ReadAll failed: %s", err)
+	}
+	if len(all) == 0 {
+		t.Fatalf("ReadAll found no KStats")
+	}
+	sels := selectors(t, "cpu::sys")
+	some, err := tok.ReadAll(sels...)
+	if _, ok := err.(kstat.KStatErrors); err != nil && !ok {
+		t.Fatalf("ReadAll(cpu::sys) failed: %s", err)
+	}
+	snap, err := tok.Snapshot(sels...)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	if len(some) == 0 || len(some) != len(snap.KStats) {
+		t.Fatalf("ReadAll found %d KStats, Snapshot %d", len(some), len(snap.KStats))
+	}
+}
+
+// RefreshMany should give the same Values as refreshing each KStat,
+// including for a KStat that's listed twice.
+func TestRefreshMany(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	ks, err := tok.ReadAll()
+	if _, ok := err.(kstat.KStatErrors); err != nil && !ok {
+		t.Fatalf("ReadAll failed: %s", err)
+	}
+	ks = append(ks, ks[0])
+	vals, err := tok.RefreshMany(ks)
+	if err != nil {
+		t.Fatalf("RefreshMany failed: %s", err)
+	}
+	if len(vals) != len(ks) {
+		t.Fatalf("RefreshMany gave %d results for %d KStats", len(vals), len(ks))
+	}
+	for i, k := range ks {
+		v, err := k.Values()
+		if err != nil {
+			t.Fatalf("Values of %s failed: %s", k, err)
+		}
+		if len(v) != len(vals[i]) {
+			t.Fatalf("RefreshMany gave %d Values for %s, Values %d", len(vals[i]), k, len(v))
+		}
+	}
+}
+
+// A coherent Sampler reads everything in one batch, so it should
+// find all CPUs every time.
+func TestSamplerCoherent(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	s := kstat.NewSampler(tok, time.Second, selectors(t, "cpu::sys:syscall")...)
+	s.SetCoherent(true)
+	for i := 0; i < 2; i++ {
+		sm, err := s.Sample()
+		if err != nil || len(sm.Errors) != 0 {
+			t.Fatalf("coherent Sample failed: %v %v", err, sm)
+		}
+		if len(sm.Values) == 0 || len(sm.Values) != len(sm.KStats) {
+			t.Fatalf("bad coherent Sample: %+v", sm)
+		}
+	}
+}
+
+// Every Sample goes to every Sink, and Run flushes them at the end.
+func TestSamplerSinks(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	s := kstat.NewSampler(tok, 10*time.Millisecond, selectors(t, "unix:0:system_misc:clk_intr")...)
+	a, b := &countSink{}, &countSink{}
+	s.AddSink(a)
+	s.AddSink(b)
+	n := 0
+	s.Run(func(sm *kstat.Sample) {
+		if n++; n == 3 {
+			s.Stop()
+		}
+	})
+	if a.writes != 3 || b.writes != 3 || a.flushes != 1 || b.flushes != 1 {
+		t.Fatalf("Sinks not used properly: %+v %+v", a, b)
+	}
+}
+
+// SetSelectors changes what the next Sample collects.
+func TestSamplerSetSelectors(t *testing.T) {
+	tok := start(t)
+	defer stop(t, tok)
+	s := kstat.NewSampler(tok, time.Second, selectors(t, "unix:0:system_misc:clk_intr")...)
+	if sm, err := s.Sample(); err != nil || len(sm.Values) != 1 {
+		t.Fatalf("wrong first Sample: %v %v", sm, err)
+	}
+	s.SetSelectors(selectors(t, "unix:0:system_misc:clk_intr", "unix:0:system_misc:nproc")...)
+	if sm, err := s.Sample(); err != nil || len(sm.Values) != 2 {
+		t.Fatalf("wrong Sample after SetSelectors: %v %v", sm, err)
+	}
+}
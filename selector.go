@@ -0,0 +1,228 @@
+//
+// Selectors pick out kstats and their statistics by
+// module:instance:name:statistic, in the style of kstat(1).
+
+package kstat
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Selector selects some set of kstats and statistics, in the same
+// way as a module:instance:name:statistic argument to kstat(1).
+// Module, Name, and Stat are shell glob patterns as understood by
+// path.Match; "" (or "*") matches anything. Instance is either a
+// specific instance or -1 to match all instances.
+//
+// The zero value of a Selector is not a match-everything selector,
+// because it matches only instance 0; use ParseSelector("") or set
+// Instance to -1.
+type Selector struct {
+	Module   string
+	Instance int
+	Name     string
+	Stat     string
+}
+
+// ParseSelector parses a selector in the kstat(1) form of
+// module:instance:name:statistic. Trailing fields may be omitted and
+// any field may be blank or "*" to match anything, so "cpu::sys" and
+// "cpu:*:sys:*" are the same thing. Unlike kstat(1), /regexp/
+// patterns are not supported.
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{Instance: -1}
+	fields := strings.Split(s, ":")
+	if len(fields) > 4 {
+		return sel, fmt.Errorf("selector %q has too many fields", s)
+	}
+	for len(fields) < 4 {
+		fields = append(fields, "")
+	}
+	if fields[1] != "" && fields[1] != "*" {
+		i, err := strconv.Atoi(fields[1])
+		if err != nil || i < 0 {
+			return sel, fmt.Errorf("selector %q has bad instance %q", s, fields[1])
+		}
+		sel.Instance = i
+	}
+	unstar := func(p string) string {
+		if p == "*" {
+			return ""
+		}
+		return p
+	}
+	sel.Module = unstar(fields[0])
+	sel.Name = unstar(fields[2])
+	sel.Stat = unstar(fields[3])
+
+	// Check the patterns now so that we don't have to worry about
+	// errors when matching.
+	for _, p := range []string{sel.Module, sel.Name, sel.Stat} {
+		if _, err := path.Match(p, ""); err != nil {
+			return sel, fmt.Errorf("selector %q has bad pattern %q: %s", s, p, err)
+		}
+	}
+	return sel, nil
+}
+
+// ParseSelectors parses a list of selectors with ParseSelector,
+// stopping at the first error.
+func ParseSelectors(lst []string) ([]Selector, error) {
+	sels := make([]Selector, 0, len(lst))
+	for _, s := range lst {
+		sel, err := ParseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	return sels, nil
+}
+
+// globMatch matches a single Selector field. Bad patterns never
+// match.
+func globMatch(pat, s string) bool {
+	if pat == "" || pat == "*" {
+		return true
+	}
+	m, err := path.Match(pat, s)
+	return err == nil && m
+}
+
+// MatchKStat returns true if the selector matches a kstat with the
+// given module, instance, and name.
+func (s Selector) MatchKStat(module string, instance int, name string) bool {
+	return (s.Instance < 0 || s.Instance == instance) && globMatch(s.Module, module) && globMatch(s.Name, name)
+}
+
+// MatchStat returns true if the selector matches the given statistic
+// name. It doesn't check the kstat that the statistic is part of; use
+// MatchKStat for that.
+func (s Selector) MatchStat(stat string) bool {
+	return globMatch(s.Stat, stat)
+}
+
+// Match returns true if the selector matches a Value.
+func (s Selector) Match(v Value) bool {
+	return s.MatchKStat(v.Module, v.Instance, v.Name) && s.MatchStat(v.Stat)
+}
+
+// Matcher is a Selector that has been prepared for fast matching
+// with Selector.Compile. It matches exactly what its Selector does,
+// but the common sorts of patterns (anything, a literal, and a
+// literal prefix followed by '*') are matched without path.Match.
+// It's worth compiling Selectors that are matched against a lot of
+// kstats over and over, for example on every sample.
+type Matcher struct {
+	sel                Selector
+	module, name, stat pattern
+}
+
+// patKind is what sort of pattern a pattern is.
+type patKind int
+
+const (
+	patAny    patKind = iota // matches anything
+	patExact                 // matches only lit
+	patPrefix                // matches anything starting with lit
+	patGlob                  // needs path.Match
+)
+
+// pattern is a compiled Selector field.
+type pattern struct {
+	kind patKind
+	lit  string
+}
+
+func compilePattern(pat string) pattern {
+	switch {
+	case pat == "" || pat == "*":
+		return pattern{kind: patAny}
+	case !strings.ContainsAny(pat, `*?[\`):
+		return pattern{patExact, pat}
+	case strings.HasSuffix(pat, "*") && !strings.ContainsAny(pat[:len(pat)-1], `*?[\`):
+		return pattern{patPrefix, pat[:len(pat)-1]}
+	}
+	return pattern{patGlob, pat}
+}
+
+func (p pattern) match(s string) bool {
+	switch p.kind {
+	case patAny:
+		return true
+	case patExact:
+		return s == p.lit
+	case patPrefix:
+		// As with path.Match, '*' doesn't match '/'.
+		return strings.HasPrefix(s, p.lit) && !strings.Contains(s[len(p.lit):], "/")
+	}
+	m, err := path.Match(p.lit, s)
+	return err == nil && m
+}
+
+// Compile prepares the selector for fast matching.
+func (s Selector) Compile() *Matcher {
+	return &Matcher{
+		sel:    s,
+		module: compilePattern(s.Module),
+		name:   compilePattern(s.Name),
+		stat:   compilePattern(s.Stat),
+	}
+}
+
+// compileAll compiles a list of selectors.
+func compileAll(sels []Selector) []*Matcher {
+	ms := make([]*Matcher, len(sels))
+	for i, sel := range sels {
+		ms[i] = sel.Compile()
+	}
+	return ms
+}
+
+// Selector returns the Selector that the Matcher was compiled from.
+func (m *Matcher) Selector() Selector {
+	return m.sel
+}
+
+// Exact returns the module, instance, and name of the single kstat
+// that the Matcher can match, if its module and name are literals
+// and it has a specific instance.
+func (m *Matcher) Exact() (module string, instance int, name string, ok bool) {
+	if m.module.kind != patExact || m.name.kind != patExact || m.sel.Instance < 0 {
+		return "", 0, "", false
+	}
+	return m.module.lit, m.sel.Instance, m.name.lit, true
+}
+
+// MatchKStat is Selector.MatchKStat.
+func (m *Matcher) MatchKStat(module string, instance int, name string) bool {
+	return (m.sel.Instance < 0 || m.sel.Instance == instance) && m.module.match(module) && m.name.match(name)
+}
+
+// MatchStat is Selector.MatchStat.
+func (m *Matcher) MatchStat(stat string) bool {
+	return m.stat.match(stat)
+}
+
+// Match is Selector.Match.
+func (m *Matcher) Match(v Value) bool {
+	return m.MatchKStat(v.Module, v.Instance, v.Name) && m.MatchStat(v.Stat)
+}
+
+// String returns the selector in the form accepted by ParseSelector.
+func (s Selector) String() string {
+	inst := "*"
+	if s.Instance >= 0 {
+		inst = strconv.Itoa(s.Instance)
+	}
+	star := func(p string) string {
+		if p == "" {
+			return "*"
+		}
+		return p
+	}
+	return star(s.Module) + ":" + inst + ":" + star(s.Name) + ":" + star(s.Stat)
+}
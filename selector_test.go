@@ -0,0 +1,155 @@
+//
+// Test Selectors.
+
+package kstat_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, c := range []struct {
+		in  string
+		sel kstat.Selector
+	}{
+		{"", kstat.Selector{Instance: -1}},
+		{"cpu", kstat.Selector{Module: "cpu", Instance: -1}},
+		{"cpu::sys", kstat.Selector{Module: "cpu", Instance: -1, Name: "sys"}},
+		{"cpu:*:sys:cpu_nsec_*", kstat.Selector{Module: "cpu", Instance: -1, Name: "sys", Stat: "cpu_nsec_*"}},
+		{"sd:0:sd0:nread", kstat.Selector{Module: "sd", Instance: 0, Name: "sd0", Stat: "nread"}},
+	} {
+		sel, err := kstat.ParseSelector(c.in)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) failed: %s", c.in, err)
+		}
+		if sel != c.sel {
+			t.Fatalf("ParseSelector(%q) gave %#v, expected %#v", c.in, sel, c.sel)
+		}
+		// Round trip through String()
+		s2, err := kstat.ParseSelector(sel.String())
+		if err != nil || s2 != sel {
+			t.Fatalf("%q does not round trip through %q: %#v %s", c.in, sel.String(), s2, err)
+		}
+	}
+
+	for _, bad := range []string{"a:b:c:d:e", "cpu:x:sys", "cpu:-2:sys", "cpu:0:[sys"} {
+		sel, err := kstat.ParseSelector(bad)
+		if err == nil {
+			t.Fatalf("ParseSelector(%q) succeeded: %#v", bad, sel)
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	sel, err := kstat.ParseSelector("cpu:*:sys:cpu_nsec_*")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %s", err)
+	}
+	v := kstat.Value{Module: "cpu", Instance: 3, Name: "sys", Stat: "cpu_nsec_idle"}
+	if !sel.Match(v) {
+		t.Fatalf("%s does not match %s", sel, v)
+	}
+	v.Stat = "syscall"
+	if sel.Match(v) || !sel.MatchKStat(v.Module, v.Instance, v.Name) {
+		t.Fatalf("%s matches wrongly against %s", sel, v)
+	}
+	if sel.MatchKStat("cpu", 0, "vm") {
+		t.Fatalf("%s matches cpu:0:vm", sel)
+	}
+
+	sel = kstat.Selector{Module: "sd", Instance: 0}
+	if !sel.MatchKStat("sd", 0, "sd0") || sel.MatchKStat("sd", 1, "sd1") {
+		t.Fatalf("%s instance matching is wrong", sel)
+	}
+}
+
+// A compiled Selector must match exactly what the Selector does.
+func TestCompile(t *testing.T) {
+	pats := []string{"", "*", "cpu", "cpu*", "c?u", "[cs]*", "zone*", "sd0", "*link"}
+	names := []string{"", "cpu", "cpu_info", "cpux", "sd", "sd0", "zone1/net0", "zone1", "e1000g0link"}
+	for _, p := range pats {
+		sel := kstat.Selector{Module: p, Instance: -1, Name: p, Stat: p}
+		m := sel.Compile()
+		if m.Selector() != sel {
+			t.Fatalf("Compile of %s gives Selector %s", sel, m.Selector())
+		}
+		for _, n := range names {
+			v := kstat.Value{Module: n, Instance: 2, Name: n, Stat: n}
+			if m.Match(v) != sel.Match(v) {
+				t.Errorf("pattern %q: Matcher says %v and Selector %v for %q", p, m.Match(v), sel.Match(v), n)
+			}
+		}
+	}
+
+	m := kstat.Selector{Module: "sd", Instance: 1, Name: "sd1"}.Compile()
+	if mod, inst, name, ok := m.Exact(); !ok || mod != "sd" || inst != 1 || name != "sd1" {
+		t.Errorf("Exact of sd:1:sd1 is %s %d %s %v", mod, inst, name, ok)
+	}
+	for _, s := range []string{"sd::sd1", "sd:1:sd*", "*:1:sd1"} {
+		sel, err := kstat.ParseSelector(s)
+		if err != nil {
+			t.Fatalf("ParseSelector %q failed: %s", s, err)
+		}
+		if _, _, _, ok := sel.Compile().Exact(); ok {
+			t.Errorf("%s is wrongly exact", s)
+		}
+	}
+}
+
+func TestSnapshotSelect(t *testing.T) {
+	snap := &kstat.Snapshot{
+		KStats: []kstat.KStatInfo{{Module: "cpu", Instance: 0, Name: "sys"}, {Module: "cpu", Instance: 0, Name: "vm"}},
+		Values: []kstat.Value{
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "syscall"},
+			{Module: "cpu", Instance: 0, Name: "sys", Stat: "sysread"},
+			{Module: "cpu", Instance: 0, Name: "vm", Stat: "pgin"},
+		},
+	}
+	sel, _ := kstat.ParseSelector("cpu:0:sys:syscall")
+	ns := snap.Select(sel)
+	if len(ns.KStats) != 1 || len(ns.Values) != 1 || ns.Values[0].Stat != "syscall" {
+		t.Fatalf("bad Select result: %+v", ns)
+	}
+	if _, ok := ns.Get("cpu", 0, "sys", "syscall"); !ok {
+		t.Fatalf("Get failed on selected Snapshot: %+v", ns)
+	}
+	if _, ok := ns.Get("cpu", 0, "vm", "pgin"); ok {
+		t.Fatalf("Get found unselected Value: %+v", ns)
+	}
+}
+
+func TestSnapshotSkew(t *testing.T) {
+	snap := &kstat.Snapshot{}
+	if snap.Skew() != 0 {
+		t.Fatalf("empty Snapshot has skew %s", snap.Skew())
+	}
+	snap.KStats = []kstat.KStatInfo{{Snaptime: 20}, {Snaptime: 10}, {Snaptime: 50}}
+	if snap.Skew() != 40 {
+		t.Fatalf("bad Snapshot skew %s", snap.Skew())
+	}
+}
+
+func TestKStatErrors(t *testing.T) {
+	var err error = kstat.KStatErrors{errors.New("sd:0:sd0: permission denied")}
+	if err.Error() != "sd:0:sd0: permission denied" {
+		t.Errorf("wrong single error: %s", err)
+	}
+	err = append(err.(kstat.KStatErrors), errors.New("sd:1:sd1: no such device"))
+	if err.Error() != "sd:0:sd0: permission denied (and 1 more kstat errors)" {
+		t.Errorf("wrong multiple errors: %s", err)
+	}
+	if (kstat.KStatErrors{}).Error() != "no kstat errors" {
+		t.Errorf("wrong empty errors: %s", kstat.KStatErrors{})
+	}
+
+	// errors.Is reaches the errors wrapped by each entry.
+	enxio := errors.New("no such device or address")
+	err = kstat.KStatErrors{errors.New("sd:0:sd0: permission denied"), fmt.Errorf("sd:1:sd1: %w", enxio)}
+	if !errors.Is(err, enxio) {
+		t.Errorf("errors.Is does not find a wrapped per-kstat error in %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+//
+// Sinks are destinations that Samples are written to.
+
+package kstat
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sink is a destination for Samples, such as a file, a metrics
+// system, or a network service. A Sampler (or a Replayer) can write
+// every Sample it produces to any number of Sinks, so one collection
+// pass can feed several destinations at once.
+//
+// Write may buffer; Flush writes out anything buffered. Close
+// flushes the Sink and releases its resources, including closing
+// its underlying writer or connection if it has one.
+type Sink interface {
+	Write(sm *Sample) error
+	Flush() error
+	Close() error
+}
+
+// All of the package's exporters are Sinks.
+var (
+	_ Sink = (*Recorder)(nil)
+	_ Sink = (*SnapshotVar)(nil)
+	_ Sink = (*StatsdSink)(nil)
+	_ Sink = (*InfluxWriter)(nil)
+	_ Sink = (*GraphiteSink)(nil)
+	_ Sink = (*TelegrafWriter)(nil)
+	_ Sink = (*CollectdWriter)(nil)
+	_ Sink = (*NDJSONEncoder)(nil)
+	_ Sink = (*CSVWriter)(nil)
+	_ Sink = (*SQLiteSink)(nil)
+	_ Sink = (*RRD)(nil)
+)
+
+// SinkError is an error from writing a Sample to a Sink. Samplers
+// and Replayers record these in the Sample's Errors.
+type SinkError struct {
+	Sink Sink
+	Err  error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %T: %s", e.Sink, e.Err)
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// writeSinks writes a Sample to a list of Sinks, adding any errors
+// to the Sample.
+func writeSinks(sinks []Sink, sm *Sample) {
+	for _, sk := range sinks {
+		if err := sk.Write(sm); err != nil {
+			sm.Errors = append(sm.Errors, &SinkError{Sink: sk, Err: err})
+		}
+	}
+}
+
+// flushSinks flushes a list of Sinks, returning the first error.
+func flushSinks(sinks []Sink) error {
+	var err error
+	for _, sk := range sinks {
+		if ferr := sk.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// closeWriter closes w if it's an io.Closer.
+func closeWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
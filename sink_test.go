@@ -0,0 +1,68 @@
+//
+// Test Sinks.
+
+package kstat_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// countSink counts the Samples written to it and fails every Write
+// after the first fail.
+type countSink struct {
+	writes, flushes, fail int
+}
+
+var errSink = errors.New("sink is full")
+
+func (c *countSink) Write(sm *kstat.Sample) error {
+	c.writes++
+	if c.fail > 0 && c.writes > c.fail {
+		return errSink
+	}
+	return nil
+}
+
+func (c *countSink) Flush() error { c.flushes++; return nil }
+func (c *countSink) Close() error { return nil }
+
+// A Replayer fans out its Samples to all of its Sinks.
+func TestReplayerSinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec")
+	recordSnapshots(t, path, 3, time.Second)
+	rp, err := kstat.OpenRecording(path)
+	if err != nil {
+		t.Fatalf("OpenRecording failed: %s", err)
+	}
+	defer rp.Close()
+	rp.SetSpeed(0)
+
+	good, bad := &countSink{}, &countSink{fail: 1}
+	latest := kstat.NewSnapshotVar(nil, 0)
+	var src kstat.SampleSource = rp
+	src.AddSink(good)
+	src.AddSink(bad)
+	src.AddSink(latest)
+	var errs []error
+	err = src.Run(func(sm *kstat.Sample) {
+		errs = append(errs, sm.Errors...)
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if good.writes != 3 || bad.writes != 3 || good.flushes != 1 {
+		t.Fatalf("wrong Sink use: %+v %+v", good, bad)
+	}
+	var se *kstat.SinkError
+	if len(errs) != 2 || !errors.As(errs[0], &se) || se.Sink != bad || !errors.Is(errs[1], errSink) {
+		t.Fatalf("wrong Sample errors: %v", errs)
+	}
+	if snap, _ := latest.Snapshot(); snap == nil || snap.Values[0].UintVal != 2 {
+		t.Fatalf("SnapshotVar does not have the last Sample: %+v", snap)
+	}
+}
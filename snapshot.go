@@ -0,0 +1,194 @@
+//
+// Snapshots are complete copies of a set of kstats at a point in time.
+
+package kstat
+
+import (
+	"fmt"
+	"time"
+)
+
+// KStatInfo is a copy of the identifying information of a KStat.
+type KStatInfo struct {
+	Module   string
+	Instance int
+	Name     string
+	Class    string
+	Type     KSType
+	Crtime   int64
+	Snaptime int64
+}
+
+func (ki KStatInfo) String() string {
+	return fmt.Sprintf("%s:%d:%s (%s)", ki.Module, ki.Instance, ki.Name, ki.Class)
+}
+
+// Snapshot is a copy of a set of kstats and their statistics taken at
+// one point in time. It is entirely independent of the Token that it
+// came from, so it remains valid after Token.Close(), can be passed
+// between goroutines, and can be retained indefinitely.
+//
+// KStats lists every kstat in the Snapshot, including ones that have
+// no Values (for example, raw kstats that we don't know how to
+// decode). Both KStats and Values are sorted by module, instance, and
+// name (Values for the same kstat are in the order the kstat has
+// them).
+type Snapshot struct {
+	// Time is the wall clock time that the Snapshot was started.
+	// Use the Snaptime of KStats and Values for precise intervals.
+	Time   time.Time
+	KStats []KStatInfo
+	Values []Value
+}
+
+// SnapshotSource is something that Snapshots can be taken from,
+// with Update to see kstats that have come and gone. A Token is one,
+// and so is a kstatdev.Dev, which reads /dev/kstat without cgo, so
+// code that only needs Snapshots can work with either backend.
+type SnapshotSource interface {
+	Snapshot(sels ...Selector) (*Snapshot, error)
+	Update() (bool, error)
+	Close() error
+}
+
+// KStatErrors is the error returned along with a Snapshot (or the
+// KStats from ReadAll) when some of the selected kstats couldn't be
+// read, with one error for each of them. The Snapshot has everything
+// else; the kstats that couldn't be read are simply missing from it,
+// just as kstat(1) skips kstats that it can't read. Each error wraps
+// the underlying one, and KStatErrors unwraps to all of them, so
+// errors.Is and errors.As work on the KStatErrors as a whole.
+type KStatErrors []error
+
+func (ke KStatErrors) Error() string {
+	switch len(ke) {
+	case 0:
+		return "no kstat errors"
+	case 1:
+		return ke[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more kstat errors)", ke[0], len(ke)-1)
+}
+
+// Unwrap returns the per-kstat errors.
+func (ke KStatErrors) Unwrap() []error {
+	return ke
+}
+
+// Get returns the Value for module:instance:name:stat in a Snapshot.
+func (snap *Snapshot) Get(module string, instance int, name, stat string) (Value, bool) {
+	for _, v := range snap.Values {
+		if v.Module == module && v.Instance == instance && v.Name == name && v.Stat == stat {
+			return v, true
+		}
+	}
+	return Value{}, false
+}
+
+// Skew returns the time between the earliest and latest Snaptimes of
+// the kstats in the Snapshot, which is how far apart in time their
+// statistics may be.
+func (snap *Snapshot) Skew() time.Duration {
+	if len(snap.KStats) == 0 {
+		return 0
+	}
+	lo, hi := snap.KStats[0].Snaptime, snap.KStats[0].Snaptime
+	for _, ki := range snap.KStats[1:] {
+		if ki.Snaptime < lo {
+			lo = ki.Snaptime
+		}
+		if ki.Snaptime > hi {
+			hi = ki.Snaptime
+		}
+	}
+	return time.Duration(hi - lo)
+}
+
+// KStat returns the KStatInfo for module:instance:name in a Snapshot.
+func (snap *Snapshot) KStat(module string, instance int, name string) (KStatInfo, bool) {
+	for _, ki := range snap.KStats {
+		if ki.Module == module && ki.Instance == instance && ki.Name == name {
+			return ki, true
+		}
+	}
+	return KStatInfo{}, false
+}
+
+// Select returns a new Snapshot with only the kstats and Values that
+// match at least one of the selectors. A kstat is included if any
+// selector matches it, even if no selector matches any of its
+// statistics.
+func (snap *Snapshot) Select(sels ...Selector) *Snapshot {
+	ms := compileAll(sels)
+	nsnap := &Snapshot{Time: snap.Time}
+	for _, ki := range snap.KStats {
+		for _, sel := range ms {
+			if sel.MatchKStat(ki.Module, ki.Instance, ki.Name) {
+				nsnap.KStats = append(nsnap.KStats, ki)
+				break
+			}
+		}
+	}
+	for _, v := range snap.Values {
+		for _, sel := range ms {
+			if sel.Match(v) {
+				nsnap.Values = append(nsnap.Values, v)
+				break
+			}
+		}
+	}
+	return nsnap
+}
+
+// kstatGroup is a kstat and its Values.
+type kstatGroup struct {
+	info KStatInfo
+	vals []Value
+}
+
+// groupKey is how we group Values with their kstats. The Crtime and
+// Snaptime are included so that Values always go with the exact
+// KStatInfo they came from.
+type groupKey struct {
+	kstatKey
+	snaptime int64
+}
+
+// groups returns the Snapshot's Values grouped by their kstats, in
+// the order of KStats. Values that don't belong to any of the
+// Snapshot's KStats (which can only happen with Snapshots you've
+// assembled yourself) are put in groups with a KStatInfo made from
+// the Value.
+func (snap *Snapshot) groups() []kstatGroup {
+	grps := make([]kstatGroup, 0, len(snap.KStats))
+	idx := make(map[groupKey]int, len(snap.KStats))
+	for _, ki := range snap.KStats {
+		idx[groupKey{ki.key(), ki.Snaptime}] = len(grps)
+		grps = append(grps, kstatGroup{info: ki})
+	}
+	for _, v := range snap.Values {
+		gk := groupKey{v.key().kstatKey, v.Snaptime}
+		i, ok := idx[gk]
+		if !ok {
+			i = len(grps)
+			idx[gk] = i
+			grps = append(grps, kstatGroup{info: KStatInfo{
+				Module: v.Module, Instance: v.Instance, Name: v.Name,
+				Class: v.Class, Type: NamedStat,
+				Crtime: v.Crtime, Snaptime: v.Snaptime,
+			}})
+		}
+		grps[i].vals = append(grps[i].vals, v)
+	}
+	return grps
+}
+
+// value creates a Value for a statistic of the kstat, with everything
+// but the actual value filled in.
+func (ki KStatInfo) value(stat string, tp NamedType) Value {
+	return Value{
+		Module: ki.Module, Instance: ki.Instance, Name: ki.Name, Class: ki.Class,
+		Stat: stat, Type: tp,
+		Crtime: ki.Crtime, Snaptime: ki.Snaptime,
+	}
+}
@@ -0,0 +1,141 @@
+//go:build cgo
+// +build cgo
+
+//
+// Taking Snapshots of kstats.
+
+package kstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sampled is a KStat and the selectors that matched it, which are
+// used to pick out its statistics.
+type sampled struct {
+	k    *KStat
+	sels []*Matcher
+}
+
+// matching returns all KStats that match at least one of sels, in
+// sorted order. If there are no selectors, everything matches.
+func (t *Token) matching(sels []Selector) []sampled {
+	if len(sels) == 0 {
+		sels = []Selector{{Instance: -1}}
+	}
+	ms := compileAll(sels)
+	var lst []sampled
+	for _, k := range t.AllSorted() {
+		var ksels []*Matcher
+		for _, sel := range ms {
+			if sel.MatchKStat(k.Module, k.Instance, k.Name) {
+				ksels = append(ksels, sel)
+			}
+		}
+		if len(ksels) > 0 {
+			lst = append(lst, sampled{k, ksels})
+		}
+	}
+	return lst
+}
+
+// info returns a copy of the KStat's identifying information.
+func (k *KStat) info() KStatInfo {
+	return KStatInfo{
+		Module: k.Module, Instance: k.Instance, Name: k.Name, Class: k.Class,
+		Type: k.Type, Crtime: k.Crtime, Snaptime: k.Snaptime,
+	}
+}
+
+// add refreshes a KStat and adds it and its selected Values to the
+// Snapshot. Nothing is added if there is an error.
+func (snap *Snapshot) add(sk sampled) error {
+	if err := sk.k.Refresh(); err != nil {
+		return err
+	}
+	return snap.addRead(sk)
+}
+
+// addRead adds an already refreshed KStat and its selected Values to
+// the Snapshot.
+func (snap *Snapshot) addRead(sk sampled) error {
+	vals, err := sk.k.Values()
+	if err != nil {
+		return err
+	}
+	snap.KStats = append(snap.KStats, sk.k.info())
+	for _, v := range vals {
+		for _, sel := range sk.sels {
+			if sel.MatchStat(v.Stat) {
+				snap.Values = append(snap.Values, v)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Snapshot refreshes all KStats that match at least one of the
+// selectors and copies them and their selected statistics into a new
+// Snapshot. With no selectors, it takes a Snapshot of everything.
+// KStats that can't be refreshed are left out of the Snapshot, and
+// Snapshot returns the Snapshot of everything else along with a
+// KStatErrors for them. It only fails outright (returning a nil
+// Snapshot) if the Token is unusable.
+func (t *Token) Snapshot(sels ...Selector) (*Snapshot, error) {
+	return t.SnapshotContext(context.Background(), sels...)
+}
+
+// SnapshotContext is Snapshot with a Context. It gives up (returning
+// the Context's error) if the Context is canceled or times out while
+// it is going through the KStats, which can take a while for large
+// kstat chains.
+func (t *Token) SnapshotContext(ctx context.Context, sels ...Selector) (*Snapshot, error) {
+	if t == nil || t.kc == nil {
+		return nil, errors.New("Token not valid or closed")
+	}
+	snap := &Snapshot{Time: time.Now()}
+	var errs KStatErrors
+	for _, sk := range t.matching(sels) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := snap.add(sk); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sk.k, err))
+		}
+	}
+	if errs != nil {
+		return snap, errs
+	}
+	return snap, nil
+}
+
+// CoherentSnapshot is like Snapshot, except that it reads all of the
+// selected KStats in one tight pass before copying any of them, which
+// minimizes the time skew between the statistics of different KStats
+// (for example, of all of the CPUs). You can see the remaining skew
+// with Snapshot.Skew.
+func (t *Token) CoherentSnapshot(sels ...Selector) (*Snapshot, error) {
+	if t == nil || t.kc == nil {
+		return nil, errors.New("Token not valid or closed")
+	}
+	lst := t.matching(sels)
+	snap := &Snapshot{Time: time.Now()}
+	var rb readBatch
+	var errs KStatErrors
+	for i, err := range rb.read(lst) {
+		if err == nil {
+			err = snap.addRead(lst[i])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", lst[i].k, err))
+		}
+	}
+	if errs != nil {
+		return snap, errs
+	}
+	return snap, nil
+}
@@ -0,0 +1,128 @@
+//
+// Storing Samples in a SQLite database.
+
+package kstat
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SQLiteOptions control how a SQLiteSink stores Samples.
+type SQLiteOptions struct {
+	// Host is the value of the host column, so that databases
+	// from several machines can be merged.
+	Host string
+
+	// Table is the table Samples are stored in. If it's blank,
+	// it's "kstats".
+	Table string
+}
+
+// SQLiteSink stores Samples in a SQL table, one row per numeric
+// statistic, for ad-hoc SQL queries over the history of a machine's
+// kstats. The table is:
+//
+//	CREATE TABLE kstats (host TEXT, module TEXT, instance INTEGER,
+//		name TEXT, stat TEXT, ts INTEGER, value NUMERIC)
+//
+// ts is the Sample's Time in nanoseconds since the Unix epoch, so in
+// SQLite datetime(ts/1e9, 'unixepoch') is the time as a string.
+// value is an integer, except for unsigned statistics too big for an
+// int64, which are stored as floats. CharData and String statistics
+// aren't stored. Derived values are stored with a module of "derived"
+// and their name as the stat.
+//
+// The package doesn't import a SQLite driver; you open the database
+// with whichever one you use (such as github.com/mattn/go-sqlite3 or
+// modernc.org/sqlite) and give it to NewSQLiteSink.
+type SQLiteSink struct {
+	db     *sql.DB
+	host   string
+	insert string
+}
+
+// NewSQLiteSink creates a SQLiteSink that stores Samples in db,
+// creating its table (and an index on module, stat, and ts) if they
+// don't exist. The caller still owns db; closing the SQLiteSink
+// doesn't close it.
+func NewSQLiteSink(db *sql.DB, opts SQLiteOptions) (*SQLiteSink, error) {
+	table := opts.Table
+	if table == "" {
+		table = "kstats"
+	}
+	qt := `"` + strings.ReplaceAll(table, `"`, `""`) + `"`
+	qi := `"` + strings.ReplaceAll(table+"_stat_ts", `"`, `""`) + `"`
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS " + qt + " (host TEXT, module TEXT, instance INTEGER, name TEXT, stat TEXT, ts INTEGER, value NUMERIC)",
+		"CREATE INDEX IF NOT EXISTS " + qi + " ON " + qt + " (module, stat, ts)",
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			return nil, fmt.Errorf("creating %s: %w", table, err)
+		}
+	}
+	return &SQLiteSink{
+		db:     db,
+		host:   opts.Host,
+		insert: "INSERT INTO " + qt + " (host, module, instance, name, stat, ts, value) VALUES (?, ?, ?, ?, ?, ?, ?)",
+	}, nil
+}
+
+// Write stores a Sample, in a single transaction.
+func (ss *SQLiteSink) Write(sm *Sample) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = ss.write(tx, sm)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ss *SQLiteSink) write(tx *sql.Tx, sm *Sample) error {
+	st, err := tx.Prepare(ss.insert)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	ts := sm.Time.UnixNano()
+	for _, v := range sm.Values {
+		var val interface{}
+		switch {
+		case v.Type == Int32 || v.Type == Int64:
+			val = v.IntVal
+		case (v.Type == Uint32 || v.Type == Uint64) && v.UintVal > math.MaxInt64:
+			val = float64(v.UintVal)
+		case v.Type == Uint32 || v.Type == Uint64:
+			val = int64(v.UintVal)
+		default:
+			continue
+		}
+		if _, err := st.Exec(ss.host, v.Module, v.Instance, v.Name, v.Stat, ts, val); err != nil {
+			return err
+		}
+	}
+	for _, d := range sm.Derived {
+		if _, err := st.Exec(ss.host, "derived", 0, "", d.Name, ts, d.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush does nothing, since each Write is committed.
+func (ss *SQLiteSink) Flush() error {
+	return nil
+}
+
+// Close does nothing; the database belongs to the caller.
+func (ss *SQLiteSink) Close() error {
+	return nil
+}
@@ -0,0 +1,103 @@
+//
+// Test SQLiteSinks. Rather than a real SQLite driver, these tests use a
+// fake one that records the statements it's given.
+
+package kstat_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// sqlLog is the log of a fakeConn. Each executed statement is a line
+// with the statement and its arguments; transaction ends are "commit"
+// or "rollback".
+type sqlLog struct {
+	lines []string
+	fail  string
+}
+
+type fakeDriver struct{ log *sqlLog }
+type fakeConn struct{ log *sqlLog }
+type fakeStmt struct {
+	log   *sqlLog
+	query string
+}
+type fakeTx struct{ log *sqlLog }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn(d), nil }
+
+func (c fakeConn) Prepare(q string) (driver.Stmt, error) { return fakeStmt{c.log, q}, nil }
+func (c fakeConn) Close() error                          { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)             { return fakeTx(c), nil }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	line := fmt.Sprint(s.query, args)
+	if s.log.fail != "" && strings.Contains(line, s.log.fail) {
+		return nil, errors.New("disk full")
+	}
+	s.log.lines = append(s.log.lines, line)
+	return driver.RowsAffected(1), nil
+}
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("no queries") }
+
+func (t fakeTx) Commit() error   { t.log.lines = append(t.log.lines, "commit"); return nil }
+func (t fakeTx) Rollback() error { t.log.lines = append(t.log.lines, "rollback"); return nil }
+
+var fakeDrivers int
+
+func openFake(t *testing.T) (*sql.DB, *sqlLog) {
+	log := &sqlLog{}
+	fakeDrivers++
+	name := fmt.Sprintf("kstatfake%d", fakeDrivers)
+	sql.Register(name, fakeDriver{log})
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, log
+}
+
+func TestSQLiteSink(t *testing.T) {
+	db, log := openFake(t)
+	ss, err := kstat.NewSQLiteSink(db, kstat.SQLiteOptions{Host: "h1", Table: "k"})
+	if err != nil {
+		t.Fatalf("NewSQLiteSink failed: %s", err)
+	}
+	sm := &kstat.Sample{Snapshot: *testSnapshot()}
+	sm.Derived = []kstat.Derived{{Name: "util", Value: 1.5}}
+	if err := ss.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	ins := `INSERT INTO "k" (host, module, instance, name, stat, ts, value) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	exp := []string{
+		`CREATE TABLE IF NOT EXISTS "k" (host TEXT, module TEXT, instance INTEGER, name TEXT, stat TEXT, ts INTEGER, value NUMERIC)[]`,
+		`CREATE INDEX IF NOT EXISTS "k_stat_ts" ON "k" (module, stat, ts)[]`,
+		ins + "[h1 cpu 0 sys syscall 1440756000123456789 1.8446744073709552e+19]",
+		ins + "[h1 cpu 0 sys delta 1440756000123456789 -5]",
+		ins + "[h1 derived 0  util 1440756000123456789 1.5]",
+		"commit",
+	}
+	if strings.Join(log.lines, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("wrong statements:\n%s", strings.Join(log.lines, "\n"))
+	}
+
+	// A failed insert rolls back the whole Sample.
+	log.lines, log.fail = nil, "delta"
+	if err := ss.Write(sm); err == nil {
+		t.Fatalf("failed insert did not fail the Write")
+	}
+	if len(log.lines) != 2 || log.lines[1] != "rollback" {
+		t.Fatalf("Write was not rolled back: %q", log.lines)
+	}
+}
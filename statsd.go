@@ -0,0 +1,172 @@
+//
+// Sending Samples to statsd.
+
+package kstat
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StatsdOptions control how a StatsdSink sends statistics.
+type StatsdOptions struct {
+	// Prefix is put in front of every metric name, with a "."
+	// after it if it's not blank.
+	Prefix string
+
+	// Counters pick out the statistics that are sent as statsd
+	// counters. A counter is sent as its increase since the
+	// previous Sample (so nothing is sent for it in the first
+	// Sample, or in the Sample after it's reset). Every other
+	// numeric statistic is sent as a gauge of its current value.
+	Counters []Selector
+
+	// MaxPacket is the most bytes of metrics to send in one write.
+	// Lines are never split between writes. Zero means no limit,
+	// which is fine for TCP; DialStatsd defaults it to 1432 for
+	// UDP, which fits in a typical Ethernet MTU.
+	MaxPacket int
+
+	// Naming maps statistics to metric names. The Prefix is put
+	// in front of them and label values are added to the end as
+	// extra components.
+	Naming *Naming
+}
+
+// StatsdSink sends Samples to a statsd server, one line of the form
+// "name:value|g" or "name:value|c" per statistic. Metric names are
+// module.instance.name.stat, with any characters that are special to
+// statsd turned into underscores. Derived values are sent as gauges
+// under their sanitized names.
+type StatsdSink struct {
+	w    io.Writer
+	opts StatsdOptions
+	last map[string]Value
+	buf  bytes.Buffer
+}
+
+// NewStatsdSink creates a StatsdSink that writes to w, which is
+// normally a network connection. Each write is a batch of complete
+// lines no bigger than opts.MaxPacket (if set).
+func NewStatsdSink(w io.Writer, opts StatsdOptions) *StatsdSink {
+	return &StatsdSink{w: w, opts: opts, last: make(map[string]Value)}
+}
+
+// DialStatsd connects to a statsd server with net.Dial and creates a
+// StatsdSink that writes to it. network is normally "udp" or "tcp".
+func DialStatsd(network, addr string, opts StatsdOptions) (*StatsdSink, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxPacket == 0 && strings.HasPrefix(network, "udp") {
+		opts.MaxPacket = 1432
+	}
+	return NewStatsdSink(conn, opts), nil
+}
+
+// Write sends a Sample's numeric statistics and Derived values.
+func (s *StatsdSink) Write(sm *Sample) error {
+	s.buf.Reset()
+	last := make(map[string]Value)
+	var err error
+	for _, v := range sm.Values {
+		f, ok := v.Float()
+		if !ok {
+			continue
+		}
+		name := dottedName(v.Module, strconv.Itoa(v.Instance), v.Name, v.Stat)
+		if mn, ok := s.opts.Naming.Map(v); ok {
+			name = dottedName(mn.dotted()...)
+		}
+		if !s.counter(v) {
+			err = s.line(name, f, "g")
+		} else {
+			key := v.String()
+			last[key] = v
+			if r, ok := ComputeRate(s.last[key], v); ok {
+				err = s.line(name, r.Delta, "c")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.last = last
+	for _, d := range sm.Derived {
+		if err = s.line(dottedName(d.Name), d.Value, "g"); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+func (s *StatsdSink) counter(v Value) bool {
+	for _, sel := range s.opts.Counters {
+		if sel.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// line adds a metric line to the buffer, first sending the buffer if
+// the line would make it too big.
+func (s *StatsdSink) line(name string, f float64, tp string) error {
+	var l []byte
+	if s.opts.Prefix != "" {
+		l = append(l, s.opts.Prefix...)
+		l = append(l, '.')
+	}
+	l = append(l, name...)
+	l = append(l, ':')
+	l = strconv.AppendFloat(l, f, 'g', -1, 64)
+	l = append(l, '|')
+	l = append(l, tp...)
+	l = append(l, '\n')
+	if s.opts.MaxPacket > 0 && s.buf.Len() > 0 && s.buf.Len()+len(l) > s.opts.MaxPacket {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	s.buf.Write(l)
+	return nil
+}
+
+func (s *StatsdSink) flush() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.buf.Bytes())
+	s.buf.Reset()
+	return err
+}
+
+// Flush does nothing, since Write sends everything immediately.
+func (s *StatsdSink) Flush() error {
+	return nil
+}
+
+// Close closes the StatsdSink's writer, if it's an io.Closer.
+func (s *StatsdSink) Close() error {
+	return closeWriter(s.w)
+}
+
+// dottedName joins parts into a dotted metric name for statsd or
+// Graphite, replacing characters that either of them treat specially
+// (and dots within parts) with underscores.
+func dottedName(parts ...string) string {
+	for i, p := range parts {
+		parts[i] = strings.Map(func(r rune) rune {
+			switch r {
+			case ':', '|', '@', '.', '#', ' ', '\t', '\n', '/':
+				return '_'
+			}
+			return r
+		}, p)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,54 @@
+//
+// Test sending to statsd.
+
+package kstat_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// writes records each Write separately.
+type writes []string
+
+func (w *writes) Write(b []byte) (int, error) {
+	*w = append(*w, string(b))
+	return len(b), nil
+}
+
+func TestStatsdSink(t *testing.T) {
+	sel, _ := kstat.ParseSelector("cpu::sys:syscall")
+	var w writes
+	s := kstat.NewStatsdSink(&w, kstat.StatsdOptions{Prefix: "host1", Counters: []kstat.Selector{sel}})
+
+	nproc := kstat.Value{Module: "unix", Instance: 0, Name: "system_misc", Stat: "nproc", Type: kstat.Int32, IntVal: 42}
+	sm := &kstat.Sample{}
+	sm.Values = []kstat.Value{counter(1e9, 100), nproc}
+	sm.Derived = []kstat.Derived{{Name: "ewma(cpu:0:sys:syscall)", Value: 1.5}}
+	if err := s.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	sm.Values[0] = counter(2e9, 250)
+	if err := s.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	exp := []string{
+		"host1.unix.0.system_misc.nproc:42|g\nhost1.ewma(cpu_0_sys_syscall):1.5|g\n",
+		"host1.cpu.0.sys.syscall:150|c\nhost1.unix.0.system_misc.nproc:42|g\nhost1.ewma(cpu_0_sys_syscall):1.5|g\n",
+	}
+	if strings.Join(w, "|") != strings.Join(exp, "|") {
+		t.Fatalf("wrong writes:\n%q", w)
+	}
+
+	// Lines are batched into writes of at most MaxPacket bytes.
+	w = nil
+	s = kstat.NewStatsdSink(&w, kstat.StatsdOptions{MaxPacket: 40})
+	if err := s.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if len(w) != 3 || w[0] != "cpu.0.sys.syscall:250|g\n" {
+		t.Fatalf("wrong packets: %q", w)
+	}
+}
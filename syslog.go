@@ -0,0 +1,188 @@
+//
+// Sending Alerts to syslog.
+
+package kstat
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog facilities and severities, for SyslogOptions. These are the
+// standard values from RFC 5424.
+const (
+	SyslogDaemon = 3
+	SyslogLocal0 = 16
+
+	SyslogCrit    = 2
+	SyslogErr     = 3
+	SyslogWarning = 4
+	SyslogNotice  = 5
+)
+
+// SyslogOptions control how a SyslogAlerter formats messages.
+type SyslogOptions struct {
+	// Facility and Severity make up the priority of messages.
+	// The defaults are SyslogDaemon and SyslogWarning.
+	Facility int
+	Severity int
+
+	// Hostname and AppName identify the sender. The defaults are
+	// os.Hostname() and "kstat".
+	Hostname string
+	AppName  string
+
+	// SDID is the structured data ID that the details of the
+	// Alert go under. The default is "kstat@32473", which uses the
+	// private enterprise number set aside for documentation; you
+	// may want your own.
+	SDID string
+
+	// Framing sets whether each message is preceded by its length
+	// and a space (octet counting, from RFC 6587), which is what
+	// syslog servers expect over TCP. DialSyslog sets it for TCP.
+	Framing bool
+}
+
+// SyslogAlerter sends Alerts as RFC 5424 syslog messages, with the
+// details of the Alert as structured data so that they can be picked
+// out without parsing the message text:
+//
+//	<28>1 2015-08-28T10:00:00.123456Z h1 kstat 123 threshold [kstat@32473 stat="cpu:0:sys:syscall" selector="cpu:0:sys:syscall" x="20" threshold="15" op="above" rate="true" count="2"] cpu:0:sys:syscall rate 20 above threshold 15 for 2 samples
+//
+// Its Alert method can be used as a Rule's Func. A SyslogAlerter can
+// be used by several Alerters (or goroutines) at once.
+type SyslogAlerter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	opts SyslogOptions
+	pid  string
+	err  error
+}
+
+// NewSyslogAlerter creates a SyslogAlerter that writes messages to w,
+// one per Write.
+func NewSyslogAlerter(w io.Writer, opts SyslogOptions) *SyslogAlerter {
+	if opts.Facility == 0 && opts.Severity == 0 {
+		opts.Facility, opts.Severity = SyslogDaemon, SyslogWarning
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = "kstat"
+	}
+	if opts.SDID == "" {
+		opts.SDID = "kstat@32473"
+	}
+	return &SyslogAlerter{w: w, opts: opts, pid: strconv.Itoa(os.Getpid())}
+}
+
+// DialSyslog connects to a syslog server with net.Dial and creates a
+// SyslogAlerter that writes to it. network is normally "udp" or
+// "tcp"; for TCP, messages are framed.
+func DialSyslog(network, addr string, opts SyslogOptions) (*SyslogAlerter, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(network, "tcp") {
+		opts.Framing = true
+	}
+	return NewSyslogAlerter(conn, opts), nil
+}
+
+// Send sends an Alert.
+func (sa *SyslogAlerter) Send(al Alert) error {
+	msg := sa.format(al, time.Now())
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if sa.opts.Framing {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	_, err := io.WriteString(sa.w, msg)
+	return err
+}
+
+// Alert sends an Alert, remembering the error if it fails (see Err).
+// It's meant to be used as a Rule's Func.
+func (sa *SyslogAlerter) Alert(al Alert) {
+	if err := sa.Send(al); err != nil {
+		sa.mu.Lock()
+		sa.err = err
+		sa.mu.Unlock()
+	}
+}
+
+// Err returns the most recent error from Alert, if any, and clears
+// it.
+func (sa *SyslogAlerter) Err() error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	err := sa.err
+	sa.err = nil
+	return err
+}
+
+// Close closes the SyslogAlerter's writer, if it's an io.Closer.
+func (sa *SyslogAlerter) Close() error {
+	return closeWriter(sa.w)
+}
+
+func (sa *SyslogAlerter) format(al Alert, now time.Time) string {
+	r := al.Rule
+	op := "above"
+	if r.Below {
+		op = "below"
+	}
+	what := ""
+	if r.Rate {
+		what = " rate"
+	}
+	x := strconv.FormatFloat(al.X, 'g', -1, 64)
+	thr := strconv.FormatFloat(r.Threshold, 'g', -1, 64)
+	stat := al.Value.String()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s threshold [%s", sa.opts.Facility*8+sa.opts.Severity,
+		now.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(sa.opts.Hostname), syslogHeader(sa.opts.AppName), sa.pid, sa.opts.SDID)
+	params := []string{
+		"stat", stat,
+		"selector", r.Selector.String(),
+		"x", x,
+		"threshold", thr,
+		"op", op,
+		"rate", strconv.FormatBool(r.Rate),
+		"count", strconv.Itoa(al.Count),
+	}
+	for i := 0; i < len(params); i += 2 {
+		fmt.Fprintf(&b, " %s=\"%s\"", params[i], sdEscape.Replace(params[i+1]))
+	}
+	fmt.Fprintf(&b, "] %s%s %s %s threshold %s for %d samples", stat, what, x, op, thr, al.Count)
+	return b.String()
+}
+
+// sdEscape escapes the characters that are special in structured
+// data parameter values.
+var sdEscape = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogHeader makes s usable as a header field, which must be
+// printable ASCII with no spaces, or "-" if it's empty.
+func syslogHeader(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,49 @@
+//
+// Test formatting syslog messages.
+
+package kstat_test
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestSyslogAlerter(t *testing.T) {
+	var w writes
+	sa := kstat.NewSyslogAlerter(&w, kstat.SyslogOptions{Hostname: "h 1", Facility: kstat.SyslogLocal0, Severity: kstat.SyslogErr, Framing: true})
+	sel, _ := kstat.ParseSelector("cpu::sys:syscall")
+	a := kstat.NewAlerter(kstat.Rule{Selector: sel, Rate: true, Threshold: 15, Func: sa.Alert})
+	for i, v := range []uint64{0, 20} {
+		a.Process(&kstat.Sample{Snapshot: kstat.Snapshot{Values: []kstat.Value{counter(int64(i+1)*1e9, v)}}})
+	}
+	if len(w) != 1 || sa.Err() != nil {
+		t.Fatalf("wrong messages: %q %v", w, sa.Err())
+	}
+
+	n, msg, _ := strings.Cut(w[0], " ")
+	if n != strconv.Itoa(len(msg)) {
+		t.Errorf("wrong framing: %q", w[0])
+	}
+	ts := regexp.MustCompile(`^(<\d+>1) \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z (\S+ \S+) \d+ `)
+	msg = ts.ReplaceAllString(msg, "$1 TIME $2 PID ")
+	exp := `<131>1 TIME h_1 kstat PID threshold [kstat@32473 stat="cpu:0:sys:syscall" selector="cpu:*:sys:syscall" x="20" threshold="15" op="above" rate="true" count="1"] cpu:0:sys:syscall rate 20 above threshold 15 for 1 samples`
+	if msg != exp {
+		t.Errorf("wrong message:\n%s\n%s", msg, exp)
+	}
+}
+
+func TestSyslogEscaping(t *testing.T) {
+	var w writes
+	sa := kstat.NewSyslogAlerter(&w, kstat.SyslogOptions{Hostname: "h1", AppName: "app", SDID: "x@1"})
+	v := kstat.Value{Module: "odd", Name: `a"b]c\d`, Stat: "n", Type: kstat.Int32, IntVal: 1}
+	if err := sa.Send(kstat.Alert{Rule: &kstat.Rule{Below: true, Threshold: 2}, Value: v, X: 1, Count: 3}); err != nil {
+		t.Fatalf("Send failed: %s", err)
+	}
+	if len(w) != 1 || !strings.HasPrefix(w[0], "<28>1 ") || !strings.Contains(w[0], ` [x@1 stat="odd:0:a\"b\]c\\d:n" `) || !strings.HasSuffix(w[0], " 1 below threshold 2 for 3 samples") {
+		t.Fatalf("wrong message: %q", w)
+	}
+}
@@ -0,0 +1,168 @@
+//
+// Writing Samples in the JSON form that Telegraf's exec inputs read.
+
+package kstat
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// TelegrafOptions control how a TelegrafWriter writes Samples.
+type TelegrafOptions struct {
+	// Tags are extra tags, such as a host or role, that are added
+	// to every metric.
+	Tags map[string]string
+
+	// Measurement returns the measurement name for a kstat. If
+	// it's nil, the measurement is the kstat's module.
+	Measurement func(ki KStatInfo) string
+
+	// Naming maps statistics to measurements and tags. Each
+	// statistic that it maps is written as an object of its own,
+	// with the mapped name as the measurement, the labels as
+	// (string) fields that you'll want in tag_keys, and the
+	// statistic as the field "value".
+	Naming *Naming
+}
+
+// Telegraf tag keys and other keys that a TelegrafWriter uses. A
+// statistic with one of these names (or the name of one of the
+// TelegrafOptions.Tags) is left out.
+const (
+	TelegrafMeasurementKey = "measurement"
+	TelegrafTimeKey        = "time"
+	TelegrafInstanceKey    = "kstat_instance"
+	TelegrafNameKey        = "kstat_name"
+	TelegrafClassKey       = "kstat_class"
+)
+
+// TelegrafWriter writes Samples in the JSON form that Telegraf's exec
+// and execd inputs read with data_format = "json". Each Sample is
+// written as one line holding a JSON array with an object for every
+// kstat:
+//
+//	[{"measurement":"cpu","time":1440756000123456789,"kstat_instance":"0","kstat_name":"sys","kstat_class":"misc","syscall":1234,...},...]
+//
+// Only numeric statistics are written, since Telegraf ignores string
+// fields by default. A Sample's Derived values are written as an
+// object with the measurement "kstat_derived". The matching Telegraf
+// input configuration is:
+//
+//	data_format = "json"
+//	json_name_key = "measurement"
+//	json_time_key = "time"
+//	json_time_format = "unix_ns"
+//	tag_keys = ["kstat_instance", "kstat_name", "kstat_class"]
+//
+// plus the names of any extra Tags.
+type TelegrafWriter struct {
+	w        io.Writer
+	opts     TelegrafOptions
+	reserved map[string]bool
+}
+
+// NewTelegrafWriter creates a TelegrafWriter that writes to w, which
+// is normally standard output.
+func NewTelegrafWriter(w io.Writer, opts TelegrafOptions) *TelegrafWriter {
+	reserved := map[string]bool{
+		TelegrafMeasurementKey: true, TelegrafTimeKey: true,
+		TelegrafInstanceKey: true, TelegrafNameKey: true, TelegrafClassKey: true,
+	}
+	for k := range opts.Tags {
+		reserved[k] = true
+	}
+	return &TelegrafWriter{w: w, opts: opts, reserved: reserved}
+}
+
+// Write writes a Sample's Snapshot and Derived values as one line.
+func (tw *TelegrafWriter) Write(sm *Sample) error {
+	objs := tw.objects(&sm.Snapshot)
+	if len(sm.Derived) > 0 {
+		obj := tw.object("kstat_derived", sm.Time.UnixNano())
+		for _, d := range sm.Derived {
+			if !tw.reserved[d.Name] {
+				obj[d.Name] = d.Value
+			}
+		}
+		objs = append(objs, obj)
+	}
+	return tw.write(objs)
+}
+
+// WriteSnapshot writes a Snapshot as one line.
+func (tw *TelegrafWriter) WriteSnapshot(snap *Snapshot) error {
+	return tw.write(tw.objects(snap))
+}
+
+func (tw *TelegrafWriter) write(objs []map[string]interface{}) error {
+	b, err := json.Marshal(objs)
+	if err != nil {
+		return err
+	}
+	_, err = tw.w.Write(append(b, '\n'))
+	return err
+}
+
+// object starts an object with the measurement, time, and extra tags.
+func (tw *TelegrafWriter) object(meas string, ts int64) map[string]interface{} {
+	obj := map[string]interface{}{TelegrafMeasurementKey: meas, TelegrafTimeKey: ts}
+	for k, v := range tw.opts.Tags {
+		obj[k] = v
+	}
+	return obj
+}
+
+func (tw *TelegrafWriter) objects(snap *Snapshot) []map[string]interface{} {
+	objs := []map[string]interface{}{}
+	ts := snap.Time.UnixNano()
+	for _, g := range snap.groups() {
+		meas := g.info.Module
+		if tw.opts.Measurement != nil {
+			meas = tw.opts.Measurement(g.info)
+		}
+		obj := tw.object(meas, ts)
+		n := 0
+		for _, v := range g.vals {
+			switch v.Type {
+			case Int32, Int64, Uint32, Uint64:
+			default:
+				continue
+			}
+			if mn, ok := tw.opts.Naming.Map(v); ok {
+				mobj := tw.object(mn.Name, ts)
+				for _, l := range mn.Labels {
+					if l.Name != TelegrafMeasurementKey && l.Name != TelegrafTimeKey {
+						mobj[l.Name] = l.Value
+					}
+				}
+				mobj["value"] = v.native()
+				objs = append(objs, mobj)
+				continue
+			}
+			if !tw.reserved[v.Stat] {
+				obj[v.Stat] = v.native()
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		obj[TelegrafInstanceKey] = strconv.Itoa(g.info.Instance)
+		obj[TelegrafNameKey] = g.info.Name
+		obj[TelegrafClassKey] = g.info.Class
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// Flush does nothing, since Write writes everything immediately.
+func (tw *TelegrafWriter) Flush() error {
+	return nil
+}
+
+// Close closes the TelegrafWriter's writer, if it's an io.Closer.
+func (tw *TelegrafWriter) Close() error {
+	return closeWriter(tw.w)
+}
@@ -0,0 +1,26 @@
+//
+// Test Telegraf output.
+
+package kstat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+func TestTelegrafWriter(t *testing.T) {
+	var b bytes.Buffer
+	tw := kstat.NewTelegrafWriter(&b, kstat.TelegrafOptions{Tags: map[string]string{"host": "h1"}})
+	sm := &kstat.Sample{Snapshot: *testSnapshot()}
+	sm.Derived = []kstat.Derived{{Name: "ewma(cpu:0:sys:syscall)", Value: 1.5}}
+	if err := tw.Write(sm); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	exp := `[{"delta":-5,"host":"h1","kstat_class":"misc","kstat_instance":"0","kstat_name":"sys","measurement":"cpu","syscall":18446744073709551615,"time":1440756000123456789},` +
+		`{"ewma(cpu:0:sys:syscall)":1.5,"host":"h1","measurement":"kstat_derived","time":1440756000123456789}]` + "\n"
+	if b.String() != exp {
+		t.Fatalf("wrong output:\n%s", b.String())
+	}
+}
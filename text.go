@@ -0,0 +1,109 @@
+//
+// Text output in the formats of 'kstat' and 'kstat -p'.
+
+package kstat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// hrtimeText formats an hrtime (such as a Crtime or Snaptime) as
+// kstat(1) does, in seconds with nanosecond precision.
+func hrtimeText(t int64) string {
+	return fmt.Sprintf("%d.%09d", t/1e9, t%1e9)
+}
+
+// valueText formats the value of a Value as kstat -p does.
+func valueText(v Value) string {
+	switch v.Type {
+	case Int32, Int64:
+		return strconv.FormatInt(v.IntVal, 10)
+	case Uint32, Uint64:
+		return strconv.FormatUint(v.UintVal, 10)
+	}
+	return v.StringVal
+}
+
+// statLine returns a kstat -p line for one statistic, without the
+// newline.
+func statLine(ki KStatInfo, stat, val string) string {
+	return fmt.Sprintf("%s:%d:%s:%s\t%s", ki.Module, ki.Instance, ki.Name, stat, val)
+}
+
+// writeParseable writes a kstat and its Values in kstat -p form.
+// As kstat -p does, it adds the class, crtime, and snaptime
+// pseudo-statistics and sorts the statistics by name.
+func writeParseable(w io.Writer, ki KStatInfo, vals []Value) error {
+	lines := []string{
+		statLine(ki, "class", ki.Class),
+		statLine(ki, "crtime", hrtimeText(ki.Crtime)),
+		statLine(ki, "snaptime", hrtimeText(ki.Snaptime)),
+	}
+	for _, v := range vals {
+		lines = append(lines, statLine(ki, v.Stat, valueText(v)))
+	}
+	sort.Strings(lines)
+	for _, l := range lines {
+		if _, err := io.WriteString(w, l+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteParseable writes a Snapshot to w in the same format as
+// 'kstat -p', so that existing parsers and scripts can read it.
+// Each statistic is a line of "module:instance:name:statistic", a
+// tab, and the value.
+func (snap *Snapshot) WriteParseable(w io.Writer) error {
+	for _, g := range snap.groups() {
+		if err := writeParseable(w, g.info, g.vals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeText writes a kstat and its Values in the default format of
+// kstat(1): a two line header with the module, instance, name, and
+// class, then a line for each statistic (including the crtime and
+// snaptime pseudo-statistics) with its name and value, sorted by
+// name, then a blank line. The field widths are kstat's.
+func writeText(w io.Writer, ki KStatInfo, vals []Value) error {
+	type stat struct{ name, val string }
+	stats := []stat{
+		{"crtime", hrtimeText(ki.Crtime)},
+		{"snaptime", hrtimeText(ki.Snaptime)},
+	}
+	for _, v := range vals {
+		stats = append(stats, stat{v.Stat, valueText(v)})
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].name < stats[j].name })
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "module: %-30.30s  instance: %-6d\n", ki.Module, ki.Instance)
+	fmt.Fprintf(&b, "name:   %-30.30s  class:    %-.30s\n", ki.Name, ki.Class)
+	for _, st := range stats {
+		fmt.Fprintf(&b, "\t%-30s  %s\n", st.name, st.val)
+	}
+	b.WriteByte('\n')
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteText writes a Snapshot to w in the same format as kstat(1)
+// without options, so that Go tools can stand in for kstat in scripts
+// that read its output. Each kstat is a header of its module,
+// instance, name, and class, followed by its statistics.
+func (snap *Snapshot) WriteText(w io.Writer) error {
+	for _, g := range snap.groups() {
+		if err := writeText(w, g.info, g.vals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build cgo
+// +build cgo
+
+//
+// Text output of KStats and Nameds in the formats of 'kstat' and
+// 'kstat -p'.
+
+package kstat
+
+import (
+	"io"
+)
+
+// MarshalText encodes a Named as a line of 'kstat -p' output (without
+// the trailing newline): "module:instance:name:statistic", a tab, and
+// the value.
+func (ks *Named) MarshalText() ([]byte, error) {
+	v := ks.Value()
+	return []byte(statLine(ks.KStat.info(), v.Stat, valueText(v))), nil
+}
+
+// WriteParseable writes all statistics of a KStat to w in the format
+// of 'kstat -p', as Snapshot.WriteParseable does. Like Values, it
+// does not refresh the KStat.
+func (k *KStat) WriteParseable(w io.Writer) error {
+	vals, err := k.Values()
+	if err != nil {
+		return err
+	}
+	return writeParseable(w, k.info(), vals)
+}
+
+// WriteText writes all statistics of a KStat to w in the default
+// format of kstat(1), as Snapshot.WriteText does. Like Values, it
+// does not refresh the KStat.
+func (k *KStat) WriteText(w io.Writer) error {
+	vals, err := k.Values()
+	if err != nil {
+		return err
+	}
+	return writeText(w, k.info(), vals)
+}
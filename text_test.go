@@ -0,0 +1,57 @@
+//
+// Test text output.
+
+package kstat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+func textSnapshot() *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	kstattest.AddValues(snap, kstat.KStatInfo{Module: "cpu", Instance: 0, Name: "sys", Class: "misc", Type: kstat.NamedStat, Crtime: 1500000000, Snaptime: 12345678901},
+		kstat.Value{Stat: "syscall", Type: kstat.Uint64, UintVal: 300},
+		kstattest.String("brand", "i86pc"),
+		kstat.Value{Stat: "temp", Type: kstat.Int32, IntVal: -5})
+	return snap
+}
+
+func TestWriteParseable(t *testing.T) {
+	snap := textSnapshot()
+	var b bytes.Buffer
+	if err := snap.WriteParseable(&b); err != nil {
+		t.Fatalf("WriteParseable failed: %s", err)
+	}
+	want := "cpu:0:sys:brand\ti86pc\n" +
+		"cpu:0:sys:class\tmisc\n" +
+		"cpu:0:sys:crtime\t1.500000000\n" +
+		"cpu:0:sys:snaptime\t12.345678901\n" +
+		"cpu:0:sys:syscall\t300\n" +
+		"cpu:0:sys:temp\t-5\n"
+	if b.String() != want {
+		t.Fatalf("bad WriteParseable output:\n%s\nshould be:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	snap := textSnapshot()
+	var b bytes.Buffer
+	if err := snap.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %s", err)
+	}
+	want := "module: cpu                             instance: 0     \n" +
+		"name:   sys                             class:    misc\n" +
+		"\tbrand                           i86pc\n" +
+		"\tcrtime                          1.500000000\n" +
+		"\tsnaptime                        12.345678901\n" +
+		"\tsyscall                         300\n" +
+		"\ttemp                            -5\n" +
+		"\n"
+	if b.String() != want {
+		t.Fatalf("bad WriteText output:\n%q\nshould be:\n%q", b.String(), want)
+	}
+}
@@ -0,0 +1,91 @@
+//
+// Kstat types that don't depend on cgo, so that things like Values
+// and Samples can be used on any platform.
+//
+// The numeric values of the constants here are the ones from
+// sys/kstat.h. They're part of the kernel ABI, so they can't change,
+// and kstat_solaris.go verifies them against the C definitions.
+
+package kstat
+
+import (
+	"fmt"
+)
+
+// KSType is the type of the data in a KStat.
+type KSType int
+
+// The different types of data that a KStat may contain, ie these
+// are the value of a KStat.Type. We currently only support getting
+// Named and IO statistics.
+const (
+	RawStat   KSType = 0
+	NamedStat KSType = 1
+	IntrStat  KSType = 2
+	IoStat    KSType = 3
+	TimerStat KSType = 4
+)
+
+func (tp KSType) String() string {
+	switch tp {
+	case RawStat:
+		return "raw"
+	case NamedStat:
+		return "named"
+	case IntrStat:
+		return "interrupt"
+	case IoStat:
+		return "io"
+	case TimerStat:
+		return "timer"
+	default:
+		return fmt.Sprintf("kstat_type:%d", tp)
+	}
+}
+
+// NamedType represents the various types of named kstat statistics.
+type NamedType int
+
+// The different types of data that a named kstat statistic can be
+// (ie, these are the potential values of Named.Type).
+const (
+	CharData NamedType = 0
+	Int32    NamedType = 1
+	Uint32   NamedType = 2
+	Int64    NamedType = 3
+	Uint64   NamedType = 4
+	String   NamedType = 9
+
+	// InvalidType isn't a kstat type; it's what LazyNamed.Type
+	// returns once the statistic can no longer be read.
+	InvalidType NamedType = -1
+
+	// CharData is found in StringVal. At the moment we assume that
+	// it is a real string, because this matches how it seems to be
+	// used for short strings in the Solaris kernel. Someday we may
+	// find something that uses it as just a data dump for 16 bytes.
+
+	// Solaris sys/kstat.h also has _FLOAT (5) and _DOUBLE (6) types,
+	// but labels them as obsolete.
+)
+
+func (tp NamedType) String() string {
+	switch tp {
+	case CharData:
+		return "char"
+	case Int32:
+		return "int32"
+	case Uint32:
+		return "uint32"
+	case Int64:
+		return "int64"
+	case Uint64:
+		return "uint64"
+	case String:
+		return "string"
+	case InvalidType:
+		return "invalid"
+	default:
+		return fmt.Sprintf("named_type-%d", tp)
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Values and Samples are copies of kstat statistics that are
+// independent of the Token they came from and of cgo, so they can be
+// kept indefinitely and used on any platform.
+
+package kstat
+
+import (
+	"fmt"
+)
+
+// Value is a single module:instance:name:statistic statistic and its
+// value, copied out of a KStat. Unlike a Named it doesn't refer to
+// its KStat, so it stays valid after Token.Close() and can be freely
+// passed between goroutines.
+//
+// Values are produced for named kstats and also for IO kstats and the
+// supported unix:0:* raw kstats, whose fields are turned into
+// statistics with the same names that kstat(1) uses for them.
+//
+// As with Named, only one of StringVal, IntVal, or UintVal is valid,
+// depending on Type.
+type Value struct {
+	Module   string
+	Instance int
+	Name     string
+	Class    string
+	Stat     string
+
+	Type      NamedType
+	StringVal string
+	IntVal    int64
+	UintVal   uint64
+
+	// Crtime and Snaptime are the Crtime and Snaptime of the
+	// KStat at the time the Value was copied out of it.
+	Crtime   int64
+	Snaptime int64
+}
+
+func (v Value) String() string {
+	return fmt.Sprintf("%s:%d:%s:%s", v.Module, v.Instance, v.Name, v.Stat)
+}
+
+// Float returns the value of a numeric Value as a float64. It returns
+// false for CharData and String Values.
+func (v Value) Float() (float64, bool) {
+	switch v.Type {
+	case Int32, Int64:
+		return float64(v.IntVal), true
+	case Uint32, Uint64:
+		return float64(v.UintVal), true
+	}
+	return 0, false
+}
+
+// native returns the value of a Value as an int64, uint64, or string.
+func (v Value) native() interface{} {
+	switch v.Type {
+	case Int32, Int64:
+		return v.IntVal
+	case Uint32, Uint64:
+		return v.UintVal
+	}
+	return v.StringVal
+}
+
+// Sample is a Snapshot gathered in one collection pass by a Sampler,
+// along with any errors from the pass. A Sample is encoded to JSON
+// as just its Snapshot.
+type Sample struct {
+	Snapshot
+
+	// Errors holds any errors from individual kstats during the
+	// collection pass, which will be missing from the Snapshot,
+	// and any SinkErrors from writing the Sample to Sinks.
+	Errors []error
+
+	// Derived holds values computed from the Sample's statistics
+	// (and perhaps earlier Samples) by Processors, such as
+	// smoothed rates.
+	Derived []Derived
+}
+
+// Derived is a value computed from statistics instead of read
+// directly from a kstat. Processors that derive values from a single
+// statistic name them in the form function(module:instance:name:stat),
+// for example "ewma_rate(cpu:0:sys:syscall)".
+type Derived struct {
+	Name  string
+	Value float64
+}
+
+// Get returns the value of a Derived value in the Sample by name.
+func (sm *Sample) Get(name string) (float64, bool) {
+	for _, d := range sm.Derived {
+		if d.Name == name {
+			return d.Value, true
+		}
+	}
+	return 0, false
+}
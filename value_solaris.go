@@ -0,0 +1,73 @@
+//go:build cgo
+// +build cgo
+
+//
+// Copying KStat statistics out as Values.
+
+package kstat
+
+import (
+	"unsafe"
+)
+
+// Values returns all statistics of a KStat as Values. For named
+// kstats this is the same statistics as AllNamed(); IO kstats and the
+// unix:0:sysinfo, unix:0:vminfo, and unix:0:var raw kstats have their
+// fields turned into statistics with the names that kstat(1) uses.
+// Other sorts of kstats have no Values.
+//
+// Like GetNamed and Raw, Values does not refresh the KStat's data
+// (although it will load it for the first time if necessary).
+func (k *KStat) Values() ([]Value, error) {
+	if err := k.prep(); err != nil {
+		return nil, err
+	}
+
+	switch k.Type {
+	case NamedStat:
+		lst, err := k.AllNamed()
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]Value, len(lst))
+		for i, n := range lst {
+			vals[i] = n.Value()
+		}
+		ReleaseAll(lst)
+		return vals, nil
+	case IoStat:
+		io := *((*IO)(k.ksp.ks_data))
+		return k.ioValues(&io), nil
+	case RawStat:
+		return k.rawValues()
+	}
+	return nil, nil
+}
+
+// ToMap returns all statistics of a KStat as a map from their names
+// to their values as plain Go values, which are int64 for signed
+// statistics, uint64 for unsigned ones, and string for String and
+// CharData statistics. It covers the same statistics as Values and,
+// like Values, does not refresh the KStat.
+func (k *KStat) ToMap() (map[string]interface{}, error) {
+	vals, err := k.Values()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(vals))
+	for _, v := range vals {
+		m[v.Stat] = v.native()
+	}
+	return m, nil
+}
+
+// ioValues returns the fields of an IO as Values.
+func (k *KStat) ioValues(io *IO) []Value {
+	return k.info().IOValues(io)
+}
+
+// rawValues returns Values for the raw kstats that we know how to
+// decode. Unknown raw kstats have no Values.
+func (k *KStat) rawValues() ([]Value, error) {
+	return k.info().RawValues(unsafe.Slice((*byte)(k.ksp.ks_data), int(k.ksp.ks_data_size)))
+}
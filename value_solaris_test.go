@@ -0,0 +1,127 @@
+//go:build cgo
+// +build cgo
+
+//
+// Test getting Values from KStats.
+
+package kstat_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/siebenmann/go-kstat"
+)
+
+// Values of a named KStat should be the same as its AllNamed.
+func TestNamedValues(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "cpu", "sys")
+	lst, err := ks.AllNamed()
+	if err != nil {
+		t.Fatalf("%s AllNamed failed: %s", ks, err)
+	}
+	vals, err := ks.Values()
+	if err != nil {
+		t.Fatalf("%s Values failed: %s", ks, err)
+	}
+	if len(vals) != len(lst) {
+		t.Fatalf("%s has %d Values but %d Nameds", ks, len(vals), len(lst))
+	}
+	for i, v := range vals {
+		n := lst[i]
+		if v.String() != n.String() || v.Type != n.Type || v.UintVal != n.UintVal || v.IntVal != n.IntVal || v.StringVal != n.StringVal {
+			t.Fatalf("Value %#v does not match Named %#v", v, n)
+		}
+		if v.Class != ks.Class || v.Snaptime != ks.Snaptime || v.Crtime != ks.Crtime {
+			t.Fatalf("Value %#v does not match KStat %#v", v, ks)
+		}
+	}
+	stop(t, tok)
+
+	_, err = ks.Values()
+	if err == nil {
+		t.Fatalf("%s Values succeeded after Close", ks)
+	}
+}
+
+// IO and unix:0:* raw kstats have their fields turned into Values.
+func TestStructValues(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "sd", "sd0")
+	io, err := ks.GetIO()
+	if err != nil {
+		t.Fatalf("%s GetIO failed: %s", ks, err)
+	}
+	vals, err := ks.Values()
+	if err != nil {
+		t.Fatalf("%s Values failed: %s", ks, err)
+	}
+	if len(vals) != 12 || vals[0].Stat != "nread" || vals[0].UintVal != io.Nread {
+		t.Fatalf("%s bad IO Values: %+v", ks, vals)
+	}
+
+	ks, si, err := tok.Sysinfo()
+	if err != nil {
+		t.Fatalf("Sysinfo failed: %s", err)
+	}
+	vals, err = ks.Values()
+	if err != nil {
+		t.Fatalf("%s Values failed: %s", ks, err)
+	}
+	if len(vals) != 6 || vals[0].Stat != "updates" || vals[0].UintVal != uint64(si.Updates) {
+		t.Fatalf("%s bad Sysinfo Values: %+v", ks, vals)
+	}
+
+	for _, name := range []string{"vminfo", "var"} {
+		ks = lookup(t, tok, "unix", name)
+		vals, err = ks.Values()
+		if err != nil || len(vals) == 0 {
+			t.Fatalf("%s Values failed: %v %s", ks, vals, err)
+		}
+	}
+	stop(t, tok)
+}
+
+func TestToMap(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "unix", "system_misc")
+	m, err := ks.ToMap()
+	if err != nil {
+		t.Fatalf("%s ToMap failed: %s", ks, err)
+	}
+	n := kgetnamed(t, ks, "clk_intr")
+	if v, ok := m["clk_intr"].(uint64); !ok || v != n.UintVal {
+		t.Fatalf("bad clk_intr in ToMap: %#v (should be %d)", m["clk_intr"], n.UintVal)
+	}
+	lst, _ := ks.AllNamed()
+	if len(m) != len(lst) {
+		t.Fatalf("ToMap has %d entries, AllNamed has %d", len(m), len(lst))
+	}
+	stop(t, tok)
+}
+
+func TestParseable(t *testing.T) {
+	tok := start(t)
+	ks := lookup(t, tok, "unix", "system_misc")
+	n := kgetnamed(t, ks, "ncpus")
+	b, err := n.MarshalText()
+	want := fmt.Sprintf("unix:0:system_misc:ncpus\t%d", n.UintVal)
+	if n.Type == kstat.Int32 || n.Type == kstat.Int64 {
+		want = fmt.Sprintf("unix:0:system_misc:ncpus\t%d", n.IntVal)
+	}
+	if err != nil || string(b) != want {
+		t.Fatalf("bad MarshalText: %q %v (should be %q)", b, err, want)
+	}
+
+	var out bytes.Buffer
+	if err = ks.WriteParseable(&out); err != nil {
+		t.Fatalf("%s WriteParseable failed: %s", ks, err)
+	}
+	if !strings.Contains(out.String(), "unix:0:system_misc:class\tmisc\n") {
+		t.Fatalf("bad WriteParseable output:\n%s", out.String())
+	}
+	stop(t, tok)
+}
@@ -0,0 +1,116 @@
+//
+// vmstat-style metrics computed from kstats.
+
+package kstat
+
+import (
+	"time"
+)
+
+// VMMetrics are the vmstat(1M) metrics for the whole system over the
+// interval between two Snapshots. Rates are per second, sizes are in
+// kilobytes, and the usr, sys, and idle times are percentages.
+type VMMetrics struct {
+	Elapsed time.Duration
+
+	// kthr: from unix:0:sysinfo.
+	RunQueue float64 // r
+	Blocked  float64 // b
+	Swapped  float64 // w
+
+	// memory: from unix:0:vminfo.
+	SwapKB float64 // swap
+	FreeKB float64 // free
+
+	// page: from cpu:N:vm, summed over all CPUs.
+	Reclaims    float64 // re
+	MinorFaults float64 // mf
+	PageInKB    float64 // pi
+	PageOutKB   float64 // po
+	FreedKB     float64 // fr
+	ScanRate    float64 // sr
+	SwapInKB    float64 // si (vmstat -S)
+	SwapOutKB   float64 // so (vmstat -S)
+
+	// faults and cpu: from cpu:N:sys, summed over all CPUs.
+	Interrupts  float64 // in
+	Syscalls    float64 // sy
+	CtxSwitches float64 // cs
+	PctUser     float64 // us
+	PctSystem   float64 // sy
+	PctIdle     float64 // id
+}
+
+// ComputeVMMetrics computes VMMetrics from two Snapshots that include
+// unix:0:sysinfo, unix:0:vminfo, and the cpu:N:sys and cpu:N:vm
+// kstats. Since kstats report memory in pages, it needs the page size
+// of the system the Snapshots came from (for live data, that's
+// os.Getpagesize()). Metrics whose kstats are missing are zero. It
+// fails if there are no cpu:N:sys kstats in both Snapshots.
+//
+// As in vmstat, the kthr and memory metrics are averages of the
+// once a second samples that the kernel accumulates in sysinfo and
+// vminfo, so they change at most once a second.
+func ComputeVMMetrics(prev, cur *Snapshot, pageSize int) (VMMetrics, bool) {
+	var vm VMMetrics
+	kb := float64(pageSize) / 1024
+
+	old := make(map[kstatKey]kstatGroup)
+	for _, g := range prev.groups() {
+		old[g.info.key()] = g
+	}
+	cpus := 0
+	for _, g := range cur.groups() {
+		pg, ok := old[g.info.key()]
+		if !ok {
+			continue
+		}
+		switch {
+		case g.info.Module == "unix" && g.info.Instance == 0 && g.info.Name == "sysinfo":
+			d := statDeltas(pg, g)
+			if upd := d["updates"]; upd > 0 {
+				vm.RunQueue = d["runque"] / upd
+				vm.Blocked = d["waiting"] / upd
+				vm.Swapped = d["swpque"] / upd
+			}
+		case g.info.Module == "unix" && g.info.Instance == 0 && g.info.Name == "vminfo":
+			d := statDeltas(pg, g)
+			if upd := d["updates"]; upd > 0 {
+				vm.SwapKB = d["swap_avail"] / upd * kb
+				vm.FreeKB = d["freemem"] / upd * kb
+			}
+		case g.info.Module == "cpu" && g.info.Name == "vm" && g.info.Snaptime > pg.info.Snaptime:
+			r := statRates(pg, g)
+			vm.Reclaims += r["pgrec"]
+			vm.MinorFaults += r["hat_fault"] + r["as_fault"]
+			vm.PageInKB += r["pgpgin"] * kb
+			vm.PageOutKB += r["pgpgout"] * kb
+			vm.FreedKB += r["dfree"] * kb
+			vm.ScanRate += r["scan"]
+			vm.SwapInKB += r["pgswapin"] * kb
+			vm.SwapOutKB += r["pgswapout"] * kb
+		case g.info.Module == "cpu" && g.info.Name == "sys" && g.info.Snaptime > pg.info.Snaptime:
+			if cpus == 0 {
+				vm.Elapsed = time.Duration(g.info.Snaptime - pg.info.Snaptime)
+			}
+			cpus++
+			r := statRates(pg, g)
+			vm.Interrupts += r["intr"]
+			vm.Syscalls += r["syscall"]
+			vm.CtxSwitches += r["pswitch"]
+			vm.PctUser += r["cpu_nsec_user"]
+			vm.PctSystem += r["cpu_nsec_kernel"]
+			vm.PctIdle += r["cpu_nsec_idle"]
+		}
+	}
+	if cpus == 0 {
+		return VMMetrics{}, false
+	}
+	// The percentages are still the total nanosecond rates.
+	if total := vm.PctUser + vm.PctSystem + vm.PctIdle; total > 0 {
+		vm.PctUser = vm.PctUser * 100 / total
+		vm.PctSystem = vm.PctSystem * 100 / total
+		vm.PctIdle = vm.PctIdle * 100 / total
+	}
+	return vm, true
+}
@@ -0,0 +1,60 @@
+//
+// Test VM metrics.
+
+package kstat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/siebenmann/go-kstat"
+	"github.com/siebenmann/go-kstat/kstattest"
+)
+
+// addStats adds a kstat and its Uint64 statistics to a Snapshot.
+func addStats(snap *kstat.Snapshot, module string, instance int, name string, snaptime int64, stats map[string]uint64) {
+	kstattest.Add(snap, kstat.KStatInfo{Module: module, Instance: instance, Name: name, Class: "misc", Type: kstat.NamedStat, Crtime: 1, Snaptime: snaptime}, stats)
+}
+
+func vmSnapshot(snaptime int64, scale uint64) *kstat.Snapshot {
+	snap := &kstat.Snapshot{}
+	addStats(snap, "cpu", 0, "sys", snaptime, map[string]uint64{"syscall": 100 * scale, "cpu_nsec_user": 10 * scale, "cpu_nsec_idle": 30 * scale})
+	addStats(snap, "cpu", 0, "vm", snaptime, map[string]uint64{"scan": 50 * scale, "pgpgin": 2 * scale})
+	addStats(snap, "cpu", 1, "sys", snaptime, map[string]uint64{"syscall": 300 * scale, "cpu_nsec_user": 30 * scale, "cpu_nsec_idle": 10 * scale})
+	addStats(snap, "cpu", 1, "vm", snaptime, map[string]uint64{"scan": 50 * scale, "pgpgin": 2 * scale})
+	addStats(snap, "unix", 0, "sysinfo", snaptime, map[string]uint64{"updates": 2 * scale, "runque": 6 * scale})
+	addStats(snap, "unix", 0, "vminfo", snaptime, map[string]uint64{"updates": 2 * scale, "freemem": 2000 * scale})
+	return snap
+}
+
+func TestComputeVMMetrics(t *testing.T) {
+	sec := int64(time.Second)
+	vm, ok := kstat.ComputeVMMetrics(vmSnapshot(sec, 1), vmSnapshot(3*sec, 2), 4096)
+	if !ok {
+		t.Fatalf("ComputeVMMetrics failed")
+	}
+	want := []struct {
+		name     string
+		got, exp float64
+	}{
+		{"r", vm.RunQueue, 3},
+		{"free", vm.FreeKB, 4000},
+		{"pi", vm.PageInKB, 8},
+		{"sr", vm.ScanRate, 50},
+		{"sy", vm.Syscalls, 200},
+		{"us", vm.PctUser, 50},
+		{"id", vm.PctIdle, 50},
+	}
+	for _, w := range want {
+		if math.Abs(w.got-w.exp) > 1e-9 {
+			t.Fatalf("bad %s: %f (should be %f)", w.name, w.got, w.exp)
+		}
+	}
+	if vm.Elapsed != 2*time.Second {
+		t.Fatalf("bad Elapsed: %s", vm.Elapsed)
+	}
+	if _, ok = kstat.ComputeVMMetrics(&kstat.Snapshot{}, vmSnapshot(sec, 1), 4096); ok {
+		t.Fatalf("ComputeVMMetrics succeeded without CPU kstats")
+	}
+}